@@ -2,41 +2,49 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/mark3labs/mcp-go/client"
 	"github.com/mark3labs/mcp-go/mcp"
-)
 
-/*
-{
-  "mcpServers": {
-    "mcp-curl-with-docker" :{
-      "command": "docker",
-      "args": [
-        "run",
-        "--rm",
-        "-i",
-        "mcp-curl"
-      ]
-    }
-  }
-}
+	"github.com/k33g/ollama-tlms-golang/06-mcp-host-genaiapp/mcphost"
+)
 
-*/
+// The MCP servers are declared in a JSON file (see mcp.json)
+// using the standard "mcpServers" format.
 
 func main() {
 
-	mcpClient, err := client.NewStdioMCPClient(
-		"docker",
-		[]string{}, // Empty ENV
-		"run",
-		"--rm",
-		"-i",
-		"mcp-curl",
-	)
+	var mcpConfigPath string
+	if mcpConfigPath = os.Getenv("MCP_CONFIG"); mcpConfigPath == "" {
+		mcpConfigPath = "mcp.json"
+	}
+
+	config, err := mcphost.ParseConfig(mcpConfigPath)
+	if err != nil {
+		log.Fatalf("😡 Failed to load the MCP config: %v", err)
+	}
+
+	serverName, serverConfig, err := selectServer(config, os.Getenv("MCP_SERVER"))
+	if err != nil {
+		log.Fatalf("😡 Failed to select the MCP server: %v", err)
+	}
+	fmt.Println("🐳 Starting MCP server:", serverName)
+
+	command, args, err := serverConfig.CommandLine()
+	if err != nil {
+		log.Fatalf("😡 Failed to read the command of the MCP server: %v", err)
+	}
+	env, err := serverConfig.Environment()
+	if err != nil {
+		log.Fatalf("😡 Failed to read the env of the MCP server: %v", err)
+	}
+	mcpClient, err := client.NewStdioMCPClient(command, env, args...)
 	if err != nil {
 		log.Fatalf("😡 Failed to create client: %v", err)
 	}
@@ -79,7 +87,6 @@ func main() {
 	}
 	fmt.Println()
 
-
 	// Fetch
 	fmt.Println("📣 calling use_curl")
 	fetchRequest := mcp.CallToolRequest{
@@ -92,16 +99,49 @@ func main() {
 		"url": "https://raw.githubusercontent.com/docker-sa/01-build-image/refs/heads/main/main.go",
 	}
 
-
 	result, err := mcpClient.CallTool(ctx, fetchRequest)
 	if err != nil {
 		log.Fatalf("😡 Failed to call the tool: %v", err)
 	}
 	// display the text content of result
+	// (the images and the other contents are described in the text)
+	content := mcphost.NormalizeToolResult(result)
+	if result.IsError {
+		log.Fatalf("😡 The tool returned an error: %s", content.Text)
+	}
+	if content.Text == "" {
+		log.Fatalln("😡 The tool returned no content")
+	}
 	fmt.Println("🌍 content of the page:")
-	fmt.Println(result.Content[0].(map[string]interface{})["text"])
-
-
+	fmt.Println(content.Text)
 
+}
 
+// selectServer returns the config of the server called name.
+// If name is empty, the config file must declare only one server.
+// This client only starts the stdio servers.
+func selectServer(config mcphost.Config, name string) (string, mcphost.MCPServerConfig, error) {
+	if len(config.MCPServers) == 0 {
+		return "", mcphost.MCPServerConfig{}, errors.New("no mcpServers declared in the config")
+	}
+	if name == "" {
+		if len(config.MCPServers) != 1 {
+			return "", mcphost.MCPServerConfig{}, fmt.Errorf(
+				"several servers declared (%s), choose one with MCP_SERVER",
+				strings.Join(config.ServerNames(), ", "),
+			)
+		}
+		name = config.ServerNames()[0]
+	}
+	server, ok := config.MCPServers[name]
+	if !ok {
+		return "", mcphost.MCPServerConfig{}, fmt.Errorf("server %s not found in config", name)
+	}
+	if server.Transport != "" && server.Transport != "stdio" {
+		return "", mcphost.MCPServerConfig{}, fmt.Errorf("server %s: the %s transport is not supported", name, server.Transport)
+	}
+	if server.Command == "" {
+		return "", mcphost.MCPServerConfig{}, fmt.Errorf("server %s: missing command", name)
+	}
+	return name, server, nil
 }
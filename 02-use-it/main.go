@@ -12,6 +12,8 @@ import (
 	"github.com/mark3labs/mcp-go/client"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/ollama/ollama/api"
+
+	"github.com/k33g/ollama-tlms-golang/06-mcp-host-genaiapp/mcphost"
 )
 
 /*
@@ -149,15 +151,23 @@ func main() {
 				},
 			}
 			fetchRequest.Params.Name = toolCall.Function.Name
-			fetchRequest.Params.Arguments = toolCall.Function.Arguments
+			fetchRequest.Params.Arguments = toolCall.Function.Arguments.ToMap()
 
 			result, err := mcpClient.CallTool(ctx, fetchRequest)
 			if err != nil {
 				log.Fatalf("😡 Failed to call the tool: %v", err)
 			}
 			// display the text content of result
+			// (the images and the other contents are described in the text)
+			content := mcphost.NormalizeToolResult(result)
+			if result.IsError {
+				log.Println("😡 The tool returned an error:", content.Text)
+			}
+			if content.Text == "" {
+				log.Println("😡 The tool returned no content")
+			}
 			fmt.Println("🌍 content of the result:")
-			contentForThePrompt += result.Content[0].(map[string]interface{})["text"].(string)
+			contentForThePrompt += content.Text
 			fmt.Println(contentForThePrompt)
 		}
 
@@ -211,15 +221,7 @@ func ConvertToOllamaTools(tools []mcp.Tool) []api.Tool {
 			Function: api.ToolFunction{
 				Name:        tool.Name,
 				Description: tool.Description,
-				Parameters: struct {
-					Type       string   `json:"type"`
-					Required   []string `json:"required"`
-					Properties map[string]struct {
-						Type        string   `json:"type"`
-						Description string   `json:"description"`
-						Enum        []string `json:"enum,omitempty"`
-					} `json:"properties"`
-				}{
+				Parameters: api.ToolFunctionParameters{
 					Type:       tool.InputSchema.Type,
 					Required:   tool.InputSchema.Required,
 					Properties: convertProperties(tool.InputSchema.Properties),
@@ -231,38 +233,22 @@ func ConvertToOllamaTools(tools []mcp.Tool) []api.Tool {
 }
 
 // Helper function to convert properties to Ollama's format
-func convertProperties(props map[string]interface{}) map[string]struct {
-	Type        string   `json:"type"`
-	Description string   `json:"description"`
-	Enum        []string `json:"enum,omitempty"`
-} {
-	result := make(map[string]struct {
-		Type        string   `json:"type"`
-		Description string   `json:"description"`
-		Enum        []string `json:"enum,omitempty"`
-	})
+func convertProperties(props map[string]interface{}) *api.ToolPropertiesMap {
+	result := api.NewToolPropertiesMap()
 
 	for name, prop := range props {
 		if propMap, ok := prop.(map[string]interface{}); ok {
-			prop := struct {
-				Type        string   `json:"type"`
-				Description string   `json:"description"`
-				Enum        []string `json:"enum,omitempty"`
-			}{
-				Type:        getString(propMap, "type"),
+			prop := api.ToolProperty{
+				Type:        api.PropertyType{getString(propMap, "type")},
 				Description: getString(propMap, "description"),
 			}
 
 			// Handle enum if present
 			if enumRaw, ok := propMap["enum"].([]interface{}); ok {
-				for _, e := range enumRaw {
-					if str, ok := e.(string); ok {
-						prop.Enum = append(prop.Enum, str)
-					}
-				}
+				prop.Enum = enumRaw
 			}
 
-			result[name] = prop
+			result.Set(name, prop)
 		}
 	}
 
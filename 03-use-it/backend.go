@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/k33g/ollama-tlms-golang/06-mcp-host-genaiapp/mcphost"
+
+	"github.com/ollama/ollama/api"
+)
+
+// llmBackend is the client of the backend answering the chat requests
+type llmBackend struct {
+	Type   string
+	Client *api.Client
+	// Pool is the pool of the Ollama endpoints (nil for the other backends)
+	Pool *mcphost.OllamaPool
+}
+
+// newLLMBackend creates the client of the backend of the config:
+// LLM_BACKEND (ollama, openai or mock) overrides the type of the config,
+// OPENAI_BASE_URL and OPENAI_API_KEY its url and key, MOCK_FIXTURES its fixtures
+func newLLMBackend(config mcphost.BackendConfig, ollamaRawUrl string, roundRobin bool) (*llmBackend, error) {
+	if backend := os.Getenv("LLM_BACKEND"); backend != "" {
+		config.Type = backend
+	}
+	if url := os.Getenv("OPENAI_BASE_URL"); url != "" {
+		config.URL = url
+	}
+	if key := os.Getenv("OPENAI_API_KEY"); key != "" {
+		config.APIKey, config.APIKeyEnv = key, ""
+	}
+	if fixtures := os.Getenv("MOCK_FIXTURES"); fixtures != "" {
+		config.Fixtures = fixtures
+	}
+
+	backend := &llmBackend{Type: config.Type}
+	switch config.Type {
+	case "", "ollama":
+		pool, err := mcphost.NewOllamaPool(mcphost.ParseOllamaHosts(ollamaRawUrl), roundRobin)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OLLAMA_HOST: %w", err)
+		}
+		backend.Type, backend.Client, backend.Pool = "ollama", pool.Client(), pool
+	case "openai":
+		openai, err := mcphost.NewOpenAIBackend(config.URL, config.Key())
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("using the OpenAI-compatible backend", "url", config.URL)
+		backend.Client = openai.Client()
+	case "mock":
+		mock, err := mcphost.NewMockOllama(config.Fixtures)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the mock fixtures: %w", err)
+		}
+		slog.Info("using the mock LLM backend", "fixtures", config.Fixtures)
+		backend.Client = mock.Client()
+	default:
+		return nil, fmt.Errorf("unknown backend %s (ollama, openai or mock)", config.Type)
+	}
+	return backend, nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/k33g/ollama-tlms-golang/06-mcp-host-genaiapp/mcphost"
+)
+
+// batchPrompt is a line of the input of the batch mode: a JSON object,
+// or a plain text prompt
+type batchPrompt struct {
+	ID       string                 `json:"id,omitempty"`
+	Prompt   string                 `json:"prompt"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// batchResult is a line of the output of the batch mode
+type batchResult struct {
+	batchPrompt
+	Model      string `json:"model"`
+	ToolsModel string `json:"tools_model"`
+	Answer     string `json:"answer"`
+	// Tools are the tool calls and their results, in their order
+	Tools      []mcphost.Event `json:"tools"`
+	Error      string          `json:"error,omitempty"`
+	DurationMs int64           `json:"duration_ms"`
+}
+
+// RunBatch asks the prompts of a file (or stdin), one per line, each one in a
+// new session, and writes a JSON result per prompt (for datasets and regression runs):
+//
+//	03-use-it batch -input prompts.jsonl -output results.jsonl
+//
+// A line is a JSON object ({"id": "...", "prompt": "...", "metadata": {...}}) or a plain
+// text prompt, the empty lines are skipped. The id is the line number by default.
+// Nobody can answer the approval questions: the tools that need an approval are denied.
+func RunBatch(ctx context.Context, host *mcphost.Host, args []string) error {
+	flags := flag.NewFlagSet("batch", flag.ExitOnError)
+	inputPath := flags.String("input", "-", "file of the prompts (- for stdin)")
+	outputPath := flags.String("output", "-", "file of the results (- for stdout)")
+	timeout := flags.Duration("timeout", 0, "timeout of a prompt (0 means no timeout)")
+	flags.Parse(args)
+
+	input := os.Stdin
+	if *inputPath != "-" {
+		file, err := os.Open(*inputPath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		input = file
+	}
+	var output io.Writer = os.Stdout
+	if *outputPath != "-" {
+		file, err := os.Create(*outputPath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		output = file
+	}
+
+	encoder := json.NewEncoder(output)
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	lineNumber, prompts, failed := 0, 0, 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		prompt, err := parseBatchPrompt(line, lineNumber)
+		if err != nil {
+			return err
+		}
+
+		result := runBatchPrompt(ctx, host, prompt, *timeout)
+		if ctx.Err() != nil {
+			// the interrupted prompt is not written
+			return ctx.Err()
+		}
+		prompts++
+		if result.Error != "" {
+			failed++
+		}
+		if err := encoder.Encode(result); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	slog.Info("batch done", "prompts", prompts, "failed", failed)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d prompts failed", failed, prompts)
+	}
+	return nil
+}
+
+// parseBatchPrompt reads a line of the input
+func parseBatchPrompt(line string, lineNumber int) (batchPrompt, error) {
+	prompt := batchPrompt{Prompt: line}
+	if strings.HasPrefix(line, "{") {
+		prompt = batchPrompt{}
+		if err := json.Unmarshal([]byte(line), &prompt); err != nil {
+			return prompt, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		if strings.TrimSpace(prompt.Prompt) == "" {
+			return prompt, fmt.Errorf("line %d: the prompt is missing", lineNumber)
+		}
+	}
+	if prompt.ID == "" {
+		prompt.ID = strconv.Itoa(lineNumber)
+	}
+	return prompt, nil
+}
+
+// runBatchPrompt asks a prompt in a new session, the errors are reported in the result
+func runBatchPrompt(ctx context.Context, host *mcphost.Host, prompt batchPrompt, timeout time.Duration) batchResult {
+	session := host.NewSession()
+	result := batchResult{
+		batchPrompt: prompt,
+		Model:       session.ChatModel,
+		ToolsModel:  session.Agent.Model,
+		Tools:       []mcphost.Event{},
+	}
+	session.Agent.OnEvent = func(event mcphost.Event) {
+		if event.Type == mcphost.EventToolCall || event.Type == mcphost.EventToolResult {
+			result.Tools = append(result.Tools, event)
+		}
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	slog.Info("batch prompt", "id", prompt.ID)
+	start := time.Now()
+	answer, err := session.Ask(ctx, prompt.Prompt, func(string) {})
+	result.DurationMs = time.Since(start).Milliseconds()
+	result.Answer = strings.TrimSpace(answer)
+	if err != nil {
+		slog.Warn("batch prompt failed", "id", prompt.ID, "error", err)
+		result.Error = err.Error()
+	}
+	return result
+}
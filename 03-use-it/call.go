@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/k33g/ollama-tlms-golang/06-mcp-host-genaiapp/mcphost"
+)
+
+// RunCall calls a tool of a server without any model, like the client of
+// 01-mcp-client, and prints its result (the JSON texts are indented):
+//
+//	03-use-it call fetch fetch --args '{"url": "https://example.com"}'
+//
+// The tools denied by the config can not be called.
+func RunCall(ctx context.Context, w io.Writer, host *mcphost.Host, args []string) error {
+	flags := flag.NewFlagSet("call", flag.ExitOnError)
+	arguments := flags.String("args", "{}", "arguments of the tool (a JSON object)")
+	raw := flags.Bool("raw", false, "print the whole MCP result as JSON")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: call <server> <tool> [--args JSON] [--raw]")
+		flags.PrintDefaults()
+	}
+	if len(args) < 2 || strings.HasPrefix(args[0], "-") || strings.HasPrefix(args[1], "-") {
+		flags.Usage()
+		return errors.New("the server and the tool are required")
+	}
+	serverName, toolName := args[0], args[1]
+	flags.Parse(args[2:])
+
+	var parsed map[string]interface{}
+	if err := json.Unmarshal([]byte(*arguments), &parsed); err != nil {
+		return fmt.Errorf("invalid --args, a JSON object is expected: %w", err)
+	}
+	if parsed == nil {
+		parsed = map[string]interface{}{}
+	}
+
+	name := serverName + mcphost.ToolNameSeparator + toolName
+	if _, _, ok := host.Registry.Lookup(name); !ok {
+		if err, failed := host.Registry.Failed()[serverName]; failed {
+			return fmt.Errorf("the server %s is unavailable: %w", serverName, err)
+		}
+		return fmt.Errorf("unknown tool %s (see the tools subcommand)", name)
+	}
+	for _, server := range host.Registry.Servers() {
+		if server.Name == serverName && server.Config.ApprovalPolicy(toolName) == mcphost.ApprovalDeny {
+			return fmt.Errorf("the tool %s is denied by the config", name)
+		}
+	}
+	parsed = host.Registry.CoerceArguments(name, parsed)
+	if err := host.Registry.ValidateArguments(name, parsed); err != nil {
+		return err
+	}
+
+	progressShown := false
+	ctx = mcphost.WithProgress(ctx, func(progress mcphost.Progress) {
+		event := mcphost.Event{Tool: name, Progress: progress.Progress, Total: progress.Total, Content: progress.Message}
+		progressShown = showProgress(name, event)
+	})
+	result, err := host.Registry.CallTool(ctx, name, parsed)
+	if progressShown {
+		fmt.Fprintln(os.Stderr)
+	}
+	if err != nil {
+		return err
+	}
+
+	if *raw {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(result); err != nil {
+			return err
+		}
+	} else {
+		content := mcphost.NormalizeToolResult(result)
+		fmt.Fprintln(w, indentJSON(content.Text))
+		if len(content.Images) > 0 {
+			fmt.Fprintf(w, "(%d images)\n", len(content.Images))
+		}
+	}
+	if result.IsError {
+		return fmt.Errorf("the tool %s returned an error", name)
+	}
+	return nil
+}
+
+// indentJSON indents a JSON text, the other texts are kept
+func indentJSON(text string) string {
+	var indented bytes.Buffer
+	if json.Indent(&indented, []byte(text), "", "  ") != nil {
+		return text
+	}
+	return indented.String()
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/k33g/ollama-tlms-golang/06-mcp-host-genaiapp/mcphost"
+)
+
+// RunDaemon runs the tasks of the schedules of the config until the end of
+// the process (Ctrl-C or SIGTERM), or runs a task once with -now:
+//
+//	03-use-it daemon
+//	03-use-it daemon -now digest
+//
+// Nobody can answer the approval questions: the tools that need an approval are denied.
+func RunDaemon(ctx context.Context, host *mcphost.Host, schedules []mcphost.ScheduleConfig, args []string) error {
+	flags := flag.NewFlagSet("daemon", flag.ExitOnError)
+	now := flags.String("now", "", "run the task of this schedule once, then exit")
+	flags.Parse(args)
+
+	scheduler := mcphost.NewScheduler(host, schedules)
+	if *now == "" {
+		return scheduler.Run(ctx)
+	}
+	for _, schedule := range schedules {
+		if schedule.Name == *now {
+			if result := scheduler.RunNow(ctx, schedule); result.Error != "" {
+				return errors.New(result.Error)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown schedule %s", *now)
+}
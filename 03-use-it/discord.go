@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/k33g/ollama-tlms-golang/06-mcp-host-genaiapp/mcphost"
+)
+
+// RunDiscord connects the host to the Discord bot of the config until the end
+// of the process (Ctrl-C or SIGTERM): the mentions of the bot, the direct
+// messages and the /ask command are answered, each channel is a chat session
+// (/reset starts a new one).
+//
+//	DISCORD_BOT_TOKEN=... 03-use-it discord
+//
+// The tool calls that need an approval are asked to the user of the prompt
+// with the buttons of a message.
+func RunDiscord(ctx context.Context, host *mcphost.Host, config *mcphost.DiscordConfig, args []string) error {
+	flags := flag.NewFlagSet("discord", flag.ExitOnError)
+	turnTimeout := flags.Duration("timeout", 0, "timeout of a turn (0 means no timeout)")
+	maxSessions := flags.Int("max-sessions", mcphost.DefaultMaxSessions, "maximum number of sessions (channels) kept in memory")
+	sessionIdle := flags.Duration("session-idle", mcphost.DefaultSessionIdleTimeout, "time after which an idle channel starts a new session")
+	flags.Parse(args)
+
+	if config == nil {
+		return fmt.Errorf("no discord setting in the config")
+	}
+	bot := mcphost.NewDiscordBot(host, *config, *turnTimeout)
+	bot.Sessions = mcphost.NewSessionPool(host, *maxSessions, *sessionIdle)
+	return bot.Run(ctx)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/k33g/ollama-tlms-golang/06-mcp-host-genaiapp/mcphost"
+)
+
+// The types of the events of the JSONL output, the other events
+// of the agent (e.g. tool_progress) keep their type
+const (
+	jsonlToolCall    = "tool_call_requested"
+	jsonlFinalAnswer = "final_answer"
+)
+
+// jsonlEvent is a line of the JSONL output
+type jsonlEvent struct {
+	mcphost.Event
+	Session string    `json:"session,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// JSONLWriter writes the events of a turn as JSON lines (-output jsonl),
+// for the programs wrapping the host:
+//
+//	{"type":"tool_call_requested","tool":"fetch.fetch","arguments":{...},...}
+//	{"type":"tool_result","tool":"fetch.fetch","content":"...",...}
+//	{"type":"token","content":"..."}
+//	{"type":"final_answer","content":"..."}
+//	{"type":"error","error":"..."}
+type JSONLWriter struct {
+	session string
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewJSONLWriter writes the events of a session on w
+func NewJSONLWriter(w io.Writer, session *mcphost.ChatSession) *JSONLWriter {
+	writer := &JSONLWriter{session: session.ID, encoder: json.NewEncoder(w)}
+	session.Agent.OnEvent = func(event mcphost.Event) {
+		if event.Type == mcphost.EventToolCall {
+			event.Type = jsonlToolCall
+		}
+		writer.Write(event)
+	}
+	return writer
+}
+
+// Write writes an event on a line
+func (w *JSONLWriter) Write(event mcphost.Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.encoder.Encode(jsonlEvent{Event: event, Session: w.session, Time: time.Now()})
+}
+
+// WriteToken writes a token of the answer
+func (w *JSONLWriter) WriteToken(token string) {
+	w.Write(mcphost.Event{Type: mcphost.EventToken, Content: token})
+}
+
+// Done writes the answer, or the error of the turn
+func (w *JSONLWriter) Done(answer string, err error) {
+	if err != nil {
+		w.Write(mcphost.Event{Type: mcphost.EventError, Error: err.Error()})
+		return
+	}
+	w.Write(mcphost.Event{Type: jsonlFinalAnswer, Content: answer})
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// newLogger creates the logger of the app. The logs are written to output
+// (stderr, or the TUI), stdout only gets the answers (and the REPL).
+// quiet only keeps the errors.
+func newLogger(output io.Writer, level string, format string, quiet bool) (*slog.Logger, error) {
+	var logLevel slog.Level
+	if err := logLevel.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %s (debug, info, warn or error)", level)
+	}
+	if quiet {
+		logLevel = slog.LevelError
+	}
+
+	options := &slog.HandlerOptions{Level: logLevel}
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(output, options)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(output, options)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %s (text or json)", format)
+	}
+}
+
+// plainOutput writes the messages of the REPL and of the one-shot mode
+// without emoji nor terminal escapes (-plain), the errors start with "error:"
+var plainOutput bool
+
+// quietOutput hides the progress of the tools (-quiet), stderr only gets the errors
+var quietOutput bool
+
+// icon returns the emoji starting a message (with its space),
+// nothing in the plain output
+func icon(emoji string) string {
+	if plainOutput {
+		return ""
+	}
+	return emoji + " "
+}
+
+// printError displays an error to the user
+func printError(err error) {
+	if plainOutput {
+		fmt.Println("error:", err)
+		return
+	}
+	fmt.Println("😡", err)
+}
+
+// fatal logs the error and exits
+func fatal(message string, err error) {
+	slog.Error(message, "error", err)
+	os.Exit(1)
+}
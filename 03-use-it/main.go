@@ -1,293 +1,440 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
-	"net/http"
-	"net/url"
+	"log/slog"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
-	"github.com/mark3labs/mcp-go/client"
-	"github.com/mark3labs/mcp-go/mcp"
-	"github.com/ollama/ollama/api"
+	"github.com/k33g/ollama-tlms-golang/06-mcp-host-genaiapp/mcphost"
 )
 
-/*
-{
-  "mcpServers": {
-    "mcp-curl-with-docker" :{
-      "command": "docker",
-      "args": [
-        "run",
-        "--rm",
-        "-i",
-        "mcp-curl"
-      ]
-    }
-  }
-}
-
-*/
+// The MCP servers are declared in a JSON file (see mcp.json)
+// using the standard "mcpServers" format.
 
 func main() {
 
-	ctx := context.Background()
+	repl := flag.Bool("repl", false, "start an interactive chat session")
+	tuiMode := flag.Bool("tui", false, "start an interactive chat session in a terminal UI")
+	markdown := flag.Bool("markdown", false, "render the markdown of the answers in the terminal (REPL and one-shot mode)")
+	systemFile := flag.String("system-file", "", "file with the system instructions of the chat model")
+	toolsSystemFile := flag.String("tools-system-file", "", "file with the system instructions of the tools model")
+	promptFile := flag.String("prompt-file", "", "file with the user prompt (- for stdin)")
+	sessionsDir := flag.String("sessions-dir", ".sessions", "directory of the saved sessions")
+	resume := flag.String("resume", "", "id of a saved session to continue")
+	jsonAnswer := flag.Bool("json", false, "ask for a JSON answer")
+	formatSchemaFile := flag.String("format-schema", "", "file with the JSON schema of the answer (implies -json)")
+	logLevel := flag.String("log-level", "info", "level of the logs: debug, info, warn or error")
+	logFormat := flag.String("log-format", "text", "format of the logs: text or json")
+	quiet := flag.Bool("quiet", false, "only log the errors, without the progress of the tools")
+	plain := flag.Bool("plain", false, "write the messages without emoji nor terminal escapes (REPL and one-shot mode)")
+	seed := flag.Int("seed", 0, "seed of the models for reproducible runs, recorded in the saved session (0 for a random seed)")
+	record := flag.String("record", "", "cassette file where the MCP interactions are recorded")
+	replay := flag.String("replay", "", "cassette file replaying the recorded MCP interactions (the servers are not started)")
+	debugMCP := flag.Bool("debug-mcp", false, "log the JSON-RPC messages exchanged with the MCP servers")
+	transcript := flag.String("transcript", "", "file where the transcript of the session is written at the end (.md or .html)")
+	output := flag.String("output", "text", "output of the one-shot mode: text, or jsonl for a JSON event per line")
+	flag.Parse()
+
+	logger, err := newLogger(os.Stderr, *logLevel, *logFormat, *quiet)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	slog.SetDefault(logger)
+	plainOutput, quietOutput = *plain, *quiet
+	// the plain output is not rendered
+	renderMarkdown := *markdown && !*plain
+
+	var format json.RawMessage
+	switch {
+	case *formatSchemaFile != "":
+		schema, err := os.ReadFile(*formatSchemaFile)
+		if err != nil {
+			fatal("failed to read the JSON schema", err)
+		}
+		if !json.Valid(schema) {
+			fatal("invalid JSON schema", fmt.Errorf("%s is not JSON", *formatSchemaFile))
+		}
+		format = schema
+	case *jsonAnswer:
+		format = json.RawMessage(`"json"`)
+	}
+
+	if *output != "text" && *output != "jsonl" {
+		fmt.Fprintf(os.Stderr, "invalid -output %s (text or jsonl)\n", *output)
+		os.Exit(2)
+	}
+
+	// In the one-shot JSON and JSONL modes, stdout only gets the answer or the events
+	// (the approval questions go to stderr with the logs) so that it can be piped,
+	// in the mcp-server mode, stdout only gets the MCP messages
+	answerOutput := os.Stdout
+	command, isSubcommand := subcommands[flag.Arg(0)]
+	oneShot := !*repl && !*tuiMode && !isSubcommand
+	oneShotJSON := format != nil && oneShot
+	oneShotJSONL := *output == "jsonl" && oneShot
+	if oneShotJSON || oneShotJSONL || flag.Arg(0) == "mcp-server" {
+		os.Stdout = os.Stderr
+	}
 
+	// OLLAMA_HOST can list several endpoints (comma separated): the requests
+	// fail over to the next one, OLLAMA_ROUND_ROBIN=true spreads the completions
 	var ollamaRawUrl string
 	if ollamaRawUrl = os.Getenv("OLLAMA_HOST"); ollamaRawUrl == "" {
 		ollamaRawUrl = "http://localhost:11434"
 	}
+	roundRobin, _ := strconv.ParseBool(os.Getenv("OLLAMA_ROUND_ROBIN"))
 
 	var chatLLM string
 	if chatLLM = os.Getenv("CHAT_LLM"); chatLLM == "" {
-		chatLLM = "qwen2.5-coder:3b"
+		chatLLM = mcphost.DefaultChatModel
 	}
 
 	var toolsLLM string
 	if toolsLLM = os.Getenv("TOOLS_LLM"); toolsLLM == "" {
 		//toolsLLM = "allenporter/xlam:1b"
-		toolsLLM = "qwen2.5:0.5b"
+		toolsLLM = mcphost.DefaultToolsModel
 	}
 
-	url, _ := url.Parse(ollamaRawUrl)
-
-	ollamaClient := api.NewClient(url, http.DefaultClient)
+	var mcpConfigPath string
+	if mcpConfigPath = os.Getenv("MCP_CONFIG"); mcpConfigPath == "" {
+		mcpConfigPath = "mcp.json"
+	}
 
-	mcpClient, err := client.NewStdioMCPClient(
-		"docker",
-		[]string{}, // Empty ENV
-		"run",
-		"--rm",
-		"-i",
-		"mcp-curl",
-	)
+	config, err := mcphost.LoadConfig(mcpConfigPath)
 	if err != nil {
-		log.Fatalf("😡 Failed to create client: %v", err)
+		fatal("failed to load the MCP config", err)
 	}
-	defer mcpClient.Close()
 
-	// Create context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	if *debugMCP {
+		config.DebugMCP = true
+	}
+	if *record != "" || *replay != "" {
+		if *record != "" && *replay != "" {
+			fatal("invalid flags", errors.New("-record and -replay can not be used together"))
+		}
+		config.Record, config.Replay = *record, *replay
+	}
+
+	// The backend of the config (Ollama by default): LLM_BACKEND=openai sends
+	// the requests to an OpenAI-compatible endpoint (OPENAI_BASE_URL),
+	// LLM_BACKEND=mock answers with the canned tool calls and completions
+	// of the MOCK_FIXTURES file (no Ollama needed)
+	backend, err := newLLMBackend(config.Backend, ollamaRawUrl, roundRobin)
+	if err != nil {
+		fatal("invalid LLM backend", err)
+	}
 
-	// Initialize the client
-	fmt.Println("🚀 Initializing mcp client...")
-	initRequest := mcp.InitializeRequest{}
-	initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
-	initRequest.Params.ClientInfo = mcp.Implementation{
-		Name:    "mcp-curl client 🌍",
-		Version: "1.0.0",
+	// SINGLE_MODEL=true|false overrides the singleModel setting of the config
+	singleModel := config.SingleModel
+	if value, err := strconv.ParseBool(os.Getenv("SINGLE_MODEL")); err == nil {
+		singleModel = value
 	}
 
-	initResult, err := mcpClient.Initialize(ctx, initRequest)
+	// TOOL_CALL_MODE=native|prompt|auto: the prompt mode describes the tools
+	// in the system prompt for the models without (reliable) tool support
+	toolCallMode, err := mcphost.ParseToolCallMode(os.Getenv("TOOL_CALL_MODE"))
 	if err != nil {
-		log.Fatalf("Failed to initialize: %v", err)
+		fatal("invalid TOOL_CALL_MODE", err)
 	}
-	fmt.Printf(
-		"🎉 Initialized with server: %s %s\n\n",
-		initResult.ServerInfo.Name,
-		initResult.ServerInfo.Version,
-	)
 
-	// List Tools
-	fmt.Println("🛠️ Available tools...")
-	toolsRequest := mcp.ListToolsRequest{}
-	tools, err := mcpClient.ListTools(ctx, toolsRequest)
+	// THINKING=hide|show|log: the reasoning of the thinking models (<think> blocks)
+	// is removed from the answers, displayed dimmed or logged
+	thinking, err := mcphost.ParseThinkingMode(os.Getenv("THINKING"))
 	if err != nil {
-		log.Fatalf("😡 Failed to list tools: %v", err)
+		fatal("invalid THINKING", err)
 	}
 
-	for _, tool := range tools.Tools {
-		fmt.Printf("- %s: %s\n", tool.Name, tool.Description)
-		fmt.Println("Arguments:", tool.InputSchema.Properties)
+	// PLAN=off|execute|approve: the tools model writes the plan of its tool calls,
+	// then the steps are executed in order (approve asks for the whole plan
+	// instead of each tool call)
+	plan, err := mcphost.ParsePlanMode(os.Getenv("PLAN"))
+	if err != nil {
+		fatal("invalid PLAN", err)
 	}
-	fmt.Println()
 
-	// Define tool with Ollama format
+	defaultChatInstructions := mcphost.DefaultSystemChatInstructions
+	if singleModel {
+		defaultChatInstructions = mcphost.DefaultSingleModelInstructions
+	}
+	systemChatInstructions, err := ReadTextFile(*systemFile, defaultChatInstructions)
+	if err != nil {
+		fatal("failed to read the system instructions", err)
+	}
+	systemToolsInstructions, err := ReadTextFile(*toolsSystemFile, mcphost.DefaultSystemToolsInstructions)
+	if err != nil {
+		fatal("failed to read the tools system instructions", err)
+	}
 
-	// From: https://github.com/mark3labs/mcphost/blob/main/pkg/llm/ollama/provider.go
-	// Convert tools to Ollama format
-	ollamaTools := ConvertToOllamaTools(tools.Tools)
+	// OTEL_EXPORTER_OTLP_ENDPOINT (or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT) enables
+	// the tracing of the turns, the chat completions and the tool calls
+	baseCtx := context.Background()
+	var tracer *mcphost.Tracer
+	if endpoint := otlpTracesEndpoint(); endpoint != "" {
+		serviceName := os.Getenv("OTEL_SERVICE_NAME")
+		if serviceName == "" {
+			serviceName = "mcp-host"
+		}
+		if tracer, err = mcphost.NewTracer(endpoint, serviceName); err != nil {
+			fatal("failed to enable the tracing", err)
+		}
+		baseCtx = mcphost.WithTracer(baseCtx, tracer)
+		slog.Info("tracing enabled", "endpoint", endpoint)
+	}
 
-	// Display the Ollama format
-	fmt.Println("🦙 Ollama tools:")
-	fmt.Println(ollamaTools)
-
-	// Have a "tool chat" with Ollama 🦙
-	// Prompt construction
-
-	systemMCPInstructions := `You are a useful AI agent. 
-	Your job is to understand the user prompt ans decide if you need to use a tool to run external commands.
-	Ignore all things not related to the usage of a tool.
-	`
-	userInstructions := `Fetch this page: https://raw.githubusercontent.com/docker-sa/01-build-image/refs/heads/main/main.go 
-	and then analyse the source code.
-	`
-
-	messages := []api.Message{
-		{Role: "system", Content: systemMCPInstructions},
-		{Role: "user", Content: userInstructions},
-	}
-
-	var FALSE = false
-	req := &api.ChatRequest{
-		Model:    toolsLLM,
-		Messages: messages,
-		Options: map[string]interface{}{
-			"temperature":   0.0,
-			"repeat_last_n": 2,
-		},
-		Tools:  ollamaTools,
-		Stream: &FALSE,
-	}
-
-	contentForThePrompt := ""
-
-	err = ollamaClient.Chat(ctx, req, func(resp api.ChatResponse) error {
-
-		// Ollma found tool(s) to call
-		for _, toolCall := range resp.Message.ToolCalls {
-
-			fmt.Println("🦙🛠️", toolCall.Function.Name, toolCall.Function.Arguments)
-			// 🖐️ Call the mcp server
-			fmt.Println("📣 calling", toolCall.Function.Name)
-			fetchRequest := mcp.CallToolRequest{
-				Request: mcp.Request{
-					Method: "tools/call",
-				},
-			}
-			fetchRequest.Params.Name = toolCall.Function.Name
-			fetchRequest.Params.Arguments = toolCall.Function.Arguments
+	// Ctrl-C and SIGTERM cancel the root context: the running requests
+	// are cancelled, then the MCP servers are closed before exiting.
+	// A second Ctrl-C kills the process immediately.
+	rootCtx, stop := signal.NotifyContext(baseCtx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-rootCtx.Done()
+		stop()
+	}()
+
+	if backend.Pool != nil && backend.Pool.CheckHealth(rootCtx) == 0 {
+		slog.Warn("no Ollama endpoint is available", "endpoints", ollamaRawUrl)
+	}
 
-			result, err := mcpClient.CallTool(ctx, fetchRequest)
-			if err != nil {
-				log.Fatalf("😡 Failed to call the tool: %v", err)
-			}
-			// display the text content of result
-			fmt.Println("🌍 content of the result:")
-			contentForThePrompt += result.Content[0].(map[string]interface{})["text"].(string)
-			fmt.Println(contentForThePrompt)
+	// The login subcommand runs without starting the servers
+	if isSubcommand && command.step == withoutServers {
+		if err := command.run(rootCtx, nil, config, answerOutput, flag.Args()[1:]); err != nil {
+			fatal("failed to run "+flag.Arg(0), err)
 		}
+		return
+	}
 
-		return nil
-	})
-
+	// Start and initialize all the MCP servers
+	// (the timeouts of the requests are set in the config)
+	slog.Info("initializing the MCP clients", "config", mcpConfigPath)
+	host, err := mcphost.NewHost(rootCtx, backend.Client, config)
 	if err != nil {
-		log.Fatalln("😡", err)
+		fatal("failed to start the MCP servers", err)
 	}
 
-	fmt.Println("⏳ Generating the completion...")
-
-	// Have a "chat" with Ollama 🦙
-	// Prompt construction
-	systemChatInstructions := `You are a useful AI agent. your job is to answer the user prompt.
-	If you detect that the user prompt is related to a tool, ignore this part and focus on the other parts.
-	`
-
-	messages = []api.Message{
-		{Role: "system", Content: systemChatInstructions},
-		{Role: "user", Content: userInstructions},
-		{Role: "user", Content: contentForThePrompt},
+	for _, server := range host.Registry.Servers() {
+		slog.Info("MCP server initialized",
+			"name", server.Name,
+			"server", server.Info.Name,
+			"version", server.Info.Version,
+		)
+	}
+	for name, err := range host.Registry.Failed() {
+		slog.Warn("MCP server unavailable, its tools are not used", "name", name, "error", err)
 	}
 
-	var TRUE = true
-	reqChat := &api.ChatRequest{
-		Model:    chatLLM,
-		Messages: messages,
-		Options: map[string]interface{}{
-			"temperature":   0.0,
-			"repeat_last_n": 2,
-		},
-		Stream: &TRUE,
+	// List Tools
+	for _, tool := range host.Registry.Tools() {
+		slog.Info("available tool", "tool", tool.Name, "description", tool.Description)
+		slog.Debug("tool arguments", "tool", tool.Name, "arguments", tool.InputSchema.Properties)
 	}
 
-	answer := ""
-	errChat := ollamaClient.Chat(ctx, reqChat, func(resp api.ChatResponse) error {
-		answer += resp.Message.Content
-		fmt.Print(resp.Message.Content)
-		return nil
-	})
+	// Display the Ollama format
+	slog.Debug("Ollama tools", "tools", host.OllamaTools())
+
+	// The tools and call subcommands do not use any model
+	if isSubcommand && command.step == withoutModels {
+		err := command.run(rootCtx, host, config, answerOutput, flag.Args()[1:])
+		host.Close()
+		if err != nil {
+			fatal("failed to run "+flag.Arg(0), err)
+		}
+		return
+	}
 
-	if errChat != nil {
-		log.Fatalln("😡", err)
+	host.ToolsModel = toolsLLM
+	host.ChatModel = chatLLM
+	host.SingleModel = singleModel
+	host.Format = format
+	host.SystemToolsInstructions = systemToolsInstructions
+	host.SystemChatInstructions = systemChatInstructions
+	// MAX_TOOL_ITERATIONS overrides the maxIterations limit of the config
+	if maxIterations, err := strconv.Atoi(os.Getenv("MAX_TOOL_ITERATIONS")); err == nil && maxIterations > 0 {
+		host.MaxIterations = maxIterations
+	}
+	host.ToolCallMode = toolCallMode
+	host.Thinking = thinking
+	host.Plan = plan
+	if *seed != 0 {
+		host.Seed = seed
+	}
+	// MODEL_OPTIONS (a JSON object, e.g. {"temperature":0.7,"seed":42})
+	// overrides the options of the config for all the models
+	if value := os.Getenv("MODEL_OPTIONS"); value != "" {
+		var options map[string]interface{}
+		if err := json.Unmarshal([]byte(value), &options); err != nil {
+			host.Close()
+			fatal("invalid MODEL_OPTIONS", err)
+		}
+		if err := mcphost.ValidateOptions(options); err != nil {
+			host.Close()
+			fatal("invalid MODEL_OPTIONS", err)
+		}
+		host.OptionOverrides = mcphost.MergeOptions(host.OptionOverrides, options)
+	}
+	// NUM_CTX sets the context window of the models: the conversations
+	// are trimmed to fit in it
+	if numCtx, err := strconv.Atoi(os.Getenv("NUM_CTX")); err == nil && numCtx > 0 {
+		host.OptionOverrides["num_ctx"] = numCtx
 	}
 
-}
+	// PULL_MODELS=true downloads the missing models (the mock has all the models,
+	// the OpenAI-compatible endpoints serve their own models)
+	pullModels, _ := strconv.ParseBool(os.Getenv("PULL_MODELS"))
+	if backend.Type == "ollama" {
+		if err := host.EnsureModels(rootCtx, pullModels); err != nil {
+			host.Close()
+			fatal("missing model (PULL_MODELS=true pulls the missing models)", err)
+		}
+	}
+	if err := host.CheckToolSupport(rootCtx); err != nil {
+		slog.Warn("failed to check the tool support", "error", err)
+	}
 
-// From: https://github.com/mark3labs/mcphost/blob/main/pkg/llm/ollama/provider.go
-func ConvertToOllamaTools(tools []mcp.Tool) []api.Tool {
-	// Convert tools to Ollama format
-	ollamaTools := make([]api.Tool, len(tools))
-	for i, tool := range tools {
-		ollamaTools[i] = api.Tool{
-			Type: "function",
-			Function: api.ToolFunction{
-				Name:        tool.Name,
-				Description: tool.Description,
-				Parameters: struct {
-					Type       string   `json:"type"`
-					Required   []string `json:"required"`
-					Properties map[string]struct {
-						Type        string   `json:"type"`
-						Description string   `json:"description"`
-						Enum        []string `json:"enum,omitempty"`
-					} `json:"properties"`
-				}{
-					Type:       tool.InputSchema.Type,
-					Required:   tool.InputSchema.Required,
-					Properties: convertProperties(tool.InputSchema.Properties),
-				},
-			},
+	// The sessions of the REPL and of the one-shot mode are saved after each answer
+	host.Store, err = mcphost.NewSessionStore(*sessionsDir)
+	if err != nil {
+		host.Close()
+		fatal("failed to open the sessions directory", err)
+	}
+	// openedSession is the session of the REPL, of the TUI or of the one-shot mode (for -transcript)
+	var openedSession *mcphost.ChatSession
+	openSession := func() (*mcphost.ChatSession, error) {
+		if *resume == "" {
+			openedSession = host.NewSession()
+			slog.Info("new session", "session", openedSession.ID, "seed", seedValue(openedSession.Seed))
+			return openedSession, nil
+		}
+		session, err := host.ResumeSession(*resume)
+		if err != nil {
+			return nil, err
 		}
+		openedSession = session
+		slog.Info("session resumed", "session", session.ID, "messages", len(session.History), "seed", seedValue(session.Seed))
+		return session, nil
 	}
-	return ollamaTools
-}
 
-// Helper function to convert properties to Ollama's format
-func convertProperties(props map[string]interface{}) map[string]struct {
-	Type        string   `json:"type"`
-	Description string   `json:"description"`
-	Enum        []string `json:"enum,omitempty"`
-} {
-	result := make(map[string]struct {
-		Type        string   `json:"type"`
-		Description string   `json:"description"`
-		Enum        []string `json:"enum,omitempty"`
-	})
-
-	for name, prop := range props {
-		if propMap, ok := prop.(map[string]interface{}); ok {
-			prop := struct {
-				Type        string   `json:"type"`
-				Description string   `json:"description"`
-				Enum        []string `json:"enum,omitempty"`
-			}{
-				Type:        getString(propMap, "type"),
-				Description: getString(propMap, "description"),
+	switch {
+	case isSubcommand:
+		// Nobody can answer the approval questions of the subcommands:
+		// the tools that need an approval are denied, the sessions are not saved
+		host.Approver = mcphost.NewApprover(nil, os.Stderr)
+		host.Store = nil
+		err = command.run(rootCtx, host, config, answerOutput, flag.Args()[1:])
+
+	case *repl:
+		// The REPL and the tool approvals share the same input
+		input := bufio.NewScanner(os.Stdin)
+		host.Approver = mcphost.NewApprover(input, os.Stdout)
+		host.Approver.Plain = plainOutput
+		var session *mcphost.ChatSession
+		if session, err = openSession(); err != nil {
+			break
+		}
+		showEvents(session)
+		err = RunREPL(rootCtx, session, input, NewMarkdownWriter(os.Stdout, renderMarkdown))
+
+	case *tuiMode:
+		// The logs and the approval questions are displayed in the TUI
+		ui := NewTUI()
+		host.Approver = mcphost.NewRemoteApprover(ui.Approve)
+		uiLogger, _ := newLogger(ui, *logLevel, *logFormat, *quiet)
+		slog.SetDefault(uiLogger)
+		var session *mcphost.ChatSession
+		if session, err = openSession(); err != nil {
+			break
+		}
+		err = ui.Run(rootCtx, session)
+		slog.SetDefault(logger)
+
+	default:
+		var userInstructions string
+		userInstructions, err = ReadUserPrompt(*promptFile, flag.Args(), defaultUserPrompt)
+		if err != nil {
+			break
+		}
+		host.Approver = mcphost.NewApprover(bufio.NewScanner(os.Stdin), os.Stdout)
+		host.Approver.Plain = plainOutput
+		var session *mcphost.ChatSession
+		if session, err = openSession(); err != nil {
+			break
+		}
+		if oneShotJSONL {
+			events := NewJSONLWriter(answerOutput, session)
+			var answer string
+			answer, err = session.Ask(rootCtx, userInstructions, events.WriteToken)
+			events.Done(strings.TrimSpace(answer), err)
+			break
+		}
+		showEvents(session)
+		if oneShotJSON {
+			var answer string
+			// the answer is only printed once validated
+			answer, err = session.Ask(rootCtx, userInstructions, func(string) {})
+			if err == nil {
+				fmt.Fprintln(answerOutput, strings.TrimSpace(answer))
 			}
+			break
+		}
+		answers := NewMarkdownWriter(os.Stdout, renderMarkdown)
+		_, err = session.Ask(rootCtx, userInstructions, answers.WriteToken)
+		answers.Flush()
+	}
 
-			// Handle enum if present
-			if enumRaw, ok := propMap["enum"].([]interface{}); ok {
-				for _, e := range enumRaw {
-					if str, ok := e.(string); ok {
-						prop.Enum = append(prop.Enum, str)
-					}
-				}
-			}
+	if *transcript != "" && openedSession != nil {
+		if err := mcphost.ExportTranscript(*transcript, openedSession.Saved()); err != nil {
+			slog.Error("failed to write the transcript", "file", *transcript, "error", err)
+		} else {
+			slog.Info("transcript written", "file", *transcript)
+		}
+	}
 
-			result[name] = prop
+	// Stop the MCP servers (and wait for their processes) before exiting
+	host.Close()
+	if tracer != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := tracer.Shutdown(shutdownCtx); err != nil {
+			slog.Warn("failed to export the traces", "error", err)
 		}
+		cancel()
 	}
 
-	return result
+	if rootCtx.Err() != nil {
+		fmt.Println()
+		slog.Warn("interrupted")
+		os.Exit(130)
+	}
+	if err != nil {
+		fatal("failed to run", err)
+	}
 }
 
-// Helper function to safely get string values from map
-func getString(m map[string]interface{}, key string) string {
-	if v, ok := m[key].(string); ok {
-		return v
+// seedValue returns the seed for the logs ("random" when it is not set)
+func seedValue(seed *int) string {
+	if seed == nil {
+		return "random"
+	}
+	return strconv.Itoa(*seed)
+}
+
+// otlpTracesEndpoint returns the OTLP/HTTP traces endpoint of the standard
+// OpenTelemetry environment variables ("" when the tracing is disabled)
+func otlpTracesEndpoint() string {
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); endpoint != "" {
+		return endpoint
+	}
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint != "" {
+		return strings.TrimSuffix(endpoint, "/") + "/v1/traces"
 	}
 	return ""
 }
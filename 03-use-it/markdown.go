@@ -0,0 +1,110 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/glamour"
+)
+
+// MarkdownWriter renders the markdown of a streamed answer with glamour
+// (the style follows the background of the terminal). The tokens are buffered
+// until the end of a block: each block (a paragraph, a list, a code block...)
+// is rendered as soon as it is followed by an empty line, Flush renders the
+// last one. When Render is false, the tokens are written as they are.
+type MarkdownWriter struct {
+	Render bool
+
+	out      io.Writer
+	renderer *glamour.TermRenderer
+	// block is the current block, line the current line of the block
+	block  strings.Builder
+	line   strings.Builder
+	inCode bool
+	fence  string
+}
+
+// NewMarkdownWriter creates a writer rendering the markdown to out
+func NewMarkdownWriter(out io.Writer, render bool) *MarkdownWriter {
+	writer := &MarkdownWriter{Render: render, out: out}
+	if render {
+		renderer, err := glamour.NewTermRenderer(glamour.WithAutoStyle())
+		if err != nil {
+			slog.Warn("the markdown is not rendered", "error", err)
+			writer.Render = false
+		}
+		writer.renderer = renderer
+	}
+	return writer
+}
+
+// markdownFence matches the fences of the code blocks
+var markdownFence = regexp.MustCompile("^\\s*(```+|~~~+)")
+
+// WriteToken writes a token of the streamed answer
+func (m *MarkdownWriter) WriteToken(token string) {
+	if !m.Render {
+		io.WriteString(m.out, token)
+		return
+	}
+	for {
+		before, after, found := strings.Cut(token, "\n")
+		m.line.WriteString(before)
+		if !found {
+			return
+		}
+		m.endLine()
+		token = after
+	}
+}
+
+// endLine adds the complete line to the block, an empty line
+// outside of a code block ends the block
+func (m *MarkdownWriter) endLine() {
+	line := m.line.String()
+	m.line.Reset()
+	if match := markdownFence.FindStringSubmatch(line); match != nil {
+		// a code block ends with the same kind of fence (at least as long)
+		switch {
+		case !m.inCode:
+			m.inCode, m.fence = true, match[1]
+		case match[1][0] == m.fence[0] && len(match[1]) >= len(m.fence):
+			m.inCode, m.fence = false, ""
+		}
+	}
+	if strings.TrimSpace(line) == "" && !m.inCode {
+		m.renderBlock()
+		return
+	}
+	m.block.WriteString(line + "\n")
+}
+
+// Flush renders the last block (the answer is over)
+func (m *MarkdownWriter) Flush() {
+	if !m.Render {
+		return
+	}
+	if m.line.Len() > 0 {
+		m.endLine()
+	}
+	m.renderBlock()
+	m.inCode, m.fence = false, ""
+}
+
+// renderBlock renders the current block with glamour
+// (the markdown is written as it is when it can not be rendered)
+func (m *MarkdownWriter) renderBlock() {
+	block := m.block.String()
+	m.block.Reset()
+	if strings.TrimSpace(block) == "" {
+		return
+	}
+	rendered, err := m.renderer.Render(block)
+	if err != nil {
+		slog.Warn("failed to render the markdown", "error", err)
+		rendered = block
+	}
+	io.WriteString(m.out, rendered)
+}
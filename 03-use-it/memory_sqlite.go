@@ -0,0 +1,5 @@
+package main
+
+// The memory of the conversations (the "memory" setting of the config)
+// uses the SQLite driver of modernc.org/sqlite (pure Go, no cgo)
+import _ "modernc.org/sqlite"
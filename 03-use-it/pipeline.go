@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/k33g/ollama-tlms-golang/06-mcp-host-genaiapp/mcphost"
+)
+
+// RunPipeline runs the steps of a pipeline file (YAML or JSON, see
+// mcphost.Pipeline) and prints its output:
+//
+//	03-use-it pipeline digest.yaml -var url=https://example.com
+//
+// Nobody can answer the approval questions of the ask steps: the tools
+// that need an approval are denied (the tool steps are declared by the user).
+func RunPipeline(ctx context.Context, w io.Writer, host *mcphost.Host, args []string) error {
+	flags := flag.NewFlagSet("pipeline", flag.ExitOnError)
+	vars := map[string]string{}
+	flags.Func("var", "variable of the pipeline (name=value, repeatable)", func(value string) error {
+		name, value, ok := strings.Cut(value, "=")
+		if !ok || name == "" {
+			return errors.New("name=value is expected")
+		}
+		vars[name] = value
+		return nil
+	})
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: pipeline <file> [-var name=value]...")
+		flags.PrintDefaults()
+	}
+	if len(args) < 1 || strings.HasPrefix(args[0], "-") {
+		flags.Usage()
+		return errors.New("the pipeline file is required")
+	}
+	flags.Parse(args[1:])
+
+	pipeline, err := mcphost.LoadPipeline(args[0])
+	if err != nil {
+		return err
+	}
+	output, err := host.RunPipeline(ctx, pipeline, vars)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, strings.TrimSpace(output))
+	return nil
+}
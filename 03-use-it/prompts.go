@@ -0,0 +1,55 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+)
+
+// defaultUserPrompt is used when no prompt is given on the command line
+const defaultUserPrompt = `Fetch this page: https://raw.githubusercontent.com/docker-sa/01-build-image/refs/heads/main/main.go
+	and then analyse the source code.
+	`
+
+// ReadTextFile returns the content of the file at path,
+// or defaultValue when path is empty. "-" reads stdin.
+func ReadTextFile(path string, defaultValue string) (string, error) {
+	if path == "" {
+		return defaultValue, nil
+	}
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// ReadUserPrompt returns the user prompt, from (in this order):
+// the prompt file, the command line arguments, or stdin when it is piped.
+// Otherwise defaultPrompt is returned.
+func ReadUserPrompt(promptFile string, args []string, defaultPrompt string) (string, error) {
+	if promptFile != "" {
+		return ReadTextFile(promptFile, defaultPrompt)
+	}
+	if len(args) > 0 {
+		return strings.Join(args, " "), nil
+	}
+	if stdinIsPiped() {
+		return ReadTextFile("-", defaultPrompt)
+	}
+	return defaultPrompt, nil
+}
+
+func stdinIsPiped() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice == 0
+}
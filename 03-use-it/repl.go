@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/k33g/ollama-tlms-golang/06-mcp-host-genaiapp/mcphost"
+)
+
+// RunREPL reads the user prompts line by line and sends them to the session,
+// until /quit, the end of the input or the cancellation of ctx.
+// The answers are written to answers (rendered as markdown or not).
+func RunREPL(ctx context.Context, session *mcphost.ChatSession, scanner *bufio.Scanner, answers *MarkdownWriter) error {
+	fmt.Println(icon("💬") + "Type your prompt (/prompts and /resources list the MCP prompts and resources, /quit to exit)")
+	fmt.Println("   @<uri> in a prompt adds the content of the resource, /compact summarizes the older turns")
+	fmt.Println("   /servers shows the state of the MCP servers, /export [file] writes the transcript (.md or .html)")
+	fmt.Println("   /watch <uri> keeps a resource fresh, /refresh adds its updates to the next prompt")
+
+	for {
+		fmt.Print(icon("🙂") + "> ")
+		// Scan does not stop on the cancellation of ctx: read in a goroutine
+		scanned := make(chan bool, 1)
+		go func() {
+			scanned <- scanner.Scan()
+		}()
+		select {
+		case <-ctx.Done():
+			return nil
+		case ok := <-scanned:
+			if !ok {
+				fmt.Println()
+				return scanner.Err()
+			}
+		}
+
+		prompt := strings.TrimSpace(scanner.Text())
+		switch {
+		case prompt == "":
+			continue
+		case prompt == "/quit":
+			fmt.Println(icon("👋") + "Bye!")
+			return nil
+		case prompt == "/prompts":
+			listPrompts(session.Agent.Registry)
+			continue
+		case prompt == "/resources":
+			listResources(session.Agent.Registry)
+			continue
+		case prompt == "/compact":
+			compact(ctx, session)
+			continue
+		case prompt == "/servers":
+			for _, line := range serverStates(session.Agent.Registry) {
+				fmt.Println(line)
+			}
+			continue
+		case prompt == "/watch":
+			listWatched(session.Agent.Registry)
+			continue
+		case strings.HasPrefix(prompt, "/watch "):
+			watch(ctx, session.Agent.Registry, strings.TrimSpace(strings.TrimPrefix(prompt, "/watch ")))
+			continue
+		case strings.HasPrefix(prompt, "/unwatch "):
+			if err := session.Agent.Registry.Unwatch(ctx, strings.TrimSpace(strings.TrimPrefix(prompt, "/unwatch "))); err != nil {
+				printError(err)
+			}
+			continue
+		case prompt == "/export" || strings.HasPrefix(prompt, "/export "):
+			path := exportTranscript(session, strings.TrimSpace(strings.TrimPrefix(prompt, "/export")))
+			if path != "" {
+				fmt.Printf(icon("📄")+"transcript written to %s\n", path)
+			}
+			continue
+		case prompt == "/refresh":
+			if updated := session.AddResourceUpdates(); updated == 0 {
+				fmt.Println(icon("🤷") + "No updated resource")
+			} else {
+				fmt.Printf(icon("🔄")+"%d updated resources added to the next prompt\n", updated)
+			}
+			continue
+		}
+
+		var err error
+		if strings.HasPrefix(prompt, "/prompt ") {
+			err = askPrompt(ctx, session, strings.TrimPrefix(prompt, "/prompt "), answers)
+		} else {
+			_, err = session.Ask(ctx, prompt, answers.WriteToken)
+		}
+		answers.Flush()
+		fmt.Println()
+
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			printError(err)
+		}
+	}
+}
+
+// showEvents displays the reasoning of the thinking models dimmed
+// (not in the plain output), the plans of the tool calls, and the progress
+// of the running tools on stderr (the reasoning is only sent with THINKING=show)
+func showEvents(session *mcphost.ChatSession) {
+	progressShown := false
+	session.Agent.OnEvent = func(event mcphost.Event) {
+		switch event.Type {
+		case mcphost.EventThinking:
+			if plainOutput {
+				fmt.Print(event.Content)
+			} else {
+				fmt.Print("\x1b[2m" + event.Content + "\x1b[0m")
+			}
+		case mcphost.EventPlan:
+			if !quietOutput {
+				fmt.Print(icon("📋") + "Plan:\n" + event.Content)
+			}
+		case mcphost.EventToolProgress:
+			progressShown = showProgress(event.Tool, event)
+		case mcphost.EventToolResult:
+			if progressShown {
+				fmt.Fprintln(os.Stderr)
+				progressShown = false
+			}
+		}
+	}
+}
+
+// showProgress displays the progress of a tool on stderr: on the same line
+// (it returns true, the line must be ended), or a line per update in the
+// plain output. Nothing is displayed with -quiet.
+func showProgress(tool string, event mcphost.Event) bool {
+	switch {
+	case quietOutput:
+		return false
+	case plainOutput:
+		fmt.Fprintf(os.Stderr, "progress: %s %s\n", tool, progressBar(event))
+		return false
+	}
+	fmt.Fprintf(os.Stderr, "\r\x1b[2K🔧 %s %s", tool, progressBar(event))
+	return true
+}
+
+// progressBar renders the progress of a tool: a bar when the total is known,
+// a spinner otherwise (the progress value in the plain output)
+func progressBar(event mcphost.Event) string {
+	const width = 20
+	var bar string
+	if event.Total > 0 {
+		ratio := min(max(event.Progress/event.Total, 0), 1)
+		done := int(ratio * width)
+		full, empty := "█", "░"
+		if plainOutput {
+			full, empty = "#", "."
+		}
+		bar = fmt.Sprintf("[%s%s] %3.0f%%", strings.Repeat(full, done), strings.Repeat(empty, width-done), ratio*100)
+	} else if plainOutput {
+		bar = fmt.Sprintf("%g", event.Progress)
+	} else {
+		spinner := []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+		bar = fmt.Sprintf("%s %g", spinner[int(event.Progress)%len(spinner)], event.Progress)
+	}
+	if event.Content != "" {
+		bar += " " + event.Content
+	}
+	return bar
+}
+
+// compact replaces the older turns of the session with a summary
+func compact(ctx context.Context, session *mcphost.ChatSession) {
+	before := mcphost.EstimateMessagesTokens(session.History)
+	compacted, err := session.Compact(ctx)
+	switch {
+	case err != nil:
+		printError(err)
+	case compacted == 0:
+		fmt.Println(icon("🤷") + "Nothing to compact")
+	default:
+		fmt.Printf(icon("🗜️")+"%d messages summarized (about %d tokens → %d tokens)\n",
+			compacted, before, mcphost.EstimateMessagesTokens(session.History))
+	}
+}
+
+// serverStates describes the state of the MCP servers: healthy, unhealthy
+// (their tools are not used), stopped (idle) or failed to start
+func serverStates(registry *mcphost.ToolRegistry) []string {
+	icons := map[string]string{
+		mcphost.ServerHealthy:   "🟢",
+		mcphost.ServerUnhealthy: "🔴",
+		mcphost.ServerStopped:   "💤",
+	}
+	lines := []string{}
+	for _, server := range registry.Servers() {
+		state := server.State()
+		line := fmt.Sprintf("%s%s (%s %s, MCP %s): %s, %d tools", icon(icons[state]), server.Name,
+			server.Info.Name, server.Info.Version, server.ProtocolVersion, state, len(server.Tools))
+		if lastCheck := server.LastCheck(); !lastCheck.IsZero() {
+			line += fmt.Sprintf(", pinged %s ago", time.Since(lastCheck).Round(time.Second))
+		}
+		lines = append(lines, line)
+	}
+	for name, err := range registry.Failed() {
+		lines = append(lines, fmt.Sprintf("%s%s: failed to start: %s", icon("❌"), name, err))
+	}
+	return lines
+}
+
+// exportTranscript writes the transcript of the session in path
+// (<session id>.md by default), it returns the path or "" on error
+func exportTranscript(session *mcphost.ChatSession, path string) string {
+	if path == "" {
+		path = session.ID + ".md"
+	}
+	if err := mcphost.ExportTranscript(path, session.Saved()); err != nil {
+		printError(err)
+		return ""
+	}
+	return path
+}
+
+// watch subscribes to the updates of a resource
+func watch(ctx context.Context, registry *mcphost.ToolRegistry, uri string) {
+	watched, err := registry.Watch(ctx, strings.TrimPrefix(uri, "@"))
+	if err != nil {
+		printError(err)
+		return
+	}
+	fmt.Printf(icon("👀")+"%s is watched on %s\n", watched.URI, watched.Server)
+}
+
+// listWatched displays the watched resources
+func listWatched(registry *mcphost.ToolRegistry) {
+	watched := registry.WatchedResources()
+	if len(watched) == 0 {
+		fmt.Println(icon("🤷") + "No watched resources")
+		return
+	}
+	for _, resource := range watched {
+		changed := ""
+		if resource.Changed {
+			changed = " (updated, /refresh adds it to the next prompt)"
+		}
+		fmt.Printf("- @%s on %s, read at %s%s\n", resource.URI, resource.Server, resource.Updated.Format(time.TimeOnly), changed)
+	}
+}
+
+// listPrompts displays the MCP prompts with their arguments
+func listPrompts(registry *mcphost.ToolRegistry) {
+	prompts := registry.Prompts()
+	if len(prompts) == 0 {
+		fmt.Println(icon("🤷") + "No MCP prompts")
+		return
+	}
+	for _, prompt := range prompts {
+		fmt.Printf("- %s: %s\n", prompt.Name, prompt.Description)
+		for _, argument := range prompt.Arguments {
+			required := ""
+			if argument.Required {
+				required = " (required)"
+			}
+			fmt.Printf("    %s%s: %s\n", argument.Name, required, argument.Description)
+		}
+	}
+}
+
+// listResources displays the MCP resources, they can be mentioned with @<uri>
+func listResources(registry *mcphost.ToolRegistry) {
+	resources := registry.Resources()
+	if len(resources) == 0 {
+		fmt.Println(icon("🤷") + "No MCP resources")
+		return
+	}
+	for _, resource := range resources {
+		fmt.Printf("- @%s (%s): %s\n", resource.URI, resource.Name, resource.Description)
+	}
+}
+
+// askPrompt runs "/prompt <name> key=value key2=\"a value\"":
+// the messages of the MCP prompt are sent to the session
+func askPrompt(ctx context.Context, session *mcphost.ChatSession, command string, answers *MarkdownWriter) error {
+	words, err := splitWords(command)
+	if err != nil {
+		return err
+	}
+	if len(words) == 0 {
+		return errors.New("usage: /prompt <name> key=value...")
+	}
+
+	arguments := map[string]string{}
+	for _, word := range words[1:] {
+		key, value, ok := strings.Cut(word, "=")
+		if !ok {
+			return fmt.Errorf("invalid prompt argument %q: expected key=value", word)
+		}
+		arguments[key] = value
+	}
+
+	messages, err := session.Agent.Registry.GetPrompt(ctx, words[0], arguments)
+	if err != nil {
+		return err
+	}
+	fmt.Printf(icon("📝")+"prompt %s (%d messages)\n", words[0], len(messages))
+	_, err = session.AskMessages(ctx, messages, answers.WriteToken)
+	return err
+}
+
+// splitWords splits a command line on the spaces,
+// except in the double quoted parts
+func splitWords(line string) ([]string, error) {
+	words := []string{}
+	var word strings.Builder
+	inWord, quoted := false, false
+	for _, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			inWord = true
+		case r == ' ' && !quoted:
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote in %q", line)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/k33g/ollama-tlms-golang/06-mcp-host-genaiapp/mcphost"
+)
+
+// shutdownTimeout is the time given to the running requests
+// to finish when the server stops
+const shutdownTimeout = 10 * time.Second
+
+// RunServer starts the HTTP server of the serve mode, until the cancellation of ctx:
+//
+//	03-use-it serve -addr 127.0.0.1:8080
+//	curl -N -d '{"prompt": "..."}' http://localhost:8080/chat
+//	curl -N -d '{"prompt": "...", "session_id": "<X-Session-ID>"}' http://localhost:8080/chat
+//
+// http://localhost:8080 is a chat page in the browser,
+// ws://localhost:8080/ws streams the events of a session over a WebSocket
+// (prompts, interruptions and tool approvals are sent by the client).
+// The host is also an MCP server on http://localhost:8080/mcp.
+// The hooks of the config run a prompt filled with the JSON payload:
+//
+//	curl -d '{"issue": {"title": "..."}}' http://localhost:8080/hooks/issue
+//
+// With the server.apiKeys of the config, the requests need a key as bearer
+// token (or access_token parameter, e.g. http://localhost:8080/?access_token=...).
+// Without keys, the server only listens on a loopback address. The web pages
+// of other origins are rejected, but the server.allowedOrigins of the config.
+//
+// With -tls-cert and -tls-key, the server uses HTTPS (and wss),
+// -tls-client-ca also requires client certificates signed by the CA (mTLS):
+//
+//	03-use-it serve -addr :8443 -tls-cert server.pem -tls-key server-key.pem -tls-client-ca ca.pem
+func RunServer(ctx context.Context, host *mcphost.Host, config mcphost.ServerConfig, args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("addr", "127.0.0.1:8080", "address of the HTTP server (a non-loopback address needs API keys or mTLS)")
+	chatTimeout := flags.Duration("timeout", 0, "timeout of a whole chat request (0 means no timeout)")
+	maxSessions := flags.Int("max-sessions", mcphost.DefaultMaxSessions, "maximum number of sessions kept in memory")
+	sessionIdle := flags.Duration("session-idle", mcphost.DefaultSessionIdleTimeout, "time after which an idle session is dropped")
+	tlsCert := flags.String("tls-cert", "", "certificate file of the server (PEM), enables HTTPS with -tls-key")
+	tlsKey := flags.String("tls-key", "", "private key file of the certificate of the server (PEM)")
+	tlsClientCA := flags.String("tls-client-ca", "", "CA file (PEM) verifying the certificates of the clients (mTLS)")
+	tlsClientOptional := flags.Bool("tls-client-optional", false, "accept the clients without certificate (the given certificates are still verified)")
+	flags.Parse(args)
+
+	tlsConfig, err := serverTLSConfig(*tlsCert, *tlsKey, *tlsClientCA, *tlsClientOptional)
+	if err != nil {
+		return err
+	}
+
+	chatServer := mcphost.NewChatServer(host, *chatTimeout)
+	chatServer.Sessions = mcphost.NewSessionPool(host, *maxSessions, *sessionIdle)
+	// the API keys of the config protect the API
+	chatServer.Auth = mcphost.NewAPIKeyAuth(config)
+	chatServer.Hooks = config.Hooks
+	chatServer.AllowedOrigins = config.AllowedOrigins
+	if chatServer.Auth == nil {
+		// the clients are authenticated by their certificates, or they are local
+		mtls := tlsConfig != nil && tlsConfig.ClientAuth == tls.RequireAndVerifyClientCert
+		if !mtls && !loopbackAddress(*addr) {
+			return fmt.Errorf("no API keys in the config: the server can not listen on %s (use a loopback address such as 127.0.0.1:8080, or add server.apiKeys)", *addr)
+		}
+		slog.Warn("no API keys in the config: the API is open", "addr", *addr)
+	}
+	server := &http.Server{
+		Addr:      *addr,
+		Handler:   chatServer.Handler(),
+		TLSConfig: tlsConfig,
+		// The chat requests are cancelled with the server
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	if tlsConfig != nil {
+		slog.Info("serving the MCP host over HTTPS", "addr", *addr, "mtls", tlsConfig.ClientCAs != nil)
+		// the certificate is in the TLS config
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		slog.Info("serving the MCP host", "addr", *addr)
+		err = server.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// loopbackAddress tells if the address of the server only accepts
+// local connections (":8080" listens on all the interfaces)
+func loopbackAddress(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// serverTLSConfig returns the TLS config of the server (nil without certificate):
+// with a client CA, the certificates of the clients are verified, and required
+// unless optional is true
+func serverTLSConfig(certFile, keyFile, clientCAFile string, optional bool) (*tls.Config, error) {
+	if certFile == "" && keyFile == "" {
+		if clientCAFile != "" {
+			return nil, fmt.Errorf("-tls-client-ca needs -tls-cert and -tls-key")
+		}
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("-tls-cert and -tls-key must be used together")
+	}
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the certificate of the server: %w", err)
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if clientCAFile == "" {
+		return config, nil
+	}
+
+	pem, err := os.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the client CA: %w", err)
+	}
+	config.ClientCAs = x509.NewCertPool()
+	if !config.ClientCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate in the client CA file %s", clientCAFile)
+	}
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+	if optional {
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return config, nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/k33g/ollama-tlms-golang/06-mcp-host-genaiapp/mcphost"
+)
+
+// RunSlack connects the host to the Slack app of the config until the end of
+// the process (Ctrl-C or SIGTERM): the mentions of the bot are answered in
+// their thread, each thread is a chat session.
+//
+//	SLACK_APP_TOKEN=xapp-... SLACK_BOT_TOKEN=xoxb-... 03-use-it slack
+//
+// Nobody can answer the approval questions: the tools that need an approval are denied.
+func RunSlack(ctx context.Context, host *mcphost.Host, config *mcphost.SlackConfig, args []string) error {
+	flags := flag.NewFlagSet("slack", flag.ExitOnError)
+	turnTimeout := flags.Duration("timeout", 0, "timeout of a turn (0 means no timeout)")
+	maxSessions := flags.Int("max-sessions", mcphost.DefaultMaxSessions, "maximum number of sessions (threads) kept in memory")
+	sessionIdle := flags.Duration("session-idle", mcphost.DefaultSessionIdleTimeout, "time after which an idle thread starts a new session")
+	flags.Parse(args)
+
+	if config == nil {
+		return fmt.Errorf("no slack setting in the config")
+	}
+	bot := mcphost.NewSlackBot(host, *config, *turnTimeout)
+	bot.Sessions = mcphost.NewSessionPool(host, *maxSessions, *sessionIdle)
+	return bot.Run(ctx)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/k33g/ollama-tlms-golang/06-mcp-host-genaiapp/mcphost"
+)
+
+// The steps of main running the subcommands
+const (
+	// withoutServers: the subcommand runs before the start of the servers
+	withoutServers = iota
+	// withoutModels: the subcommand runs with the servers, without any model
+	withoutModels
+	// withModels: the subcommand runs with the servers and the models,
+	// nobody can answer its approval questions (the tools that need
+	// an approval are denied) and its sessions are not saved
+	withModels
+)
+
+// subcommand is a mode selected by the first argument of the command line
+// (03-use-it <name> [args...]) instead of the prompt of the one-shot mode.
+// host is nil in the withoutServers step, out gets the answers.
+type subcommand struct {
+	step int
+	run  func(ctx context.Context, host *mcphost.Host, config mcphost.Config, out io.Writer, args []string) error
+}
+
+// subcommands are the subcommands by name: the other first arguments
+// are the prompt of the one-shot mode
+var subcommands = map[string]subcommand{
+	// login authorizes the host for a remote server with OAuth (again):
+	// 03-use-it login <server>
+	"login": {withoutServers, func(ctx context.Context, host *mcphost.Host, config mcphost.Config, out io.Writer, args []string) error {
+		name := ""
+		if len(args) > 0 {
+			name = args[0]
+		}
+		server, ok := config.MCPServers[name]
+		if !ok {
+			return fmt.Errorf("unknown server %q", name)
+		}
+		return mcphost.AuthorizeServer(ctx, server)
+	}},
+	"tools": {withoutModels, func(ctx context.Context, host *mcphost.Host, config mcphost.Config, out io.Writer, args []string) error {
+		return RunTools(out, host, args)
+	}},
+	"call": {withoutModels, func(ctx context.Context, host *mcphost.Host, config mcphost.Config, out io.Writer, args []string) error {
+		return RunCall(ctx, out, host, args)
+	}},
+	"serve": {withModels, func(ctx context.Context, host *mcphost.Host, config mcphost.Config, out io.Writer, args []string) error {
+		return RunServer(ctx, host, config.Server, args)
+	}},
+	"batch": {withModels, func(ctx context.Context, host *mcphost.Host, config mcphost.Config, out io.Writer, args []string) error {
+		return RunBatch(ctx, host, args)
+	}},
+	// the tool steps of the pipelines are declared by the user
+	"pipeline": {withModels, func(ctx context.Context, host *mcphost.Host, config mcphost.Config, out io.Writer, args []string) error {
+		return RunPipeline(ctx, out, host, args)
+	}},
+	// the scheduled tasks run unattended
+	"daemon": {withModels, func(ctx context.Context, host *mcphost.Host, config mcphost.Config, out io.Writer, args []string) error {
+		slog.Info("daemon started", "schedules", len(config.Schedules))
+		return RunDaemon(ctx, host, config.Schedules, args)
+	}},
+	// the threads of Slack are the sessions of the bot
+	"slack": {withModels, func(ctx context.Context, host *mcphost.Host, config mcphost.Config, out io.Writer, args []string) error {
+		slog.Info("starting the Slack bot")
+		return RunSlack(ctx, host, config.Slack, args)
+	}},
+	// the channels of Discord are the sessions of the bot,
+	// the tool calls are approved with the buttons of the messages
+	"discord": {withModels, func(ctx context.Context, host *mcphost.Host, config mcphost.Config, out io.Writer, args []string) error {
+		slog.Info("starting the Discord bot")
+		return RunDiscord(ctx, host, config.Discord, args)
+	}},
+	// the host is an MCP server on stdio (e.g. for Claude Desktop):
+	// the tools that need an approval are denied, in ask_llm
+	// and in the re-exported tools
+	"mcp-server": {withModels, func(ctx context.Context, host *mcphost.Host, config mcphost.Config, out io.Writer, args []string) error {
+		slog.Info("serving MCP on stdio")
+		return mcphost.NewGateway(host).ServeStdio(ctx, os.Stdin, out)
+	}},
+}
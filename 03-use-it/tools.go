@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ollama/ollama/api"
+
+	"github.com/k33g/ollama-tlms-golang/06-mcp-host-genaiapp/mcphost"
+)
+
+// catalogTool is a tool of the catalog: its MCP definition and the
+// Ollama tool it is converted to
+type catalogTool struct {
+	Name        string      `json:"name"`
+	Server      string      `json:"server"`
+	Approval    string      `json:"approval"`
+	Description string      `json:"description"`
+	InputSchema interface{} `json:"inputSchema"`
+	Ollama      api.Tool    `json:"ollama"`
+}
+
+// RunTools prints the catalog of the tools of the started servers, without
+// calling a model (to check the conversion of the schemas):
+//
+//	03-use-it tools -format json
+func RunTools(w io.Writer, host *mcphost.Host, args []string) error {
+	flags := flag.NewFlagSet("tools", flag.ExitOnError)
+	format := flags.String("format", "table", "output format: table, json or yaml")
+	flags.Parse(args)
+
+	catalog := []catalogTool{}
+	for _, server := range host.Registry.Servers() {
+		for _, tool := range server.Tools {
+			// the model gets the tools with the name of their server
+			qualified := tool
+			qualified.Name = server.Name + mcphost.ToolNameSeparator + tool.Name
+			catalog = append(catalog, catalogTool{
+				Name:        qualified.Name,
+				Server:      server.Name,
+				Approval:    string(server.Config.ApprovalPolicy(tool.Name)),
+				Description: tool.Description,
+				InputSchema: tool.InputSchema,
+				Ollama:      mcphost.ConvertToOllamaTools(append(server.Tools[:0:0], qualified))[0],
+			})
+		}
+	}
+
+	switch *format {
+	case "table":
+		return writeToolsTable(w, catalog)
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(catalog)
+	case "yaml":
+		data, err := json.Marshal(catalog)
+		if err != nil {
+			return err
+		}
+		if data, err = mcphost.JSONToYAML(data); err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+	return fmt.Errorf("unknown format %s (table, json or yaml)", *format)
+}
+
+// writeToolsTable writes a line per tool, the required parameters end with *
+func writeToolsTable(w io.Writer, catalog []catalogTool) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "TOOL\tAPPROVAL\tPARAMETERS\tDESCRIPTION")
+	for _, tool := range catalog {
+		function := tool.Ollama.Function
+		required := map[string]bool{}
+		for _, name := range function.Parameters.Required {
+			required[name] = true
+		}
+		parameters := []string{}
+		for name, property := range function.Parameters.Properties.All() {
+			parameter := name + ":" + strings.Join(property.Type, "|")
+			if required[name] {
+				parameter += "*"
+			}
+			parameters = append(parameters, parameter)
+		}
+		sort.Strings(parameters)
+		description, _, _ := strings.Cut(strings.TrimSpace(tool.Description), "\n")
+		if len(description) > 60 {
+			description = description[:57] + "..."
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", tool.Name, tool.Approval, strings.Join(parameters, " "), description)
+	}
+	return table.Flush()
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/k33g/ollama-tlms-golang/06-mcp-host-genaiapp/mcphost"
+)
+
+// TUI is the terminal interface of the chat (a bubbletea program): the
+// transcript fills the screen, with a status line (the running tool) and
+// the input line at the bottom. PgUp/PgDn and the arrows scroll the
+// transcript, Esc cancels the running tool calls, Ctrl-C stops the running
+// answer (or quits), Ctrl-D quits.
+//
+// The TUI is an io.Writer for the logs (they are added to the transcript)
+// and asks the approval questions of the agent (see Approve).
+type TUI struct {
+	program  *tea.Program
+	viewport viewport.Model
+	input    textinput.Model
+	session  *mcphost.ChatSession
+	ctx      context.Context
+
+	// the state below is updated by the turns running in the background
+	mu      sync.Mutex
+	entries []tuiEntry
+	status  string
+	busy    bool
+	cancel  context.CancelFunc
+	// approval receives the answer of the pending approval question (nil without question)
+	approval chan string
+	redraw   chan struct{}
+}
+
+type tuiEntry struct {
+	kind string
+	text string
+}
+
+// tuiRefreshMsg tells the program that the state of the TUI changed
+type tuiRefreshMsg struct{}
+
+// Kinds of the entries of the transcript, with their prefix and style
+var tuiStyles = map[string]struct {
+	prefix string
+	style  lipgloss.Style
+}{
+	"user":     {"🙂 ", lipgloss.NewStyle().Bold(true)},
+	"answer":   {"🤖 ", lipgloss.NewStyle()},
+	"tool":     {"🔧 ", lipgloss.NewStyle().Foreground(lipgloss.Color("6"))},
+	"thinking": {"💭 ", lipgloss.NewStyle().Faint(true)},
+	"plan":     {"📋 ", lipgloss.NewStyle().Foreground(lipgloss.Color("6"))},
+	"error":    {"😡 ", lipgloss.NewStyle().Foreground(lipgloss.Color("1"))},
+	"approval": {"🖐️ ", lipgloss.NewStyle().Foreground(lipgloss.Color("3")).Bold(true)},
+	"info":     {"", lipgloss.NewStyle().Foreground(lipgloss.Color("3"))},
+	"log":      {"", lipgloss.NewStyle().Faint(true)},
+}
+
+var tuiStatusStyle = lipgloss.NewStyle().Reverse(true)
+
+// NewTUI creates the terminal interface on stdin and stdout
+func NewTUI() *TUI {
+	input := textinput.New()
+	input.Prompt = "🙂 > "
+	input.Focus()
+	// the arrows scroll the transcript, the other keys of the viewport are typed
+	transcript := viewport.New(80, 22)
+	transcript.KeyMap = viewport.KeyMap{
+		PageUp:   key.NewBinding(key.WithKeys("pgup")),
+		PageDown: key.NewBinding(key.WithKeys("pgdown")),
+		Up:       key.NewBinding(key.WithKeys("up")),
+		Down:     key.NewBinding(key.WithKeys("down")),
+	}
+	return &TUI{
+		viewport: transcript,
+		input:    input,
+		redraw:   make(chan struct{}, 1),
+	}
+}
+
+// Write adds the logs to the transcript
+func (t *TUI) Write(data []byte) (int, error) {
+	if text := strings.TrimRight(string(data), "\n"); text != "" {
+		t.add("log", text)
+	}
+	return len(data), nil
+}
+
+// Approve asks an approval question of the agent (see mcphost.NewRemoteApprover):
+// the next input line answers it with yes, no or always
+func (t *TUI) Approve(question string) string {
+	answer := make(chan string, 1)
+	t.mu.Lock()
+	t.approval = answer
+	t.status = "🖐️  waiting for your approval"
+	t.entries = append(t.entries, tuiEntry{kind: "approval", text: question + " [y]es / [n]o / [a]lways"})
+	t.mu.Unlock()
+	t.refresh()
+	return <-answer
+}
+
+// Run runs the chat session in the TUI until /quit, Ctrl-D
+// or the cancellation of ctx
+func (t *TUI) Run(ctx context.Context, session *mcphost.ChatSession) error {
+	t.ctx, t.session = ctx, session
+	session.Agent.OnEvent = t.onEvent
+	t.add("info", "Type your prompt (/compact summarizes the older turns, /servers shows the MCP servers, /export [file] writes the transcript, /quit or Ctrl-D to exit)")
+	t.setStatus("ready")
+
+	t.program = tea.NewProgram(t, tea.WithAltScreen(), tea.WithContext(ctx))
+	// the changes of the background turns are redrawn, coalesced
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.redraw:
+				t.program.Send(tuiRefreshMsg{})
+			}
+		}
+	}()
+
+	_, err := t.program.Run()
+	t.mu.Lock()
+	if t.busy {
+		t.stopTurn()
+	}
+	t.mu.Unlock()
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// Init starts the blinking of the cursor
+func (t *TUI) Init() tea.Cmd {
+	return textinput.Blink
+}
+
+// Update handles the keys, the size of the terminal and the refreshes
+func (t *TUI) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		t.viewport.Width, t.viewport.Height = msg.Width, max(msg.Height-2, 1)
+		t.input.Width = max(msg.Width-lipgloss.Width(t.input.Prompt)-1, 1)
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "pgup", "pgdown", "up", "down":
+			t.viewport, cmd = t.viewport.Update(msg)
+			return t, cmd
+		}
+		if quit := t.handleKey(msg); quit {
+			return t, tea.Quit
+		}
+		t.input, cmd = t.input.Update(msg)
+	}
+	t.layout()
+	return t, cmd
+}
+
+// handleKey handles the keys of the chat, it returns true to quit
+func (t *TUI) handleKey(msg tea.KeyMsg) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch msg.Type {
+	case tea.KeyCtrlC:
+		if t.busy {
+			t.stopTurn()
+			return false
+		}
+		return true
+	case tea.KeyCtrlD:
+		return t.input.Value() == "" && !t.busy
+	case tea.KeyEsc:
+		// the model is told that the tools were cancelled
+		if t.busy && t.session.Agent.CancelToolCalls() > 0 {
+			t.status = "cancelling the tool calls..."
+		}
+	case tea.KeyEnter:
+		line := strings.TrimSpace(t.input.Value())
+		t.input.SetValue("")
+		return t.handleLine(line)
+	}
+	return false
+}
+
+// handleLine runs an input line: the answer of an approval, a command or
+// a prompt (t.mu is locked), it returns true to quit
+func (t *TUI) handleLine(line string) bool {
+	session := t.session
+	switch {
+	case t.approval != nil:
+		answer, ok := map[string]string{"y": "yes", "yes": "yes", "n": "no", "no": "no", "a": "always", "always": "always"}[strings.ToLower(line)]
+		if !ok {
+			t.entries = append(t.entries, tuiEntry{kind: "info", text: "Answer y, n or a"})
+			return false
+		}
+		t.approval <- answer
+		t.approval = nil
+		t.status = "running"
+		t.entries = append(t.entries, tuiEntry{kind: "user", text: line})
+	case line == "" || t.busy:
+	case line == "/quit":
+		return true
+	case line == "/servers":
+		t.entries = append(t.entries, tuiEntry{kind: "info", text: strings.Join(serverStates(session.Agent.Registry), "\n")})
+	case line == "/export" || strings.HasPrefix(line, "/export "):
+		path := strings.TrimSpace(strings.TrimPrefix(line, "/export"))
+		if path == "" {
+			path = session.ID + ".md"
+		}
+		if err := mcphost.ExportTranscript(path, session.Saved()); err != nil {
+			t.entries = append(t.entries, tuiEntry{kind: "error", text: err.Error()})
+		} else {
+			t.entries = append(t.entries, tuiEntry{kind: "info", text: "transcript written to " + path})
+		}
+	case line == "/compact":
+		t.startTurn(func(turnCtx context.Context) error {
+			compacted, err := session.Compact(turnCtx)
+			if err == nil {
+				t.add("info", fmt.Sprintf("%d messages summarized", compacted))
+			}
+			return err
+		})
+	default:
+		t.entries = append(t.entries, tuiEntry{kind: "user", text: line})
+		t.viewport.GotoBottom()
+		// the answer entry follows the tool calls and the reasoning
+		answer := -1
+		t.startTurn(func(turnCtx context.Context) error {
+			_, err := session.Ask(turnCtx, line, func(token string) {
+				t.mu.Lock()
+				if answer < 0 {
+					t.entries = append(t.entries, tuiEntry{kind: "answer"})
+					answer = len(t.entries) - 1
+				}
+				t.entries[answer].text += token
+				t.mu.Unlock()
+				t.refresh()
+			})
+			return err
+		})
+	}
+	return false
+}
+
+// startTurn runs a turn in the background (t.mu is locked)
+func (t *TUI) startTurn(turn func(context.Context) error) {
+	turnCtx, cancel := context.WithCancel(t.ctx)
+	t.busy, t.cancel = true, cancel
+	t.status = "thinking..."
+	go func() {
+		err := turn(turnCtx)
+		cancel()
+		t.mu.Lock()
+		t.busy = false
+		t.status = "ready"
+		if err != nil {
+			t.entries = append(t.entries, tuiEntry{kind: "error", text: err.Error()})
+		}
+		t.mu.Unlock()
+		t.refresh()
+	}()
+}
+
+// stopTurn cancels the running turn (t.mu is locked)
+func (t *TUI) stopTurn() {
+	t.cancel()
+	t.status = "stopping..."
+	if t.approval != nil {
+		// the approver waits for an answer
+		t.approval <- "no"
+		t.approval = nil
+	}
+}
+
+func (t *TUI) onEvent(event mcphost.Event) {
+	switch event.Type {
+	case mcphost.EventToolCall:
+		t.setStatus("🔧 running " + event.Tool)
+		t.add("tool", event.Tool)
+	case mcphost.EventPlan:
+		t.add("plan", strings.TrimSuffix(event.Content, "\n"))
+	case mcphost.EventToolProgress:
+		t.setStatus("🔧 running " + event.Tool + " " + progressBar(event) + "  (Esc to cancel)")
+	case mcphost.EventThinking:
+		// the reasoning is streamed in the last thinking entry
+		t.mu.Lock()
+		if last := len(t.entries) - 1; last >= 0 && t.entries[last].kind == "thinking" {
+			t.entries[last].text += event.Content
+		} else {
+			t.entries = append(t.entries, tuiEntry{kind: "thinking", text: strings.TrimLeft(event.Content, "\n")})
+		}
+		t.mu.Unlock()
+		t.refresh()
+	case mcphost.EventToolResult:
+		t.setStatus("thinking...")
+		if event.Error != "" {
+			t.add("error", event.Tool+": "+event.Error)
+		}
+	}
+}
+
+// add adds an entry to the transcript and refreshes the screen
+func (t *TUI) add(kind string, text string) {
+	t.mu.Lock()
+	t.entries = append(t.entries, tuiEntry{kind: kind, text: text})
+	t.mu.Unlock()
+	t.refresh()
+}
+
+func (t *TUI) setStatus(status string) {
+	t.mu.Lock()
+	t.status = status
+	t.mu.Unlock()
+	t.refresh()
+}
+
+// refresh asks for a redraw, the redraws are coalesced
+func (t *TUI) refresh() {
+	select {
+	case t.redraw <- struct{}{}:
+	default:
+	}
+}
+
+// layout renders the transcript in the viewport, which follows
+// the end of the transcript unless it is scrolled up
+func (t *TUI) layout() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	width := max(t.viewport.Width, 1)
+	lines := make([]string, 0, len(t.entries))
+	for _, entry := range t.entries {
+		style := tuiStyles[entry.kind]
+		lines = append(lines, style.style.Width(width).Render(style.prefix+entry.text))
+	}
+	following := t.viewport.AtBottom()
+	t.viewport.SetContent(strings.Join(lines, "\n"))
+	if following {
+		t.viewport.GotoBottom()
+	}
+}
+
+// View writes the screen: the transcript, the status line and the input line
+func (t *TUI) View() string {
+	t.mu.Lock()
+	status := " " + t.status
+	t.mu.Unlock()
+	if !t.viewport.AtBottom() {
+		status += fmt.Sprintf("  (scrolled up %.0f%%)", 100-t.viewport.ScrollPercent()*100)
+	}
+	status = tuiStatusStyle.Width(t.viewport.Width).MaxWidth(t.viewport.Width).Render(status)
+	return t.viewport.View() + "\n" + status + "\n" + t.input.View()
+}
@@ -0,0 +1,497 @@
+package mcphost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// ErrBudgetExceeded is wrapped by the errors of the limits of the tool loop:
+// the conversation ends with a message telling the model to answer
+// without more tool calls
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// Errors of the limits of the tool loop
+var (
+	// ErrMaxIterations is returned when the model still requests tools
+	// after the maximum number of iterations of the tool loop
+	ErrMaxIterations = fmt.Errorf("%w: maximum number of tool iterations reached", ErrBudgetExceeded)
+	// ErrMaxToolCalls is returned when the model requests more tool calls than MaxToolCalls
+	ErrMaxToolCalls = fmt.Errorf("%w: maximum number of tool calls reached", ErrBudgetExceeded)
+	// ErrMaxToolOutput is returned when the tool results are larger than MaxToolOutputBytes
+	ErrMaxToolOutput = fmt.Errorf("%w: maximum size of the tool results reached", ErrBudgetExceeded)
+)
+
+// ToolResult is the result of a tool call requested by the model
+type ToolResult struct {
+	Name      string
+	Arguments map[string]interface{}
+	Content   string
+	Images    []api.ImageData
+	// IsError is true when the tool reported an error (isError of the MCP result)
+	IsError bool
+}
+
+// Agent runs the tool loop: the model is called with the tools catalog,
+// the requested tools are executed on the MCP servers and their results
+// are sent back to the model as "tool" messages, until the model stops
+// requesting tools.
+type Agent struct {
+	Ollama        *api.Client
+	Registry      *ToolRegistry
+	Model         string
+	Tools         []api.Tool
+	Options       map[string]interface{}
+	MaxIterations int
+	// MaxToolCalls is the maximum number of tool calls of a run (0 means no limit):
+	// the calls over the limit are not executed
+	MaxToolCalls int
+	// MaxToolOutputBytes is the maximum total size of the tool results of a run
+	// (0 means no limit): the loop stops when it is reached
+	MaxToolOutputBytes int
+	// ResultLimit limits the size of each tool result (the zero value keeps them whole)
+	ResultLimit ToolResultLimit
+	// ChatTimeout is the timeout of each call of the model, retries included
+	// (0 means no timeout)
+	ChatTimeout time.Duration
+	// Retry tells how the failed calls of the model are retried
+	Retry BackoffPolicy
+	// ToolCallMode tells how the tools are given to the model ("" is the native mode)
+	ToolCallMode ToolCallMode
+	// Plan tells if the model plans its tool calls before executing them
+	// ("" is the off mode)
+	Plan PlanMode
+	// Approver validates the tool calls before their execution (nil allows all the calls)
+	Approver *Approver
+	// Summarizer shortens the large tool results (nil keeps the results as they are)
+	Summarizer *Summarizer
+	// InjectionScanner flags the instructions injected in the tool results
+	// (nil sends the results as they are)
+	InjectionScanner *InjectionScanner
+	// PIIFilter masks the personal data of the tool results
+	// (nil sends the results as they are)
+	PIIFilter *PIIFilter
+	// Thinking tells what to do with the reasoning of the thinking models
+	// ("" hides it)
+	Thinking ThinkingMode
+	// OnEvent, if set, is called when a tool is called, when its result is received
+	// and with the reasoning of the model (ThinkingShow)
+	OnEvent func(Event)
+
+	// ToolSelector, if set, only sends the tools relevant to the prompt
+	// when the catalog is large
+	ToolSelector *ToolSelector
+	// AllowedTools are the patterns of the tools of the agent, "!pattern"
+	// excludes tools (all the tools by default), see AgentConfig
+	AllowedTools []string
+	// Metrics record the chat completions (nil records nothing)
+	Metrics *Metrics
+
+	eventMu sync.Mutex
+	// toolsVersion is the version of the registry of Tools
+	toolsVersion int
+	// selected are the names of the tools selected for the run (nil for all the tools)
+	selected map[string]bool
+
+	// cancels are the cancel functions of the running tool calls
+	cancelMu sync.Mutex
+	cancels  map[*context.CancelFunc]bool
+}
+
+// CancelToolCalls cancels the running tool calls (not the turn): the servers
+// receive notifications/cancelled and the model is told that the user cancelled them. It returns the number of cancelled calls.
+func (a *Agent) CancelToolCalls() int {
+	a.cancelMu.Lock()
+	defer a.cancelMu.Unlock()
+	for cancel := range a.cancels {
+		(*cancel)()
+	}
+	return len(a.cancels)
+}
+
+// cancellable returns the context of a tool call cancelled by CancelToolCalls,
+// done must be called at the end of the call
+func (a *Agent) cancellable(ctx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	a.cancelMu.Lock()
+	if a.cancels == nil {
+		a.cancels = map[*context.CancelFunc]bool{}
+	}
+	a.cancels[&cancel] = true
+	a.cancelMu.Unlock()
+	return ctx, func() {
+		a.cancelMu.Lock()
+		delete(a.cancels, &cancel)
+		a.cancelMu.Unlock()
+		cancel()
+	}
+}
+
+// Run runs the tool loop on the messages. It returns the whole conversation
+// (the messages followed by the assistant and tool messages) and the results
+// of the tool calls.
+// When a limit is reached, the conversation ends with a "budget exceeded"
+// message and the error wraps ErrBudgetExceeded.
+// In the plan modes, the model writes the plan of its tool calls first.
+func (a *Agent) Run(ctx context.Context, messages []api.Message) ([]api.Message, []ToolResult, error) {
+	a.selectTools(ctx, messages)
+	if a.Plan == PlanExecute || a.Plan == PlanApprove {
+		return a.runPlan(ctx, messages)
+	}
+	return a.runLoop(ctx, messages)
+}
+
+// runLoop runs the tool loop: the model decides the next tool calls
+// after each result
+func (a *Agent) runLoop(ctx context.Context, messages []api.Message) ([]api.Message, []ToolResult, error) {
+	results := []ToolResult{}
+	toolCalls, toolOutputBytes := 0, 0
+	var budgetErr error
+
+	mode := a.ToolCallMode
+	if mode == ToolCallModePrompt {
+		messages = withToolsPrompt(messages, a.availableTools())
+	}
+
+	for iteration := 0; iteration < a.MaxIterations; iteration++ {
+		tools := a.availableTools()
+		if mode == ToolCallModePrompt {
+			tools = nil
+		}
+		answer, err := a.chat(ctx, messages, tools)
+		if mode == ToolCallModeAuto && toolsNotSupported(err) {
+			slog.Warn("the model does not support tools: they are described in the prompt", "model", a.Model)
+			mode = ToolCallModePrompt
+			messages = withToolsPrompt(messages, a.availableTools())
+			answer, err = a.chat(ctx, messages, nil)
+		}
+		if err != nil {
+			return messages, results, err
+		}
+
+		// In the prompt and auto modes, the tool calls can be written in the content.
+		// Their results are sent back as user messages (the model may not know the tool role).
+		promptToolCalls := false
+		if len(answer.ToolCalls) == 0 && mode != ToolCallModeNative && mode != "" {
+			answer.ToolCalls = parseToolCalls(answer.Content, a.Tools)
+			promptToolCalls = len(answer.ToolCalls) > 0
+		}
+		// The arguments are converted to the types of the tool schemas
+		// (the conversation keeps the converted calls)
+		for i, toolCall := range answer.ToolCalls {
+			answer.ToolCalls[i].Function.Arguments = callArguments(a.Registry.CoerceArguments(toolCall.Function.Name, toolArguments(toolCall)))
+		}
+		messages = append(messages, answer)
+
+		// The model did not find any tool to call: the loop is over
+		if len(answer.ToolCalls) == 0 {
+			return messages, results, nil
+		}
+
+		// Ollama found tool(s) to call: the arguments are checked with the schemas
+		// of the tools and the approvals are asked one by one,
+		// then the approved calls run concurrently
+		approved := make([]bool, len(answer.ToolCalls))
+		callResults := make([]ToolResult, len(answer.ToolCalls))
+		// The identical calls (same tool and arguments) of the answer are
+		// executed once, duplicateOf is the index of the first call (-1 for it)
+		duplicateOf := make([]int, len(answer.ToolCalls))
+		firstCalls := map[string]int{}
+		for i, toolCall := range answer.ToolCalls {
+			key := toolCallKey(toolCall.Function.Name, toolArguments(toolCall))
+			first, duplicate := firstCalls[key]
+			duplicateOf[i] = -1
+			if duplicate {
+				slog.Warn("duplicate tool call, its result is reused", "tool", toolCall.Function.Name)
+				duplicateOf[i] = first
+				continue
+			}
+			firstCalls[key] = i
+			if a.MaxToolCalls > 0 && toolCalls >= a.MaxToolCalls {
+				// the call is not executed (nor approved)
+				slog.Warn("tool call over the budget", "tool", toolCall.Function.Name, "max", a.MaxToolCalls)
+				callResults[i] = a.overBudget(toolCall)
+				approved[i] = true
+				budgetErr = ErrMaxToolCalls
+				continue
+			}
+			toolCalls++
+			slog.Info("tool call", "tool", toolCall.Function.Name, "arguments", toolArguments(toolCall))
+			a.emit(Event{Type: EventToolCall, Tool: toolCall.Function.Name, Arguments: toolArguments(toolCall)})
+			if !a.allowsTool(toolCall.Function.Name) {
+				// the model called a tool outside of its catalog
+				slog.Warn("tool outside of the tools of the agent", "tool", toolCall.Function.Name, "model", a.Model)
+				a.emit(Event{Type: EventToolResult, Tool: toolCall.Function.Name, Error: "not available"})
+				callResults[i] = ToolResult{
+					Name:      toolCall.Function.Name,
+					Arguments: toolArguments(toolCall),
+					Content:   fmt.Sprintf("Error: the tool %s is not available. Use one of your tools.", toolCall.Function.Name),
+					IsError:   true,
+				}
+				approved[i] = true
+				continue
+			}
+			if err := a.Registry.ValidateArguments(toolCall.Function.Name, toolArguments(toolCall)); err != nil {
+				// the tool is not called: the model gets the errors to fix its call
+				callResults[i] = a.invalidArguments(toolCall, err)
+				approved[i] = true
+				continue
+			}
+			approved[i] = a.approve(toolCall.Function.Name, toolArguments(toolCall))
+		}
+
+		var wg sync.WaitGroup
+		for i, toolCall := range answer.ToolCalls {
+			if !approved[i] || callResults[i].IsError || duplicateOf[i] >= 0 {
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				callResults[i] = a.callTool(ctx, toolCall)
+			}()
+		}
+		wg.Wait()
+		if ctx.Err() != nil {
+			return messages, results, fmt.Errorf("failed to call the tools: %w", ctx.Err())
+		}
+
+		// The tool messages follow the order of the tool calls
+		// (the duplicates get the result of their first call)
+		for i, toolCall := range answer.ToolCalls {
+			duplicate := duplicateOf[i] >= 0
+			if duplicate {
+				approved[i], callResults[i] = approved[duplicateOf[i]], callResults[duplicateOf[i]]
+			}
+			message := api.Message{Role: "tool", ToolName: toolCall.Function.Name, Content: callResults[i].Content, Images: callResults[i].Images}
+			if !approved[i] {
+				message.Content = fmt.Sprintf("The user denied the execution of the tool %s.", toolCall.Function.Name)
+			} else if !duplicate {
+				results = append(results, callResults[i])
+				toolOutputBytes += len(callResults[i].Content)
+			}
+			if promptToolCalls {
+				message.Role, message.ToolName = "user", ""
+				message.Content = fmt.Sprintf("Result of the tool %s:\n%s", toolCall.Function.Name, message.Content)
+			}
+			messages = append(messages, message)
+		}
+
+		if budgetErr == nil && a.MaxToolOutputBytes > 0 && toolOutputBytes > a.MaxToolOutputBytes {
+			budgetErr = ErrMaxToolOutput
+		}
+		if budgetErr != nil {
+			return a.budgetExceeded(messages, budgetErr), results, budgetErr
+		}
+	}
+	return a.budgetExceeded(messages, ErrMaxIterations), results, ErrMaxIterations
+}
+
+// overBudget is the result of a tool call over the MaxToolCalls budget
+func (a *Agent) overBudget(toolCall api.ToolCall) ToolResult {
+	return ToolResult{
+		Name:      toolCall.Function.Name,
+		Arguments: toolArguments(toolCall),
+		Content: fmt.Sprintf("The tool %s was not called: the budget of %d tool calls is exceeded.",
+			toolCall.Function.Name, a.MaxToolCalls),
+		IsError: true,
+	}
+}
+
+// budgetExceeded appends the message telling the model that the tools
+// can not be used anymore in this turn
+func (a *Agent) budgetExceeded(messages []api.Message, err error) []api.Message {
+	slog.Warn(err.Error(), "tool_calls", a.MaxToolCalls, "iterations", a.MaxIterations, "tool_output_bytes", a.MaxToolOutputBytes)
+	return append(messages, api.Message{
+		Role: "system",
+		Content: fmt.Sprintf("Budget exceeded (%s): no more tools can be called in this turn. "+
+			"Answer the user with the results you already have, and tell them if they are incomplete.",
+			strings.TrimPrefix(err.Error(), ErrBudgetExceeded.Error()+": ")),
+	})
+}
+
+// selectTools selects the tools relevant to the last prompt of the user
+func (a *Agent) selectTools(ctx context.Context, messages []api.Message) {
+	a.selected = nil
+	if a.ToolSelector == nil {
+		return
+	}
+	prompt := ""
+	for _, message := range messages {
+		if message.Role == "user" {
+			prompt = message.Content
+		}
+	}
+	a.selected = a.ToolSelector.Select(ctx, prompt, a.availableTools())
+}
+
+// availableTools returns the tools sent to the model
+// (without the tools of the unhealthy servers, and only the selected tools).
+// When the tools of a server changed, the tools of the agent are updated.
+func (a *Agent) availableTools() []api.Tool {
+	if version := a.Registry.Version(); version != a.toolsVersion {
+		a.Tools = ConvertToOllamaTools(a.Registry.Tools())
+		a.toolsVersion = version
+	}
+	tools := make([]api.Tool, 0, len(a.Tools))
+	for _, tool := range a.Tools {
+		if a.Registry.Available(tool.Function.Name) && (a.selected == nil || a.selected[tool.Function.Name]) &&
+			a.allowsTool(tool.Function.Name) {
+			tools = append(tools, tool)
+		}
+	}
+	return tools
+}
+
+// chat sends the messages and the tools to the model
+func (a *Agent) chat(ctx context.Context, messages []api.Message, tools []api.Tool) (api.Message, error) {
+	var FALSE = false
+	options, keepAlive := requestOptions(a.Options)
+	req := &api.ChatRequest{
+		Model:     a.Model,
+		Messages:  FitContextWindow(messages, promptBudget(a.Options)-toolsTokens(tools)),
+		Options:   options,
+		KeepAlive: keepAlive,
+		Tools:     tools,
+		Stream:    &FALSE,
+	}
+
+	ctx, span := startSpan(ctx, "ollama chat", spanKindClient, "model", a.Model, "tools", strconv.Itoa(len(tools)))
+	ctx, cancel := withTimeout(ctx, a.ChatTimeout)
+	defer cancel()
+
+	var answer api.Message
+	var last api.ChatResponse
+	start := time.Now()
+	err := chatWithRetry(ctx, a.Ollama, a.Retry, req, func(resp api.ChatResponse) error {
+		answer.Role = resp.Message.Role
+		answer.Content += resp.Message.Content
+		answer.ToolCalls = append(answer.ToolCalls, resp.Message.ToolCalls...)
+		last = resp
+		return nil
+	})
+	a.Metrics.recordChat(a.Model, time.Since(start), last)
+	// the reasoning is neither parsed for tool calls nor kept in the conversation
+	answer.Content = stripThinking(answer.Content, a.Thinking, a.Model, a.emit)
+	span.SetAttribute("tool_calls", strconv.Itoa(len(answer.ToolCalls)))
+	span.End(err)
+	return answer, err
+}
+
+// callTool calls the tool on its MCP server. A failed (or timed out) tool
+// does not stop the session: the result tells the model about the failure.
+func (a *Agent) callTool(ctx context.Context, toolCall api.ToolCall) ToolResult {
+	// 🖐️ Call the mcp server
+	slog.Debug("calling the tool", "tool", toolCall.Function.Name)
+	toolResult := ToolResult{
+		Name:      toolCall.Function.Name,
+		Arguments: toolArguments(toolCall),
+	}
+
+	// the progress notifications of the server are sent as events
+	callCtx, done := a.cancellable(ctx)
+	defer done()
+	if a.Approver != nil {
+		callCtx = withAuditDecision(callCtx, AuditApproved)
+	}
+	// the sub-agents take the settings of the agent delegating the task
+	callCtx = context.WithValue(callCtx, parentAgentKey{}, a)
+	callCtx = WithProgress(callCtx, func(progress Progress) {
+		a.emit(Event{Type: EventToolProgress, Tool: toolCall.Function.Name, Content: progress.Message,
+			Progress: progress.Progress, Total: progress.Total})
+	})
+	result, err := a.Registry.CallTool(callCtx, toolCall.Function.Name, toolArguments(toolCall))
+	if err != nil && callCtx.Err() != nil && ctx.Err() == nil {
+		slog.Warn("tool call cancelled by the user", "tool", toolCall.Function.Name)
+		a.emit(Event{Type: EventToolResult, Tool: toolCall.Function.Name, Error: "cancelled"})
+		toolResult.Content = fmt.Sprintf("The user cancelled the tool %s before its end.", toolCall.Function.Name)
+		toolResult.IsError = true
+		return toolResult
+	}
+	if err != nil {
+		slog.Warn("tool call failed", "tool", toolCall.Function.Name, "error", err)
+		a.emit(Event{Type: EventToolResult, Tool: toolCall.Function.Name, Error: err.Error()})
+		toolResult.Content = fmt.Sprintf("The tool %s failed: %v", toolCall.Function.Name, err)
+		toolResult.IsError = true
+		return toolResult
+	}
+
+	content := NormalizeToolResult(result)
+	// the injected instructions are caught before the summary (its model could follow them)
+	content.Text = a.InjectionScanner.Scan(ctx, toolCall.Function.Name, content.Text)
+	content.Text = a.PIIFilter.Mask(content.Text)
+	if result.IsError {
+		// The error is sent to the model so that it can call the tool
+		// again with corrected arguments instead of inventing a result
+		slog.Warn("the tool returned an error", "tool", toolCall.Function.Name, "error", content.Text)
+		a.emit(Event{Type: EventToolResult, Tool: toolCall.Function.Name, Error: content.Text})
+		toolResult.Content = fmt.Sprintf("Error: the tool %s returned an error: %s\n"+
+			"Check the arguments and call the tool again, or tell the user that the tool failed. Do not invent a result.",
+			toolCall.Function.Name, a.ResultLimit.Limit(toolCall.Function.Name, content.Text))
+		toolResult.IsError = true
+		return toolResult
+	}
+	if a.Summarizer.NeedsSummary(content.Text) {
+		slog.Info("summarizing the tool result", "tool", toolCall.Function.Name,
+			"tokens", EstimateTokens(content.Text), "model", a.Summarizer.Model)
+		summary, err := a.Summarizer.Summarize(ctx, toolCall.Function.Name, content.Text)
+		if err != nil {
+			// the result is sent as it is (and truncated if it does not fit in the context window)
+			slog.Warn("failed to summarize the tool result", "tool", toolCall.Function.Name, "error", err)
+		} else {
+			content.Text = summary
+		}
+	}
+	content.Text = a.ResultLimit.Limit(toolCall.Function.Name, content.Text)
+	a.emit(Event{Type: EventToolResult, Tool: toolCall.Function.Name, Content: content.Text})
+	toolResult.Content = content.Text
+	toolResult.Images = content.Images
+	return toolResult
+}
+
+// invalidArguments returns the result of a tool call whose arguments
+// do not follow the input schema of the tool
+func (a *Agent) invalidArguments(toolCall api.ToolCall, err error) ToolResult {
+	slog.Warn("invalid tool arguments", "tool", toolCall.Function.Name, "error", err)
+	a.emit(Event{Type: EventToolResult, Tool: toolCall.Function.Name, Error: err.Error()})
+	return ToolResult{
+		Name:      toolCall.Function.Name,
+		Arguments: toolArguments(toolCall),
+		Content: fmt.Sprintf("Error: invalid arguments for the tool %s:\n%s\n"+
+			"Call the tool again with arguments following its parameters.",
+			toolCall.Function.Name, err),
+		IsError: true,
+	}
+}
+
+func (a *Agent) approve(name string, arguments map[string]interface{}) bool {
+	if a.Approver == nil {
+		return true
+	}
+	server, toolName, ok := a.Registry.server(name)
+	if !ok {
+		// unknown tools are reported by CallTool
+		return true
+	}
+	if !a.Approver.Approve(server, toolName, arguments) {
+		a.Registry.audit.recordCall(withAuditDecision(context.Background(), AuditDenied), server.Name, toolName, arguments, nil, nil, 0, false)
+		return false
+	}
+	return true
+}
+
+// emit is called by the concurrent tool calls: the events are sent one at a time
+func (a *Agent) emit(event Event) {
+	a.eventMu.Lock()
+	defer a.eventMu.Unlock()
+	if a.OnEvent != nil {
+		a.OnEvent(event)
+	}
+}
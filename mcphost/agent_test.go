@@ -0,0 +1,217 @@
+package mcphost
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// newTestOllama returns a client of an Ollama server whose chat answers
+// are the messages of answer, the server is closed at the end of the test
+func newTestOllama(t *testing.T, answer func(request api.ChatRequest) api.Message) *api.Client {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			http.NotFound(w, r)
+			return
+		}
+		var request api.ChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(api.ChatResponse{Model: request.Model, Message: answer(request), Done: true})
+	}))
+	t.Cleanup(server.Close)
+	base, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return api.NewClient(base, server.Client())
+}
+
+// toolCallsAnswer calls the tools for the user prompts, then answers "done"
+func toolCallsAnswer(toolCalls ...api.ToolCall) func(request api.ChatRequest) api.Message {
+	return func(request api.ChatRequest) api.Message {
+		if request.Messages[len(request.Messages)-1].Role == "user" {
+			return api.Message{Role: "assistant", ToolCalls: toolCalls}
+		}
+		return api.Message{Role: "assistant", Content: "done"}
+	}
+}
+
+// testToolCall is a call of a tool requested by the model
+func testToolCall(name string, arguments map[string]interface{}) api.ToolCall {
+	toolCall := api.ToolCall{}
+	toolCall.Function.Name = name
+	toolCall.Function.Arguments = api.NewToolCallFunctionArguments()
+	for key, value := range arguments {
+		toolCall.Function.Arguments.Set(key, value)
+	}
+	return toolCall
+}
+
+// newTestAgent returns an agent with the tools of the test server
+// and the answers of a test Ollama server
+func newTestAgent(t *testing.T, server *testServer, answer func(request api.ChatRequest) api.Message) *Agent {
+	t.Helper()
+	registry, err := NewToolRegistry(context.Background(), Config{
+		MCPServers: map[string]MCPServerConfig{"test": server.config()},
+	})
+	if err != nil {
+		t.Fatalf("NewToolRegistry: %v", err)
+	}
+	t.Cleanup(registry.Close)
+	return &Agent{
+		Ollama:        newTestOllama(t, answer),
+		Registry:      registry,
+		Model:         "test",
+		Tools:         ConvertToOllamaTools(registry.Tools()),
+		MaxIterations: 5,
+	}
+}
+
+func TestAgentConcurrentToolCalls(t *testing.T) {
+	// wait answers "together" when the 2 calls of the answer run at the same time
+	var running sync.WaitGroup
+	running.Add(2)
+	server := newTestServer(t, map[string]testTool{
+		"wait": func(arguments map[string]interface{}) (string, error) {
+			running.Done()
+			together := make(chan struct{})
+			go func() {
+				running.Wait()
+				close(together)
+			}()
+			select {
+			case <-together:
+				return "together", nil
+			case <-time.After(5 * time.Second):
+				return "alone", nil
+			}
+		},
+	})
+	agent := newTestAgent(t, server, toolCallsAnswer(
+		testToolCall("test.wait", map[string]interface{}{"id": 1}),
+		testToolCall("test.wait", map[string]interface{}{"id": 2}),
+	))
+
+	messages, results, err := agent.Run(context.Background(), []api.Message{{Role: "user", Content: "wait twice"}})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("%d tool results, want 2", len(results))
+	}
+	// the results and the tool messages follow the order of the tool calls
+	for i, result := range results {
+		if result.Content != "together" || result.Arguments["id"] != float64(i+1) {
+			t.Errorf("result %d = %+v, want the call %d run together with the other one", i, result, i+1)
+		}
+	}
+	if len(messages) != 5 || messages[2].Role != "tool" || messages[3].Role != "tool" || messages[4].Content != "done" {
+		t.Errorf("messages = %+v, want user, assistant, tool, tool, assistant", messages)
+	}
+}
+
+func TestAgentBudget(t *testing.T) {
+	calls := []api.ToolCall{
+		testToolCall("test.echo", map[string]interface{}{"text": "hello1"}),
+		testToolCall("test.echo", map[string]interface{}{"text": "hello2"}),
+		testToolCall("test.echo", map[string]interface{}{"text": "hello3"}),
+	}
+	tests := []struct {
+		name               string
+		maxIterations      int
+		maxToolCalls       int
+		maxToolOutputBytes int
+		// always calls the tools in every answer of the model
+		always bool
+		err    error
+		// calls are the calls of the server, results the tool results of the run
+		calls   int64
+		results int
+	}{
+		{name: "within the budget", maxIterations: 5, maxToolCalls: 3, maxToolOutputBytes: 18, calls: 3, results: 3},
+		{name: "tool calls", maxIterations: 5, maxToolCalls: 2, err: ErrMaxToolCalls, calls: 2, results: 3},
+		{name: "iterations", maxIterations: 2, always: true, err: ErrMaxIterations, calls: 6, results: 6},
+		{name: "tool output", maxIterations: 5, maxToolOutputBytes: 17, err: ErrMaxToolOutput, calls: 3, results: 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t, map[string]testTool{
+				"echo": func(arguments map[string]interface{}) (string, error) {
+					text, _ := arguments["text"].(string)
+					return text, nil
+				},
+			})
+			answer := toolCallsAnswer(calls...)
+			if test.always {
+				answer = func(request api.ChatRequest) api.Message {
+					return api.Message{Role: "assistant", ToolCalls: calls}
+				}
+			}
+			agent := newTestAgent(t, server, answer)
+			agent.MaxIterations = test.maxIterations
+			agent.MaxToolCalls = test.maxToolCalls
+			agent.MaxToolOutputBytes = test.maxToolOutputBytes
+
+			messages, results, err := agent.Run(context.Background(), []api.Message{{Role: "user", Content: "echo hello"}})
+			if !errors.Is(err, test.err) {
+				t.Fatalf("Run() error = %v, want %v", err, test.err)
+			}
+			if server.calls.Load() != test.calls || len(results) != test.results {
+				t.Errorf("%d calls and %d results, want %d and %d", server.calls.Load(), len(results), test.calls, test.results)
+			}
+			last := messages[len(messages)-1]
+			switch {
+			case test.err == nil && last.Content != "done":
+				t.Errorf("last message = %+v, want the answer of the model", last)
+			case test.err != nil && (last.Role != "system" || !strings.HasPrefix(last.Content, "Budget exceeded")):
+				t.Errorf("last message = %+v, want the budget exceeded message", last)
+			}
+		})
+	}
+}
+
+func TestAgentDuplicateToolCalls(t *testing.T) {
+	server := newTestServer(t, map[string]testTool{
+		"echo": func(arguments map[string]interface{}) (string, error) {
+			text, _ := arguments["text"].(string)
+			return text, nil
+		},
+	})
+	agent := newTestAgent(t, server, toolCallsAnswer(
+		testToolCall("test.echo", map[string]interface{}{"text": "a"}),
+		testToolCall("test.echo", map[string]interface{}{"text": "b"}),
+		// identical to the first call
+		testToolCall("test.echo", map[string]interface{}{"text": "a"}),
+	))
+
+	messages, results, err := agent.Run(context.Background(), []api.Message{{Role: "user", Content: "echo a, b and a"}})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if server.calls.Load() != 2 || len(results) != 2 {
+		t.Errorf("%d calls and %d results, want 2 and 2", server.calls.Load(), len(results))
+	}
+	// the duplicate gets the tool message of its first call
+	var contents []string
+	for _, message := range messages {
+		if message.Role == "tool" {
+			contents = append(contents, message.Content)
+		}
+	}
+	if got := strings.Join(contents, ","); got != "a,b,a" {
+		t.Errorf("tool messages = %s, want a,b,a", got)
+	}
+}
@@ -0,0 +1,182 @@
+package mcphost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/ollama/ollama/api"
+)
+
+// AgentsServerName is the server name of the tools delegating
+// the tasks to the sub-agents
+const AgentsServerName = "agents"
+
+// DefaultAgentTaskTimeout is the timeout of the tasks of the sub-agents
+const DefaultAgentTaskTimeout = 10 * time.Minute
+
+// AgentConfig is a specialized sub-agent: the model calling the tools (the
+// router) delegates tasks to it with the tool agents.<name>, the sub-agent
+// runs its own tool loop and its answer is the result of the tool. The chat
+// model writes the final answer with the results.
+type AgentConfig struct {
+	// Description tells the router what the agent does
+	Description string `json:"description"`
+	// Model of the agent (the tools model by default)
+	Model string `json:"model"`
+	// System is the system prompt of the agent
+	System string `json:"system"`
+	// Tools are the patterns of the namespaced tools of the agent
+	// (e.g. "github.*"), all the tools by default
+	Tools []string `json:"tools"`
+	// MaxIterations of the tool loop of the agent (the one of the host by default)
+	MaxIterations int `json:"maxIterations"`
+}
+
+// parentAgentKey is the context key of the agent calling a tool
+type parentAgentKey struct{}
+
+// validateAgents checks the sub-agents of the config
+func (c Config) validateAgents() error {
+	if len(c.Agents) == 0 {
+		return nil
+	}
+	if _, ok := c.MCPServers[AgentsServerName]; ok {
+		return fmt.Errorf("server %s: the name is used by the sub-agents", AgentsServerName)
+	}
+	for name, agent := range c.Agents {
+		switch {
+		case name == "" || strings.Contains(name, ToolNameSeparator):
+			return fmt.Errorf("agents: invalid name %q", name)
+		case agent.Description == "":
+			return fmt.Errorf("agents: %s: missing description", name)
+		case agent.MaxIterations < 0:
+			return fmt.Errorf("agents: %s: negative maxIterations", name)
+		}
+		for _, pattern := range agent.Tools {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("agents: %s: invalid tool pattern %s", name, pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// registerAgents adds the tools delegating the tasks to the sub-agents
+func (h *Host) registerAgents(agents map[string]AgentConfig) error {
+	if len(agents) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(agents))
+	for name := range agents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	tools := make([]NativeTool, 0, len(agents))
+	for _, name := range names {
+		config := agents[name]
+		tools = append(tools, NativeTool{
+			Tool: mcp.NewTool(name,
+				mcp.WithDescription(fmt.Sprintf("Delegate a task to the agent %s: %s. "+
+					"The agent answers with its result.", name, config.Description)),
+				mcp.WithString("task", mcp.Required(), mcp.Description("the task, with all the details the agent needs")),
+			),
+			Handler: func(ctx context.Context, arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+				task, _ := arguments["task"].(string)
+				return h.delegate(ctx, name, config, task)
+			},
+		})
+	}
+	// the tool calls of the sub-agents are approved, not the delegation
+	config := MCPServerConfig{Approval: ApprovalAllow, Timeouts: Timeouts{CallTool: Duration(DefaultAgentTaskTimeout)}}
+	return h.Registry.RegisterNativeTools(AgentsServerName, config, tools...)
+}
+
+// delegate runs the task with the sub-agent. It uses the settings (approver,
+// events, filters) of the agent calling the tool, the sub-agents can not
+// delegate.
+func (h *Host) delegate(ctx context.Context, name string, config AgentConfig, task string) (*mcp.CallToolResult, error) {
+	parent, ok := ctx.Value(parentAgentKey{}).(*Agent)
+	if !ok {
+		// the tool is not called by an agent (e.g. the call subcommand)
+		parent = h.NewSession().Agent
+	}
+	if len(parent.AllowedTools) > 0 {
+		return nil, errors.New("a sub-agent can not delegate a task")
+	}
+
+	model := config.Model
+	if model == "" {
+		model = parent.Model
+	}
+	maxIterations := config.MaxIterations
+	if maxIterations == 0 {
+		maxIterations = parent.MaxIterations
+	}
+	tools := config.Tools
+	if len(tools) == 0 {
+		tools = []string{"*"}
+	}
+	agent := &Agent{
+		Ollama:           parent.Ollama,
+		Registry:         parent.Registry,
+		Model:            model,
+		Tools:            ConvertToOllamaTools(parent.Registry.Tools()),
+		Options:          h.ModelOptionsOf(model),
+		MaxIterations:    maxIterations,
+		MaxToolCalls:     parent.MaxToolCalls,
+		ResultLimit:      parent.ResultLimit,
+		ChatTimeout:      parent.ChatTimeout,
+		Retry:            parent.Retry,
+		ToolCallMode:     parent.ToolCallMode,
+		Plan:             parent.Plan,
+		Approver:         parent.Approver,
+		Summarizer:       parent.Summarizer,
+		InjectionScanner: parent.InjectionScanner,
+		PIIFilter:        parent.PIIFilter,
+		Metrics:          parent.Metrics,
+		Thinking:         parent.Thinking,
+		OnEvent:          parent.emit,
+		AllowedTools:     append(append([]string{}, tools...), "!"+AgentsServerName+ToolNameSeparator+"*"),
+	}
+
+	slog.Info("task delegated to the agent", "agent", name, "model", model)
+	messages := []api.Message{{Role: "user", Content: task}}
+	if config.System != "" {
+		messages = append([]api.Message{{Role: "system", Content: config.System}}, messages...)
+	}
+	conversation, _, err := agent.Run(ctx, messages)
+	if err != nil && !errors.Is(err, ErrBudgetExceeded) {
+		return nil, fmt.Errorf("agent %s: %w", name, err)
+	}
+	answer := conversation[len(conversation)-1]
+	if answer.Role != "assistant" || len(answer.ToolCalls) > 0 {
+		return mcp.NewToolResultError(fmt.Sprintf("the agent %s did not finish the task: %v", name, err)), nil
+	}
+	return mcp.NewToolResultText(answer.Content), nil
+}
+
+// allowsTool tells if the tool is one of the allowed tools of the agent:
+// the tools matching a pattern and no !pattern (all the tools without patterns)
+func (a *Agent) allowsTool(name string) bool {
+	if len(a.AllowedTools) == 0 {
+		return true
+	}
+	allowed := false
+	for _, pattern := range a.AllowedTools {
+		if excluded, ok := strings.CutPrefix(pattern, "!"); ok {
+			if match, _ := path.Match(excluded, name); match {
+				return false
+			}
+		} else if match, _ := path.Match(pattern, name); match {
+			allowed = true
+		}
+	}
+	return allowed
+}
@@ -0,0 +1,189 @@
+package mcphost
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/ollama/ollama/api"
+)
+
+// ApprovalPolicy tells if a tool can be executed without asking the user
+type ApprovalPolicy string
+
+const (
+	ApprovalAllow ApprovalPolicy = "allow"
+	ApprovalAsk   ApprovalPolicy = "ask"
+	ApprovalDeny  ApprovalPolicy = "deny"
+)
+
+func (p ApprovalPolicy) valid() bool {
+	switch p {
+	case "", ApprovalAllow, ApprovalAsk, ApprovalDeny:
+		return true
+	}
+	return false
+}
+
+// Approver decides if a tool call requested by the model can be executed,
+// using the policies of the server config and asking the user when needed
+type Approver struct {
+	input  *bufio.Scanner
+	output io.Writer
+	// answer, if set, asks the questions instead of input (see NewRemoteApprover)
+	answer func(question string) string
+	// Plain asks the questions without emoji (e.g. for the terminals without emoji fonts)
+	Plain bool
+
+	mu sync.Mutex
+	// tools the user allowed for the rest of the session
+	alwaysAllowed map[string]bool
+}
+
+// NewApprover creates an approver reading the answers of the user from input.
+// Without input (nil), the tools with the "ask" policy are denied.
+func NewApprover(input *bufio.Scanner, output io.Writer) *Approver {
+	return &Approver{
+		input:         input,
+		output:        output,
+		alwaysAllowed: map[string]bool{},
+	}
+}
+
+// NewRemoteApprover creates an approver asking the questions with answer
+// (e.g. to the client of a WebSocket), which returns yes, no or always
+func NewRemoteApprover(answer func(question string) string) *Approver {
+	return &Approver{
+		answer:        answer,
+		alwaysAllowed: map[string]bool{},
+	}
+}
+
+// ApprovalPolicy returns the policy of a tool: the policy of the tool in the
+// server config, then the policy of the server, then the default policy (ask)
+func (c MCPServerConfig) ApprovalPolicy(toolName string) ApprovalPolicy {
+	if policy, ok := c.ToolApprovals[toolName]; ok && policy != "" {
+		return policy
+	}
+	if c.Approval != "" {
+		return c.Approval
+	}
+	return ApprovalAsk
+}
+
+// Approve returns true if the tool call of a server can be executed
+func (a *Approver) Approve(server *MCPServer, toolName string, arguments map[string]interface{}) bool {
+	name := server.Name + ToolNameSeparator + toolName
+
+	switch server.Config.ApprovalPolicy(toolName) {
+	case ApprovalAllow:
+		return true
+	case ApprovalDeny:
+		slog.Warn("tool denied by the config", "tool", name)
+		return false
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.alwaysAllowed[name] {
+		return true
+	}
+	if a.input == nil && a.answer == nil {
+		slog.Warn("tool denied: it needs an approval, but there is nobody to ask", "tool", name)
+		return false
+	}
+
+	jsonArguments, _ := json.Marshal(arguments)
+	return a.ask(name, fmt.Sprintf("Run %s %s?", name, jsonArguments))
+}
+
+// ApproveSampling returns true if the server can ask a completion to the model
+// (the approval policy of the server is used, the last message is shown)
+func (a *Approver) ApproveSampling(server *MCPServer, model string, messages []api.Message) bool {
+	name := server.Name + " sampling"
+
+	switch server.Config.ApprovalPolicy("") {
+	case ApprovalAllow:
+		return true
+	case ApprovalDeny:
+		slog.Warn("sampling denied by the config", "server", server.Name)
+		return false
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.alwaysAllowed[name] {
+		return true
+	}
+	if a.input == nil && a.answer == nil {
+		slog.Warn("sampling denied: it needs an approval, but there is nobody to ask", "server", server.Name)
+		return false
+	}
+
+	prompt := ""
+	if len(messages) > 0 {
+		prompt = messages[len(messages)-1].Content
+	}
+	if len(prompt) > 200 {
+		prompt = prompt[:cutIndex(prompt, 200)] + "..."
+	}
+	return a.ask(name, fmt.Sprintf("Let %s ask %s %q?", server.Name, model, prompt))
+}
+
+// ApprovePlan returns true if the plan of tool calls can be executed
+// (the plan is shown with a plan event before the question)
+func (a *Approver) ApprovePlan(plan string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.alwaysAllowed[planApprovalName] {
+		return true
+	}
+	if a.input == nil && a.answer == nil {
+		slog.Warn("plan denied: it needs an approval, but there is nobody to ask")
+		return false
+	}
+	return a.ask(planApprovalName, fmt.Sprintf("Execute the plan of %d steps?", strings.Count(plan, "\n")))
+}
+
+// prefix starts the questions to the user
+func (a *Approver) prefix() string {
+	if a.Plain {
+		return "question: "
+	}
+	return "🖐️ "
+}
+
+// ask asks the user a question until a valid answer (a.mu is locked),
+// "always" allows name for the rest of the session
+func (a *Approver) ask(name string, question string) bool {
+	if a.answer != nil {
+		switch a.answer(question) {
+		case "yes":
+			return true
+		case "always":
+			a.alwaysAllowed[name] = true
+			return true
+		}
+		return false
+	}
+	for {
+		fmt.Fprintf(a.output, "%s%s [y]es / [n]o / [a]lways: ", a.prefix(), question)
+		if !a.input.Scan() {
+			fmt.Fprintln(a.output)
+			return false
+		}
+		switch strings.ToLower(strings.TrimSpace(a.input.Text())) {
+		case "y", "yes":
+			return true
+		case "n", "no":
+			return false
+		case "a", "always":
+			a.alwaysAllowed[name] = true
+			return true
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package mcphost
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Approval decisions of the audit records
+const (
+	// AuditApproved calls were approved by the approver (the user or the config)
+	AuditApproved = "approved"
+	// AuditDenied calls were denied by the approver: they are not executed
+	AuditDenied = "denied"
+	// AuditPolicyDenied calls were denied by the tool policy
+	AuditPolicyDenied = "policy_denied"
+	// AuditUnchecked calls are executed without approver
+	// (e.g. the call subcommand, the gateway)
+	AuditUnchecked = "unchecked"
+)
+
+// AuditRecord is a line of the audit log: a tool invocation
+type AuditRecord struct {
+	Time   time.Time `json:"time"`
+	Server string    `json:"server"`
+	Tool   string    `json:"tool"`
+	// ArgumentsHash and ResultHash are the SHA-256 of the JSON of the
+	// arguments and of the result (the contents are not in the log)
+	ArgumentsHash string `json:"argumentsHash"`
+	ResultHash    string `json:"resultHash,omitempty"`
+	// DurationMs is the duration of the call in milliseconds
+	DurationMs float64 `json:"durationMs"`
+	Decision   string  `json:"decision"`
+	// Cached tells that the result came from the cache of the host
+	Cached  bool   `json:"cached,omitempty"`
+	IsError bool   `json:"isError,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// AuditLog is an append-only JSONL file of the tool invocations
+type AuditLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// auditDecisionKey is the context key of the approval decision of a call
+type auditDecisionKey struct{}
+
+// withAuditDecision returns a context with the approval decision
+// of the tool call, for its audit record
+func withAuditDecision(ctx context.Context, decision string) context.Context {
+	return context.WithValue(ctx, auditDecisionKey{}, decision)
+}
+
+// OpenAuditLog opens the audit log (the file is created if needed, the
+// records are always appended)
+func OpenAuditLog(path string) (*AuditLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the audit log: %w", err)
+	}
+	return &AuditLog{file: file}, nil
+}
+
+// Record appends the record of a tool invocation (a nil log records nothing)
+func (l *AuditLog) Record(record AuditRecord) {
+	if l == nil {
+		return
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// a record is written at once, the concurrent processes do not mix their lines
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		slog.Error("failed to write the audit log", "tool", record.Server+ToolNameSeparator+record.Tool, "error", err)
+	}
+}
+
+// Close closes the file of the log
+func (l *AuditLog) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// recordCall appends the record of a tool call of the server, the decision
+// is the one of the context (AuditUnchecked without decision)
+func (l *AuditLog) recordCall(ctx context.Context, server string, tool string, arguments map[string]interface{},
+	result *mcp.CallToolResult, err error, duration time.Duration, cached bool) {
+	if l == nil {
+		return
+	}
+	decision, ok := ctx.Value(auditDecisionKey{}).(string)
+	if !ok {
+		decision = AuditUnchecked
+	}
+	record := AuditRecord{
+		Time:          time.Now().UTC(),
+		Server:        server,
+		Tool:          tool,
+		ArgumentsHash: auditHash(arguments),
+		DurationMs:    float64(duration.Microseconds()) / 1000,
+		Decision:      decision,
+		Cached:        cached,
+	}
+	switch {
+	case err != nil:
+		record.Error = err.Error()
+	case result != nil:
+		record.ResultHash = auditHash(result)
+		record.IsError = result.IsError
+	}
+	l.Record(record)
+}
+
+// auditHash returns the SHA-256 of the JSON of the value
+// (the keys of the maps are sorted: the hash does not depend on their order)
+func auditHash(value interface{}) string {
+	data, _ := json.Marshal(value)
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
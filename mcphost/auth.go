@@ -0,0 +1,284 @@
+package mcphost
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ServerConfig is the setting of the HTTP server of the serve mode
+type ServerConfig struct {
+	// APIKeys protect the API: the requests need one of the keys as bearer
+	// token (without keys, the API is open)
+	APIKeys []APIKeyConfig `json:"apiKeys"`
+	// Hooks are the webhook triggers by name (see HookConfig)
+	Hooks map[string]HookConfig `json:"hooks"`
+	// AllowedOrigins are the origins (e.g. "https://chat.example.com") of the
+	// web pages allowed to call the API besides the pages of the server
+	AllowedOrigins []string `json:"allowedOrigins"`
+}
+
+// APIKeyConfig is an API key of the HTTP server
+type APIKeyConfig struct {
+	// Name identifies the key in the logs
+	Name string `json:"name"`
+	// Key is the bearer token, KeyEnv is the environment variable holding it
+	Key    string `json:"key"`
+	KeyEnv string `json:"keyEnv"`
+	// RequestsPerMinute limits the requests and the prompts of the WebSockets,
+	// TokensPerMinute limits the (estimated) tokens of the prompts and the answers
+	// (0 means no limit)
+	RequestsPerMinute int `json:"requestsPerMinute"`
+	TokensPerMinute   int `json:"tokensPerMinute"`
+}
+
+// Token returns the bearer token of the key (KeyEnv wins over Key)
+func (k APIKeyConfig) Token() string {
+	if k.KeyEnv != "" {
+		if key := os.Getenv(k.KeyEnv); key != "" {
+			return key
+		}
+	}
+	return k.Key
+}
+
+// validate checks the API keys of the config
+func (c ServerConfig) validate() error {
+	names := map[string]bool{}
+	for _, key := range c.APIKeys {
+		switch {
+		case key.Name == "":
+			return fmt.Errorf("API key without name")
+		case names[key.Name]:
+			return fmt.Errorf("API key %s declared twice", key.Name)
+		case key.Token() == "":
+			return fmt.Errorf("API key %s: missing key", key.Name)
+		case key.RequestsPerMinute < 0 || key.TokensPerMinute < 0:
+			return fmt.Errorf("API key %s: negative limit", key.Name)
+		}
+		names[key.Name] = true
+	}
+	for _, origin := range c.AllowedOrigins {
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" {
+			return fmt.Errorf("allowed origin %q: scheme://host[:port] expected", origin)
+		}
+	}
+	return c.validateHooks()
+}
+
+// OriginCheck rejects the requests sent by the web pages of other origins (403):
+// without it, any page opened in a browser of the network could send prompts
+// to the server and approve the tools over a WebSocket. The requests without
+// Origin header (curl, the SDKs) are not browser requests.
+func OriginCheck(allowedOrigins []string, next http.Handler) http.Handler {
+	allowed := map[string]bool{}
+	for _, origin := range allowedOrigins {
+		allowed[strings.ToLower(strings.TrimSuffix(origin, "/"))] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin != "" && !sameOrigin(origin, r.Host) && !allowed[strings.ToLower(origin)] {
+			slog.Warn("request of another origin", "origin", origin, "path", r.URL.Path, "remote", r.RemoteAddr)
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// sameOrigin tells if the origin is the host of the request
+func sameOrigin(origin string, host string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && strings.EqualFold(u.Host, host)
+}
+
+// APIKeyAuth checks the bearer tokens of the requests of the HTTP server
+// and the rate limits of their keys
+type APIKeyAuth struct {
+	keys []*apiKey
+}
+
+// apiKey is a key with the state of its limits
+type apiKey struct {
+	name     string
+	token    []byte
+	requests *rateLimit
+	tokens   *rateLimit
+}
+
+// apiKeyKey is the context key of the API key of a request
+type apiKeyKey struct{}
+
+// NewAPIKeyAuth creates the authentication of the keys, nil without keys
+func NewAPIKeyAuth(config ServerConfig) *APIKeyAuth {
+	if len(config.APIKeys) == 0 {
+		return nil
+	}
+	auth := &APIKeyAuth{}
+	for _, key := range config.APIKeys {
+		auth.keys = append(auth.keys, &apiKey{
+			name:     key.Name,
+			token:    []byte(key.Token()),
+			requests: newRateLimit(key.RequestsPerMinute),
+			tokens:   newRateLimit(key.TokensPerMinute),
+		})
+	}
+	return auth
+}
+
+// Handler rejects the requests without a valid key (401) and the requests
+// over the limits of their key (429). The token is the bearer token of the
+// Authorization header, or the access_token parameter (for the WebSockets
+// of the browsers).
+func (a *APIKeyAuth) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := a.key(r)
+		if key == nil {
+			slog.Warn("request without a valid API key", "path", r.URL.Path, "remote", r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "a valid API key is required", http.StatusUnauthorized)
+			return
+		}
+		if wait := key.limited(); wait > 0 {
+			slog.Warn("API key over its limits", "key", key.name, "path", r.URL.Path)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyKey{}, key)))
+	})
+}
+
+// key returns the key of the token of the request (nil when it is unknown)
+func (a *APIKeyAuth) key(r *http.Request) *apiKey {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		token = r.URL.Query().Get("access_token")
+	}
+	if token == "" {
+		return nil
+	}
+	for _, key := range a.keys {
+		if subtle.ConstantTimeCompare(key.token, []byte(token)) == 1 {
+			return key
+		}
+	}
+	return nil
+}
+
+// limited takes a request of the key, it returns how long to wait
+// when the key is over its limits (0 when the request is allowed)
+func (k *apiKey) limited() time.Duration {
+	if wait := k.tokens.wait(); wait > 0 {
+		return wait
+	}
+	return k.requests.take(1)
+}
+
+// apiKeyName returns the name of the API key of the context
+// (empty without keys)
+func apiKeyName(ctx context.Context) string {
+	if key, ok := ctx.Value(apiKeyKey{}).(*apiKey); ok {
+		return key.name
+	}
+	return ""
+}
+
+// rateLimited takes a request (e.g. a prompt of a WebSocket) of the key
+// of the context, it returns an error when the key is over its limits
+func rateLimited(ctx context.Context) error {
+	key, ok := ctx.Value(apiKeyKey{}).(*apiKey)
+	if !ok {
+		return nil
+	}
+	if wait := key.limited(); wait > 0 {
+		return fmt.Errorf("rate limit exceeded, retry in %s", wait.Round(time.Second))
+	}
+	return nil
+}
+
+// useTokens counts the tokens of a turn in the limit of the key of the context
+func useTokens(ctx context.Context, texts ...string) {
+	key, ok := ctx.Value(apiKeyKey{}).(*apiKey)
+	if !ok {
+		return
+	}
+	tokens := 0
+	for _, text := range texts {
+		tokens += EstimateTokens(text)
+	}
+	key.tokens.use(tokens)
+}
+
+// rateLimit is a token bucket refilled with perMinute units per minute
+// (nil means no limit)
+type rateLimit struct {
+	mu        sync.Mutex
+	perMinute float64
+	available float64
+	last      time.Time
+}
+
+func newRateLimit(perMinute int) *rateLimit {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &rateLimit{perMinute: float64(perMinute), available: float64(perMinute), last: time.Now()}
+}
+
+// refill adds the units of the time since the last refill (l.mu is locked)
+func (l *rateLimit) refill() {
+	now := time.Now()
+	l.available = min(l.perMinute, l.available+now.Sub(l.last).Minutes()*l.perMinute)
+	l.last = now
+}
+
+// take takes n units, it returns how long to wait when they are not available
+func (l *rateLimit) take(n float64) time.Duration {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill()
+	if l.available < n {
+		return time.Duration((n - l.available) / l.perMinute * float64(time.Minute))
+	}
+	l.available -= n
+	return 0
+}
+
+// wait returns how long to wait until units are available
+// (the bucket is negative after a turn larger than the available units)
+func (l *rateLimit) wait() time.Duration {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill()
+	if l.available > 0 {
+		return 0
+	}
+	return time.Duration((1 - l.available) / l.perMinute * float64(time.Minute))
+}
+
+// use removes units already used (the bucket can become negative)
+func (l *rateLimit) use(n int) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill()
+	l.available -= float64(n)
+}
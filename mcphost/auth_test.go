@@ -0,0 +1,158 @@
+package mcphost
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serveAuth sends a request with the token (as a bearer token, or the
+// access_token parameter when query is true) to a handler protected by auth,
+// the handler answers with the name of the key
+func serveAuth(auth *APIKeyAuth, token string, query bool) *httptest.ResponseRecorder {
+	handler := auth.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(apiKeyName(r.Context())))
+	}))
+	target := "/chat"
+	if query {
+		target += "?access_token=" + token
+	}
+	request := httptest.NewRequest(http.MethodPost, target, nil)
+	if !query && token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	auth := NewAPIKeyAuth(ServerConfig{APIKeys: []APIKeyConfig{
+		{Name: "alice", Key: "secret-a"},
+		{Name: "bob", Key: "secret-b"},
+	}})
+	tests := []struct {
+		name   string
+		token  string
+		query  bool
+		status int
+		key    string
+	}{
+		{name: "bearer token", token: "secret-b", status: http.StatusOK, key: "bob"},
+		{name: "access_token parameter", token: "secret-a", query: true, status: http.StatusOK, key: "alice"},
+		{name: "no token", status: http.StatusUnauthorized},
+		{name: "unknown token", token: "secret-c", status: http.StatusUnauthorized},
+		{name: "prefix of a token", token: "secret", status: http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := serveAuth(auth, test.token, test.query)
+			if recorder.Code != test.status {
+				t.Fatalf("status = %d, want %d", recorder.Code, test.status)
+			}
+			if test.status == http.StatusUnauthorized && recorder.Header().Get("WWW-Authenticate") != "Bearer" {
+				t.Errorf("WWW-Authenticate = %q, want Bearer", recorder.Header().Get("WWW-Authenticate"))
+			}
+			if test.status == http.StatusOK && recorder.Body.String() != test.key {
+				t.Errorf("key of the request = %q, want %s", recorder.Body.String(), test.key)
+			}
+		})
+	}
+
+	if NewAPIKeyAuth(ServerConfig{}) != nil {
+		t.Error("NewAPIKeyAuth without keys: nil expected")
+	}
+}
+
+func TestAPIKeyAuthRequestsPerMinute(t *testing.T) {
+	auth := NewAPIKeyAuth(ServerConfig{APIKeys: []APIKeyConfig{
+		{Name: "alice", Key: "secret-a", RequestsPerMinute: 2},
+		{Name: "bob", Key: "secret-b"},
+	}})
+	for i := 0; i < 2; i++ {
+		if recorder := serveAuth(auth, "secret-a", false); recorder.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want 200", i+1, recorder.Code)
+		}
+	}
+	recorder := serveAuth(auth, "secret-a", false)
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Fatalf("request over the limit: status = %d, want 429", recorder.Code)
+	}
+	// a request comes back every 30 seconds
+	if retry := recorder.Header().Get("Retry-After"); retry != "30" {
+		t.Errorf("Retry-After = %q, want 30", retry)
+	}
+	// the limits are per key
+	if recorder := serveAuth(auth, "secret-b", false); recorder.Code != http.StatusOK {
+		t.Errorf("other key: status = %d, want 200", recorder.Code)
+	}
+}
+
+func TestAPIKeyAuthTokensPerMinute(t *testing.T) {
+	auth := NewAPIKeyAuth(ServerConfig{APIKeys: []APIKeyConfig{
+		{Name: "alice", Key: "secret-a", TokensPerMinute: 100},
+	}})
+	handler := auth.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// a turn larger than the limit
+		useTokens(r.Context(), strings.Repeat("word ", 200))
+	}))
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		request := httptest.NewRequest(http.MethodPost, "/chat", nil)
+		request.Header.Set("Authorization", "Bearer secret-a")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if recorder.Code != want {
+			t.Errorf("request %d: status = %d, want %d", i+1, recorder.Code, want)
+		}
+	}
+}
+
+func TestServerConfigValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config ServerConfig
+		valid  bool
+	}{
+		{name: "keys and origins", config: ServerConfig{
+			APIKeys:        []APIKeyConfig{{Name: "alice", Key: "a", RequestsPerMinute: 10}},
+			AllowedOrigins: []string{"https://chat.example.com"},
+		}, valid: true},
+		{name: "key without name", config: ServerConfig{APIKeys: []APIKeyConfig{{Key: "a"}}}},
+		{name: "key declared twice", config: ServerConfig{APIKeys: []APIKeyConfig{{Name: "a", Key: "a"}, {Name: "a", Key: "b"}}}},
+		{name: "missing key", config: ServerConfig{APIKeys: []APIKeyConfig{{Name: "a", KeyEnv: "MCPHOST_TEST_UNSET_KEY"}}}},
+		{name: "negative limit", config: ServerConfig{APIKeys: []APIKeyConfig{{Name: "a", Key: "a", TokensPerMinute: -1}}}},
+		{name: "origin with a path", config: ServerConfig{AllowedOrigins: []string{"https://chat.example.com/app"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.config.validate(); (err == nil) != test.valid {
+				t.Errorf("validate() = %v, want valid %v", err, test.valid)
+			}
+		})
+	}
+}
+
+func TestOriginCheck(t *testing.T) {
+	handler := OriginCheck([]string{"https://chat.example.com/"}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tests := []struct {
+		origin string
+		status int
+	}{
+		{origin: "", status: http.StatusOK},
+		{origin: "http://localhost:8080", status: http.StatusOK},
+		{origin: "https://chat.example.com", status: http.StatusOK},
+		{origin: "https://evil.example.com", status: http.StatusForbidden},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest(http.MethodPost, "http://localhost:8080/chat", nil)
+		if test.origin != "" {
+			request.Header.Set("Origin", test.origin)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if recorder.Code != test.status {
+			t.Errorf("Origin %q: status = %d, want %d", test.origin, recorder.Code, test.status)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package mcphost
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// BackoffPolicy tells how the failed requests to Ollama are retried:
+// the delay doubles after each attempt, up to MaxDelay, with a random jitter.
+// Only the transient errors are retried (connection errors, 429 and 5xx
+// statuses, e.g. while a model is loading).
+type BackoffPolicy struct {
+	// MaxAttempts is the maximum number of attempts of a request (0 or 1: no retry)
+	MaxAttempts  int      `json:"maxAttempts"`
+	InitialDelay Duration `json:"initialDelay"`
+	MaxDelay     Duration `json:"maxDelay"`
+}
+
+// DefaultOllamaRetry is used when the config has no ollamaRetry
+var DefaultOllamaRetry = BackoffPolicy{
+	MaxAttempts:  3,
+	InitialDelay: Duration(500 * time.Millisecond),
+	MaxDelay:     Duration(10 * time.Second),
+}
+
+// delay returns the wait before the attempt following attempt (1 for the first one):
+// between half and all of the exponential delay
+func (p BackoffPolicy) delay(attempt int) time.Duration {
+	delay := time.Duration(p.InitialDelay)
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || delay < time.Duration(p.MaxDelay)); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 {
+		delay = min(delay, time.Duration(p.MaxDelay))
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// retry runs request until it succeeds, fails with an error which is not
+// retryable, the attempts are exhausted or ctx is cancelled
+func (p BackoffPolicy) retry(ctx context.Context, operation string, request func() error, retryable func(error) bool) error {
+	for attempt := 1; ; attempt++ {
+		err := request()
+		if err == nil || attempt >= p.MaxAttempts || ctx.Err() != nil || !retryable(err) {
+			return err
+		}
+		delay := p.delay(attempt)
+		slog.Warn("ollama request failed, retrying", "operation", operation,
+			"attempt", attempt, "max", p.MaxAttempts, "delay", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// transientOllamaMessages are the messages of the Ollama errors which can
+// be retried: the client only returns the message of an error with a body
+// (the status is lost)
+var transientOllamaMessages = []string{
+	"server busy",
+	"llama runner",
+	"timed out waiting",
+	"connection reset",
+}
+
+// transientOllamaError tells if a request to Ollama can succeed when retried
+func transientOllamaError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var statusErr api.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	message := strings.ToLower(err.Error())
+	for _, transient := range transientOllamaMessages {
+		if strings.Contains(message, transient) {
+			return true
+		}
+	}
+	return false
+}
+
+// chatWithRetry sends a chat request with the retry policy.
+// A streamed completion is not retried once a response has been received
+// (the tokens are already sent to fn).
+func chatWithRetry(ctx context.Context, ollama *api.Client, policy BackoffPolicy, req *api.ChatRequest, fn api.ChatResponseFunc) error {
+	received := false
+	return policy.retry(ctx, "chat "+req.Model, func() error {
+		return ollama.Chat(ctx, req, func(resp api.ChatResponse) error {
+			received = true
+			return fn(resp)
+		})
+	}, func(err error) bool {
+		return !received && transientOllamaError(err)
+	})
+}
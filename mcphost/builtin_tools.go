@@ -0,0 +1,300 @@
+package mcphost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// BuiltinServerName is the server name of the built-in tools
+// (e.g. "builtin.current_time")
+const BuiltinServerName = "builtin"
+
+// maxReadFileSize is the size limit of the files read by read_file
+const maxReadFileSize = 1 << 20
+
+// BuiltinTools returns the built-in tools of the host:
+//   - current_time: the date and time, in a time zone;
+//   - calculate: the value of an arithmetic expression;
+//   - read_file: the content of a text file of the root directory.
+func BuiltinTools(root string) []NativeTool {
+	return []NativeTool{
+		{
+			Tool: mcp.NewTool("current_time",
+				mcp.WithDescription("Get the current date and time"),
+				mcp.WithString("timezone", mcp.Description("IANA time zone, e.g. Europe/Paris (local time by default)")),
+			),
+			Handler: currentTime,
+		},
+		{
+			Tool: mcp.NewTool("calculate",
+				mcp.WithDescription("Compute an arithmetic expression with + - * / % ^, parentheses and the functions sqrt, abs, round, floor and ceil"),
+				mcp.WithString("expression", mcp.Required(), mcp.Description("the expression, e.g. (2 + 3) * sqrt(16)")),
+			),
+			Handler: calculate,
+		},
+		{
+			Tool: mcp.NewTool("read_file",
+				mcp.WithDescription("Read a local text file"),
+				mcp.WithString("path", mcp.Required(), mcp.Description("relative path of the file")),
+			),
+			Handler: func(ctx context.Context, arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+				return readFile(root, arguments)
+			},
+		},
+	}
+}
+
+func currentTime(ctx context.Context, arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	location := time.Local
+	if name, _ := arguments["timezone"].(string); name != "" {
+		var err error
+		if location, err = time.LoadLocation(name); err != nil {
+			return nil, fmt.Errorf("unknown time zone %s", name)
+		}
+	}
+	now := time.Now().In(location)
+	return mcp.NewToolResultText(now.Format("Monday, 2 January 2006 15:04:05 MST (2006-01-02T15:04:05Z07:00)")), nil
+}
+
+func calculate(ctx context.Context, arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	expression, _ := arguments["expression"].(string)
+	value, err := evaluate(expression)
+	if err != nil {
+		return nil, err
+	}
+	return mcp.NewToolResultText(strconv.FormatFloat(value, 'g', -1, 64)), nil
+}
+
+// readFile reads a text file of the root directory (the files outside
+// of the root, through ".." or a symbolic link, cannot be read)
+func readFile(root string, arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	path, _ := arguments["path"].(string)
+	if !filepath.IsLocal(path) {
+		return nil, fmt.Errorf("%s is outside of the readable directory", path)
+	}
+	if root == "" {
+		root = "."
+	}
+	absoluteRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, err
+	}
+	absoluteRoot, err = filepath.Abs(absoluteRoot)
+	if err != nil {
+		return nil, err
+	}
+	file, err := filepath.EvalSymlinks(filepath.Join(absoluteRoot, path))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s: %w", path, errors.Unwrap(err))
+	}
+	if relative, err := filepath.Rel(absoluteRoot, file); err != nil || !filepath.IsLocal(relative) {
+		return nil, fmt.Errorf("%s is outside of the readable directory", path)
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s: %w", path, errors.Unwrap(err))
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", path)
+	}
+	if info.Size() > maxReadFileSize {
+		return nil, fmt.Errorf("%s is too large (%d bytes, at most %d)", path, info.Size(), maxReadFileSize)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s: %w", path, errors.Unwrap(err))
+	}
+	if !utf8.Valid(data) {
+		return nil, fmt.Errorf("%s is not a text file", path)
+	}
+	return mcp.NewToolResultText(string(data)), nil
+}
+
+// evaluate computes an arithmetic expression
+func evaluate(expression string) (float64, error) {
+	parser := &expressionParser{input: expression}
+	value, err := parser.expression()
+	if err != nil {
+		return 0, err
+	}
+	parser.skipSpaces()
+	if parser.position < len(parser.input) {
+		return 0, fmt.Errorf("unexpected %q at position %d", parser.input[parser.position:], parser.position+1)
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, errors.New("the result is not a number (division by zero?)")
+	}
+	return value, nil
+}
+
+// expressionParser is a recursive descent parser of the expressions:
+//
+//	expression = term { ("+" | "-") term }
+//	term       = unary { ("*" | "/" | "%") unary }
+//	unary      = ("-" | "+") unary | power
+//	power      = primary [ "^" unary ]
+//	primary    = number | "(" expression ")" | function "(" expression ")"
+type expressionParser struct {
+	input    string
+	position int
+}
+
+var expressionFunctions = map[string]func(float64) float64{
+	"sqrt":  math.Sqrt,
+	"abs":   math.Abs,
+	"round": math.Round,
+	"floor": math.Floor,
+	"ceil":  math.Ceil,
+}
+
+func (p *expressionParser) skipSpaces() {
+	for p.position < len(p.input) && p.input[p.position] == ' ' {
+		p.position++
+	}
+}
+
+// accept consumes the operator if it is the next character
+func (p *expressionParser) accept(operator byte) bool {
+	p.skipSpaces()
+	if p.position < len(p.input) && p.input[p.position] == operator {
+		p.position++
+		return true
+	}
+	return false
+}
+
+func (p *expressionParser) expression() (float64, error) {
+	value, err := p.term()
+	for err == nil {
+		var right float64
+		switch {
+		case p.accept('+'):
+			right, err = p.term()
+			value += right
+		case p.accept('-'):
+			right, err = p.term()
+			value -= right
+		default:
+			return value, nil
+		}
+	}
+	return 0, err
+}
+
+func (p *expressionParser) term() (float64, error) {
+	value, err := p.unary()
+	for err == nil {
+		var right float64
+		switch {
+		case p.accept('*'):
+			right, err = p.unary()
+			value *= right
+		case p.accept('/'):
+			right, err = p.unary()
+			value /= right
+		case p.accept('%'):
+			right, err = p.unary()
+			value = math.Mod(value, right)
+		default:
+			return value, nil
+		}
+	}
+	return 0, err
+}
+
+func (p *expressionParser) power() (float64, error) {
+	value, err := p.primary()
+	if err != nil {
+		return 0, err
+	}
+	if p.accept('^') {
+		exponent, err := p.unary()
+		if err != nil {
+			return 0, err
+		}
+		return math.Pow(value, exponent), nil
+	}
+	return value, nil
+}
+
+func (p *expressionParser) unary() (float64, error) {
+	if p.accept('-') {
+		value, err := p.unary()
+		return -value, err
+	}
+	if p.accept('+') {
+		return p.unary()
+	}
+	return p.power()
+}
+
+func (p *expressionParser) primary() (float64, error) {
+	if p.accept('(') {
+		value, err := p.expression()
+		if err != nil {
+			return 0, err
+		}
+		if !p.accept(')') {
+			return 0, fmt.Errorf("missing ) at position %d", p.position+1)
+		}
+		return value, nil
+	}
+
+	p.skipSpaces()
+	start := p.position
+	for p.position < len(p.input) && (isNumberOrName(rune(p.input[p.position])) || p.exponentSign(start)) {
+		p.position++
+	}
+	token := p.input[start:p.position]
+	if token == "" {
+		if p.position >= len(p.input) {
+			return 0, errors.New("unexpected end of the expression")
+		}
+		return 0, fmt.Errorf("unexpected %q at position %d", p.input[p.position], p.position+1)
+	}
+
+	if function, ok := expressionFunctions[token]; ok {
+		if !p.accept('(') {
+			return 0, fmt.Errorf("missing ( after %s", token)
+		}
+		argument, err := p.expression()
+		if err != nil {
+			return 0, err
+		}
+		if !p.accept(')') {
+			return 0, fmt.Errorf("missing ) at position %d", p.position+1)
+		}
+		return function(argument), nil
+	}
+	value, err := strconv.ParseFloat(token, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %s", token)
+	}
+	return value, nil
+}
+
+func isNumberOrName(r rune) bool {
+	return unicode.IsDigit(r) || unicode.IsLetter(r) || r == '.' || r == '_'
+}
+
+// exponentSign tells if the next character is the sign of the exponent
+// of the number starting at start (e.g. the - of 2e-3)
+func (p *expressionParser) exponentSign(start int) bool {
+	sign, token := p.input[p.position], p.input[start:p.position]
+	if (sign != '-' && sign != '+') || token == "" || (token[0] != '.' && !unicode.IsDigit(rune(token[0]))) {
+		return false
+	}
+	last := token[len(token)-1]
+	return last == 'e' || last == 'E'
+}
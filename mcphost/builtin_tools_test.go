@@ -0,0 +1,106 @@
+package mcphost
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       float64
+		err        string
+	}{
+		{expression: "1 + 2 * 3", want: 7},
+		{expression: "(1 + 2) * 3", want: 9},
+		{expression: "10 - 4 - 3", want: 3},
+		{expression: "2 ^ 3 ^ 2", want: 512},
+		{expression: "-2 ^ 2", want: -4},
+		{expression: "2 * -3", want: -6},
+		{expression: "--3", want: 3},
+		{expression: "10 % 4", want: 2},
+		{expression: "sqrt(16) + abs(-2)", want: 6},
+		{expression: "round(2.5) * floor(1.9) + ceil(0.1)", want: 4},
+		{expression: "2e-3 * 1000", want: 2},
+		{expression: "1.5E+2 - 1e2", want: 50},
+		{expression: ".5e1", want: 5},
+		{expression: "1 / 0", err: "the result is not a number (division by zero?)"},
+		{expression: "0 / 0", err: "the result is not a number (division by zero?)"},
+		{expression: "2 +", err: "unexpected end of the expression"},
+		{expression: "(1 + 2", err: "missing ) at position 7"},
+		{expression: "sqrt 4", err: "missing ( after sqrt"},
+		{expression: "pow(2)", err: "invalid number pow"},
+		{expression: "2e", err: "invalid number 2e"},
+		{expression: "2 3", err: `unexpected "3" at position 3`},
+	}
+	for _, test := range tests {
+		t.Run(test.expression, func(t *testing.T) {
+			got, err := evaluate(test.expression)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Errorf("evaluate(%q) = %v, %v, want error %q", test.expression, got, err, test.err)
+				}
+				return
+			}
+			if err != nil || got != test.want {
+				t.Errorf("evaluate(%q) = %v, %v, want %v", test.expression, got, err, test.want)
+			}
+		})
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	root, outside := t.TempDir(), t.TempDir()
+	files := map[string]string{
+		filepath.Join(root, "notes.txt"):         "inside",
+		filepath.Join(root, "docs", "readme.md"): "nested",
+		filepath.Join(outside, "secret.txt"):     "secret",
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(root, "escape.txt")); err != nil {
+		t.Skipf("symbolic links are not supported: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(root, "notes.txt"), filepath.Join(root, "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want string
+		err  string
+	}{
+		{name: "file of the root", path: "notes.txt", want: "inside"},
+		{name: "nested file", path: "docs/readme.md", want: "nested"},
+		{name: "link inside of the root", path: "link.txt", want: "inside"},
+		{name: "parent directory", path: "../" + filepath.Base(outside) + "/secret.txt", err: "outside of the readable directory"},
+		{name: "dot dot in the path", path: "docs/../../secret.txt", err: "outside of the readable directory"},
+		{name: "absolute path", path: filepath.Join(outside, "secret.txt"), err: "outside of the readable directory"},
+		{name: "link outside of the root", path: "escape.txt", err: "outside of the readable directory"},
+		{name: "directory", path: "docs", err: "is a directory"},
+		{name: "missing file", path: "missing.txt", err: "cannot read missing.txt"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := readFile(root, map[string]interface{}{"path": test.path})
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("readFile(%s) = %+v, %v, want an error with %q", test.path, result, err, test.err)
+				}
+				return
+			}
+			if err != nil || NormalizeToolResult(result).Text != test.want {
+				t.Errorf("readFile(%s) = %+v, %v, want %q", test.path, result, err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+package mcphost
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Cassette is the recording of the MCP interactions of the servers
+// (initialize, tools/list and the tools/call request/response pairs),
+// saved as a JSON file. In record mode, the clients of the servers write
+// in the cassette; in replay mode, the cassette answers instead of the servers
+// (offline demos and deterministic tests, without docker or network).
+type Cassette struct {
+	Servers map[string]*CassetteServer `json:"servers"`
+
+	path string
+	mu   sync.Mutex
+	// replayed counts the replays of each recorded call
+	replayed map[*CassetteCall]int
+}
+
+// CassetteServer is the recording of a server
+type CassetteServer struct {
+	Initialize *mcp.InitializeResult `json:"initialize"`
+	Tools      *mcp.ListToolsResult  `json:"tools"`
+	Calls      []*CassetteCall       `json:"calls"`
+}
+
+// CassetteCall is a tool call and its result (or its error)
+type CassetteCall struct {
+	Tool      string                 `json:"tool"`
+	Arguments map[string]interface{} `json:"arguments"`
+	Result    *mcp.CallToolResult    `json:"result,omitempty"`
+	Error     string                 `json:"error,omitempty"`
+}
+
+// NewCassette creates an empty cassette saved in path after each recorded interaction
+func NewCassette(path string) *Cassette {
+	return &Cassette{Servers: map[string]*CassetteServer{}, path: path}
+}
+
+// LoadCassette reads a recorded cassette
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cassette := NewCassette(path)
+	if err := json.Unmarshal(data, cassette); err != nil {
+		return nil, fmt.Errorf("invalid cassette %s: %w", path, err)
+	}
+	return cassette, nil
+}
+
+// record updates the recording of a server and saves the cassette
+func (c *Cassette) record(name string, update func(server *CassetteServer)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	server, ok := c.Servers[name]
+	if !ok {
+		server = &CassetteServer{}
+		c.Servers[name] = server
+	}
+	update(server)
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, data, 0o644)
+}
+
+// server returns the recording of a server
+func (c *Cassette) server(name string) (*CassetteServer, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	server, ok := c.Servers[name]
+	return server, ok
+}
+
+// replay returns the recorded call of the tool with the same arguments:
+// the identical calls are replayed in the order of the recording,
+// the last one is replayed again when they are all used
+func (c *Cassette) replay(name string, tool string, arguments map[string]interface{}) (*CassetteCall, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	server, ok := c.Servers[name]
+	if !ok {
+		return nil, false
+	}
+	if c.replayed == nil {
+		c.replayed = map[*CassetteCall]int{}
+	}
+
+	var last *CassetteCall
+	for _, call := range server.Calls {
+		if call.Tool != tool || !sameArguments(call.Arguments, arguments) {
+			continue
+		}
+		if c.replayed[call] == 0 {
+			c.replayed[call]++
+			return call, true
+		}
+		last = call
+	}
+	if last != nil {
+		c.replayed[last]++
+	}
+	return last, last != nil
+}
+
+// sameArguments compares the arguments as JSON values
+// (the recorded numbers are float64)
+func sameArguments(recorded map[string]interface{}, arguments map[string]interface{}) bool {
+	data, err := json.Marshal(arguments)
+	if err != nil {
+		return false
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return false
+	}
+	return len(recorded) == len(decoded) && (len(decoded) == 0 || reflect.DeepEqual(recorded, decoded))
+}
+
+// recordingMCPClient writes the interactions of a server in the cassette
+type recordingMCPClient struct {
+	MCPClient
+	server   string
+	cassette *Cassette
+}
+
+func (c *recordingMCPClient) Initialize(ctx context.Context, request mcp.InitializeRequest) (*mcp.InitializeResult, error) {
+	result, err := c.MCPClient.Initialize(ctx, request)
+	if err == nil {
+		err = c.cassette.record(c.server, func(server *CassetteServer) { server.Initialize = result })
+		if err != nil {
+			return nil, fmt.Errorf("failed to record: %w", err)
+		}
+	}
+	return result, err
+}
+
+// ListTools records the tools of all the pages in a single page
+func (c *recordingMCPClient) ListTools(ctx context.Context, request mcp.ListToolsRequest) (*mcp.ListToolsResult, error) {
+	result, err := c.MCPClient.ListTools(ctx, request)
+	if err == nil {
+		err = c.cassette.record(c.server, func(server *CassetteServer) {
+			recorded := *result
+			recorded.NextCursor = ""
+			if request.Params.Cursor != "" && server.Tools != nil {
+				recorded.Tools = append(append([]mcp.Tool{}, server.Tools.Tools...), result.Tools...)
+			}
+			server.Tools = &recorded
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to record: %w", err)
+		}
+	}
+	return result, err
+}
+
+// CallTool records the results and the errors of the tool calls
+// (except the cancellations)
+func (c *recordingMCPClient) CallTool(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	result, err := c.MCPClient.CallTool(ctx, request)
+	if ctx.Err() != nil {
+		return result, err
+	}
+	call := &CassetteCall{Tool: request.Params.Name, Arguments: request.GetArguments(), Result: result}
+	if err != nil {
+		call.Result, call.Error = nil, err.Error()
+	}
+	if recordErr := c.cassette.record(c.server, func(server *CassetteServer) {
+		server.Calls = append(server.Calls, call)
+	}); recordErr != nil {
+		return nil, fmt.Errorf("failed to record: %w", recordErr)
+	}
+	return result, err
+}
+
+// replayMCPClient answers with the recording of a server
+type replayMCPClient struct {
+	server   string
+	cassette *Cassette
+}
+
+// Initialize returns the recorded result, without the prompts
+// and resources capabilities (they are not recorded)
+func (c *replayMCPClient) Initialize(ctx context.Context, request mcp.InitializeRequest) (*mcp.InitializeResult, error) {
+	server, ok := c.cassette.server(c.server)
+	if !ok || server.Initialize == nil {
+		return nil, fmt.Errorf("server %s is not recorded in the cassette", c.server)
+	}
+	result := *server.Initialize
+	result.Capabilities.Prompts = nil
+	result.Capabilities.Resources = nil
+	return &result, nil
+}
+
+func (c *replayMCPClient) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (c *replayMCPClient) ListTools(ctx context.Context, request mcp.ListToolsRequest) (*mcp.ListToolsResult, error) {
+	server, ok := c.cassette.server(c.server)
+	if !ok || server.Tools == nil {
+		return nil, fmt.Errorf("the tools of %s are not recorded in the cassette", c.server)
+	}
+	return server.Tools, nil
+}
+
+func (c *replayMCPClient) CallTool(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	call, ok := c.cassette.replay(c.server, request.Params.Name, request.GetArguments())
+	if !ok {
+		return nil, fmt.Errorf("no recorded call of %s with the arguments %s", request.Params.Name, rawJSON(request.GetArguments()))
+	}
+	if call.Error != "" {
+		return nil, errors.New(call.Error)
+	}
+	return call.Result, nil
+}
+
+func (c *replayMCPClient) ListPrompts(ctx context.Context, request mcp.ListPromptsRequest) (*mcp.ListPromptsResult, error) {
+	return nil, errors.New("prompts are not recorded")
+}
+
+func (c *replayMCPClient) GetPrompt(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	return nil, errors.New("prompts are not recorded")
+}
+
+func (c *replayMCPClient) ListResources(ctx context.Context, request mcp.ListResourcesRequest) (*mcp.ListResourcesResult, error) {
+	return nil, errors.New("resources are not recorded")
+}
+
+func (c *replayMCPClient) ReadResource(ctx context.Context, request mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+	return nil, errors.New("resources are not recorded")
+}
+
+func (c *replayMCPClient) Subscribe(ctx context.Context, request mcp.SubscribeRequest) error {
+	return errors.New("resources are not recorded")
+}
+
+func (c *replayMCPClient) Unsubscribe(ctx context.Context, request mcp.UnsubscribeRequest) error {
+	return errors.New("resources are not recorded")
+}
+
+func (c *replayMCPClient) SetLevel(ctx context.Context, request mcp.SetLevelRequest) error {
+	return nil
+}
+
+func (c *replayMCPClient) Close() error {
+	return nil
+}
@@ -0,0 +1,163 @@
+package mcphost
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ollama/ollama/api"
+)
+
+// newCassetteHost returns a host whose server "web" is replayed
+// by testdata/web.cassette.json and whose model answers with answer
+func newCassetteHost(t *testing.T, answer func(request api.ChatRequest) api.Message) *Host {
+	t.Helper()
+	config := Config{
+		MCPServers: map[string]MCPServerConfig{
+			"web": {Command: "web-server", Approval: ApprovalAllow},
+		},
+		Replay: "testdata/web.cassette.json",
+	}
+	host, err := NewHost(context.Background(), newTestOllama(t, answer), config)
+	if err != nil {
+		t.Fatalf("NewHost: %v", err)
+	}
+	t.Cleanup(host.Close)
+	return host
+}
+
+// fetchAnswer calls web.fetch with the url for the prompts,
+// then answers with the result of the tool
+func fetchAnswer(url string) func(request api.ChatRequest) api.Message {
+	return func(request api.ChatRequest) api.Message {
+		last := request.Messages[len(request.Messages)-1]
+		switch {
+		case last.Role == "user" && strings.Contains(last.Content, "?"):
+			return api.Message{Role: "assistant", ToolCalls: []api.ToolCall{
+				testToolCall("web.fetch", map[string]interface{}{"url": url}),
+			}}
+		case last.Role == "tool":
+			return api.Message{Role: "assistant", Content: "The page says: " + last.Content}
+		default:
+			return api.Message{Role: "assistant", Content: "You are welcome"}
+		}
+	}
+}
+
+func TestCassetteRecordReplay(t *testing.T) {
+	server := newTestServer(t, map[string]testTool{
+		"echo": func(arguments map[string]interface{}) (string, error) {
+			text, _ := arguments["text"].(string)
+			return text, nil
+		},
+	})
+	path := filepath.Join(t.TempDir(), "test.cassette.json")
+	echo := func(config Config, text string) (string, error) {
+		t.Helper()
+		registry, err := NewToolRegistry(context.Background(), config)
+		if err != nil {
+			t.Fatalf("NewToolRegistry: %v", err)
+		}
+		defer registry.Close()
+		result, err := registry.CallTool(context.Background(), "test.echo", map[string]interface{}{"text": text})
+		if err != nil {
+			return "", err
+		}
+		return NormalizeToolResult(result).Text, nil
+	}
+	servers := map[string]MCPServerConfig{"test": server.config()}
+
+	if got, err := echo(Config{MCPServers: servers, Record: path}, "hello"); err != nil || got != "hello" {
+		t.Fatalf("recorded echo = %q, %v, want hello", got, err)
+	}
+	// the replay does not use the server
+	server.Close()
+	if got, err := echo(Config{MCPServers: servers, Replay: path}, "hello"); err != nil || got != "hello" {
+		t.Errorf("replayed echo = %q, %v, want hello", got, err)
+	}
+	if got, err := echo(Config{MCPServers: servers, Replay: path}, "bye"); err == nil {
+		t.Errorf("replayed echo = %q, want an error for a call not recorded", got)
+	}
+	if server.calls.Load() != 1 {
+		t.Errorf("%d calls of the server, want 1", server.calls.Load())
+	}
+}
+
+func TestCassetteAgentRun(t *testing.T) {
+	host := newCassetteHost(t, fetchAnswer("https://example.com"))
+	agent := host.NewSession().Agent
+
+	messages, results, err := agent.Run(context.Background(), []api.Message{
+		{Role: "user", Content: "What is on example.com?"},
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("Run: %d tool results, want 1", len(results))
+	}
+	result := results[0]
+	if result.Name != "web.fetch" || result.Arguments["url"] != "https://example.com" || result.IsError {
+		t.Errorf("tool result = %+v, want a call of web.fetch on https://example.com", result)
+	}
+	if !strings.Contains(result.Content, "Example Domain") {
+		t.Errorf("tool result content = %q, want the recorded result", result.Content)
+	}
+
+	var roles []string
+	for _, message := range messages {
+		roles = append(roles, message.Role)
+	}
+	if got := strings.Join(roles, ","); !strings.HasSuffix(got, "user,assistant,tool,assistant") {
+		t.Errorf("roles of the conversation = %s, want ...user,assistant,tool,assistant", got)
+	}
+}
+
+func TestCassetteAgentRunToolError(t *testing.T) {
+	host := newCassetteHost(t, fetchAnswer("https://down.example.com"))
+	agent := host.NewSession().Agent
+
+	_, results, err := agent.Run(context.Background(), []api.Message{
+		{Role: "user", Content: "Is down.example.com up?"},
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(results) != 1 || !results[0].IsError || !strings.Contains(results[0].Content, "connection refused") {
+		t.Errorf("tool results = %+v, want the recorded error", results)
+	}
+}
+
+func TestCassetteChatSessionAsk(t *testing.T) {
+	host := newCassetteHost(t, fetchAnswer("https://example.com"))
+	session := host.NewSession()
+
+	var streamed strings.Builder
+	answer, err := session.Ask(context.Background(), "What is on example.com?", func(token string) {
+		streamed.WriteString(token)
+	})
+	if err != nil {
+		t.Fatalf("Ask: %v", err)
+	}
+	if !strings.HasPrefix(answer, "The page says: ") || !strings.Contains(answer, "Example Domain") {
+		t.Errorf("Ask = %q, want an answer with the recorded result", answer)
+	}
+	if streamed.String() != answer {
+		t.Errorf("streamed tokens = %q, want the answer %q", streamed.String(), answer)
+	}
+
+	// the next turn continues the conversation
+	if _, err := session.Ask(context.Background(), "Thanks", func(string) {}); err != nil {
+		t.Fatalf("Ask: %v", err)
+	}
+	users := 0
+	for _, message := range session.History {
+		if message.Role == "user" {
+			users++
+		}
+	}
+	if users != 2 {
+		t.Errorf("history with %d user messages, want 2", users)
+	}
+}
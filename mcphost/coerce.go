@@ -0,0 +1,139 @@
+package mcphost
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// CoerceToolArguments converts the arguments of a tool call to the types of the
+// input schema of the tool. The small models often write the numbers and the
+// booleans as strings ("3", "true"), or a single value instead of a list.
+// The values which cannot be converted are kept as they are (the validation reports them).
+func CoerceToolArguments(schema mcp.ToolInputSchema, arguments map[string]interface{}) map[string]interface{} {
+	coerced := make(map[string]interface{}, len(arguments))
+	for name, value := range arguments {
+		if property, ok := schema.Properties[name].(map[string]interface{}); ok {
+			value = coerceValue(property, jsonValue(value))
+		}
+		coerced[name] = value
+	}
+	return coerced
+}
+
+// jsonValue converts a Go value to its JSON form (e.g. an int to a float64)
+func jsonValue(value interface{}) interface{} {
+	switch value.(type) {
+	case nil, bool, string, float64, []interface{}, map[string]interface{}:
+		return value
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	var converted interface{}
+	if err := json.Unmarshal(data, &converted); err != nil {
+		return value
+	}
+	return converted
+}
+
+func coerceValue(schema map[string]interface{}, value interface{}) interface{} {
+	types := schemaTypes(schema["type"])
+	for _, schemaType := range types {
+		if jsonTypeMatches(schemaType, value) {
+			return coerceChildren(schema, value)
+		}
+	}
+	for _, schemaType := range types {
+		if converted, ok := convertValue(schemaType, value); ok {
+			return coerceChildren(schema, converted)
+		}
+	}
+	return coerceChildren(schema, value)
+}
+
+// coerceChildren converts the properties of an object and the items of an array
+func coerceChildren(schema map[string]interface{}, value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		properties, ok := schema["properties"].(map[string]interface{})
+		if !ok {
+			return value
+		}
+		for name, item := range value {
+			if property, ok := properties[name].(map[string]interface{}); ok {
+				value[name] = coerceValue(property, item)
+			}
+		}
+	case []interface{}:
+		items, ok := schema["items"].(map[string]interface{})
+		if !ok {
+			return value
+		}
+		for i, item := range value {
+			value[i] = coerceValue(items, item)
+		}
+	}
+	return value
+}
+
+// convertValue converts a value to a JSON type, ok is false when it is not possible
+func convertValue(schemaType string, value interface{}) (interface{}, bool) {
+	text, isString := value.(string)
+	text = strings.TrimSpace(text)
+
+	switch schemaType {
+	case "integer":
+		if isString {
+			if number, err := strconv.ParseFloat(text, 64); err == nil && number == math.Trunc(number) {
+				return number, true
+			}
+		}
+	case "number":
+		if isString {
+			if number, err := strconv.ParseFloat(text, 64); err == nil {
+				return number, true
+			}
+		}
+	case "boolean":
+		if isString {
+			if boolean, err := strconv.ParseBool(strings.ToLower(text)); err == nil {
+				return boolean, true
+			}
+		}
+	case "string":
+		switch value := value.(type) {
+		case float64:
+			return strconv.FormatFloat(value, 'f', -1, 64), true
+		case bool:
+			return strconv.FormatBool(value), true
+		}
+	case "array":
+		if isString && strings.HasPrefix(text, "[") {
+			var list []interface{}
+			if err := json.Unmarshal([]byte(text), &list); err == nil {
+				return list, true
+			}
+		}
+		// a single value is a list of one item
+		if _, isObject := value.(map[string]interface{}); value != nil && !isObject {
+			return []interface{}{value}, true
+		}
+	case "object":
+		if isString && strings.HasPrefix(text, "{") {
+			var object map[string]interface{}
+			if err := json.Unmarshal([]byte(text), &object); err == nil {
+				return object, true
+			}
+		}
+	case "null":
+		if isString && (text == "" || text == "null") {
+			return nil, true
+		}
+	}
+	return nil, false
+}
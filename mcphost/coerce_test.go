@@ -0,0 +1,92 @@
+package mcphost
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestCoerceToolArguments(t *testing.T) {
+	schema := mcp.ToolInputSchema{Type: "object"}
+	properties := `{
+		"days": {"type": "integer"},
+		"ratio": {"type": "number"},
+		"verbose": {"type": "boolean"},
+		"name": {"type": "string"},
+		"limit": {"type": ["integer", "null"]},
+		"tags": {"type": "array", "items": {"type": "integer"}},
+		"page": {"type": "object", "properties": {"size": {"type": "integer"}}}
+	}`
+	if err := json.Unmarshal([]byte(properties), &schema.Properties); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		arguments map[string]interface{}
+		want      map[string]interface{}
+	}{
+		{
+			name:      "scalars from strings",
+			arguments: map[string]interface{}{"days": " 3 ", "ratio": "0.5", "verbose": "TRUE"},
+			want:      map[string]interface{}{"days": 3.0, "ratio": 0.5, "verbose": true},
+		},
+		{
+			name:      "strings from scalars",
+			arguments: map[string]interface{}{"name": 42.0},
+			want:      map[string]interface{}{"name": "42"},
+		},
+		{
+			name:      "go values",
+			arguments: map[string]interface{}{"days": 3, "tags": []int{1, 2}},
+			want:      map[string]interface{}{"days": 3.0, "tags": []interface{}{1.0, 2.0}},
+		},
+		{
+			name:      "list of types",
+			arguments: map[string]interface{}{"limit": "null"},
+			want:      map[string]interface{}{"limit": nil},
+		},
+		{
+			name:      "json strings",
+			arguments: map[string]interface{}{"tags": `["1", 2]`, "page": `{"size": "10"}`},
+			want:      map[string]interface{}{"tags": []interface{}{1.0, 2.0}, "page": map[string]interface{}{"size": 10.0}},
+		},
+		{
+			name:      "single value as a list",
+			arguments: map[string]interface{}{"tags": "7"},
+			want:      map[string]interface{}{"tags": []interface{}{7.0}},
+		},
+		{
+			name:      "unconvertible values and unknown arguments",
+			arguments: map[string]interface{}{"days": "2.5", "verbose": "maybe", "other": "3"},
+			want:      map[string]interface{}{"days": "2.5", "verbose": "maybe", "other": "3"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := CoerceToolArguments(schema, test.arguments)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("CoerceToolArguments() = %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRegistryCoerceArguments(t *testing.T) {
+	registry, server := newMathRegistry(t)
+
+	got := registry.CoerceArguments("math.add", map[string]interface{}{"a": "2", "b": 3})
+	if want := map[string]interface{}{"a": 2.0, "b": 3.0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("CoerceArguments(math.add) = %#v, want %#v", got, want)
+	}
+	// the arguments of the unknown tools are kept as they are
+	arguments := map[string]interface{}{"a": "2"}
+	if got := registry.CoerceArguments("math.sub", arguments); !reflect.DeepEqual(got, arguments) {
+		t.Errorf("CoerceArguments(math.sub) = %#v, want %#v", got, arguments)
+	}
+	if server.calls.Load() != 0 {
+		t.Errorf("%d calls of the tools, want 0", server.calls.Load())
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !windows
+
+package mcphost
+
+import "os/exec"
+
+// stdioCommand returns the command starting a stdio server
+func stdioCommand(command string, args []string) (*exec.Cmd, error) {
+	return exec.Command(command, args...), nil
+}
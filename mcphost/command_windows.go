@@ -0,0 +1,71 @@
+//go:build windows
+
+package mcphost
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+)
+
+// cmdMetaChars are the characters interpreted by cmd.exe
+var cmdMetaChars = regexp.MustCompile(`([()\][%!^"<>&|;, *?])`)
+
+// quotedBackslashes are the backslashes before a quote or at the end of an argument
+var quotedBackslashes = regexp.MustCompile(`(\\*)("|$)`)
+
+// cmdShim matches the shims of the npm packages, they pass their arguments
+// to cmd.exe a second time
+var cmdShim = regexp.MustCompile(`(?i)node_modules[\\/]\.bin[\\/][^\\/]+\.cmd$`)
+
+// stdioCommand returns the command starting a stdio server. The command is
+// resolved with PATHEXT (npx is npx.cmd), the batch files (.cmd and .bat)
+// can not be started without cmd.exe: they are run by cmd.exe with their
+// arguments escaped for it.
+func stdioCommand(command string, args []string) (*exec.Cmd, error) {
+	path, err := exec.LookPath(command)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".cmd", ".bat":
+	default:
+		return exec.Command(path, args...), nil
+	}
+
+	shim := cmdShim.MatchString(path)
+	line := []string{cmdMetaChars.ReplaceAllString(path, "^$1")}
+	for _, arg := range args {
+		line = append(line, escapeCmdArgument(arg, shim))
+	}
+	shell := os.Getenv("COMSPEC")
+	if shell == "" {
+		shell = "cmd.exe"
+	}
+	cmd := exec.Command(shell)
+	// the command line (with the program) is passed as is: exec would quote it again
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		CmdLine: syscall.EscapeArg(shell) + ` /d /s /c "` + strings.Join(line, " ") + `"`,
+	}
+	return cmd, nil
+}
+
+// escapeCmdArgument quotes an argument for the C runtime of the program,
+// then escapes the metacharacters of cmd.exe (twice for the npm shims)
+func escapeCmdArgument(arg string, shim bool) string {
+	// the backslashes before a quote (and at the end) are doubled
+	arg = quotedBackslashes.ReplaceAllStringFunc(arg, func(match string) string {
+		if backslashes, ok := strings.CutSuffix(match, `"`); ok {
+			return backslashes + backslashes + `\"`
+		}
+		return match + match
+	})
+	arg = cmdMetaChars.ReplaceAllString(`"`+arg+`"`, "^$1")
+	if shim {
+		arg = cmdMetaChars.ReplaceAllString(arg, "^$1")
+	}
+	return arg
+}
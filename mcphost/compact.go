@@ -0,0 +1,112 @@
+package mcphost
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+)
+
+// DefaultCompactKeepTurns is the number of recent turns kept by the compaction
+const DefaultCompactKeepTurns = 2
+
+// compactedPrefix starts the message replacing the compacted turns
+const compactedPrefix = "Summary of the previous conversation:\n"
+
+// transcriptToolResultSize is the size (in characters) of the tool results
+// in the transcript sent to the model for the summary
+const transcriptToolResultSize = 2000
+
+// Compact replaces the older turns of the history with a summary written
+// by the chat model, the CompactKeepTurns last turns are kept as they are.
+// It returns the number of messages replaced (0 when there is nothing to compact).
+func (s *ChatSession) Compact(ctx context.Context) (int, error) {
+	start := compactionStart(s.History, s.keepTurns())
+	older := s.History[:start]
+	if len(older) == 0 || (len(older) == 1 && isCompactedSummary(older[0])) {
+		return 0, nil
+	}
+
+	messages := []api.Message{
+		{Role: "system", Content: "Summarize the conversation between a user and an assistant using tools. " +
+			"Keep the questions of the user, the facts, names, numbers and results useful to continue the conversation. " +
+			"Answer with the summary only."},
+		{Role: "user", Content: transcript(older)},
+	}
+	summary, err := complete(ctx, s.Ollama, s.Agent.Metrics, s.ChatModel, messages, s.Options, s.ChatTimeout, s.Retry, "compaction")
+	if err != nil {
+		return 0, fmt.Errorf("failed to summarize the conversation: %w", err)
+	}
+
+	history := []api.Message{{Role: "system", Content: compactedPrefix + strings.TrimSpace(summary)}}
+	s.History = append(history, s.History[start:]...)
+	s.save()
+	return len(older), nil
+}
+
+// autoCompact compacts the history when it is larger than CompactThreshold tokens.
+// A failure is reported but does not stop the conversation.
+func (s *ChatSession) autoCompact(ctx context.Context) {
+	if s.CompactThreshold <= 0 || EstimateMessagesTokens(s.History) <= s.CompactThreshold {
+		return
+	}
+	slog.Info("compacting the conversation", "session", s.ID,
+		"tokens", EstimateMessagesTokens(s.History), "threshold", s.CompactThreshold)
+	compacted, err := s.Compact(ctx)
+	if err != nil {
+		slog.Warn("failed to compact the conversation", "session", s.ID, "error", err)
+		return
+	}
+	slog.Info("conversation compacted", "session", s.ID, "messages", compacted,
+		"tokens", EstimateMessagesTokens(s.History))
+}
+
+func (s *ChatSession) keepTurns() int {
+	if s.CompactKeepTurns <= 0 {
+		return DefaultCompactKeepTurns
+	}
+	return s.CompactKeepTurns
+}
+
+// compactionStart returns the index of the first message of the keepTurns
+// last turns (a turn starts with a user prompt)
+func compactionStart(history []api.Message, keepTurns int) int {
+	turns := 0
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Role == "user" && !isToolResult(history[i]) {
+			turns++
+			if turns == keepTurns {
+				return i
+			}
+		}
+	}
+	return 0
+}
+
+func isCompactedSummary(message api.Message) bool {
+	return message.Role == "system" && strings.HasPrefix(message.Content, compactedPrefix)
+}
+
+// transcript writes the messages as text for the summary,
+// the tool results are shortened
+func transcript(messages []api.Message) string {
+	var text strings.Builder
+	for _, message := range messages {
+		switch {
+		case isCompactedSummary(message):
+			text.WriteString(message.Content + "\n")
+		case isToolResult(message):
+			text.WriteString("Tool result: " + truncateText(message.Content, transcriptToolResultSize) + "\n")
+		case len(message.ToolCalls) > 0:
+			for _, toolCall := range message.ToolCalls {
+				fmt.Fprintf(&text, "Assistant called the tool %s with %s\n",
+					toolCall.Function.Name, toolCall.Function.Arguments.String())
+			}
+		default:
+			fmt.Fprintf(&text, "%s: %s\n", message.Role, message.Content)
+		}
+	}
+	return text.String()
+}
@@ -0,0 +1,692 @@
+package mcphost
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// MCPServerConfig describes how to start an MCP server.
+// It uses the same format as the "mcpServers" entries of Claude Desktop or mcphost.
+type MCPServerConfig struct {
+	// Transport is "stdio" (default) or "http" (streamable HTTP)
+	Transport string `json:"transport"`
+	// Command, Args, Env and Cwd are used by the stdio transport:
+	// ${VAR} (or ${VAR:-default}) in them is replaced by the variable of the host
+	// environment (e.g. "env": {"GITHUB_TOKEN": "${GITHUB_TOKEN}"})
+	Command string            `json:"command"`
+	Args    []string          `json:"args"`
+	Env     map[string]string `json:"env"`
+	// Cwd is the working directory of the server (the current directory by default)
+	Cwd string `json:"cwd"`
+	// URL is the MCP endpoint of the http transport (with the ${VAR} references)
+	URL string `json:"url"`
+	// Headers are added to the requests of the http transport, with the ${VAR}
+	// references (e.g. "Authorization": "Bearer ${API_TOKEN}" or "X-API-Key")
+	Headers map[string]string `json:"headers"`
+	// Approval is the approval policy of the tools of the server (allow, ask or deny),
+	// ToolApprovals overrides it for some tools
+	Approval      ApprovalPolicy            `json:"approval"`
+	ToolApprovals map[string]ApprovalPolicy `json:"toolApprovals"`
+	// Retry tells how a crashed server is restarted during a tool call
+	Retry *RetryPolicy `json:"retry"`
+	// Include and Exclude filter the tools sent to the model with glob patterns
+	// (e.g. "use_*"): an empty Include keeps all the tools
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+	// Timeouts overrides the global timeouts for the server (chat is not used),
+	// ToolTimeouts overrides the callTool timeout for some tools
+	Timeouts     Timeouts            `json:"timeouts"`
+	ToolTimeouts map[string]Duration `json:"toolTimeouts"`
+	// LogLevel is the minimum level of the log messages of the server
+	// (debug, info, notice, warning, error, critical, alert or emergency),
+	// DefaultServerLogLevel by default
+	LogLevel mcp.LoggingLevel `json:"logLevel"`
+	// IdleTimeout stops the process of a stdio server after this time without
+	// request (0 keeps it running), it is restarted by the next request
+	IdleTimeout Duration `json:"idleTimeout"`
+	// Sampling lets the server ask completions to the models of the host
+	// (sampling/createMessage), with the approval policy of the server
+	Sampling bool `json:"sampling"`
+	// Roots are the directories the server may use (the global roots by default),
+	// they are listed to the server with the roots capability
+	Roots []string `json:"roots"`
+	// CacheTTL is how long the results of the tools are reused for the same
+	// arguments (0 calls the tools each time), ToolCacheTTLs overrides it for some tools
+	CacheTTL      Duration            `json:"cacheTTL"`
+	ToolCacheTTLs map[string]Duration `json:"toolCacheTTLs"`
+	// MaxConcurrency is the maximum number of requests sent at the same time
+	// to the server by all the sessions (0 means no limit), e.g. 1 for the
+	// servers handling one request at a time
+	MaxConcurrency int `json:"maxConcurrency"`
+	// Processes is the number of processes of a stdio server (1 by default)
+	// for the servers which can not handle concurrent calls: each process
+	// runs one request at a time, the other requests wait for a free process
+	Processes int `json:"processes"`
+	// OAuth enables the OAuth authorization of the http transport (see OAuthConfig)
+	OAuth *OAuthConfig `json:"oauth"`
+	// Kubernetes runs the docker run command line as a pod (see KubernetesConfig)
+	Kubernetes *KubernetesConfig `json:"kubernetes"`
+	// Container limits the resources and the network of the docker run servers
+	// (the container setting of the config by default)
+	Container *ContainerConfig `json:"container"`
+}
+
+// RetryPolicy tells how many times a crashed server is restarted
+// to retry a tool call, and how long to wait before each restart
+type RetryPolicy struct {
+	MaxRestarts int      `json:"maxRestarts"`
+	Delay       Duration `json:"delay"`
+}
+
+// DefaultRetryPolicy is used by the servers without retry policy
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRestarts: 1,
+	Delay:       Duration(time.Second),
+}
+
+// Timeouts of the MCP requests and of the chat completions.
+// A missing (or zero) value keeps the default one.
+type Timeouts struct {
+	// Initialize covers the start and the initialization of a server
+	Initialize Duration `json:"initialize"`
+	ListTools  Duration `json:"listTools"`
+	// CallTool is the timeout of each tool call
+	CallTool Duration `json:"callTool"`
+	// Chat is the timeout of each completion of a model
+	Chat Duration `json:"chat"`
+}
+
+// DefaultTimeouts is used for the timeouts missing in the config
+var DefaultTimeouts = Timeouts{
+	Initialize: Duration(30 * time.Second),
+	ListTools:  Duration(30 * time.Second),
+	CallTool:   Duration(time.Minute),
+	Chat:       Duration(2 * time.Minute),
+}
+
+// withDefaults returns the timeouts where the missing values are taken from defaults
+func (t Timeouts) withDefaults(defaults Timeouts) Timeouts {
+	if t.Initialize <= 0 {
+		t.Initialize = defaults.Initialize
+	}
+	if t.ListTools <= 0 {
+		t.ListTools = defaults.ListTools
+	}
+	if t.CallTool <= 0 {
+		t.CallTool = defaults.CallTool
+	}
+	if t.Chat <= 0 {
+		t.Chat = defaults.Chat
+	}
+	return t
+}
+
+// withTimeout returns a context cancelled after timeout (0 means no timeout)
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// Duration is a time.Duration written as a string in the config ("500ms", "30s", "5m")
+type Duration time.Duration
+
+// UnmarshalJSON parses a duration string
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("invalid duration %s: must be a string like \"30s\"", data)
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+// MarshalJSON writes the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Config is the content of the MCP configuration file
+type Config struct {
+	MCPServers map[string]MCPServerConfig `json:"mcpServers"`
+	// SingleModel makes one model (CHAT_LLM) call the tools and write the answer
+	SingleModel bool `json:"singleModel"`
+	// Timeouts of the requests, the servers can override them
+	Timeouts Timeouts `json:"timeouts"`
+	// DebugMCP logs the JSON-RPC requests and responses exchanged with the servers
+	DebugMCP bool `json:"debugMCP"`
+	// Summarize enables the summary of the large tool results (nil disables it)
+	Summarize *SummarizeConfig `json:"summarize"`
+	// Compact enables the automatic compaction of the long conversations
+	Compact CompactConfig `json:"compact"`
+	// Builtin enables the built-in tools of the host (nil disables them)
+	Builtin *BuiltinConfig `json:"builtin"`
+	// Limits is the budget of the tool loop of each turn
+	Limits LimitsConfig `json:"limits"`
+	// OllamaRetry tells how the failed requests to Ollama are retried
+	// (nil uses DefaultOllamaRetry)
+	OllamaRetry *BackoffPolicy `json:"ollamaRetry"`
+	// Options are the Ollama options of all the models (e.g. temperature, num_ctx,
+	// top_p, seed, stop, num_predict, keep_alive), they override DefaultOptions.
+	// ModelOptions overrides them for some models.
+	Options      map[string]interface{}            `json:"options"`
+	ModelOptions map[string]map[string]interface{} `json:"modelOptions"`
+	// Record is the cassette file where the MCP interactions are recorded,
+	// Replay is a recorded cassette answering instead of the servers
+	// (see Cassette)
+	Record string `json:"record"`
+	Replay string `json:"replay"`
+	// Backend is the LLM backend (Ollama by default)
+	Backend BackendConfig `json:"backend"`
+	// HealthCheckInterval is the time between two pings of the servers
+	// (DefaultHealthCheckInterval by default, negative to disable them)
+	HealthCheckInterval Duration `json:"healthCheckInterval"`
+	// StartConcurrency is the number of servers started at the same time
+	// (DefaultStartConcurrency by default)
+	StartConcurrency int `json:"startConcurrency"`
+	// EnvFile is the dotenv file loaded with the config (relative to the
+	// directory of the config), DefaultEnvFile is loaded when it exists
+	EnvFile string `json:"envFile"`
+	// Roots are the directories the servers may use (roots/list), ${VAR}
+	// references and relative paths are resolved when they are listed
+	Roots []string `json:"roots"`
+	// Memory enables the memory of the conversations across the sessions
+	// (nil disables it)
+	Memory *MemoryConfig `json:"memory"`
+	// RAG enables the retrieval of the local documents relevant
+	// to the prompts (nil disables it)
+	RAG *RAGConfig `json:"rag"`
+	// ToolSelection only sends the tools relevant to the prompts
+	// when the catalog is large (nil sends all the tools)
+	ToolSelection *ToolSelectionConfig `json:"toolSelection"`
+	// ToolCacheSize is the number of tool results kept for the servers with
+	// a cache TTL (DefaultToolCacheSize by default)
+	ToolCacheSize int `json:"toolCacheSize"`
+	// Server is the setting of the HTTP server of the serve mode
+	Server ServerConfig `json:"server"`
+	// DockerMCP registers the servers enabled in the MCP Toolkit of Docker
+	// Desktop (nil disables it)
+	DockerMCP *DockerMCPConfig `json:"dockerMCP"`
+	// DockerLabels attaches the host to the running containers labelled
+	// mcp.enabled=true (nil disables it)
+	DockerLabels *DockerLabelsConfig `json:"dockerLabels"`
+	// ContainerRuntime runs the servers whose command is docker with podman
+	// or nerdctl (nil detects the installed runtime)
+	ContainerRuntime *ContainerRuntimeConfig `json:"containerRuntime"`
+	// Kubernetes runs the docker servers as pods of a cluster
+	// (nil runs them with the container runtime)
+	Kubernetes *KubernetesConfig `json:"kubernetes"`
+	// Container is the default limits of the docker servers (nil means no limits)
+	Container *ContainerConfig `json:"container"`
+	// ToolPolicy are the rules checked before each tool call (see PolicyRule)
+	ToolPolicy []PolicyRule `json:"toolPolicy"`
+	// Injection enables the detection of the instructions injected
+	// in the tool results (nil disables it)
+	Injection *InjectionConfig `json:"injection"`
+	// AuditLog is the append-only JSONL file recording the tool invocations
+	// (see AuditRecord), ${VAR} references are replaced (empty disables it)
+	AuditLog string `json:"auditLog"`
+	// PII masks the personal data of the tool results (nil disables it)
+	PII *PIIConfig `json:"pii"`
+	// Agents are the sub-agents the tools model delegates tasks to
+	// (see AgentConfig)
+	Agents map[string]AgentConfig `json:"agents"`
+	// Schedules are the tasks run by the daemon mode (see ScheduleConfig)
+	Schedules []ScheduleConfig `json:"schedules"`
+	// Slack connects the host to a Slack app (see SlackConfig)
+	Slack *SlackConfig `json:"slack"`
+	// Discord connects the host to a Discord bot (see DiscordConfig)
+	Discord *DiscordConfig `json:"discord"`
+}
+
+// BackendConfig selects the backend answering the chat requests
+type BackendConfig struct {
+	// Type is "ollama" (OLLAMA_HOST), "openai" (an OpenAI-compatible
+	// /v1/chat/completions endpoint: vLLM, llama.cpp server, LM Studio...)
+	// or "mock" (see MockOllama)
+	Type string `json:"type"`
+	// URL is the base URL of the OpenAI-compatible API, with the /v1 prefix
+	URL string `json:"url"`
+	// APIKey is the key of the OpenAI-compatible API,
+	// APIKeyEnv is the environment variable holding it
+	APIKey    string `json:"apiKey"`
+	APIKeyEnv string `json:"apiKeyEnv"`
+	// Fixtures is the fixture file of the mock
+	Fixtures string `json:"fixtures"`
+}
+
+// Key returns the API key of the backend (APIKeyEnv wins over APIKey)
+func (b BackendConfig) Key() string {
+	if b.APIKeyEnv != "" {
+		if key := os.Getenv(b.APIKeyEnv); key != "" {
+			return key
+		}
+	}
+	return b.APIKey
+}
+
+// LimitsConfig is the budget of the tool loop of a turn, 0 keeps the default
+// (DefaultMaxIterations for maxIterations, no limit for the others)
+type LimitsConfig struct {
+	// MaxIterations is the maximum number of calls of the model in the tool loop
+	MaxIterations int `json:"maxIterations"`
+	// MaxToolCalls is the maximum number of tool calls
+	MaxToolCalls int `json:"maxToolCalls"`
+	// MaxToolOutputBytes is the maximum total size of the tool results
+	MaxToolOutputBytes int `json:"maxToolOutputBytes"`
+	// MaxToolResultBytes is the maximum size of each tool result: the larger
+	// results keep their head and tail
+	MaxToolResultBytes int `json:"maxToolResultBytes"`
+	// ToolResultDir, if set, is the directory where the full content
+	// of the truncated tool results is written
+	ToolResultDir string `json:"toolResultDir"`
+}
+
+// BuiltinConfig is the setting of the built-in tools (see BuiltinTools),
+// they are the tools of the "builtin" server
+type BuiltinConfig struct {
+	// Root is the directory of the files of read_file (the current directory by default)
+	Root          string                    `json:"root"`
+	Approval      ApprovalPolicy            `json:"approval"`
+	ToolApprovals map[string]ApprovalPolicy `json:"toolApprovals"`
+	Include       []string                  `json:"include"`
+	Exclude       []string                  `json:"exclude"`
+}
+
+// CompactConfig is the setting of the compaction of the conversations
+type CompactConfig struct {
+	// Threshold is the size (in tokens) of the history above which the older
+	// turns are replaced by a summary (0 disables the automatic compaction)
+	Threshold int `json:"threshold"`
+	// KeepTurns is the number of recent turns kept as they are
+	KeepTurns int `json:"keepTurns"`
+}
+
+// SummarizeConfig is the setting of the summary of the large tool results
+type SummarizeConfig struct {
+	// Threshold is the size (in tokens) above which a tool result is summarized
+	Threshold int `json:"threshold"`
+	// Model summarizes the results (the tools model by default)
+	Model string `json:"model"`
+	// ChunkTokens is the size (in tokens) of the parts summarized one at a time
+	ChunkTokens int `json:"chunkTokens"`
+}
+
+// ParseConfig only reads an MCP configuration file: unlike LoadConfig, the env
+// file is not loaded, the docker servers are not discovered and the config
+// is not validated (e.g. for a client of a single server)
+func ParseConfig(path string) (Config, error) {
+	var config Config
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// LoadConfig reads an MCP configuration file (the standard "mcpServers" JSON format),
+// loads its env file, adds the discovered servers and validates the config
+func LoadConfig(path string) (Config, error) {
+	config, err := ParseConfig(path)
+	if err != nil {
+		return config, err
+	}
+
+	// the secrets (e.g. GITHUB_TOKEN) are kept out of the config
+	// in a dotenv file, and referenced with ${VAR}
+	envFile, optional := config.EnvFile, config.EnvFile == ""
+	if optional {
+		envFile = DefaultEnvFile
+	}
+	if !filepath.IsAbs(envFile) {
+		envFile = filepath.Join(filepath.Dir(path), envFile)
+	}
+	if err := LoadDotEnv(envFile, optional); err != nil {
+		return config, fmt.Errorf("failed to load the env file: %w", err)
+	}
+	if err := config.useContainerLimits(); err != nil {
+		return config, err
+	}
+	if err := config.useKubernetes(); err != nil {
+		return config, err
+	}
+	runtime, err := config.ContainerRuntime.resolve()
+	if err != nil {
+		return config, fmt.Errorf("containerRuntime: %w", err)
+	}
+	config.useContainerRuntime(runtime)
+	// the gateway of the MCP Toolkit is a plugin of docker
+	if err := config.addDockerMCPServers(); err != nil {
+		return config, fmt.Errorf("dockerMCP: %w", err)
+	}
+	if err := config.addDockerLabelServers(runtime); err != nil {
+		return config, fmt.Errorf("dockerLabels: %w", err)
+	}
+	if len(config.MCPServers) == 0 && config.Builtin == nil {
+		return config, fmt.Errorf("no mcpServers declared in %s", path)
+	}
+	if _, ok := config.MCPServers[BuiltinServerName]; ok && config.Builtin != nil {
+		return config, fmt.Errorf("server %s: the name is used by the built-in tools", BuiltinServerName)
+	}
+	for name, server := range config.MCPServers {
+		switch server.Transport {
+		case "", "stdio":
+			if server.Command == "" {
+				return config, fmt.Errorf("server %s: missing command", name)
+			}
+		case "http":
+			if server.URL == "" {
+				return config, fmt.Errorf("server %s: missing url", name)
+			}
+		default:
+			return config, fmt.Errorf("server %s: unknown transport %s", name, server.Transport)
+		}
+		if _, ok := loggingLevels[server.LogLevel]; server.LogLevel != "" && !ok {
+			return config, fmt.Errorf("server %s: unknown log level %s", name, server.LogLevel)
+		}
+		if err := server.validatePolicies(); err != nil {
+			return config, fmt.Errorf("server %s: %w", name, err)
+		}
+		if server.MaxConcurrency < 0 || server.Processes < 0 {
+			return config, fmt.Errorf("server %s: negative maxConcurrency or processes", name)
+		}
+		if server.Processes > 1 && server.Transport == "http" {
+			return config, fmt.Errorf("server %s: processes is only used by the stdio transport", name)
+		}
+		if len(server.Headers) > 0 && server.Transport != "http" {
+			return config, fmt.Errorf("server %s: headers are only used by the http transport", name)
+		}
+		if server.OAuth != nil && server.Transport != "http" {
+			return config, fmt.Errorf("server %s: oauth is only used by the http transport", name)
+		}
+	}
+	if config.Builtin != nil {
+		if err := config.Builtin.serverConfig().validatePolicies(); err != nil {
+			return config, fmt.Errorf("builtin: %w", err)
+		}
+	}
+	if config.Summarize != nil && (config.Summarize.Threshold < 0 || config.Summarize.ChunkTokens < 0) {
+		return config, fmt.Errorf("summarize: negative threshold or chunkTokens in %s", path)
+	}
+	if config.Compact.Threshold < 0 || config.Compact.KeepTurns < 0 {
+		return config, fmt.Errorf("compact: negative threshold or keepTurns in %s", path)
+	}
+	if config.Limits.MaxIterations < 0 || config.Limits.MaxToolCalls < 0 || config.Limits.MaxToolOutputBytes < 0 ||
+		config.Limits.MaxToolResultBytes < 0 {
+		return config, fmt.Errorf("limits: negative limit in %s", path)
+	}
+	if config.Injection != nil {
+		if _, err := NewInjectionScanner(nil, *config.Injection); err != nil {
+			return config, fmt.Errorf("injection: %w", err)
+		}
+	}
+	if config.PII != nil {
+		if _, err := NewPIIFilter(*config.PII); err != nil {
+			return config, fmt.Errorf("pii: %w", err)
+		}
+	}
+	if err := config.validateAgents(); err != nil {
+		return config, err
+	}
+	if err := config.validateSchedules(); err != nil {
+		return config, err
+	}
+	if config.Slack != nil {
+		if err := config.Slack.validate(); err != nil {
+			return config, err
+		}
+	}
+	if config.Discord != nil {
+		if err := config.Discord.validate(); err != nil {
+			return config, err
+		}
+	}
+	if _, err := NewToolPolicy(config.ToolPolicy); err != nil {
+		return config, fmt.Errorf("toolPolicy: %w", err)
+	}
+	if err := config.Server.validate(); err != nil {
+		return config, fmt.Errorf("server: %w", err)
+	}
+	if err := ValidateOptions(config.Options); err != nil {
+		return config, fmt.Errorf("options: %w", err)
+	}
+	for model, options := range config.ModelOptions {
+		if err := ValidateOptions(options); err != nil {
+			return config, fmt.Errorf("modelOptions %s: %w", model, err)
+		}
+	}
+	if config.Record != "" && config.Replay != "" {
+		return config, fmt.Errorf("record and replay can not be used together in %s", path)
+	}
+	switch config.Backend.Type {
+	case "", "ollama", "mock":
+	case "openai":
+		if config.Backend.URL == "" {
+			return config, fmt.Errorf("backend: the url of the openai backend is missing in %s", path)
+		}
+	default:
+		return config, fmt.Errorf("backend: unknown type %s in %s (ollama, openai or mock)", config.Backend.Type, path)
+	}
+	if retry := config.OllamaRetry; retry != nil && (retry.MaxAttempts < 0 || retry.InitialDelay < 0 || retry.MaxDelay < 0) {
+		return config, fmt.Errorf("ollamaRetry: negative value in %s", path)
+	}
+	return config, nil
+}
+
+// validatePolicies checks the approval policies and the tool patterns
+func (c MCPServerConfig) validatePolicies() error {
+	if !c.Approval.valid() {
+		return fmt.Errorf("unknown approval policy %s", c.Approval)
+	}
+	for _, pattern := range append(c.Include, c.Exclude...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid tool pattern %s", pattern)
+		}
+	}
+	for tool, policy := range c.ToolApprovals {
+		if !policy.valid() {
+			return fmt.Errorf("tool %s: unknown approval policy %s", tool, policy)
+		}
+	}
+	return nil
+}
+
+// serverConfig returns the config of the "builtin" server
+func (b BuiltinConfig) serverConfig() MCPServerConfig {
+	return MCPServerConfig{
+		Approval:      b.Approval,
+		ToolApprovals: b.ToolApprovals,
+		Include:       b.Include,
+		Exclude:       b.Exclude,
+	}
+}
+
+// ServerConfig returns the config of a server (the built-in tools included)
+func (c Config) ServerConfig(name string) MCPServerConfig {
+	if name == BuiltinServerName && c.Builtin != nil {
+		return c.Builtin.serverConfig()
+	}
+	return c.MCPServers[name]
+}
+
+// cassette returns the cassette of the record or replay mode (nil without cassette)
+func (c Config) cassette() (*Cassette, bool, error) {
+	switch {
+	case c.Replay != "":
+		cassette, err := LoadCassette(c.Replay)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to load the cassette: %w", err)
+		}
+		return cassette, true, nil
+	case c.Record != "":
+		return NewCassette(c.Record), false, nil
+	default:
+		return nil, false, nil
+	}
+}
+
+// OllamaRetryPolicy returns the retry policy of the requests to Ollama
+func (c Config) OllamaRetryPolicy() BackoffPolicy {
+	if c.OllamaRetry == nil {
+		return DefaultOllamaRetry
+	}
+	return *c.OllamaRetry
+}
+
+// ChatTimeout returns the timeout of a chat completion
+func (c Config) ChatTimeout() time.Duration {
+	return time.Duration(c.Timeouts.withDefaults(DefaultTimeouts).Chat)
+}
+
+// ServerTimeouts returns the timeouts of a server: its own timeouts,
+// then the global ones, then the default ones
+func (c Config) ServerTimeouts(name string) Timeouts {
+	return c.MCPServers[name].Timeouts.withDefaults(c.Timeouts.withDefaults(DefaultTimeouts))
+}
+
+// ServerNames returns the names of the declared servers, sorted
+func (c Config) ServerNames() []string {
+	names := make([]string, 0, len(c.MCPServers))
+	for name := range c.MCPServers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// HTTPHeaders returns the headers of the http transport, with the values
+// of the ${VAR} references
+func (s MCPServerConfig) HTTPHeaders() (map[string]string, error) {
+	headers := make(map[string]string, len(s.Headers))
+	for name, value := range s.Headers {
+		expanded, err := expandEnv(value)
+		if err != nil {
+			return nil, fmt.Errorf("header %s: %w", name, err)
+		}
+		headers[name] = expanded
+	}
+	return headers, nil
+}
+
+// Environment returns the env vars of the server with the KEY=VALUE format
+// expected by the stdio transport (they are added to the host environment)
+func (s MCPServerConfig) Environment() ([]string, error) {
+	env := make([]string, 0, len(s.Env))
+	for key, value := range s.Env {
+		expanded, err := expandEnv(value)
+		if err != nil {
+			return nil, fmt.Errorf("env %s: %w", key, err)
+		}
+		env = append(env, key+"="+expanded)
+	}
+	sort.Strings(env)
+	return env, nil
+}
+
+// CommandLine returns the command and the arguments starting the server.
+// The stdio clients only take a command line: with Cwd, the command
+// is started by a shell after changing the directory.
+func (s MCPServerConfig) CommandLine() (string, []string, error) {
+	command, err := expandEnv(s.Command)
+	if err != nil {
+		return "", nil, fmt.Errorf("command: %w", err)
+	}
+	args := make([]string, 0, len(s.Args))
+	for _, arg := range s.Args {
+		expanded, err := expandEnv(arg)
+		if err != nil {
+			return "", nil, fmt.Errorf("args: %w", err)
+		}
+		args = append(args, expanded)
+	}
+	if s.Cwd == "" {
+		return command, args, nil
+	}
+
+	cwd, err := expandEnv(s.Cwd)
+	if err != nil {
+		return "", nil, fmt.Errorf("cwd: %w", err)
+	}
+	if info, err := os.Stat(cwd); err != nil || !info.IsDir() {
+		return "", nil, fmt.Errorf("cwd: %s is not a directory", cwd)
+	}
+	if runtime.GOOS == "windows" {
+		return "", nil, errors.New("cwd is not supported on Windows")
+	}
+	// the directory and the command line are passed as positional parameters
+	// (no quoting needed)
+	return "/bin/sh", append([]string{"-c", `cd "$0" && exec "$@"`, cwd, command}, args...), nil
+}
+
+// envReference is a ${VAR} or ${VAR:-default} reference
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandEnv replaces the ${VAR} references with the variables of the host
+// environment: an unset (or empty) variable takes the default value,
+// an unset variable without default is an error
+func expandEnv(value string) (string, error) {
+	var missing []string
+	expanded := envReference.ReplaceAllStringFunc(value, func(reference string) string {
+		match := envReference.FindStringSubmatch(reference)
+		variable, ok := os.LookupEnv(match[1])
+		switch {
+		case match[2] != "" && variable == "":
+			return match[3]
+		case !ok:
+			missing = append(missing, match[1])
+		}
+		return variable
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable %s is not set", missing[0])
+	}
+	return expanded, nil
+}
+
+// AllowsTool tells if the tool matches the include patterns
+// and none of the exclude patterns
+func (s MCPServerConfig) AllowsTool(tool string) bool {
+	included := len(s.Include) == 0
+	for _, pattern := range s.Include {
+		if matched, _ := filepath.Match(pattern, tool); matched {
+			included = true
+			break
+		}
+	}
+	if !included {
+		return false
+	}
+	for _, pattern := range s.Exclude {
+		if matched, _ := filepath.Match(pattern, tool); matched {
+			return false
+		}
+	}
+	return true
+}
+
+// RetryPolicy returns the retry policy of the server, or the default one
+func (s MCPServerConfig) RetryPolicy() RetryPolicy {
+	if s.Retry == nil {
+		return DefaultRetryPolicy
+	}
+	return *s.Retry
+}
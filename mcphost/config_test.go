@@ -0,0 +1,54 @@
+package mcphost
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, content string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	write("secrets.env", "MCPHOST_TEST_PORT=8080\n")
+	valid := write("mcp.json", `{"envFile": "secrets.env", "mcpServers": {"web": {"command": "web-server", "args": ["--port", "${MCPHOST_TEST_PORT}"]}}}`)
+	invalid := write("invalid.json", `{"mcpServers": {"web": {"args": ["--port", "8080"]}}}`)
+	t.Setenv("MCPHOST_TEST_PORT", "")
+	os.Unsetenv("MCPHOST_TEST_PORT")
+
+	// ParseConfig neither loads the env file nor validates the config
+	config, err := ParseConfig(valid)
+	if err != nil {
+		t.Fatalf("ParseConfig(mcp.json) = %v", err)
+	}
+	if _, set := os.LookupEnv("MCPHOST_TEST_PORT"); set {
+		t.Error("ParseConfig(mcp.json) loaded the env file")
+	}
+	if server := config.MCPServers["web"]; server.Command != "web-server" || len(server.Args) != 2 {
+		t.Errorf("ParseConfig(mcp.json) = %+v, want the web server", config.MCPServers)
+	}
+	if _, err := ParseConfig(invalid); err != nil {
+		t.Errorf("ParseConfig(invalid.json) = %v, want no error", err)
+	}
+	if _, err := ParseConfig(write("broken.json", `{"mcpServers": [`)); err == nil {
+		t.Error("ParseConfig(broken.json): error expected for an invalid JSON")
+	}
+
+	// LoadConfig loads the env file and validates the config
+	if config, err = LoadConfig(valid); err != nil {
+		t.Fatalf("LoadConfig(mcp.json) = %v", err)
+	}
+	if _, args, err := config.MCPServers["web"].CommandLine(); err != nil || strings.Join(args, " ") != "--port 8080" {
+		t.Errorf("CommandLine() = %v, %v, want --port 8080", args, err)
+	}
+	if _, err := LoadConfig(invalid); err == nil || !strings.Contains(err.Error(), "missing command") {
+		t.Errorf("LoadConfig(invalid.json) = %v, want a missing command error", err)
+	}
+}
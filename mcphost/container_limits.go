@@ -0,0 +1,115 @@
+package mcphost
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// ContainerConfig constrains the containers of the docker servers (command
+// "docker", args "run ..."), e.g. for the untrusted tools:
+//
+//	"container": {"memory": "512m", "cpus": "0.5", "network": "none", "readOnly": true}
+type ContainerConfig struct {
+	// Memory is the memory limit (docker format: 512m, 1g...)
+	Memory string `json:"memory"`
+	// CPUs is the number of CPUs (e.g. 0.5)
+	CPUs string `json:"cpus"`
+	// Network is the network of the container: none, bridge, host
+	// or the name of a network (the default network of the runtime by default)
+	Network string `json:"network"`
+	// ReadOnly mounts the root filesystem read-only (/tmp stays writable)
+	ReadOnly bool `json:"readOnly"`
+}
+
+// dockerMemory matches the docker memory sizes
+var dockerMemory = regexp.MustCompile(`^(?i)([0-9]+)([bkmg]?)$`)
+
+// validate checks the limits, kubernetes tells if the container is a pod
+func (c ContainerConfig) validate(kubernetes bool) error {
+	if c.Memory != "" && !dockerMemory.MatchString(c.Memory) {
+		return fmt.Errorf("container: invalid memory %s (e.g. 512m)", c.Memory)
+	}
+	if cpus, err := strconv.ParseFloat(c.CPUs, 64); c.CPUs != "" && (err != nil || cpus <= 0) {
+		return fmt.Errorf("container: invalid cpus %s (e.g. 0.5)", c.CPUs)
+	}
+	if kubernetes && c.Network != "" {
+		return fmt.Errorf("container: the network of the pods is set by the network policies of the cluster")
+	}
+	return nil
+}
+
+// runArgs returns the options of docker run
+func (c ContainerConfig) runArgs() []string {
+	var args []string
+	if c.Memory != "" {
+		args = append(args, "--memory", c.Memory)
+	}
+	if c.CPUs != "" {
+		args = append(args, "--cpus", c.CPUs)
+	}
+	if c.Network != "" {
+		args = append(args, "--network", c.Network)
+	}
+	if c.ReadOnly {
+		args = append(args, "--read-only", "--tmpfs", "/tmp")
+	}
+	return args
+}
+
+// setPodLimits sets the resources and the security context
+// of the container of a pod
+func (c ContainerConfig) setPodLimits(container *corev1.Container) error {
+	limits := corev1.ResourceList{}
+	if match := dockerMemory.FindStringSubmatch(c.Memory); match != nil {
+		// the suffixes of docker are binary units
+		memory, err := resource.ParseQuantity(match[1] + map[string]string{"": "", "b": "", "k": "Ki", "m": "Mi", "g": "Gi"}[strings.ToLower(match[2])])
+		if err != nil {
+			return fmt.Errorf("container: invalid memory %s: %w", c.Memory, err)
+		}
+		limits[corev1.ResourceMemory] = memory
+	}
+	if c.CPUs != "" {
+		cpus, err := resource.ParseQuantity(c.CPUs)
+		if err != nil {
+			return fmt.Errorf("container: invalid cpus %s: %w", c.CPUs, err)
+		}
+		limits[corev1.ResourceCPU] = cpus
+	}
+	if len(limits) > 0 {
+		container.Resources.Limits = limits
+	}
+	if c.ReadOnly {
+		readOnly := true
+		container.SecurityContext = &corev1.SecurityContext{ReadOnlyRootFilesystem: &readOnly}
+	}
+	return nil
+}
+
+// useContainerLimits sets the default limits of the config
+// on the docker servers without their own limits
+func (c *Config) useContainerLimits() error {
+	for name, server := range c.MCPServers {
+		if server.Command != RuntimeDocker || len(server.Args) == 0 || server.Args[0] != "run" {
+			if server.Container != nil {
+				return fmt.Errorf("server %s: container is only used by the docker run servers", name)
+			}
+			continue
+		}
+		if server.Container == nil && c.Container != nil {
+			server.Container = c.Container
+			c.MCPServers[name] = server
+		}
+		if server.Container != nil {
+			kubernetes := server.Kubernetes != nil || c.Kubernetes != nil
+			if err := server.Container.validate(kubernetes); err != nil {
+				return fmt.Errorf("server %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
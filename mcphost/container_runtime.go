@@ -0,0 +1,108 @@
+package mcphost
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"slices"
+)
+
+// Container runtimes of the stdio servers started with "docker"
+const (
+	RuntimeDocker  = "docker"
+	RuntimePodman  = "podman"
+	RuntimeNerdctl = "nerdctl"
+	// RuntimeAuto uses the first installed runtime of ContainerRuntimes
+	RuntimeAuto = "auto"
+)
+
+// ContainerRuntimes are the known runtimes, in the order of the detection:
+// their command lines are compatible with docker (run, exec, ps, inspect)
+var ContainerRuntimes = []string{RuntimeDocker, RuntimePodman, RuntimeNerdctl}
+
+// ContainerRuntimeConfig selects the runtime of the servers whose command is
+// "docker" (and of the discovery of DockerLabelsConfig): the command lines of
+// the config keep docker and run with podman or nerdctl on the hosts without
+// docker
+type ContainerRuntimeConfig struct {
+	// Name is one of ContainerRuntimes or RuntimeAuto (default)
+	Name string `json:"name"`
+	// Command is the path of the executable (the name of the runtime by default)
+	Command string `json:"command"`
+	// Args are added before the subcommand (e.g. ["--namespace", "k8s.io"] for nerdctl)
+	Args []string `json:"args"`
+	// RunArgs are added after the run subcommand (e.g. ["--userns=keep-id"] for podman)
+	RunArgs []string `json:"runArgs"`
+}
+
+// containerRuntime is the resolved runtime of the config
+type containerRuntime struct {
+	name    string
+	command string
+	args    []string
+	runArgs []string
+}
+
+// resolve returns the runtime of the config (c may be nil), the auto
+// detection falls back to docker when no runtime is installed
+func (c *ContainerRuntimeConfig) resolve() (containerRuntime, error) {
+	var config ContainerRuntimeConfig
+	if c != nil {
+		config = *c
+	}
+	runtime := containerRuntime{name: config.Name, command: config.Command, args: config.Args, runArgs: config.RunArgs}
+	switch {
+	case runtime.name == "" || runtime.name == RuntimeAuto:
+		runtime.name = RuntimeDocker
+		for _, name := range ContainerRuntimes {
+			if _, err := exec.LookPath(name); err == nil {
+				runtime.name = name
+				break
+			}
+		}
+		slog.Debug("container runtime detected", "runtime", runtime.name)
+	case !slices.Contains(ContainerRuntimes, runtime.name):
+		return runtime, fmt.Errorf("unknown runtime %s (%v or %s)", runtime.name, ContainerRuntimes, RuntimeAuto)
+	}
+	if runtime.command == "" {
+		runtime.command = runtime.name
+	}
+	return runtime, nil
+}
+
+// commandLine returns the command line of the runtime for the arguments
+// of a docker command line
+func (r containerRuntime) commandLine(args []string) (string, []string) {
+	line := append([]string{}, r.args...)
+	if len(args) > 0 && args[0] == "run" && len(r.runArgs) > 0 {
+		line = append(line, "run")
+		line = append(line, r.runArgs...)
+		args = args[1:]
+	}
+	return r.command, append(line, args...)
+}
+
+// cmd returns the command of the runtime for the arguments of a docker command
+func (r containerRuntime) cmd(ctx context.Context, args ...string) *exec.Cmd {
+	command, args := r.commandLine(args)
+	return exec.CommandContext(ctx, command, args...)
+}
+
+// useContainerRuntime runs the declared "docker" servers with the runtime
+func (c *Config) useContainerRuntime(runtime containerRuntime) {
+	for name, server := range c.MCPServers {
+		if server.Command != RuntimeDocker || server.Kubernetes != nil || (server.Transport != "" && server.Transport != "stdio") {
+			continue
+		}
+		args := server.Args
+		if server.Container != nil {
+			args = append(append([]string{"run"}, server.Container.runArgs()...), args[1:]...)
+		}
+		server.Command, server.Args = runtime.commandLine(args)
+		c.MCPServers[name] = server
+		if runtime.name != RuntimeDocker {
+			slog.Debug("server run with the container runtime", "server", name, "runtime", runtime.name)
+		}
+	}
+}
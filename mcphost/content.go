@@ -0,0 +1,141 @@
+package mcphost
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/ollama/ollama/api"
+)
+
+// ToolContent is the content of a tool result, converted for an Ollama message
+type ToolContent struct {
+	Text   string
+	Images []api.ImageData
+}
+
+// contentItem covers the fields of the MCP content types
+// (TextContent, ImageContent and EmbeddedResource)
+type contentItem struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	Data     string `json:"data"`
+	MIMEType string `json:"mimeType"`
+	Resource *struct {
+		URI      string `json:"uri"`
+		MIMEType string `json:"mimeType"`
+		Text     string `json:"text"`
+		Blob     string `json:"blob"`
+	} `json:"resource"`
+}
+
+// NormalizeToolResult converts all the content items of a tool result:
+// the texts are concatenated, the images are decoded for the Images field
+// of the Ollama message, and the other contents are described in the text.
+func NormalizeToolResult(result *mcp.CallToolResult) ToolContent {
+	return normalizeContent(result.Content)
+}
+
+// ConvertPromptMessages converts the messages of an MCP prompt to Ollama messages
+func ConvertPromptMessages(result *mcp.GetPromptResult) []api.Message {
+	messages := []api.Message{}
+	for _, message := range result.Messages {
+		content := normalizeContent([]interface{}{message.Content})
+		messages = append(messages, api.Message{
+			Role:    string(message.Role),
+			Content: content.Text,
+			Images:  content.Images,
+		})
+	}
+	return messages
+}
+
+// ConvertSamplingMessages converts the messages of a sampling request to Ollama messages
+func ConvertSamplingMessages(samplingMessages []mcp.SamplingMessage) []api.Message {
+	messages := []api.Message{}
+	for _, message := range samplingMessages {
+		content := normalizeContent([]interface{}{message.Content})
+		messages = append(messages, api.Message{
+			Role:    string(message.Role),
+			Content: content.Text,
+			Images:  content.Images,
+		})
+	}
+	return messages
+}
+
+// ConvertResourceContents converts the contents of a read resource
+// (they are handled like the embedded resources of the tool results)
+func ConvertResourceContents(result *mcp.ReadResourceResult) ToolContent {
+	items := []interface{}{}
+	for _, contents := range result.Contents {
+		items = append(items, map[string]interface{}{
+			"type":     "resource",
+			"resource": contents,
+		})
+	}
+	return normalizeContent(items)
+}
+
+func normalizeContent[T any](items []T) ToolContent {
+	content := ToolContent{}
+	texts := []string{}
+
+	for _, raw := range items {
+		// Depending on the transport, an item is a map or an mcp content struct
+		var item contentItem
+		data, err := json.Marshal(raw)
+		if err == nil {
+			err = json.Unmarshal(data, &item)
+		}
+		if err != nil {
+			texts = append(texts, "[unreadable content]")
+			continue
+		}
+
+		switch item.Type {
+		case "text":
+			texts = append(texts, item.Text)
+
+		case "image":
+			image, err := base64.StdEncoding.DecodeString(item.Data)
+			if err != nil {
+				texts = append(texts, fmt.Sprintf("[invalid %s image]", item.MIMEType))
+				continue
+			}
+			content.Images = append(content.Images, api.ImageData(image))
+			texts = append(texts, fmt.Sprintf("[%s image #%d]", item.MIMEType, len(content.Images)))
+
+		case "resource":
+			if item.Resource == nil {
+				continue
+			}
+			resource := item.Resource
+			switch {
+			case resource.Blob == "":
+				texts = append(texts, fmt.Sprintf("Resource %s:\n%s", resource.URI, resource.Text))
+			case strings.HasPrefix(resource.MIMEType, "image/"):
+				image, err := base64.StdEncoding.DecodeString(resource.Blob)
+				if err != nil {
+					texts = append(texts, fmt.Sprintf("[invalid %s resource %s]", resource.MIMEType, resource.URI))
+					continue
+				}
+				content.Images = append(content.Images, api.ImageData(image))
+				texts = append(texts, fmt.Sprintf("[%s image #%d: %s]", resource.MIMEType, len(content.Images), resource.URI))
+			default:
+				texts = append(texts, fmt.Sprintf(
+					"[binary resource %s (%s, %d bytes)]",
+					resource.URI, resource.MIMEType, base64.StdEncoding.DecodedLen(len(resource.Blob)),
+				))
+			}
+
+		default:
+			texts = append(texts, fmt.Sprintf("[unsupported %s content]", item.Type))
+		}
+	}
+
+	content.Text = strings.Join(texts, "\n")
+	return content
+}
@@ -0,0 +1,168 @@
+package mcphost
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ollama/ollama/api"
+)
+
+// DefaultContextWindow is the context size (num_ctx) of Ollama
+// when the options of the host do not set it
+const DefaultContextWindow = 2048
+
+// Estimations of the tokens: there is no tokenizer in the host
+const (
+	charactersPerToken = 4
+	// messageOverheadTokens covers the role and the separators of the template
+	messageOverheadTokens = 4
+	imageTokens           = 512
+)
+
+// EstimateTokens estimates the number of tokens of a text
+func EstimateTokens(text string) int {
+	return (len(text) + charactersPerToken - 1) / charactersPerToken
+}
+
+// EstimateMessageTokens estimates the number of tokens of a message
+func EstimateMessageTokens(message api.Message) int {
+	tokens := messageOverheadTokens + EstimateTokens(message.Content)
+	for _, toolCall := range message.ToolCalls {
+		tokens += EstimateTokens(toolCall.Function.Name) + EstimateTokens(toolCall.Function.Arguments.String())
+	}
+	return tokens + len(message.Images)*imageTokens
+}
+
+// EstimateMessagesTokens estimates the number of tokens of a conversation
+func EstimateMessagesTokens(messages []api.Message) int {
+	tokens := 0
+	for _, message := range messages {
+		tokens += EstimateMessageTokens(message)
+	}
+	return tokens
+}
+
+// toolsTokens estimates the number of tokens of the tools catalog
+func toolsTokens(tools []api.Tool) int {
+	tokens := 0
+	for _, tool := range tools {
+		data, _ := json.Marshal(tool)
+		tokens += EstimateTokens(string(data))
+	}
+	return tokens
+}
+
+// contextWindow returns the num_ctx option, or the default context size
+func contextWindow(options map[string]interface{}) int {
+	switch value := options["num_ctx"].(type) {
+	case int:
+		return value
+	case float64:
+		return int(value)
+	}
+	return DefaultContextWindow
+}
+
+// promptBudget is the part of the context window left to the prompt:
+// a quarter of the window (at most 1024 tokens) is kept for the answer
+func promptBudget(options map[string]interface{}) int {
+	window := contextWindow(options)
+	return window - min(window/4, 1024)
+}
+
+// FitContextWindow returns the messages trimmed to fit in budget tokens,
+// so that Ollama does not silently truncate the beginning of the prompt:
+//   - the oldest messages after the system messages are dropped first
+//     (with their tool results), the last user message is always kept;
+//   - then the largest tool results are shortened, at a line boundary,
+//     with a note telling how much was removed.
+func FitContextWindow(messages []api.Message, budget int) []api.Message {
+	tokens := EstimateMessagesTokens(messages)
+	if tokens <= budget {
+		return messages
+	}
+
+	// The system messages and the messages from the last user message are kept
+	first := 0
+	for first < len(messages) && messages[first].Role == "system" {
+		first++
+	}
+	lastUser := len(messages) - 1
+	for lastUser > first && (messages[lastUser].Role != "user" || isToolResult(messages[lastUser])) {
+		lastUser--
+	}
+
+	kept := append([]api.Message{}, messages[:first]...)
+	dropped := 0
+	older := messages[first:lastUser]
+	for len(older) > 0 && tokens > budget {
+		tokens -= EstimateMessageTokens(older[0])
+		older = older[1:]
+		dropped++
+		// a tool result without its tool call is dropped too
+		for len(older) > 0 && older[0].Role == "tool" {
+			tokens -= EstimateMessageTokens(older[0])
+			older = older[1:]
+			dropped++
+		}
+	}
+	kept = append(kept, older...)
+	kept = append(kept, messages[lastUser:]...)
+	if dropped > 0 {
+		slog.Warn("the conversation does not fit in the context window: older messages dropped",
+			"dropped", dropped, "budget", budget)
+	}
+
+	// Shorten the largest tool results (a copy: the history is not changed)
+	for tokens > budget {
+		largest := -1
+		for i, message := range kept {
+			if isToolResult(message) && (largest < 0 || len(message.Content) > len(kept[largest].Content)) {
+				largest = i
+			}
+		}
+		if largest < 0 || EstimateTokens(kept[largest].Content) <= 64 {
+			slog.Warn("the prompt is still larger than the context window", "tokens", tokens, "budget", budget)
+			break
+		}
+		before := EstimateMessageTokens(kept[largest])
+		excess := tokens - budget
+		// 100 characters are left for the note
+		keep := max(len(kept[largest].Content)-excess*charactersPerToken-100, 256)
+		kept[largest].Content = truncateText(kept[largest].Content, keep)
+		tokens += EstimateMessageTokens(kept[largest]) - before
+		slog.Warn("tool result truncated to fit in the context window", "budget", budget)
+	}
+	return kept
+}
+
+// isToolResult tells if the message contains a tool result
+// (a tool message, or a user message of the prompt tool call mode)
+func isToolResult(message api.Message) bool {
+	return message.Role == "tool" || (message.Role == "user" && strings.HasPrefix(message.Content, "Result of the tool "))
+}
+
+// truncateText keeps about size characters of the text, cut at a line boundary
+func truncateText(text string, size int) string {
+	if size >= len(text) {
+		return text
+	}
+	cut := cutIndex(text, size)
+	return text[:cut] + fmt.Sprintf("\n[... %d characters truncated to fit in the context window]", len(text)-cut)
+}
+
+// cutIndex returns where to cut the text to keep at most size bytes:
+// at the last line boundary, or at a rune boundary when the line is too long
+func cutIndex(text string, size int) int {
+	cut := strings.LastIndex(text[:size], "\n")
+	if cut < size/2 {
+		cut = size
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+	}
+	return cut
+}
@@ -0,0 +1,173 @@
+package mcphost
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronShortcuts are the @ shortcuts of the cron expressions
+var cronShortcuts = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronNames are the names of the months and of the days of the week
+var cronNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+// cronSchedule is a parsed cron expression: the allowed values of each field,
+// or a fixed interval (@every)
+type cronSchedule struct {
+	minutes, hours, days, months, weekdays map[int]bool
+	// anyDay and anyWeekday tell if the fields are *: when both fields are
+	// restricted, a time matching one of them matches
+	anyDay, anyWeekday bool
+	every              time.Duration
+}
+
+// parseCron parses a cron expression: 5 fields (minute hour day-of-month
+// month day-of-week) with the *, lists, ranges, steps and names
+// (e.g. "0 8 * * mon-fri", "*/15 * * * *"), a @ shortcut (@daily, @hourly...)
+// or "@every <duration>"
+func parseCron(expression string) (*cronSchedule, error) {
+	expression = strings.TrimSpace(expression)
+	if interval, ok := strings.CutPrefix(expression, "@every "); ok {
+		every, err := time.ParseDuration(strings.TrimSpace(interval))
+		if err != nil || every < time.Second {
+			return nil, fmt.Errorf("invalid interval %s (at least 1s)", interval)
+		}
+		return &cronSchedule{every: every}, nil
+	}
+	if shortcut, ok := cronShortcuts[expression]; ok {
+		expression = shortcut
+	}
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression %q: 5 fields are expected", expression)
+	}
+	schedule := &cronSchedule{anyDay: fields[2] == "*", anyWeekday: fields[4] == "*"}
+	var err error
+	for _, field := range []struct {
+		values   *map[int]bool
+		text     string
+		min, max int
+	}{
+		{&schedule.minutes, fields[0], 0, 59},
+		{&schedule.hours, fields[1], 0, 23},
+		{&schedule.days, fields[2], 1, 31},
+		{&schedule.months, fields[3], 1, 12},
+		{&schedule.weekdays, fields[4], 0, 7},
+	} {
+		if *field.values, err = parseCronField(field.text, field.min, field.max); err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %w", expression, err)
+		}
+	}
+	// 7 is also Sunday
+	if schedule.weekdays[7] {
+		schedule.weekdays[0] = true
+	}
+	return schedule, nil
+}
+
+// parseCronField returns the values of a field: a list of *, values
+// and ranges, with an optional step (e.g. "1-5", "*/10", "0,30")
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+	values := map[int]bool{}
+	for _, part := range strings.Split(field, ",") {
+		part, stepText, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepText); err != nil || step <= 0 {
+				return nil, fmt.Errorf("invalid step %s", stepText)
+			}
+		}
+		start, end := min, max
+		if part != "*" {
+			first, last, isRange := strings.Cut(part, "-")
+			var err error
+			if start, err = cronValue(first, min, max); err != nil {
+				return nil, err
+			}
+			end = start
+			if isRange {
+				if end, err = cronValue(last, min, max); err != nil {
+					return nil, err
+				}
+			} else if hasStep {
+				// "5/10" is from 5 to the end
+				end = max
+			}
+			if end < start {
+				return nil, fmt.Errorf("invalid range %s", part)
+			}
+		}
+		for value := start; value <= end; value += step {
+			values[value] = true
+		}
+	}
+	return values, nil
+}
+
+func cronValue(text string, min, max int) (int, error) {
+	value, ok := cronNames[strings.ToLower(text)]
+	if !ok {
+		var err error
+		if value, err = strconv.Atoi(text); err != nil {
+			return 0, fmt.Errorf("invalid value %s", text)
+		}
+	}
+	if value < min || value > max {
+		return 0, fmt.Errorf("value %s out of the range %d-%d", text, min, max)
+	}
+	return value, nil
+}
+
+// next returns the first time of the schedule after t (the zero time
+// when there is none within 5 years, e.g. on February 30)
+func (s *cronSchedule) next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Add(s.every)
+	}
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case !s.months[int(t.Month())]:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !s.hours[t.Hour()]:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case !s.minutes[t.Minute()]:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// matchesDay tells if the day of t matches the day-of-month and day-of-week fields
+func (s *cronSchedule) matchesDay(t time.Time) bool {
+	day, weekday := s.days[t.Day()], s.weekdays[int(t.Weekday())]
+	switch {
+	case s.anyDay && s.anyWeekday:
+		return true
+	case s.anyDay:
+		return weekday
+	case s.anyWeekday:
+		return day
+	}
+	return day || weekday
+}
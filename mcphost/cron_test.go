@@ -0,0 +1,117 @@
+package mcphost
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expression string
+		// want are the allowed values of the fields
+		// (minutes, hours, days, months, weekdays)
+		want [5][]int
+		err  string
+	}{
+		{expression: "*/15 0 1 1 0", want: [5][]int{{0, 15, 30, 45}, {0}, {1}, {1}, {0}}},
+		{expression: "5/10 0 1 1 0", want: [5][]int{{5, 15, 25, 35, 45, 55}, {0}, {1}, {1}, {0}}},
+		{expression: "0 1-5/2 1 1 0", want: [5][]int{{0}, {1, 3, 5}, {1}, {1}, {0}}},
+		{expression: "0,30 8 1,15 jan,JUL mon-fri", want: [5][]int{{0, 30}, {8}, {1, 15}, {1, 7}, {1, 2, 3, 4, 5}}},
+		{expression: "0 0 1 1 7", want: [5][]int{{0}, {0}, {1}, {1}, {0, 7}}},
+		{expression: "0 0 1 1 fri-sun", err: "invalid range fri-sun"},
+		{expression: "@weekly", want: [5][]int{{0}, {0}, nil, nil, {0}}},
+		{expression: "0 0 * * *", want: [5][]int{{0}, {0}, nil, nil, nil}},
+		{expression: "*/0 * * * *", err: "invalid step 0"},
+		{expression: "0 5-1 * * *", err: "invalid range 5-1"},
+		{expression: "60 * * * *", err: "value 60 out of the range 0-59"},
+		{expression: "0 0 0 * *", err: "value 0 out of the range 1-31"},
+		{expression: "0 0 * foo *", err: "invalid value foo"},
+		{expression: "0 0 * *", err: "5 fields are expected"},
+		{expression: "@every 500ms", err: "invalid interval 500ms (at least 1s)"},
+		{expression: "@every soon", err: "invalid interval soon (at least 1s)"},
+	}
+	for _, test := range tests {
+		t.Run(test.expression, func(t *testing.T) {
+			schedule, err := parseCron(test.expression)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("parseCron() = %v, want an error with %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseCron() = %v", err)
+			}
+			fields := []map[int]bool{schedule.minutes, schedule.hours, schedule.days, schedule.months, schedule.weekdays}
+			for i, field := range fields {
+				// the * fields are checked with the full ranges
+				if test.want[i] == nil {
+					continue
+				}
+				values := []int{}
+				for value := range field {
+					values = append(values, value)
+				}
+				sort.Ints(values)
+				if !reflect.DeepEqual(values, test.want[i]) {
+					t.Errorf("field %d = %v, want %v", i+1, values, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skipf("no time zone database: %v", err)
+	}
+	// 2026-10-16 is a Friday
+	friday := time.Date(2026, 10, 16, 10, 7, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		expression string
+		from       time.Time
+		want       time.Time
+	}{
+		{name: "next minute", expression: "* * * * *", from: friday, want: friday.Add(time.Minute)},
+		{name: "step", expression: "*/15 * * * *", from: friday, want: time.Date(2026, 10, 16, 10, 15, 0, 0, time.UTC)},
+		{name: "next hour", expression: "5 * * * *", from: friday, want: time.Date(2026, 10, 16, 11, 5, 0, 0, time.UTC)},
+		{name: "working days", expression: "0 8 * * mon-fri", from: friday, want: time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)},
+		{name: "sunday as 7", expression: "0 8 * * 7", from: friday, want: time.Date(2026, 10, 18, 8, 0, 0, 0, time.UTC)},
+		{name: "next month", expression: "0 0 1 * *", from: friday, want: time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "next year", expression: "@yearly", from: friday, want: time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		// with a day of month and a day of week, a day matching one of them matches
+		{name: "day of week or day of month", expression: "0 0 1 * mon", from: friday, want: time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)},
+		{name: "day of month or day of week", expression: "0 0 1 * mon", from: time.Date(2026, 10, 27, 0, 0, 0, 0, time.UTC),
+			want: time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "leap day", expression: "0 0 29 2 *", from: friday, want: time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{name: "impossible date", expression: "0 0 30 2 *", from: friday, want: time.Time{}},
+		{name: "interval", expression: "@every 90s", from: friday.Add(time.Second), want: friday.Add(91 * time.Second)},
+		// 2026-03-29 02:00 CET is 03:00 CEST, 2026-10-25 03:00 CEST is 02:00 CET
+		{name: "hourly when the clocks go forward", expression: "0 * * * *", from: time.Date(2026, 3, 29, 1, 0, 0, 0, paris),
+			want: time.Date(2026, 3, 29, 3, 0, 0, 0, paris)},
+		{name: "skipped local time", expression: "30 2 * * *", from: time.Date(2026, 3, 28, 3, 0, 0, 0, paris),
+			want: time.Date(2026, 3, 30, 2, 30, 0, 0, paris)},
+		{name: "hourly when the clocks go back", expression: "0 * * * *", from: time.Date(2026, 10, 25, 0, 0, 0, 0, time.UTC).In(paris),
+			want: time.Date(2026, 10, 25, 1, 0, 0, 0, time.UTC)},
+		{name: "repeated local time", expression: "30 2 * * *", from: time.Date(2026, 10, 24, 2, 30, 0, 0, paris),
+			want: time.Date(2026, 10, 25, 1, 30, 0, 0, time.UTC)},
+		{name: "day after the repeated local time", expression: "30 2 * * *", from: time.Date(2026, 10, 25, 1, 30, 0, 0, time.UTC).In(paris),
+			want: time.Date(2026, 10, 26, 2, 30, 0, 0, paris)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schedule, err := parseCron(test.expression)
+			if err != nil {
+				t.Fatalf("parseCron(%q) = %v", test.expression, err)
+			}
+			if got := schedule.next(test.from); !got.Equal(test.want) {
+				t.Errorf("next(%v) = %v, want %v", test.from, got, test.want)
+			}
+		})
+	}
+}
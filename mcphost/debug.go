@@ -0,0 +1,115 @@
+package mcphost
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// debugMCPClient logs the JSON-RPC requests sent to a server and its responses
+// (as they are decoded by the client: when a tool result has an unexpected
+// shape, the logged result shows what the host received)
+type debugMCPClient struct {
+	server string
+	client MCPClient
+}
+
+// traceCall logs the params of the request, then the result (or the error) of the call
+func traceCall[T any](c *debugMCPClient, method string, params interface{}, call func() (T, error)) (T, error) {
+	slog.Info("mcp request", "server", c.server, "method", method, "params", rawJSON(params))
+	start := time.Now()
+	result, err := call()
+	if err != nil {
+		slog.Info("mcp error", "server", c.server, "method", method, "duration", time.Since(start), "error", err)
+	} else {
+		slog.Info("mcp response", "server", c.server, "method", method, "duration", time.Since(start), "result", rawJSON(result))
+	}
+	return result, err
+}
+
+// rawJSON returns the JSON of a message for the logs
+func rawJSON(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
+
+func (c *debugMCPClient) Initialize(ctx context.Context, request mcp.InitializeRequest) (*mcp.InitializeResult, error) {
+	return traceCall(c, "initialize", request.Params, func() (*mcp.InitializeResult, error) {
+		return c.client.Initialize(ctx, request)
+	})
+}
+
+func (c *debugMCPClient) Ping(ctx context.Context) error {
+	_, err := traceCall(c, "ping", nil, func() (struct{}, error) {
+		return struct{}{}, c.client.Ping(ctx)
+	})
+	return err
+}
+
+func (c *debugMCPClient) ListTools(ctx context.Context, request mcp.ListToolsRequest) (*mcp.ListToolsResult, error) {
+	return traceCall(c, "tools/list", request.Params, func() (*mcp.ListToolsResult, error) {
+		return c.client.ListTools(ctx, request)
+	})
+}
+
+func (c *debugMCPClient) CallTool(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return traceCall(c, "tools/call", request.Params, func() (*mcp.CallToolResult, error) {
+		return c.client.CallTool(ctx, request)
+	})
+}
+
+func (c *debugMCPClient) ListPrompts(ctx context.Context, request mcp.ListPromptsRequest) (*mcp.ListPromptsResult, error) {
+	return traceCall(c, "prompts/list", request.Params, func() (*mcp.ListPromptsResult, error) {
+		return c.client.ListPrompts(ctx, request)
+	})
+}
+
+func (c *debugMCPClient) GetPrompt(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	return traceCall(c, "prompts/get", request.Params, func() (*mcp.GetPromptResult, error) {
+		return c.client.GetPrompt(ctx, request)
+	})
+}
+
+func (c *debugMCPClient) ListResources(ctx context.Context, request mcp.ListResourcesRequest) (*mcp.ListResourcesResult, error) {
+	return traceCall(c, "resources/list", request.Params, func() (*mcp.ListResourcesResult, error) {
+		return c.client.ListResources(ctx, request)
+	})
+}
+
+func (c *debugMCPClient) ReadResource(ctx context.Context, request mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+	return traceCall(c, "resources/read", request.Params, func() (*mcp.ReadResourceResult, error) {
+		return c.client.ReadResource(ctx, request)
+	})
+}
+
+func (c *debugMCPClient) Subscribe(ctx context.Context, request mcp.SubscribeRequest) error {
+	_, err := traceCall(c, "resources/subscribe", request.Params, func() (struct{}, error) {
+		return struct{}{}, c.client.Subscribe(ctx, request)
+	})
+	return err
+}
+
+func (c *debugMCPClient) Unsubscribe(ctx context.Context, request mcp.UnsubscribeRequest) error {
+	_, err := traceCall(c, "resources/unsubscribe", request.Params, func() (struct{}, error) {
+		return struct{}{}, c.client.Unsubscribe(ctx, request)
+	})
+	return err
+}
+
+func (c *debugMCPClient) SetLevel(ctx context.Context, request mcp.SetLevelRequest) error {
+	_, err := traceCall(c, "logging/setLevel", request.Params, func() (struct{}, error) {
+		return struct{}{}, c.client.SetLevel(ctx, request)
+	})
+	return err
+}
+
+func (c *debugMCPClient) Close() error {
+	slog.Info("mcp close", "server", c.server)
+	return c.client.Close()
+}
@@ -0,0 +1,853 @@
+package mcphost
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/coder/websocket"
+)
+
+// Default settings of the Discord bot
+const (
+	DefaultDiscordAPIURL          = "https://discord.com/api/v10"
+	DefaultDiscordApprovalTimeout = 5 * time.Minute
+)
+
+// maxDiscordText is the maximum number of characters of a message
+const maxDiscordText = 2000
+
+// Opcodes of the Discord gateway
+const (
+	discordDispatch       = 0
+	discordHeartbeat      = 1
+	discordIdentify       = 2
+	discordReconnect      = 7
+	discordInvalidSession = 9
+	discordHello          = 10
+	discordHeartbeatACK   = 11
+)
+
+// Intents of the gateway: the messages of the servers and the direct
+// messages (the content of the messages mentioning the bot is given
+// without the privileged message content intent)
+const discordIntents = 1<<9 | 1<<12
+
+// Types of the interactions and of their responses
+const (
+	discordApplicationCommand = 2
+	discordMessageComponent   = 3
+
+	discordChannelMessage         = 4
+	discordDeferredChannelMessage = 5
+	discordUpdateMessage          = 7
+)
+
+// discordEphemeral is the flag of the responses only shown to the user
+const discordEphemeral = 1 << 6
+
+// discordCommands are the slash commands of the bot
+var discordCommands = []map[string]interface{}{
+	{
+		"name":        "ask",
+		"description": "Ask a question to the MCP host",
+		"options": []map[string]interface{}{
+			{"type": 3, "name": "prompt", "description": "The question", "required": true},
+		},
+	},
+	{"name": "reset", "description": "Start a new conversation in this channel"},
+}
+
+// DiscordConfig connects the host to a Discord bot through the gateway: a
+// mention of the bot (or a direct message) and the /ask slash command ask
+// the prompt to the session of the channel, the answer is streamed by editing
+// the reply, the tool calls are approved with the buttons of a message, e.g.
+//
+//	"discord": {"tokenEnv": "DISCORD_BOT_TOKEN", "guilds": ["123456789012345678"]}
+//
+// The bot needs the bot and applications.commands scopes and the
+// permission to send messages.
+type DiscordConfig struct {
+	// TokenEnv is the environment variable of the bot token,
+	// DISCORD_BOT_TOKEN by default
+	TokenEnv string `json:"tokenEnv"`
+	// APIURL is the base URL of the REST API (DefaultDiscordAPIURL by default)
+	APIURL string `json:"apiURL"`
+	// Guilds are the servers where the slash commands are registered (they are
+	// available at once), else they are global (Discord can take an hour to show them)
+	Guilds []string `json:"guilds"`
+	// UpdateInterval is the time between two edits of the reply while the
+	// answer is streamed (DefaultUpdateInterval by default)
+	UpdateInterval Duration `json:"updateInterval"`
+	// ApprovalTimeout is the time given to click a button of an approval,
+	// then the tool call is denied (DefaultDiscordApprovalTimeout by default)
+	ApprovalTimeout Duration `json:"approvalTimeout"`
+}
+
+// validate checks the setting of the bot (the token is checked when it starts)
+func (c DiscordConfig) validate() error {
+	if c.APIURL != "" {
+		if _, err := url.ParseRequestURI(c.APIURL); err != nil {
+			return fmt.Errorf("discord: invalid apiURL: %w", err)
+		}
+	}
+	switch {
+	case c.UpdateInterval < 0:
+		return fmt.Errorf("discord: negative updateInterval")
+	case c.ApprovalTimeout < 0:
+		return fmt.Errorf("discord: negative approvalTimeout")
+	}
+	return nil
+}
+
+// DiscordError is an error answered by the REST API of Discord
+type DiscordError struct {
+	Status  int
+	Message string
+}
+
+func (e *DiscordError) Error() string {
+	return fmt.Sprintf("discord: %s (%d)", e.Message, e.Status)
+}
+
+// discordUser is a user of a message or of an interaction
+type discordUser struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Bot      bool   `json:"bot"`
+}
+
+// discordMessage is a message received from the gateway or created by the bot
+type discordMessage struct {
+	ID        string        `json:"id"`
+	ChannelID string        `json:"channel_id"`
+	GuildID   string        `json:"guild_id"`
+	Content   string        `json:"content"`
+	Author    discordUser   `json:"author"`
+	Mentions  []discordUser `json:"mentions"`
+}
+
+// discordInteraction is a slash command or a click on a button
+type discordInteraction struct {
+	ID        string `json:"id"`
+	Type      int    `json:"type"`
+	Token     string `json:"token"`
+	ChannelID string `json:"channel_id"`
+	// Member is the member of the server who interacted, User the user of a direct message
+	Member *struct {
+		User discordUser `json:"user"`
+	} `json:"member"`
+	User *discordUser `json:"user"`
+	Data struct {
+		Name     string `json:"name"`
+		CustomID string `json:"custom_id"`
+		Options  []struct {
+			Name  string      `json:"name"`
+			Value interface{} `json:"value"`
+		} `json:"options"`
+	} `json:"data"`
+	// Message is the message of the clicked button
+	Message *discordMessage `json:"message"`
+}
+
+// user returns the id of the user of the interaction
+func (i discordInteraction) user() string {
+	if i.Member != nil {
+		return i.Member.User.ID
+	}
+	if i.User != nil {
+		return i.User.ID
+	}
+	return ""
+}
+
+// DiscordBot answers the mentions and the slash commands of a Discord bot with
+// the chat sessions of the host: each channel is a session, the sessions
+// answer one prompt at a time
+type DiscordBot struct {
+	Host   *Host
+	Config DiscordConfig
+	// Sessions are the sessions of the channels
+	Sessions *SessionPool
+	// Timeout of a turn (0 means no timeout)
+	Timeout time.Duration
+
+	token  string
+	client *http.Client
+	turns  sync.WaitGroup
+
+	mu sync.Mutex
+	// user and application are the ids of the bot (READY event)
+	user, application string
+	registered        bool
+	// channels are the approvers of the channels, approvals the pending approvals by id
+	channels  map[string]*discordChannel
+	approvals map[string]*discordApproval
+}
+
+// discordChannel is the approver of a channel: the "always" answers are kept
+// between the turns, the questions are asked to the user of the running turn
+type discordChannel struct {
+	approver *Approver
+	turn     context.Context
+	user     string
+	lastUsed time.Time
+}
+
+// discordApproval is an approval waiting for the click of its user
+type discordApproval struct {
+	user   string
+	answer chan string
+}
+
+// NewDiscordBot returns the bot of the host, with a default session pool
+func NewDiscordBot(host *Host, config DiscordConfig, timeout time.Duration) *DiscordBot {
+	return &DiscordBot{
+		Host:      host,
+		Config:    config,
+		Sessions:  NewSessionPool(host, 0, 0),
+		Timeout:   timeout,
+		client:    &http.Client{Timeout: scheduleWebhookTimeout},
+		channels:  map[string]*discordChannel{},
+		approvals: map[string]*discordApproval{},
+	}
+}
+
+// Run connects the bot to the gateway until the context is cancelled: the
+// connection is opened again when it is lost (or when Discord asks to),
+// Run waits for the end of the running turns
+func (b *DiscordBot) Run(ctx context.Context) error {
+	tokenEnv := b.Config.TokenEnv
+	if tokenEnv == "" {
+		tokenEnv = "DISCORD_BOT_TOKEN"
+	}
+	if b.token = os.Getenv(tokenEnv); b.token == "" {
+		return fmt.Errorf("the environment variable %s of the Discord bot token is not set", tokenEnv)
+	}
+	defer b.turns.Wait()
+
+	policy := BackoffPolicy{InitialDelay: Duration(time.Second), MaxDelay: Duration(time.Minute)}
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		err := b.connect(ctx)
+		var discordErr *DiscordError
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case errors.As(err, &discordErr) && discordErr.Status == http.StatusUnauthorized:
+			// a wrong token
+			return err
+		case err == nil:
+			// Discord asks to reconnect
+			attempt = 0
+			continue
+		case time.Since(start) > time.Minute:
+			// the loss of a connection which worked
+			attempt = 0
+		}
+		delay := policy.delay(max(attempt, 1))
+		slog.Warn("Discord connection closed, reconnecting", "error", err, "delay", delay)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+	}
+}
+
+// connect opens a gateway connection and handles its events until it is
+// closed (nil when Discord asks to reconnect)
+func (b *DiscordBot) connect(ctx context.Context) error {
+	var gateway struct {
+		URL string `json:"url"`
+	}
+	if err := b.call(ctx, http.MethodGet, "/gateway/bot", nil, &gateway); err != nil {
+		return err
+	}
+	ws, _, err := websocket.Dial(ctx, strings.TrimSuffix(gateway.URL, "/")+"/?v=10&encoding=json", nil)
+	if err != nil {
+		return err
+	}
+	defer ws.CloseNow()
+	ws.SetReadLimit(maxWebSocketMessage)
+
+	// sequence is the number of the last event (0 before the first one),
+	// sent back with the heartbeats
+	var sequence atomic.Int64
+	var acked atomic.Bool
+	done := make(chan struct{})
+	defer close(done)
+	heartbeat := func() error {
+		var last interface{}
+		if s := sequence.Load(); s > 0 {
+			last = s
+		}
+		return discordSend(ctx, ws, discordHeartbeat, last)
+	}
+
+	for {
+		// the connection is closed when ctx is cancelled
+		_, data, err := ws.Read(ctx)
+		if err != nil {
+			return err
+		}
+		var payload struct {
+			Op int             `json:"op"`
+			D  json.RawMessage `json:"d"`
+			S  int64           `json:"s"`
+			T  string          `json:"t"`
+		}
+		if err := json.Unmarshal(data, &payload); err != nil {
+			slog.Warn("invalid Discord message", "error", err)
+			continue
+		}
+		if payload.S > 0 {
+			sequence.Store(payload.S)
+		}
+		switch payload.Op {
+		case discordHello:
+			var hello struct {
+				HeartbeatInterval int64 `json:"heartbeat_interval"`
+			}
+			if err := json.Unmarshal(payload.D, &hello); err != nil || hello.HeartbeatInterval <= 0 {
+				return fmt.Errorf("invalid Discord hello: %s", payload.D)
+			}
+			acked.Store(true)
+			go discordHeartbeats(ws, time.Duration(hello.HeartbeatInterval)*time.Millisecond, heartbeat, &acked, done)
+			err = discordSend(ctx, ws, discordIdentify, map[string]interface{}{
+				"token":      b.token,
+				"intents":    discordIntents,
+				"properties": map[string]string{"os": runtime.GOOS, "browser": "mcphost", "device": "mcphost"},
+			})
+			if err != nil {
+				return err
+			}
+		case discordHeartbeat:
+			if err := heartbeat(); err != nil {
+				return err
+			}
+		case discordHeartbeatACK:
+			acked.Store(true)
+		case discordReconnect:
+			slog.Info("Discord asks to reconnect")
+			return nil
+		case discordInvalidSession:
+			return fmt.Errorf("invalid Discord session")
+		case discordDispatch:
+			b.dispatch(ctx, payload.T, payload.D)
+		}
+	}
+}
+
+// discordHeartbeats sends the heartbeats of the connection until done is closed:
+// the first one after a random part of the interval (as asked by Discord), and
+// the connection is closed when the previous heartbeat was not acknowledged
+func discordHeartbeats(ws *websocket.Conn, interval time.Duration, heartbeat func() error, acked *atomic.Bool, done chan struct{}) {
+	timer := time.NewTimer(time.Duration(rand.Float64() * float64(interval)))
+	defer timer.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-timer.C:
+		}
+		if !acked.Swap(false) {
+			slog.Warn("no Discord heartbeat acknowledgement, closing the connection")
+			ws.CloseNow()
+			return
+		}
+		if err := heartbeat(); err != nil {
+			return
+		}
+		timer.Reset(interval)
+	}
+}
+
+// discordSend sends a payload of the opcode to the gateway
+func discordSend(ctx context.Context, ws *websocket.Conn, op int, d interface{}) error {
+	data, err := json.Marshal(map[string]interface{}{"op": op, "d": d})
+	if err != nil {
+		return err
+	}
+	return ws.Write(ctx, websocket.MessageText, data)
+}
+
+// dispatch handles an event of the gateway
+func (b *DiscordBot) dispatch(ctx context.Context, event string, data json.RawMessage) {
+	switch event {
+	case "READY":
+		var ready struct {
+			User        discordUser `json:"user"`
+			Application struct {
+				ID string `json:"id"`
+			} `json:"application"`
+		}
+		if err := json.Unmarshal(data, &ready); err != nil {
+			slog.Warn("invalid Discord READY event", "error", err)
+			return
+		}
+		b.mu.Lock()
+		b.user, b.application = ready.User.ID, ready.Application.ID
+		registered := b.registered
+		b.registered = true
+		b.mu.Unlock()
+		slog.Info("connected to Discord", "bot", ready.User.Username)
+		if !registered {
+			if err := b.registerCommands(ctx, ready.Application.ID); err != nil {
+				slog.Warn("failed to register the Discord slash commands", "error", err)
+			}
+		}
+
+	case "MESSAGE_CREATE":
+		var message discordMessage
+		if err := json.Unmarshal(data, &message); err != nil {
+			slog.Warn("invalid Discord message", "error", err)
+			return
+		}
+		b.handleMessage(ctx, message)
+
+	case "INTERACTION_CREATE":
+		var interaction discordInteraction
+		if err := json.Unmarshal(data, &interaction); err != nil {
+			slog.Warn("invalid Discord interaction", "error", err)
+			return
+		}
+		b.handleInteraction(ctx, interaction)
+	}
+}
+
+// registerCommands registers the slash commands in the guilds of the config
+// (globally without guilds)
+func (b *DiscordBot) registerCommands(ctx context.Context, application string) error {
+	if len(b.Config.Guilds) == 0 {
+		return b.call(ctx, http.MethodPut, "/applications/"+application+"/commands", discordCommands, nil)
+	}
+	for _, guild := range b.Config.Guilds {
+		if err := b.call(ctx, http.MethodPut, "/applications/"+application+"/guilds/"+guild+"/commands", discordCommands, nil); err != nil {
+			return fmt.Errorf("guild %s: %w", guild, err)
+		}
+	}
+	return nil
+}
+
+// handleMessage starts the turn of a message mentioning the bot (or of a direct message)
+func (b *DiscordBot) handleMessage(ctx context.Context, message discordMessage) {
+	b.mu.Lock()
+	bot := b.user
+	b.mu.Unlock()
+	if message.Author.Bot || bot == "" {
+		return
+	}
+	mentioned := message.GuildID == ""
+	for _, user := range message.Mentions {
+		mentioned = mentioned || user.ID == bot
+	}
+	if !mentioned {
+		return
+	}
+	prompt := strings.NewReplacer("<@"+bot+">", "", "<@!"+bot+">", "").Replace(message.Content)
+	if prompt = strings.TrimSpace(prompt); prompt == "" {
+		return
+	}
+	b.turns.Add(1)
+	go func() {
+		defer b.turns.Done()
+		body := discordMessageBody("…")
+		body["message_reference"] = map[string]string{"message_id": message.ID}
+		var reply discordMessage
+		if err := b.call(ctx, http.MethodPost, "/channels/"+message.ChannelID+"/messages", body, &reply); err != nil {
+			slog.Error("failed to reply on Discord", "channel", message.ChannelID, "error", err)
+			return
+		}
+		b.answer(ctx, message.ChannelID, message.Author.ID, prompt, &discordMessageReply{b, message.ChannelID, reply.ID})
+	}()
+}
+
+// handleInteraction runs a slash command or answers an approval
+func (b *DiscordBot) handleInteraction(ctx context.Context, interaction discordInteraction) {
+	switch {
+	case interaction.Type == discordApplicationCommand && interaction.Data.Name == "ask":
+		prompt := ""
+		for _, option := range interaction.Data.Options {
+			if option.Name == "prompt" {
+				prompt, _ = option.Value.(string)
+			}
+		}
+		// the answer is the edited response of the command
+		if err := b.respond(ctx, interaction, discordDeferredChannelMessage, nil); err != nil {
+			slog.Error("failed to answer the Discord command", "channel", interaction.ChannelID, "error", err)
+			return
+		}
+		b.mu.Lock()
+		application := b.application
+		b.mu.Unlock()
+		b.turns.Add(1)
+		go func() {
+			defer b.turns.Done()
+			b.answer(ctx, interaction.ChannelID, interaction.user(), prompt, &discordInteractionReply{b, application, interaction.Token})
+		}()
+
+	case interaction.Type == discordApplicationCommand && interaction.Data.Name == "reset":
+		response := discordMessageBody("🧹 New conversation")
+		if b.Sessions.RemoveKey(interaction.ChannelID) {
+			b.mu.Lock()
+			delete(b.channels, interaction.ChannelID)
+			b.mu.Unlock()
+		} else {
+			response = discordMessageBody("⚠️ " + ErrSessionBusy.Error())
+			response["flags"] = discordEphemeral
+		}
+		if err := b.respond(ctx, interaction, discordChannelMessage, response); err != nil {
+			slog.Error("failed to answer the Discord command", "channel", interaction.ChannelID, "error", err)
+		}
+
+	case interaction.Type == discordMessageComponent:
+		b.handleApproval(ctx, interaction)
+	}
+}
+
+// answer asks the prompt to the session of the channel, the reply is
+// edited while the answer is streamed
+func (b *DiscordBot) answer(ctx context.Context, channel, user, prompt string, reply discordReply) {
+	session, release, err := b.Sessions.AcquireKey(channel)
+	if err != nil {
+		if err := reply.edit(ctx, "⚠️ "+err.Error()); err != nil {
+			slog.Error("failed to edit the Discord reply", "channel", channel, "error", err)
+		}
+		return
+	}
+	defer release()
+	slog.Info("Discord prompt", "channel", channel, "user", user, "session", session.ID)
+
+	turnCtx, cancel := withTimeout(ctx, b.Timeout)
+	defer cancel()
+	streamed := &streamedReply{}
+	approver := session.Agent.Approver
+	session.Agent.OnEvent, session.Agent.Approver = streamed.event, b.approver(turnCtx, channel, user)
+	defer func() { session.Agent.OnEvent, session.Agent.Approver = nil, approver }()
+	stop := streamed.stream(time.Duration(b.Config.UpdateInterval), func(text string) {
+		if err := reply.edit(ctx, discordPreview(text)); err != nil {
+			slog.Warn("failed to edit the Discord reply", "channel", channel, "error", err)
+		}
+	})
+
+	answer, err := session.Ask(turnCtx, prompt, streamed.token)
+	stop()
+
+	text := strings.TrimSpace(answer)
+	if err != nil {
+		slog.Error("Discord turn failed", "channel", channel, "session", session.ID, "error", err)
+		text = strings.TrimSpace(text + "\n\n⚠️ " + err.Error())
+	}
+	// the final answer is written even when the bot stops,
+	// the long answers are followed by more messages
+	ctx = context.WithoutCancel(ctx)
+	for i, part := range splitDiscordText(text) {
+		send := reply.followUp
+		if i == 0 {
+			send = reply.edit
+		}
+		if err := send(ctx, part); err != nil {
+			slog.Error("failed to write the Discord answer", "channel", channel, "error", err)
+			return
+		}
+	}
+}
+
+// approver returns the approver of the channel for a turn of the user
+func (b *DiscordBot) approver(turn context.Context, channel, user string) *Approver {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for id, state := range b.channels {
+		if time.Since(state.lastUsed) > b.Sessions.IdleTimeout {
+			delete(b.channels, id)
+		}
+	}
+	state, ok := b.channels[channel]
+	if !ok {
+		state = &discordChannel{}
+		state.approver = NewRemoteApprover(func(question string) string {
+			b.mu.Lock()
+			turn, user := state.turn, state.user
+			b.mu.Unlock()
+			return b.ask(turn, channel, user, question)
+		})
+		b.channels[channel] = state
+	}
+	state.turn, state.user, state.lastUsed = turn, user, time.Now()
+	return state.approver
+}
+
+// ask posts the question with the approval buttons and waits for the click of
+// the user (the approval is denied when the turn ends or after the timeout)
+func (b *DiscordBot) ask(turn context.Context, channel, user, question string) string {
+	id := randomHex(8)
+	pending := &discordApproval{user: user, answer: make(chan string, 1)}
+	b.mu.Lock()
+	b.approvals[id] = pending
+	b.mu.Unlock()
+
+	content := discordPreview(fmt.Sprintf("🔐 <@%s> %s", user, question))
+	body := discordMessageBody(content, user)
+	body["components"] = discordApprovalButtons(id)
+	var message discordMessage
+	if err := b.call(turn, http.MethodPost, "/channels/"+channel+"/messages", body, &message); err != nil {
+		slog.Error("failed to ask the approval on Discord", "channel", channel, "error", err)
+		b.mu.Lock()
+		delete(b.approvals, id)
+		b.mu.Unlock()
+		return "no"
+	}
+
+	timeout := time.Duration(b.Config.ApprovalTimeout)
+	if timeout == 0 {
+		timeout = DefaultDiscordApprovalTimeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	outcome := "⌛ Not answered in time: denied"
+	select {
+	case answer := <-pending.answer:
+		return answer
+	case <-turn.Done():
+		outcome = "🚫 Cancelled"
+	case <-timer.C:
+	}
+	// a click may have arrived meanwhile
+	b.mu.Lock()
+	_, waiting := b.approvals[id]
+	delete(b.approvals, id)
+	b.mu.Unlock()
+	if !waiting {
+		return <-pending.answer
+	}
+
+	edit := discordMessageBody(discordPreview(content + "\n" + outcome))
+	edit["components"] = []interface{}{}
+	if err := b.call(context.WithoutCancel(turn), http.MethodPatch, "/channels/"+channel+"/messages/"+message.ID, edit, nil); err != nil {
+		slog.Warn("failed to close the Discord approval", "channel", channel, "error", err)
+	}
+	return "no"
+}
+
+// handleApproval answers the approval of a clicked button: only the user
+// of the turn can answer
+func (b *DiscordBot) handleApproval(ctx context.Context, interaction discordInteraction) {
+	rest, ok := strings.CutPrefix(interaction.Data.CustomID, "approval:")
+	if !ok {
+		return
+	}
+	id, answer, _ := strings.Cut(rest, ":")
+	user := interaction.user()
+	b.mu.Lock()
+	pending, ok := b.approvals[id]
+	if ok && pending.user == user {
+		delete(b.approvals, id)
+	}
+	b.mu.Unlock()
+
+	var response map[string]interface{}
+	responseType := discordChannelMessage
+	switch {
+	case !ok:
+		response = discordMessageBody("This approval is over.")
+		response["flags"] = discordEphemeral
+	case pending.user != user:
+		response = discordMessageBody(fmt.Sprintf("Only <@%s> can answer.", pending.user))
+		response["flags"] = discordEphemeral
+	default:
+		outcome := "❌ Denied"
+		switch answer {
+		case "yes":
+			outcome = "✅ Approved"
+		case "always":
+			outcome = "✅ Always approved"
+		default:
+			answer = "no"
+		}
+		pending.answer <- answer
+		content := ""
+		if interaction.Message != nil {
+			content = interaction.Message.Content
+		}
+		response = discordMessageBody(discordPreview(fmt.Sprintf("%s\n%s by <@%s>", content, outcome, user)))
+		response["components"] = []interface{}{}
+		responseType = discordUpdateMessage
+	}
+	if err := b.respond(ctx, interaction, responseType, response); err != nil {
+		slog.Warn("failed to answer the Discord approval", "channel", interaction.ChannelID, "error", err)
+	}
+}
+
+// respond sends the response of an interaction
+func (b *DiscordBot) respond(ctx context.Context, interaction discordInteraction, responseType int, data map[string]interface{}) error {
+	response := map[string]interface{}{"type": responseType}
+	if data != nil {
+		response["data"] = data
+	}
+	return b.call(ctx, http.MethodPost, "/interactions/"+interaction.ID+"/"+interaction.Token+"/callback", response, nil)
+}
+
+// call sends a request to the REST API and decodes its response in result:
+// the rate limited requests are sent again after the retry_after delay
+func (b *DiscordBot) call(ctx context.Context, method, path string, body interface{}, result interface{}) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	apiURL := b.Config.APIURL
+	if apiURL == "" {
+		apiURL = DefaultDiscordAPIURL
+	}
+	for attempt := 1; ; attempt++ {
+		request, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(apiURL, "/")+path, bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		request.Header.Set("Authorization", "Bot "+b.token)
+		request.Header.Set("User-Agent", "DiscordBot (mcphost, 1.0)")
+		if body != nil {
+			request.Header.Set("Content-Type", "application/json")
+		}
+		response, err := b.client.Do(request)
+		if err != nil {
+			return err
+		}
+		content, err := io.ReadAll(response.Body)
+		response.Body.Close()
+		if err != nil {
+			return err
+		}
+		if response.StatusCode == http.StatusTooManyRequests && attempt < 3 {
+			var limit struct {
+				RetryAfter float64 `json:"retry_after"`
+			}
+			json.Unmarshal(content, &limit)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(max(limit.RetryAfter, 0.5) * float64(time.Second))):
+			}
+			continue
+		}
+		if response.StatusCode >= 300 {
+			failure := struct {
+				Message string `json:"message"`
+			}{Message: response.Status}
+			json.Unmarshal(content, &failure)
+			return &DiscordError{Status: response.StatusCode, Message: failure.Message}
+		}
+		if result == nil || len(content) == 0 {
+			return nil
+		}
+		return json.Unmarshal(content, result)
+	}
+}
+
+// discordReply is the message of an answer: the reply to a mention,
+// or the response of a slash command
+type discordReply interface {
+	// edit replaces the text of the message
+	edit(ctx context.Context, content string) error
+	// followUp adds a message after it
+	followUp(ctx context.Context, content string) error
+}
+
+// discordMessageReply is the reply to a mention
+type discordMessageReply struct {
+	bot     *DiscordBot
+	channel string
+	message string
+}
+
+func (r *discordMessageReply) edit(ctx context.Context, content string) error {
+	return r.bot.call(ctx, http.MethodPatch, "/channels/"+r.channel+"/messages/"+r.message, discordMessageBody(content), nil)
+}
+
+func (r *discordMessageReply) followUp(ctx context.Context, content string) error {
+	return r.bot.call(ctx, http.MethodPost, "/channels/"+r.channel+"/messages", discordMessageBody(content), nil)
+}
+
+// discordInteractionReply is the response of a slash command
+type discordInteractionReply struct {
+	bot         *DiscordBot
+	application string
+	token       string
+}
+
+func (r *discordInteractionReply) edit(ctx context.Context, content string) error {
+	return r.bot.call(ctx, http.MethodPatch, "/webhooks/"+r.application+"/"+r.token+"/messages/@original", discordMessageBody(content), nil)
+}
+
+func (r *discordInteractionReply) followUp(ctx context.Context, content string) error {
+	return r.bot.call(ctx, http.MethodPost, "/webhooks/"+r.application+"/"+r.token, discordMessageBody(content), nil)
+}
+
+// discordMessageBody returns the body of a message: the mentions of its
+// content only notify the users (e.g. not @everyone written by a model)
+func discordMessageBody(content string, users ...string) map[string]interface{} {
+	return map[string]interface{}{
+		"content":          content,
+		"allowed_mentions": map[string]interface{}{"parse": []string{}, "users": append([]string{}, users...)},
+	}
+}
+
+// discordApprovalButtons returns the buttons of an approval
+func discordApprovalButtons(id string) []interface{} {
+	button := func(label string, style int, answer string) map[string]interface{} {
+		return map[string]interface{}{"type": 2, "style": style, "label": label, "custom_id": "approval:" + id + ":" + answer}
+	}
+	return []interface{}{map[string]interface{}{
+		"type":       1,
+		"components": []interface{}{button("Approve", 3, "yes"), button("Always", 1, "always"), button("Deny", 4, "no")},
+	}}
+}
+
+// discordPreview returns the text of a message: an empty text is not
+// allowed, the long texts are truncated
+func discordPreview(text string) string {
+	if text == "" {
+		return "…"
+	}
+	if utf8.RuneCountInString(text) > maxDiscordText {
+		runes := []rune(text)
+		text = string(runes[:maxDiscordText-1]) + "…"
+	}
+	return text
+}
+
+// splitDiscordText splits an answer into messages of at most maxDiscordText
+// characters, at the line breaks when possible
+func splitDiscordText(text string) []string {
+	runes := []rune(text)
+	var parts []string
+	for len(runes) > maxDiscordText {
+		cut := maxDiscordText
+		for i := maxDiscordText - 1; i > maxDiscordText/2; i-- {
+			if runes[i] == '\n' {
+				cut = i + 1
+				break
+			}
+		}
+		parts = append(parts, strings.TrimSpace(string(runes[:cut])))
+		runes = runes[cut:]
+	}
+	return append(parts, discordPreview(strings.TrimSpace(string(runes))))
+}
@@ -0,0 +1,203 @@
+package mcphost
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Labels of the containers of the MCP servers discovered by DockerLabelsConfig
+const (
+	// LabelEnabled ("true") marks the containers of MCP servers
+	LabelEnabled = "mcp.enabled"
+	// LabelName is the name of the server (the compose service
+	// or the container name by default)
+	LabelName = "mcp.name"
+	// LabelTransport is "http" (default), "sse" or "stdio"
+	LabelTransport = "mcp.transport"
+	// LabelPort is the port of the server in the container, it must be
+	// published (optional when the container publishes a single port)
+	LabelPort = "mcp.port"
+	// LabelPath is the path of the endpoint (/mcp for http, /sse for sse)
+	LabelPath = "mcp.path"
+	// LabelURL is the URL of the server (it wins over the port and the path)
+	LabelURL = "mcp.url"
+	// LabelCommand is the command of a stdio server, run with docker exec
+	// (or the exec of the container runtime)
+	LabelCommand = "mcp.command"
+
+	composeProjectLabel = "com.docker.compose.project"
+	composeServiceLabel = "com.docker.compose.service"
+)
+
+// dockerDiscoveryTimeout is the timeout of the docker commands of the discovery
+const dockerDiscoveryTimeout = 10 * time.Second
+
+// DockerLabelsConfig attaches the host to the running containers labelled
+// mcp.enabled=true (e.g. the services of a compose project), see the Label
+// constants. The containers are discovered when the config is loaded.
+type DockerLabelsConfig struct {
+	// Project only keeps the containers of the compose project
+	Project string `json:"project"`
+	// Host is the host of the published ports (localhost by default)
+	Host string `json:"host"`
+	// Server is the setting of the discovered servers (e.g. approval,
+	// timeouts, include), their transport, url or command are set by the host
+	Server MCPServerConfig `json:"server"`
+}
+
+// dockerContainer is the part of docker inspect used by the discovery
+type dockerContainer struct {
+	Name   string
+	Config struct {
+		Labels map[string]string
+	}
+	NetworkSettings struct {
+		Ports map[string][]struct {
+			HostPort string
+		}
+	}
+}
+
+// addDockerLabelServers adds the servers of the labelled containers to the
+// config, the declared servers keep their config
+func (c *Config) addDockerLabelServers(runtime containerRuntime) error {
+	labels := c.DockerLabels
+	if labels == nil {
+		return nil
+	}
+	containers, err := labels.containers(runtime)
+	if err != nil {
+		return err
+	}
+	if c.MCPServers == nil {
+		c.MCPServers = map[string]MCPServerConfig{}
+	}
+	for _, container := range containers {
+		name, server, err := labels.serverConfig(runtime, container)
+		if err != nil {
+			slog.Warn("MCP container ignored", "container", container.Name, "error", err)
+			continue
+		}
+		if _, ok := c.MCPServers[name]; ok {
+			slog.Warn("the server of the container is already declared in the config", "server", name, "container", container.Name)
+			continue
+		}
+		c.MCPServers[name] = server
+		slog.Info("MCP container discovered", "server", name, "container", container.Name)
+	}
+	return nil
+}
+
+// containers returns the running containers labelled mcp.enabled=true
+func (d DockerLabelsConfig) containers(runtime containerRuntime) ([]dockerContainer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dockerDiscoveryTimeout)
+	defer cancel()
+
+	args := []string{"ps", "--quiet", "--filter", "label=" + LabelEnabled + "=true"}
+	if d.Project != "" {
+		args = append(args, "--filter", "label="+composeProjectLabel+"="+d.Project)
+	}
+	output, err := runtime.cmd(ctx, args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the containers: %w", err)
+	}
+	ids := strings.Fields(string(output))
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	// the labels and the published ports are only complete in docker inspect
+	output, err = runtime.cmd(ctx, append([]string{"inspect"}, ids...)...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect the containers: %w", err)
+	}
+	var containers []dockerContainer
+	if err := json.Unmarshal(output, &containers); err != nil {
+		return nil, fmt.Errorf("invalid output of docker inspect: %w", err)
+	}
+	return containers, nil
+}
+
+// serverConfig returns the name and the config of the server of the container
+func (d DockerLabelsConfig) serverConfig(runtime containerRuntime, container dockerContainer) (string, MCPServerConfig, error) {
+	labels := container.Config.Labels
+	containerName := strings.TrimPrefix(container.Name, "/")
+	name := labels[LabelName]
+	if name == "" {
+		name = labels[composeServiceLabel]
+	}
+	if name == "" {
+		name = containerName
+	}
+	if strings.Contains(name, ToolNameSeparator) {
+		return "", MCPServerConfig{}, fmt.Errorf("the name %s contains %q", name, ToolNameSeparator)
+	}
+
+	server := d.Server
+	transport := labels[LabelTransport]
+	switch transport {
+	case "stdio":
+		command := strings.Fields(labels[LabelCommand])
+		if len(command) == 0 {
+			return "", server, fmt.Errorf("missing %s label", LabelCommand)
+		}
+		server.Transport = "stdio"
+		server.Command, server.Args = runtime.commandLine(append([]string{"exec", "-i", containerName}, command...))
+		return name, server, nil
+	case "", "http", "sse":
+	default:
+		return "", server, fmt.Errorf("unknown transport %s", transport)
+	}
+
+	// the http transport falls back to the HTTP+SSE transport (see connectLegacySSE)
+	server.Transport = "http"
+	if server.URL = labels[LabelURL]; server.URL != "" {
+		return name, server, nil
+	}
+	port, err := container.hostPort(labels[LabelPort])
+	if err != nil {
+		return "", server, err
+	}
+	path := labels[LabelPath]
+	if path == "" {
+		path = "/mcp"
+		if transport == "sse" {
+			path = "/sse"
+		}
+	}
+	host := d.Host
+	if host == "" {
+		host = "localhost"
+	}
+	server.URL = "http://" + host + ":" + port + "/" + strings.TrimPrefix(path, "/")
+	return name, server, nil
+}
+
+// hostPort returns the host port published for the port of the container
+// (port may be empty when the container publishes a single port)
+func (c dockerContainer) hostPort(port string) (string, error) {
+	published := map[string]string{}
+	for containerPort, bindings := range c.NetworkSettings.Ports {
+		if len(bindings) > 0 {
+			number, _, _ := strings.Cut(containerPort, "/")
+			published[number] = bindings[0].HostPort
+		}
+	}
+	if port == "" {
+		if len(published) != 1 {
+			return "", fmt.Errorf("%d published ports, the %s label is required", len(published), LabelPort)
+		}
+		for _, hostPort := range published {
+			return hostPort, nil
+		}
+	}
+	hostPort, ok := published[port]
+	if !ok {
+		return "", fmt.Errorf("the port %s is not published", port)
+	}
+	return hostPort, nil
+}
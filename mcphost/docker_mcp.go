@@ -0,0 +1,132 @@
+package mcphost
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Modes of the Docker MCP Toolkit integration
+const (
+	// DockerMCPGateway registers the "docker" server: the gateway of Docker
+	// runs all the enabled servers of the toolkit
+	DockerMCPGateway = "gateway"
+	// DockerMCPServers registers each enabled server of the toolkit as a server
+	// of the host (with its own approval policy), run by its own gateway
+	DockerMCPServers = "servers"
+)
+
+// DockerMCPServerName is the name of the server of the gateway mode
+const DockerMCPServerName = "docker"
+
+// DockerMCPConfig registers the servers enabled in the MCP Toolkit of Docker
+// Desktop (docker mcp server enable ...), through the MCP gateway of Docker
+// (docker mcp gateway run)
+type DockerMCPConfig struct {
+	// Mode is DockerMCPGateway (default) or DockerMCPServers
+	Mode string `json:"mode"`
+	// Servers filters the enabled servers (all the enabled servers by default)
+	Servers []string `json:"servers"`
+	// Registry is the file of the enabled servers of the toolkit
+	// (~/.docker/mcp/registry.yaml by default)
+	Registry string `json:"registry"`
+	// Server is the setting of the registered servers (e.g. approval,
+	// timeouts, include), its command and args are set by the host
+	Server MCPServerConfig `json:"server"`
+}
+
+// addDockerMCPServers adds the servers of the Docker MCP Toolkit to the config,
+// the declared servers keep their config
+func (c *Config) addDockerMCPServers() error {
+	docker := c.DockerMCP
+	if docker == nil {
+		return nil
+	}
+	if c.MCPServers == nil {
+		c.MCPServers = map[string]MCPServerConfig{}
+	}
+
+	switch docker.Mode {
+	case "", DockerMCPGateway:
+		args := []string{"mcp", "gateway", "run"}
+		if len(docker.Servers) > 0 {
+			args = append(args, "--servers", strings.Join(docker.Servers, ","))
+		}
+		c.addDockerMCPServer(DockerMCPServerName, args)
+	case DockerMCPServers:
+		enabled, err := docker.enabledServers()
+		if err != nil {
+			return err
+		}
+		for _, name := range enabled {
+			if len(docker.Servers) == 0 || slices.Contains(docker.Servers, name) {
+				c.addDockerMCPServer(name, []string{"mcp", "gateway", "run", "--servers", name})
+			}
+		}
+	default:
+		return fmt.Errorf("unknown mode %s", docker.Mode)
+	}
+	return nil
+}
+
+// addDockerMCPServer adds a server running the gateway with the args
+func (c *Config) addDockerMCPServer(name string, args []string) {
+	if _, ok := c.MCPServers[name]; ok {
+		slog.Warn("the Docker MCP server is already declared in the config", "server", name)
+		return
+	}
+	server := c.DockerMCP.Server
+	server.Transport = "stdio"
+	server.Command, server.Args = "docker", args
+	c.MCPServers[name] = server
+	slog.Info("Docker MCP server registered", "server", name)
+}
+
+// enabledServers returns the names of the enabled servers of the registry file:
+//
+//	registry:
+//	  duckduckgo:
+//	    ref: ""
+func (d DockerMCPConfig) enabledServers() ([]string, error) {
+	path := d.Registry
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(home, ".docker", "mcp", "registry.yaml")
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the registry of the Docker MCP Toolkit: %w", err)
+	}
+	defer file.Close()
+
+	// the servers are the keys of the registry mapping (the first indented level)
+	names := []string{}
+	inRegistry, indent := false, -1
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t")
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		level := len(line) - len(trimmed)
+		switch {
+		case level == 0:
+			inRegistry = trimmed == "registry:"
+		case inRegistry && (indent == -1 || level == indent) && strings.HasSuffix(trimmed, ":"):
+			indent = level
+			names = append(names, strings.Trim(strings.TrimSuffix(trimmed, ":"), `"'`))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
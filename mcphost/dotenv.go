@@ -0,0 +1,101 @@
+package mcphost
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// DefaultEnvFile is the dotenv file read next to the config
+// when the config does not set envFile
+const DefaultEnvFile = ".env"
+
+// LoadDotEnv sets the variables of a dotenv file (KEY=VALUE lines) in the
+// environment of the host, they are inherited by the servers and used by the
+// ${VAR} references of the config. The variables already set are kept.
+// A missing file is not an error when optional is true.
+func LoadDotEnv(path string, optional bool) error {
+	file, err := os.Open(path)
+	if optional && errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for number := 1; scanner.Scan(); number++ {
+		key, value, ok, err := parseDotEnvLine(scanner.Text())
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", path, number, err)
+		}
+		if !ok {
+			continue
+		}
+		if _, set := os.LookupEnv(key); set {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, number, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// parseDotEnvLine parses a line of a dotenv file:
+//
+//	# comment
+//	KEY=value # comment
+//	export KEY="value with\nnewlines"
+//	KEY='literal value'
+func parseDotEnvLine(line string) (key string, value string, ok bool, err error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", "", false, nil
+	}
+	line = strings.TrimPrefix(line, "export ")
+	key, value, found := strings.Cut(line, "=")
+	key = strings.TrimSpace(key)
+	if !found || key == "" || strings.ContainsAny(key, " \t") {
+		return "", "", false, fmt.Errorf("invalid line %q (KEY=VALUE expected)", line)
+	}
+
+	value = strings.TrimSpace(value)
+	switch {
+	case strings.HasPrefix(value, `"`):
+		end := closingQuote(value)
+		if end < 0 {
+			return "", "", false, fmt.Errorf("%s: unterminated double quote", key)
+		}
+		value = strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\"`, `"`, `\\`, `\`).Replace(value[1:end])
+	case strings.HasPrefix(value, "'"):
+		end := strings.Index(value[1:], "'")
+		if end < 0 {
+			return "", "", false, fmt.Errorf("%s: unterminated single quote", key)
+		}
+		value = value[1 : end+1]
+	default:
+		if comment := strings.Index(value, " #"); comment >= 0 {
+			value = strings.TrimSpace(value[:comment])
+		}
+	}
+	return key, value, true, nil
+}
+
+// closingQuote returns the index of the double quote closing the value
+// (the escaped quotes are skipped), -1 when it is missing
+func closingQuote(value string) int {
+	for i := 1; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
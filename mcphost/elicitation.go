@@ -0,0 +1,247 @@
+package mcphost
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// The actions of the answer to an elicitation request
+const (
+	ElicitationAccept  = "accept"
+	ElicitationDecline = "decline"
+	ElicitationCancel  = "cancel"
+)
+
+// ElicitationRequest is a question of a server to the user during a tool call
+// (elicitation/create, with the requested schema of mcp-go decoded)
+type ElicitationRequest struct {
+	Message         string            `json:"message"`
+	RequestedSchema ElicitationSchema `json:"requestedSchema"`
+}
+
+// elicitationQuestion decodes the requested schema of an elicitation request
+func elicitationQuestion(params mcp.ElicitationParams) (ElicitationRequest, error) {
+	question := ElicitationRequest{Message: params.Message}
+	if params.RequestedSchema == nil {
+		return question, nil
+	}
+	data, err := json.Marshal(params.RequestedSchema)
+	if err != nil {
+		return question, err
+	}
+	if err := json.Unmarshal(data, &question.RequestedSchema); err != nil {
+		return question, fmt.Errorf("invalid requested schema: %w", err)
+	}
+	return question, nil
+}
+
+// ElicitationSchema describes the fields of the answer (a flat JSON schema object)
+type ElicitationSchema struct {
+	Type       string                         `json:"type"`
+	Properties map[string]ElicitationProperty `json:"properties"`
+	Required   []string                       `json:"required,omitempty"`
+}
+
+// ElicitationProperty is a field of the answer: a string, number,
+// integer or boolean, with optional choices
+type ElicitationProperty struct {
+	Type        string      `json:"type"`
+	Title       string      `json:"title,omitempty"`
+	Description string      `json:"description,omitempty"`
+	Enum        []string    `json:"enum,omitempty"`
+	EnumNames   []string    `json:"enumNames,omitempty"`
+	Default     interface{} `json:"default,omitempty"`
+}
+
+// ElicitationResult is the answer of the user: the content is only sent
+// when the user accepted to answer
+type ElicitationResult struct {
+	Action  string                 `json:"action"`
+	Content map[string]interface{} `json:"content,omitempty"`
+}
+
+// Elicitor asks the questions of the servers to the user
+type Elicitor func(ctx context.Context, server *MCPServer, request ElicitationRequest) (ElicitationResult, error)
+
+// SetElicitor sets the handler of the questions of the servers
+// (NewHost uses Host.Elicit), without it the questions are declined
+func (r *ToolRegistry) SetElicitor(elicitor Elicitor) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.elicitor = elicitor
+}
+
+func (r *ToolRegistry) elicit(ctx context.Context, server *MCPServer, request ElicitationRequest) (ElicitationResult, error) {
+	r.mu.RLock()
+	elicitor := r.elicitor
+	r.mu.RUnlock()
+	if elicitor == nil {
+		return ElicitationResult{Action: ElicitationDecline}, nil
+	}
+	return elicitor(ctx, server, request)
+}
+
+// Elicit asks the question of a server to the user with the approver
+// (it is declined when there is nobody to ask)
+func (h *Host) Elicit(ctx context.Context, server *MCPServer, request ElicitationRequest) (ElicitationResult, error) {
+	if h.Approver == nil {
+		slog.Warn("question of the server declined: there is nobody to ask", "server", server.Name)
+		return ElicitationResult{Action: ElicitationDecline}, nil
+	}
+	return h.Approver.Elicit(server, request), nil
+}
+
+// Elicit asks the user the fields of the answer to a question of a server, one per line:
+// an empty line keeps the default value (or skips an optional field),
+// "/decline" declines to answer and "/cancel" (or the end of the input) cancels
+func (a *Approver) Elicit(server *MCPServer, request ElicitationRequest) ElicitationResult {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.input == nil {
+		slog.Warn("question of the server declined: there is nobody to ask", "server", server.Name)
+		return ElicitationResult{Action: ElicitationDecline}
+	}
+
+	fmt.Fprintf(a.output, "%s%s asks: %s (/decline or /cancel to not answer)\n", a.prefix(), server.Name, request.Message)
+	content := map[string]interface{}{}
+	for _, name := range request.RequestedSchema.fields() {
+		value, action := a.askField(name, request.RequestedSchema.Properties[name], request.RequestedSchema.required(name))
+		if action != ElicitationAccept {
+			return ElicitationResult{Action: action}
+		}
+		if value != nil {
+			content[name] = value
+		}
+	}
+	return ElicitationResult{Action: ElicitationAccept, Content: content}
+}
+
+// askField asks a field until a valid answer (a.mu is locked),
+// the value is nil for a skipped optional field
+func (a *Approver) askField(name string, property ElicitationProperty, required bool) (interface{}, string) {
+	for {
+		fmt.Fprintf(a.output, "%s%s: ", a.prefix(), property.prompt(name, required))
+		if !a.input.Scan() {
+			fmt.Fprintln(a.output)
+			return nil, ElicitationCancel
+		}
+		answer := strings.TrimSpace(a.input.Text())
+		switch {
+		case answer == "/decline":
+			return nil, ElicitationDecline
+		case answer == "/cancel":
+			return nil, ElicitationCancel
+		case answer == "" && (property.Default != nil || !required):
+			return property.Default, ElicitationAccept
+		case answer == "":
+			fmt.Fprintln(a.output, "this field is required")
+			continue
+		}
+		value, err := property.parse(answer)
+		if err == nil {
+			return value, ElicitationAccept
+		}
+		fmt.Fprintln(a.output, err)
+	}
+}
+
+// fields returns the names of the fields: the required ones first, then the others sorted
+func (s ElicitationSchema) fields() []string {
+	names := []string{}
+	for _, name := range s.Required {
+		if _, ok := s.Properties[name]; ok {
+			names = append(names, name)
+		}
+	}
+	optional := []string{}
+	for name := range s.Properties {
+		if !s.required(name) {
+			optional = append(optional, name)
+		}
+	}
+	sort.Strings(optional)
+	return append(names, optional...)
+}
+
+func (s ElicitationSchema) required(name string) bool {
+	for _, required := range s.Required {
+		if required == name {
+			return true
+		}
+	}
+	return false
+}
+
+// prompt describes the field: its title, description, choices and default value
+func (p ElicitationProperty) prompt(name string, required bool) string {
+	prompt := name
+	if p.Title != "" {
+		prompt = p.Title
+	}
+	if p.Description != "" {
+		prompt += " (" + p.Description + ")"
+	}
+	switch {
+	case len(p.Enum) > 0:
+		choices := []string{}
+		for i, value := range p.Enum {
+			if i < len(p.EnumNames) {
+				value = fmt.Sprintf("%s=%s", value, p.EnumNames[i])
+			}
+			choices = append(choices, value)
+		}
+		prompt += " [" + strings.Join(choices, " / ") + "]"
+	case p.Type == "boolean":
+		prompt += " [y/n]"
+	case p.Type != "" && p.Type != "string":
+		prompt += " [" + p.Type + "]"
+	}
+	if p.Default != nil {
+		prompt += fmt.Sprintf(" (default %v)", p.Default)
+	} else if !required {
+		prompt += " (optional)"
+	}
+	return prompt
+}
+
+// parse converts the answer of the user to the type of the field
+func (p ElicitationProperty) parse(answer string) (interface{}, error) {
+	if len(p.Enum) > 0 {
+		for _, value := range p.Enum {
+			if strings.EqualFold(value, answer) {
+				return value, nil
+			}
+		}
+		return nil, fmt.Errorf("choose one of %s", strings.Join(p.Enum, ", "))
+	}
+	switch p.Type {
+	case "number":
+		value, err := strconv.ParseFloat(answer, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", answer)
+		}
+		return value, nil
+	case "integer":
+		value, err := strconv.ParseInt(answer, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an integer", answer)
+		}
+		return value, nil
+	case "boolean":
+		switch strings.ToLower(answer) {
+		case "y", "yes", "true":
+			return true, nil
+		case "n", "no", "false":
+			return false, nil
+		}
+		return nil, fmt.Errorf("answer y or n")
+	}
+	return answer, nil
+}
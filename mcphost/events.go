@@ -0,0 +1,35 @@
+package mcphost
+
+// Types of the events of a chat session
+const (
+	EventToolCall   = "tool_call"
+	EventToolResult = "tool_result"
+	// EventToolProgress is a progress notification of a running tool
+	EventToolProgress = "tool_progress"
+	EventToken        = "token"
+	EventThinking     = "thinking"
+	EventDone         = "done"
+	EventError        = "error"
+	// EventPlan gives the numbered plan of the tool calls (see PlanMode)
+	EventPlan = "plan"
+	// EventSession gives the id of the session of a WebSocket,
+	// EventApproval asks the client to approve a tool call (see ChatServer)
+	EventSession  = "session"
+	EventApproval = "approval"
+)
+
+// Event describes a step of a chat session (e.g. for the clients of the HTTP server)
+type Event struct {
+	Type      string                 `json:"type"`
+	Tool      string                 `json:"tool,omitempty"`
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+	Content   string                 `json:"content,omitempty"`
+	Error     string                 `json:"error,omitempty"`
+	// Progress and Total are the progress of a tool (Total is 0 when it is unknown)
+	Progress float64 `json:"progress,omitempty"`
+	Total    float64 `json:"total,omitempty"`
+	// Session is the id of the session of the HTTP server (done and session events)
+	Session string `json:"session,omitempty"`
+	// ID identifies an approval event, the client answers with this id
+	ID string `json:"id,omitempty"`
+}
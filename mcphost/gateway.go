@@ -0,0 +1,251 @@
+package mcphost
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Gateway exposes the host as an MCP server: it re-exports the tools
+// of all the servers of the registry, plus an ask_llm tool which runs
+// a chat session of the host (tool loop and answer of the chat model).
+// MCP clients (e.g. Claude Desktop) can use it over stdio (ServeStdio)
+// or streamable HTTP (ServeHTTP, JSON responses only).
+type Gateway struct {
+	Host *Host
+	// Approver validates the calls of the re-exported tools with the approval
+	// policies of the host. Nobody answers its questions by default: the tools
+	// with the "ask" policy are denied (NewRemoteApprover can ask someone).
+	Approver *Approver
+}
+
+// AskLLMTool is the name of the tool asking the models of the host
+const AskLLMTool = "ask_llm"
+
+// gatewayToolSeparator replaces ToolNameSeparator in the names of the
+// re-exported tools (the MCP clients only accept [a-zA-Z0-9_-] in the names)
+const gatewayToolSeparator = "__"
+
+// JSON-RPC error codes
+const (
+	jsonrpcParseError     = -32700
+	jsonrpcMethodNotFound = -32601
+	jsonrpcInvalidParams  = -32602
+	jsonrpcInternalError  = -32603
+)
+
+type jsonrpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  interface{}     `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *jsonrpcError   `json:"error,omitempty"`
+}
+
+type jsonrpcError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *jsonrpcError) Error() string {
+	return fmt.Sprintf("JSON-RPC error %d: %s", e.Code, e.Message)
+}
+
+// NewGateway creates the MCP server of the host
+func NewGateway(host *Host) *Gateway {
+	return &Gateway{Host: host, Approver: NewApprover(nil, io.Discard)}
+}
+
+// HandleMessage handles a JSON-RPC message of an MCP client and returns
+// the response (nil for a notification)
+func (g *Gateway) HandleMessage(ctx context.Context, message json.RawMessage) mcp.JSONRPCMessage {
+	var request struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+	if err := json.Unmarshal(message, &request); err != nil {
+		return errorResponse(nil, jsonrpcParseError, "invalid JSON-RPC message")
+	}
+	if request.ID == nil {
+		// notifications/initialized, notifications/cancelled...: nothing to do
+		return nil
+	}
+
+	var result interface{}
+	switch request.Method {
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(request.Params, &params)
+		result = map[string]interface{}{
+			"protocolVersion": gatewayProtocolVersion(params.ProtocolVersion),
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+			"serverInfo":      hostInfo,
+		}
+	case "ping":
+		result = map[string]interface{}{}
+	case "tools/list":
+		result = mcp.ListToolsResult{Tools: g.tools()}
+	case "tools/call":
+		var params struct {
+			Name      string                 `json:"name"`
+			Arguments map[string]interface{} `json:"arguments"`
+		}
+		if err := json.Unmarshal(request.Params, &params); err != nil || params.Name == "" {
+			return errorResponse(request.ID, jsonrpcInvalidParams, "invalid tools/call parameters")
+		}
+		result = g.callTool(ctx, params.Name, params.Arguments)
+	default:
+		return errorResponse(request.ID, jsonrpcMethodNotFound, "method not found: "+request.Method)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return errorResponse(request.ID, jsonrpcParseError, err.Error())
+	}
+	return &jsonrpcMessage{JSONRPC: "2.0", ID: request.ID, Result: data}
+}
+
+// gatewayProtocolVersion returns the protocol version answered to the
+// initialize request of a client: the version of the client when the host
+// supports it, else the version of the host (the client may disconnect)
+func gatewayProtocolVersion(requested string) string {
+	for _, supported := range SupportedProtocolVersions {
+		if requested == supported {
+			return requested
+		}
+	}
+	return ProtocolVersion
+}
+
+func errorResponse(id json.RawMessage, code int, message string) *jsonrpcMessage {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return &jsonrpcMessage{JSONRPC: "2.0", ID: id, Error: &jsonrpcError{Code: code, Message: message}}
+}
+
+// tools returns the tools of the registry with the gateway names, and ask_llm
+func (g *Gateway) tools() []mcp.Tool {
+	tools := []mcp.Tool{
+		mcp.NewTool(AskLLMTool,
+			mcp.WithDescription("Ask a question to the local models, they use the tools of the host to answer"),
+			mcp.WithString("prompt", mcp.Required(), mcp.Description("the question")),
+		),
+	}
+	for _, tool := range g.Host.Registry.Tools() {
+		tool.Name = strings.Replace(tool.Name, ToolNameSeparator, gatewayToolSeparator, 1)
+		tools = append(tools, tool)
+	}
+	return tools
+}
+
+// callTool runs a tool call of the MCP client: the errors are tool results
+func (g *Gateway) callTool(ctx context.Context, name string, arguments map[string]interface{}) *mcp.CallToolResult {
+	if name == AskLLMTool {
+		prompt, _ := arguments["prompt"].(string)
+		if prompt == "" {
+			return mcp.NewToolResultError("missing prompt")
+		}
+		answer, err := g.Host.NewSession().Ask(ctx, prompt, func(string) {})
+		if err != nil {
+			return mcp.NewToolResultError(err.Error())
+		}
+		return mcp.NewToolResultText(answer)
+	}
+
+	serverName, toolName, found := strings.Cut(name, gatewayToolSeparator)
+	server, _, ok := g.Host.Registry.server(serverName + ToolNameSeparator + toolName)
+	if !found || !ok {
+		return mcp.NewToolResultError(fmt.Sprintf("unknown tool %s", name))
+	}
+	if !g.Approver.Approve(server, toolName, arguments) {
+		g.Host.Registry.audit.recordCall(withAuditDecision(context.Background(), AuditDenied), server.Name, toolName, arguments, nil, nil, 0, false)
+		return mcp.NewToolResultError(fmt.Sprintf("the tool %s is denied by the host", name))
+	}
+
+	result, err := g.Host.Registry.CallTool(ctx, serverName+ToolNameSeparator+toolName, arguments)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error())
+	}
+	return result
+}
+
+// ServeStdio serves MCP over stdio (one JSON-RPC message per line)
+// until the end of in or the cancellation of ctx.
+// The requests are handled concurrently.
+func (g *Gateway) ServeStdio(ctx context.Context, in io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	lines := make(chan []byte)
+	go func() {
+		defer close(lines)
+		for scanner.Scan() {
+			lines <- append([]byte{}, scanner.Bytes()...)
+		}
+	}()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case line, ok := <-lines:
+			if !ok {
+				return scanner.Err()
+			}
+			if len(strings.TrimSpace(string(line))) == 0 {
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				response := g.HandleMessage(ctx, line)
+				if response == nil {
+					return
+				}
+				data, _ := json.Marshal(response)
+				mu.Lock()
+				defer mu.Unlock()
+				out.Write(append(data, '\n'))
+			}()
+		}
+	}
+}
+
+// ServeHTTP serves MCP over streamable HTTP: each POSTed JSON-RPC message
+// is answered with a JSON document (202 for the notifications)
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := g.HandleMessage(r.Context(), body)
+	if response == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,110 @@
+package mcphost
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// postMCP posts a JSON-RPC request to the /mcp endpoint of the chat server
+// and returns its result
+func postMCP(t *testing.T, handler http.Handler, method string, params string) json.RawMessage {
+	t.Helper()
+	body := `{"jsonrpc": "2.0", "id": 1, "method": "` + method + `", "params": ` + params + `}`
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(body)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("POST /mcp %s: status = %d, want 200", method, recorder.Code)
+	}
+	var response jsonrpcMessage
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("POST /mcp %s: %v", method, err)
+	}
+	if response.Error != nil {
+		t.Fatalf("POST /mcp %s: %v", method, response.Error)
+	}
+	return response.Result
+}
+
+func TestGatewayApproval(t *testing.T) {
+	var calls atomic.Int64
+	host := newMockHost(t, &calls)
+	// the tools of the server "ask" need an approval (default policy)
+	echo := NativeTool{
+		Tool: mcp.NewTool("echo", mcp.WithString("text")),
+		Handler: func(ctx context.Context, arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+			calls.Add(1)
+			text, _ := arguments["text"].(string)
+			return mcp.NewToolResultText(text), nil
+		},
+	}
+	if err := host.Registry.RegisterNativeTools("ask", MCPServerConfig{}, echo); err != nil {
+		t.Fatalf("RegisterNativeTools: %v", err)
+	}
+	handler := NewChatServer(host, time.Minute).Handler()
+
+	tests := []struct {
+		name    string
+		tool    string
+		isError bool
+		text    string
+	}{
+		{name: "allowed tool", tool: "math__add", text: "5"},
+		{name: "tool with the ask policy", tool: "ask__echo", isError: true, text: "the tool ask__echo is denied by the host"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := postMCP(t, handler, "tools/call", `{"name": "`+test.tool+`", "arguments": {"a": 2, "b": 3, "text": "hi"}}`)
+			var result struct {
+				IsError bool `json:"isError"`
+				Content []struct {
+					Text string `json:"text"`
+				} `json:"content"`
+			}
+			if err := json.Unmarshal(data, &result); err != nil {
+				t.Fatal(err)
+			}
+			if result.IsError != test.isError || len(result.Content) != 1 || result.Content[0].Text != test.text {
+				t.Errorf("tools/call %s = %s, want isError %v and %q", test.tool, data, test.isError, test.text)
+			}
+		})
+	}
+	if calls.Load() != 1 {
+		t.Errorf("%d calls of the handlers, want 1", calls.Load())
+	}
+}
+
+func TestGatewayProtocolVersion(t *testing.T) {
+	var calls atomic.Int64
+	handler := NewChatServer(newMockHost(t, &calls), time.Minute).Handler()
+
+	tests := []struct {
+		name      string
+		requested string
+		want      string
+	}{
+		{name: "supported version", requested: legacyProtocolVersion, want: legacyProtocolVersion},
+		{name: "version of the host", requested: ProtocolVersion, want: ProtocolVersion},
+		{name: "unknown version", requested: "2099-01-01", want: ProtocolVersion},
+		{name: "no version", want: ProtocolVersion},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := postMCP(t, handler, "initialize", `{"protocolVersion": "`+test.requested+`"}`)
+			var result mcp.InitializeResult
+			if err := json.Unmarshal(data, &result); err != nil {
+				t.Fatal(err)
+			}
+			if result.ProtocolVersion != test.want {
+				t.Errorf("protocolVersion = %q, want %q", result.ProtocolVersion, test.want)
+			}
+		})
+	}
+}
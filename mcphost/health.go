@@ -0,0 +1,119 @@
+package mcphost
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// DefaultHealthCheckInterval is the time between two pings of the servers
+const DefaultHealthCheckInterval = 30 * time.Second
+
+// States of the servers (see MCPServer.State)
+const (
+	ServerHealthy = "healthy"
+	// ServerUnhealthy is a server that did not answer the last ping:
+	// its tools are not sent to the model
+	ServerUnhealthy = "unhealthy"
+	// ServerStopped is a server stopped after its idle timeout:
+	// it is restarted by the next request
+	ServerStopped = "stopped"
+)
+
+// State returns the state of the server (healthy, unhealthy or stopped)
+func (s *MCPServer) State() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	switch {
+	case s.stopped:
+		return ServerStopped
+	case s.unhealthy:
+		return ServerUnhealthy
+	default:
+		return ServerHealthy
+	}
+}
+
+// LastCheck returns the time of the last ping of the server (zero before the first one)
+func (s *MCPServer) LastCheck() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lastCheck
+}
+
+// setHealthy updates the health of the server, it tells if it changed
+func (s *MCPServer) setHealthy(healthy bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastCheck = time.Now()
+	changed := s.unhealthy == healthy
+	s.unhealthy = !healthy
+	return changed
+}
+
+// checkHealth pings the server: an unresponsive server is marked unhealthy
+// and restarted, it is healthy again as soon as it answers
+func (s *MCPServer) checkHealth(ctx context.Context) {
+	mcpClient := s.Client()
+	if mcpClient == nil {
+		// stopped after its idle timeout
+		return
+	}
+	if s.alive(mcpClient) {
+		if s.setHealthy(true) {
+			slog.Info("server is healthy again", "server", s.Name)
+		}
+		return
+	}
+
+	if s.setHealthy(false) {
+		slog.Warn("server does not answer the pings, its tools are not used", "server", s.Name)
+	}
+	if err := s.restart(ctx, mcpClient); err != nil {
+		slog.Debug("failed to restart the unhealthy server", "server", s.Name, "error", err)
+		return
+	}
+	if mcpClient = s.Client(); mcpClient != nil && s.alive(mcpClient) && s.setHealthy(true) {
+		slog.Info("server restarted, it is healthy again", "server", s.Name)
+	}
+}
+
+// checkHealth pings all the servers every interval, until the registry is closed
+func (r *ToolRegistry) checkHealth(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			select {
+			case <-r.done:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		var wg sync.WaitGroup
+		for _, server := range r.servers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				server.checkHealth(ctx)
+			}()
+		}
+		wg.Wait()
+		cancel()
+	}
+}
+
+// Available tells if a namespaced tool can be sent to the model:
+// the tools of the unhealthy servers are not
+func (r *ToolRegistry) Available(name string) bool {
+	server, _, ok := r.server(name)
+	return !ok || server.State() != ServerUnhealthy
+}
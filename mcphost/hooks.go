@@ -0,0 +1,184 @@
+package mcphost
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// maxHookPayloadBytes is the maximum size of the payloads of the hooks
+const maxHookPayloadBytes = 1 << 20
+
+// hookSignatureHeader is the header of the HMAC signature of the payloads
+// (the format of the GitHub webhooks: sha256=<hex>)
+const hookSignatureHeader = "X-Hub-Signature-256"
+
+// hookName matches the names of the hooks (a segment of their path)
+var hookName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// HookConfig is a webhook trigger of the serve mode: POST /hooks/<name>
+// runs a chat session with the prompt template filled with the payload, e.g.
+//
+//	"hooks": {"issue": {"prompt": "Triage the issue {{.payload.issue.title}}: {{.payload.issue.body}}"}}
+//
+// The template gets the JSON payload (.payload), the raw body (.body) and the
+// query parameters (.query).
+type HookConfig struct {
+	Prompt string `json:"prompt"`
+	// Callback, if set, receives the result (a POST of a HookResult): the
+	// request is answered at once (202), the result is not in the response
+	Callback        string            `json:"callback"`
+	CallbackHeaders map[string]string `json:"callbackHeaders"`
+	// SecretEnv is the environment variable of the secret of the HMAC
+	// signature of the payloads (X-Hub-Signature-256 header, as GitHub).
+	// The hooks with a secret do not need an API key.
+	SecretEnv string `json:"secretEnv"`
+	// Timeout of a run (the timeout of the chat requests by default)
+	Timeout Duration `json:"timeout"`
+}
+
+// HookResult is the result of a hook run: the response of the request,
+// or the body posted to the callback
+type HookResult struct {
+	Hook string `json:"hook"`
+	// ID is the id of the session of the run
+	ID     string `json:"id"`
+	Answer string `json:"answer,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// DurationMs is the duration of the run in milliseconds
+	DurationMs int64 `json:"durationMs,omitempty"`
+}
+
+// secret returns the secret of the signatures ("" without signatures)
+func (c HookConfig) secret() string {
+	if c.SecretEnv == "" {
+		return ""
+	}
+	return os.Getenv(c.SecretEnv)
+}
+
+// validateHooks checks the hooks of the config
+func (c ServerConfig) validateHooks() error {
+	for name, hook := range c.Hooks {
+		switch {
+		case !hookName.MatchString(name):
+			return fmt.Errorf("hook %q: invalid name (letters, digits, - and _)", name)
+		case hook.Prompt == "":
+			return fmt.Errorf("hook %s: missing prompt", name)
+		case hook.SecretEnv != "" && hook.secret() == "":
+			return fmt.Errorf("hook %s: the environment variable %s of the secret is not set", name, hook.SecretEnv)
+		case hook.Timeout < 0:
+			return fmt.Errorf("hook %s: negative timeout", name)
+		}
+	}
+	return nil
+}
+
+// handleHook runs the hook of the request
+func (s *ChatServer) handleHook(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/hooks/")
+	hook, ok := s.Hooks[name]
+	if !ok {
+		http.Error(w, "unknown hook", http.StatusNotFound)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxHookPayloadBytes))
+	if err != nil {
+		http.Error(w, "payload too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if secret := hook.secret(); secret != "" && !validHookSignature(secret, body, r.Header.Get(hookSignatureHeader)) {
+		slog.Warn("hook request with an invalid signature", "hook", name, "remote", r.RemoteAddr)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	query := map[string]string{}
+	for key, values := range r.URL.Query() {
+		query[key] = values[0]
+	}
+	data := map[string]interface{}{"payload": nil, "body": string(body), "query": query}
+	var payload interface{}
+	if json.Unmarshal(body, &payload) == nil {
+		data["payload"] = payload
+	}
+	prompt, err := renderTemplate("prompt", hook.Prompt, data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	timeout := time.Duration(hook.Timeout)
+	if timeout == 0 {
+		timeout = s.Timeout
+	}
+	session := s.Host.NewSession()
+	slog.Info("hook triggered", "hook", name, "session", session.ID)
+	if hook.Callback == "" {
+		ctx, cancel := withTimeout(r.Context(), timeout)
+		defer cancel()
+		result := s.runHook(ctx, name, session, prompt)
+		w.Header().Set("Content-Type", "application/json")
+		if result.Error != "" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		json.NewEncoder(w).Encode(result)
+		return
+	}
+
+	// the run goes on after the response, its result is posted to the callback
+	ctx, cancel := withTimeout(context.WithoutCancel(r.Context()), timeout)
+	go func() {
+		defer cancel()
+		result := s.runHook(ctx, name, session, prompt)
+		client := &http.Client{Timeout: scheduleWebhookTimeout}
+		if err := postJSON(context.WithoutCancel(ctx), client, hook.Callback, hook.CallbackHeaders, result); err != nil {
+			slog.Error("failed to post the result of the hook", "hook", name, "session", session.ID, "error", err)
+		}
+	}()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(HookResult{Hook: name, ID: session.ID})
+}
+
+// runHook asks the prompt of a hook to its session
+func (s *ChatServer) runHook(ctx context.Context, name string, session *ChatSession, prompt string) HookResult {
+	start := time.Now()
+	result := HookResult{Hook: name, ID: session.ID}
+	answer, err := session.Ask(ctx, prompt, func(string) {})
+	result.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		slog.Error("hook run failed", "hook", name, "session", session.ID, "error", err)
+		result.Error = err.Error()
+		return result
+	}
+	useTokens(ctx, prompt, answer)
+	slog.Info("hook run done", "hook", name, "session", session.ID, "duration", time.Since(start).Round(time.Millisecond))
+	result.Answer = answer
+	return result
+}
+
+// validHookSignature checks the sha256=<hex> HMAC signature of the payload
+func validHookSignature(secret string, body []byte, signature string) bool {
+	signature, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok {
+		return false
+	}
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
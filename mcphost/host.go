@@ -0,0 +1,341 @@
+// Package mcphost connects MCP servers to Ollama models:
+// the tools of the servers are offered to a tools model, the tool calls
+// are executed on the servers and a chat model writes the final answer.
+package mcphost
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// Default settings of a Host
+const (
+	DefaultChatModel     = "qwen2.5-coder:3b"
+	DefaultToolsModel    = "qwen2.5:0.5b"
+	DefaultMaxIterations = 5
+
+	DefaultSystemToolsInstructions = `You are a useful AI agent.
+	Your job is to understand the user prompt ans decide if you need to use a tool to run external commands.
+	Ignore all things not related to the usage of a tool.
+	`
+	DefaultSystemChatInstructions = `You are a useful AI agent. your job is to answer the user prompt.
+	If you detect that the user prompt is related to a tool, ignore this part and focus on the other parts.
+	`
+	// DefaultSingleModelInstructions replaces DefaultSystemChatInstructions in single model mode
+	DefaultSingleModelInstructions = `You are a useful AI agent. your job is to answer the user prompt.
+	Use the tools when you need them to run external commands, then answer with their results.
+	`
+)
+
+// Host is the MCP host: it owns the connections to the MCP servers
+// and creates the chat sessions with the Ollama models
+type Host struct {
+	Ollama   *api.Client
+	Registry *ToolRegistry
+
+	ToolsModel string
+	ChatModel  string
+	// SingleModel makes the chat model call the tools and answer
+	// in the same conversation (the tools model is not used)
+	SingleModel bool
+	// Options are the Ollama options of the models, ModelOptions overrides them
+	// for some models and OptionOverrides (e.g. the environment) overrides both
+	Options         map[string]interface{}
+	ModelOptions    map[string]map[string]interface{}
+	OptionOverrides map[string]interface{}
+	// Seed, if set, is the seed option of the models (for reproducible runs),
+	// it is recorded in the saved sessions
+	Seed          *int
+	MaxIterations int
+	// MaxToolCalls and MaxToolOutputBytes limit the tool calls of a turn
+	// and the total size of their results (0 means no limit)
+	MaxToolCalls       int
+	MaxToolOutputBytes int
+	// ToolResultLimit limits the size of each tool result
+	ToolResultLimit ToolResultLimit
+	// ChatTimeout is the timeout of each completion of the models (0 means no timeout)
+	ChatTimeout time.Duration
+	// OllamaRetry tells how the failed requests to Ollama are retried
+	OllamaRetry BackoffPolicy
+	// ToolCallMode tells how the tools are given to the models
+	ToolCallMode ToolCallMode
+	// Thinking tells what to do with the reasoning of the thinking models
+	Thinking ThinkingMode
+	// Plan tells if the models plan their tool calls before executing them
+	Plan PlanMode
+	// Approver validates the tool calls (nil allows all the calls)
+	Approver *Approver
+	// Format asks for JSON answers: "json" or a JSON schema (nil for text answers)
+	Format json.RawMessage
+	// Store saves the sessions (nil disables the saving)
+	Store *SessionStore
+	// Summarizer shortens the large tool results (nil disables the summaries);
+	// without model, the results are summarized by the model calling the tools
+	Summarizer *Summarizer
+	// InjectionScanner flags the instructions injected in the tool results
+	// (nil disables the detection)
+	InjectionScanner *InjectionScanner
+	// PIIFilter masks the personal data of the tool results (nil disables
+	// the masking), each session has its own table of placeholders
+	PIIFilter *PIIFilter
+	// CompactThreshold and CompactKeepTurns set the automatic compaction
+	// of the sessions (see ChatSession.Compact)
+	CompactThreshold int
+	CompactKeepTurns int
+	// Memory recalls the previous sessions of the user (nil disables it)
+	Memory *Memory
+	// Retriever adds the extracts of the local documents relevant
+	// to the prompts (nil disables it)
+	Retriever *Retriever
+	// ToolSelector selects the tools relevant to the prompts (nil sends all the tools)
+	ToolSelector *ToolSelector
+	// Metrics record the tool calls and the chat completions of the sessions
+	// (nil records nothing)
+	Metrics *Metrics
+
+	SystemToolsInstructions string
+	SystemChatInstructions  string
+}
+
+// NewHost starts the MCP servers of the config.
+// The returned host uses the default settings, which can be changed
+// before creating sessions.
+func NewHost(ctx context.Context, ollama *api.Client, config Config) (*Host, error) {
+	registry, err := NewToolRegistry(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	maxIterations := DefaultMaxIterations
+	if config.Limits.MaxIterations > 0 {
+		maxIterations = config.Limits.MaxIterations
+	}
+
+	var summarizer *Summarizer
+	if config.Summarize != nil && config.Summarize.Threshold > 0 {
+		summarizer = &Summarizer{
+			Ollama:      ollama,
+			Model:       config.Summarize.Model,
+			Threshold:   config.Summarize.Threshold,
+			ChunkTokens: config.Summarize.ChunkTokens,
+			Timeout:     config.ChatTimeout(),
+			Retry:       config.OllamaRetryPolicy(),
+		}
+	}
+
+	var injectionScanner *InjectionScanner
+	if config.Injection != nil {
+		if injectionScanner, err = NewInjectionScanner(ollama, *config.Injection); err != nil {
+			registry.Close()
+			return nil, err
+		}
+		injectionScanner.Timeout, injectionScanner.Retry = config.ChatTimeout(), config.OllamaRetryPolicy()
+	}
+
+	var piiFilter *PIIFilter
+	if config.PII != nil {
+		if piiFilter, err = NewPIIFilter(*config.PII); err != nil {
+			registry.Close()
+			return nil, err
+		}
+	}
+
+	var memory *Memory
+	if config.Memory != nil && config.Memory.Database != "" {
+		if memory, err = NewMemory(ollama, *config.Memory); err != nil {
+			registry.Close()
+			return nil, err
+		}
+	}
+	var retriever *Retriever
+	if config.RAG != nil && len(config.RAG.Documents) > 0 {
+		if retriever, err = NewRetriever(ctx, ollama, *config.RAG); err != nil {
+			registry.Close()
+			if memory != nil {
+				memory.Close()
+			}
+			return nil, err
+		}
+	}
+
+	var toolSelector *ToolSelector
+	if config.ToolSelection != nil {
+		toolSelector = NewToolSelector(ollama, *config.ToolSelection)
+	}
+
+	host := &Host{
+		Ollama:   ollama,
+		Registry: registry,
+
+		ToolsModel:      DefaultToolsModel,
+		ChatModel:       DefaultChatModel,
+		Options:         MergeOptions(DefaultOptions, config.Options),
+		ModelOptions:    config.ModelOptions,
+		OptionOverrides: map[string]interface{}{},
+		MaxIterations:   maxIterations,
+		ChatTimeout:     config.ChatTimeout(),
+		OllamaRetry:     config.OllamaRetryPolicy(),
+		ToolCallMode:    ToolCallModeNative,
+		Thinking:        ThinkingHide,
+		Plan:            PlanOff,
+		Summarizer:      summarizer,
+
+		InjectionScanner: injectionScanner,
+		PIIFilter:        piiFilter,
+
+		CompactThreshold: config.Compact.Threshold,
+		CompactKeepTurns: config.Compact.KeepTurns,
+		Memory:           memory,
+		Retriever:        retriever,
+		ToolSelector:     toolSelector,
+		Metrics:          NewMetrics(registry),
+
+		MaxToolCalls:       config.Limits.MaxToolCalls,
+		MaxToolOutputBytes: config.Limits.MaxToolOutputBytes,
+		ToolResultLimit: ToolResultLimit{
+			MaxBytes: config.Limits.MaxToolResultBytes,
+			Dir:      os.ExpandEnv(config.Limits.ToolResultDir),
+		},
+
+		SystemToolsInstructions: DefaultSystemToolsInstructions,
+		SystemChatInstructions:  DefaultSystemChatInstructions,
+	}
+	registry.SetSampler(host.Sample)
+	registry.SetMetrics(host.Metrics)
+	registry.SetElicitor(host.Elicit)
+	if err := host.registerAgents(config.Agents); err != nil {
+		host.Close()
+		return nil, err
+	}
+	return host, nil
+}
+
+// OllamaTools returns the tools of the registry converted to the Ollama format
+func (h *Host) OllamaTools() []api.Tool {
+	return ConvertToOllamaTools(h.Registry.Tools())
+}
+
+// NewSession creates a chat session with an empty history
+func (h *Host) NewSession() *ChatSession {
+	return &ChatSession{
+		ID:        NewSessionID(),
+		CreatedAt: time.Now(),
+		Store:     h.Store,
+		Agent: &Agent{
+			Ollama:             h.Ollama,
+			Registry:           h.Registry,
+			Model:              h.AgentModel(),
+			Tools:              h.OllamaTools(),
+			Options:            h.ModelOptionsOf(h.AgentModel()),
+			MaxIterations:      h.MaxIterations,
+			MaxToolCalls:       h.MaxToolCalls,
+			MaxToolOutputBytes: h.MaxToolOutputBytes,
+			ResultLimit:        h.ToolResultLimit,
+			ChatTimeout:        h.ChatTimeout,
+			Retry:              h.OllamaRetry,
+			ToolCallMode:       h.ToolCallMode,
+			Plan:               h.Plan,
+			Thinking:           h.Thinking,
+			Approver:           h.Approver,
+			Summarizer:         h.sessionSummarizer(),
+			InjectionScanner:   h.sessionInjectionScanner(),
+			PIIFilter:          h.PIIFilter.session(),
+			ToolSelector:       h.ToolSelector,
+			Metrics:            h.Metrics,
+		},
+		Ollama:                  h.Ollama,
+		ChatModel:               h.ChatModel,
+		SingleModel:             h.SingleModel,
+		Options:                 h.ModelOptionsOf(h.ChatModel),
+		ChatTimeout:             h.ChatTimeout,
+		Retry:                   h.OllamaRetry,
+		Thinking:                h.Thinking,
+		Format:                  h.Format,
+		SystemToolsInstructions: h.SystemToolsInstructions,
+		SystemChatInstructions:  h.SystemChatInstructions,
+		CompactThreshold:        h.CompactThreshold,
+		CompactKeepTurns:        h.CompactKeepTurns,
+		Seed:                    h.Seed,
+		Memory:                  h.Memory,
+		Retriever:               h.Retriever,
+	}
+}
+
+// ModelOptionsOf returns the options of a model: the options of the host,
+// the options of the model, then the overrides
+func (h *Host) ModelOptionsOf(model string) map[string]interface{} {
+	options := MergeOptions(h.Options, h.ModelOptions[model], h.OptionOverrides)
+	if h.Seed != nil {
+		options["seed"] = *h.Seed
+	}
+	return options
+}
+
+// sessionSummarizer returns the summarizer of the sessions,
+// with the options of the host and the model calling the tools by default
+func (h *Host) sessionSummarizer() *Summarizer {
+	if h.Summarizer == nil {
+		return nil
+	}
+	summarizer := *h.Summarizer
+	summarizer.Metrics = h.Metrics
+	if summarizer.Model == "" {
+		summarizer.Model = h.AgentModel()
+	}
+	if summarizer.Options == nil {
+		summarizer.Options = h.ModelOptionsOf(summarizer.Model)
+	}
+	return &summarizer
+}
+
+// sessionInjectionScanner returns the injection scanner of the sessions,
+// with the options of the host and the model calling the tools by default
+func (h *Host) sessionInjectionScanner() *InjectionScanner {
+	if h.InjectionScanner == nil {
+		return nil
+	}
+	scanner := *h.InjectionScanner
+	scanner.Metrics = h.Metrics
+	if scanner.Model != "" && scanner.Options == nil {
+		scanner.Options = h.ModelOptionsOf(scanner.Model)
+	}
+	return &scanner
+}
+
+// ResumeSession creates a chat session with the history of a saved session
+func (h *Host) ResumeSession(id string) (*ChatSession, error) {
+	if h.Store == nil {
+		return nil, fmt.Errorf("no session store to resume %s", id)
+	}
+	saved, err := h.Store.Load(id)
+	if err != nil {
+		return nil, err
+	}
+
+	session := h.NewSession()
+	session.ID = saved.ID
+	session.CreatedAt = saved.CreatedAt
+	session.Owner = saved.Owner
+	session.History = saved.Messages
+	// the run is reproduced with the seed of the session (unless the host has one)
+	if h.Seed == nil && saved.Seed != nil {
+		session.SetSeed(*saved.Seed)
+	}
+	return session, nil
+}
+
+// Close stops the MCP servers and closes the memory and the document index
+func (h *Host) Close() {
+	h.Registry.Close()
+	if h.Memory != nil {
+		h.Memory.Close()
+	}
+	if h.Retriever != nil {
+		h.Retriever.Close()
+	}
+}
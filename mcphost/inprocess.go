@@ -0,0 +1,48 @@
+package mcphost
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// AddInProcessServer attaches an MCP server of mcp-go running in the host
+// process: the JSON-RPC messages are passed in memory, without stdio or HTTP.
+// Its tools are used like the tools of the other servers, with the approval
+// policies, the include/exclude patterns and the timeouts of config.
+func (r *ToolRegistry) AddInProcessServer(ctx context.Context, name string, mcpServer *server.MCPServer, config MCPServerConfig) error {
+	if r.registered(name) {
+		return fmt.Errorf("server %s is already registered", name)
+	}
+	server := &MCPServer{
+		Name:     name,
+		Config:   config,
+		timeouts: config.Timeouts.withDefaults(DefaultTimeouts),
+	}
+	server.newClient = server.newInProcessClient(mcpServer)
+	if err := server.start(ctx); err != nil {
+		return fmt.Errorf("server %s: %w", name, err)
+	}
+	r.add(server)
+	return nil
+}
+
+// newInProcessClient returns the constructor of the clients of an in-process
+// server. The in-process transport of mcp-go is created with the handlers of
+// the requests of the server (client.NewInProcessClient only takes a sampling
+// handler), they are also registered on the client to declare the capabilities.
+func (s *MCPServer) newInProcessClient(mcpServer *server.MCPServer) func() (MCPClient, error) {
+	return func() (MCPClient, error) {
+		requests := serverRequests{server: s}
+		options := []transport.InProcessOption{transport.WithElicitationHandler(requests)}
+		if s.Config.Sampling {
+			options = append(options, transport.WithSamplingHandler(requests))
+		}
+		if len(s.Config.Roots) > 0 {
+			options = append(options, transport.WithRootsHandler(requests))
+		}
+		return s.startClient(context.Background(), transport.NewInProcessTransportWithOptions(mcpServer, options...))
+	}
+}
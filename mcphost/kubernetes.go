@@ -0,0 +1,424 @@
+package mcphost
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// KubernetesConfig runs the docker servers (command "docker", args "run ...")
+// as pods of a Kubernetes cluster, with the API of the cluster: for
+// "docker run -i IMAGE ARGS", the host creates a pod running IMAGE ARGS and
+// attaches to its stdin and stdout (the pod is deleted when the server stops).
+// In the cluster, the host uses the service account of its pod. (The servers
+// deployed as sidecars of the host are http servers on localhost.)
+//
+// The env vars of the servers (-e) are stored in a secret of the pod
+// (owned by the pod) and referenced by the spec of the pod: they are only
+// readable by the users allowed to read the secrets of the namespace.
+type KubernetesConfig struct {
+	// Namespace of the pods (the namespace of the context by default)
+	Namespace string `json:"namespace"`
+	// Context and Kubeconfig select the cluster (the current context by default,
+	// the cluster of the pod of the host without kubeconfig)
+	Context    string `json:"context"`
+	Kubeconfig string `json:"kubeconfig"`
+	// ServiceAccount of the pods (the default service account by default)
+	ServiceAccount string `json:"serviceAccount"`
+}
+
+// kubernetesManagedBy labels the pods of the servers and their secrets
+const kubernetesManagedBy = "mcphost"
+
+// kubernetesContainer is the name of the container of the pods
+const kubernetesContainer = "server"
+
+// kubernetesStartTimeout is the time given to a pod to start
+// (the image may be pulled)
+const kubernetesStartTimeout = 5 * time.Minute
+
+// dockerRun is the pod of a docker run command line
+type dockerRun struct {
+	image      string
+	entrypoint string
+	env        []string
+	args       []string
+}
+
+// dockerRunOptions are the options of docker run without effect on the pods
+// (true when they take a value)
+var dockerRunOptions = map[string]bool{
+	"-i": false, "-it": false, "-ti": false, "--interactive": false, "--rm": false, "-t": false, "--tty": false, "--init": false,
+	"--name": true, "--pull": true, "--platform": true, "--network": true,
+}
+
+// podNameInvalid matches the characters not allowed in the names of the pods
+var podNameInvalid = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// useKubernetes runs the declared docker servers as pods
+// (the servers with their own kubernetes setting keep it)
+func (c *Config) useKubernetes() error {
+	for name, server := range c.MCPServers {
+		if server.Kubernetes == nil && c.Kubernetes != nil && server.Command == RuntimeDocker && len(server.Args) > 0 && server.Args[0] == "run" {
+			server.Kubernetes = c.Kubernetes
+		}
+		if server.Kubernetes == nil {
+			continue
+		}
+		if server.Cwd != "" || server.Processes > 1 {
+			return fmt.Errorf("server %s: cwd and processes are not supported with kubernetes", name)
+		}
+		// the references are expanded when the server starts
+		if _, err := parseDockerRun(server.Command, server.Args, func(string) string { return "" }); err != nil {
+			return fmt.Errorf("server %s: %w", name, err)
+		}
+		c.MCPServers[name] = server
+	}
+	return nil
+}
+
+// parseDockerRun returns the pod of the docker run command line, env returns
+// the value of the env vars passed without value (-e KEY)
+func parseDockerRun(command string, args []string, env func(key string) string) (dockerRun, error) {
+	var run dockerRun
+	if command != RuntimeDocker || len(args) == 0 || args[0] != "run" {
+		return run, fmt.Errorf("kubernetes: the command is not docker run")
+	}
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			run.image, run.args = arg, args[i+1:]
+			return run, nil
+		}
+		option, value, hasValue := strings.Cut(arg, "=")
+		if strings.HasPrefix(arg, "-e") && len(arg) > 2 && arg[2] != '=' {
+			// -eKEY=VALUE
+			option, value, hasValue = "-e", arg[2:], true
+		}
+		if !hasValue && (option == "-e" || option == "--env" || option == "--entrypoint" || dockerRunOptions[option]) {
+			if i++; i == len(args) {
+				return run, fmt.Errorf("kubernetes: missing value of %s", option)
+			}
+			value = args[i]
+		}
+		switch {
+		case option == "-e" || option == "--env":
+			if !strings.Contains(value, "=") {
+				value += "=" + env(value)
+			}
+			run.env = append(run.env, value)
+		case option == "--entrypoint":
+			run.entrypoint = value
+		default:
+			if _, ok := dockerRunOptions[option]; !ok {
+				return run, fmt.Errorf("kubernetes: the docker run option %s is not supported", option)
+			}
+		}
+	}
+	return run, fmt.Errorf("kubernetes: missing image")
+}
+
+// podName returns a new name of pod for the image: each process
+// of the server is a new pod
+func podName(image string) string {
+	suffix := make([]byte, 3)
+	rand.Read(suffix)
+	image = path.Base(strings.SplitN(image, "@", 2)[0])
+	image, _, _ = strings.Cut(image, ":")
+	name := strings.Trim(podNameInvalid.ReplaceAllString(strings.ToLower(image), "-"), "-")
+	return "mcp-" + name[:min(len(name), 40)] + "-" + hex.EncodeToString(suffix)
+}
+
+// pod returns the pod running the server, the env vars are read
+// from the secret of the same name
+func (k KubernetesConfig) pod(name string, run dockerRun, container *ContainerConfig) (*corev1.Pod, error) {
+	serverContainer := corev1.Container{
+		Name:  kubernetesContainer,
+		Image: run.image,
+		Args:  run.args,
+		// the stdin of the server is closed when the host detaches
+		Stdin:     true,
+		StdinOnce: true,
+	}
+	if run.entrypoint != "" {
+		serverContainer.Command = []string{run.entrypoint}
+	}
+	for _, env := range run.env {
+		key, _, _ := strings.Cut(env, "=")
+		serverContainer.Env = append(serverContainer.Env, corev1.EnvVar{
+			Name: key,
+			ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: name},
+				Key:                  key,
+			}},
+		})
+	}
+	if container != nil {
+		if err := container.setPodLimits(&serverContainer); err != nil {
+			return nil, err
+		}
+	}
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{"app.kubernetes.io/managed-by": kubernetesManagedBy},
+		},
+		Spec: corev1.PodSpec{
+			Containers:         []corev1.Container{serverContainer},
+			RestartPolicy:      corev1.RestartPolicyNever,
+			ServiceAccountName: k.ServiceAccount,
+		},
+	}, nil
+}
+
+// restConfig returns the config of the client of the cluster
+// and the namespace of the pods
+func (k KubernetesConfig) restConfig() (*rest.Config, string, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = k.Kubeconfig
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: k.Context}
+	config := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+	restConfig, err := config.ClientConfig()
+	if err != nil {
+		return nil, "", fmt.Errorf("kubernetes: %w", err)
+	}
+	namespace := k.Namespace
+	if namespace == "" {
+		if namespace, _, err = config.Namespace(); err != nil {
+			return nil, "", fmt.Errorf("kubernetes: %w", err)
+		}
+	}
+	return restConfig, namespace, nil
+}
+
+// podStartFailures are the reasons of the waiting containers which do not start
+var podStartFailures = map[string]bool{
+	"ErrImagePull": true, "ImagePullBackOff": true, "InvalidImageName": true,
+	"CreateContainerConfigError": true, "CreateContainerError": true,
+}
+
+// kubernetesClient is the client of a server running as a pod
+type kubernetesClient struct {
+	*client.Client
+	server    string
+	clientset kubernetes.Interface
+	namespace string
+	pod       string
+	// stopAttach stops the attachment to the pod
+	stopAttach context.CancelFunc
+}
+
+// newKubernetesClient starts the pod of the server, then attaches to it
+// through the API server: the JSON-RPC messages are exchanged on the stdin
+// and the stdout of the pod with the stdio transport of mcp-go
+func (s *MCPServer) newKubernetesClient() (MCPClient, error) {
+	command, args, err := s.Config.CommandLine()
+	if err != nil {
+		return nil, err
+	}
+	run, err := parseDockerRun(command, args, func(key string) string {
+		// like docker, -e KEY takes the value of the environment of the command
+		if value, ok := s.Config.Env[key]; ok {
+			expanded, _ := expandEnv(value)
+			return expanded
+		}
+		return os.Getenv(key)
+	})
+	if err != nil {
+		return nil, err
+	}
+	restConfig, namespace, err := s.Config.Kubernetes.restConfig()
+	if err != nil {
+		return nil, err
+	}
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("kubernetes: %w", err)
+	}
+	pod, err := s.Config.Kubernetes.pod(podName(run.image), run, s.Config.Container)
+	if err != nil {
+		return nil, err
+	}
+	kubernetesClient := &kubernetesClient{server: s.Name, clientset: clientset, namespace: namespace, pod: pod.Name}
+
+	ctx, cancel := context.WithTimeout(context.Background(), kubernetesStartTimeout)
+	defer cancel()
+	if err := kubernetesClient.startPod(ctx, pod, run.env); err != nil {
+		kubernetesClient.deletePod()
+		return nil, err
+	}
+	stdio, err := kubernetesClient.attach(restConfig)
+	if err != nil {
+		kubernetesClient.deletePod()
+		return nil, err
+	}
+	if kubernetesClient.Client, err = s.startClient(context.Background(), stdio); err != nil {
+		kubernetesClient.stopAttach()
+		kubernetesClient.deletePod()
+		return nil, err
+	}
+	go logStderr(s.Name, stdio.Stderr())
+	slog.Info("server pod started", "server", s.Name, "namespace", namespace, "pod", pod.Name)
+	return kubernetesClient, nil
+}
+
+// startPod creates the secret of the env vars and the pod,
+// and waits for the pod to run
+func (c *kubernetesClient) startPod(ctx context.Context, pod *corev1.Pod, env []string) error {
+	var secret *corev1.Secret
+	if len(env) > 0 {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Labels: pod.Labels},
+			StringData: map[string]string{},
+		}
+		for _, variable := range env {
+			key, value, _ := strings.Cut(variable, "=")
+			secret.StringData[key] = value
+		}
+		var err error
+		if secret, err = c.clientset.CoreV1().Secrets(c.namespace).Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("kubernetes: failed to create the secret of the pod: %w", err)
+		}
+	}
+	created, err := c.clientset.CoreV1().Pods(c.namespace).Create(ctx, pod, metav1.CreateOptions{})
+	if err != nil {
+		c.deleteSecret(secret)
+		return fmt.Errorf("kubernetes: failed to create the pod: %w", err)
+	}
+	if secret != nil {
+		// the secret is deleted with the pod
+		secret.OwnerReferences = []metav1.OwnerReference{{
+			APIVersion: "v1", Kind: "Pod", Name: created.Name, UID: created.UID,
+		}}
+		if _, err := c.clientset.CoreV1().Secrets(c.namespace).Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+			c.deleteSecret(secret)
+			return fmt.Errorf("kubernetes: failed to update the secret of the pod: %w", err)
+		}
+	}
+
+	err = wait.PollUntilContextCancel(ctx, time.Second, true, func(ctx context.Context) (bool, error) {
+		pod, err := c.clientset.CoreV1().Pods(c.namespace).Get(ctx, created.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		switch pod.Status.Phase {
+		case corev1.PodRunning:
+			return true, nil
+		case corev1.PodSucceeded, corev1.PodFailed:
+			return false, fmt.Errorf("the pod stopped: %s %s", pod.Status.Reason, pod.Status.Message)
+		}
+		for _, status := range pod.Status.ContainerStatuses {
+			if waiting := status.State.Waiting; waiting != nil && podStartFailures[waiting.Reason] {
+				return false, fmt.Errorf("%s: %s", waiting.Reason, waiting.Message)
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return fmt.Errorf("kubernetes: the pod %s did not start: %w", created.Name, err)
+	}
+	return nil
+}
+
+// attach attaches to the stdin, the stdout and the stderr of the pod
+// (with the websocket protocol, or SPDY for the older API servers)
+// and returns the stdio transport of mcp-go exchanging the messages
+func (c *kubernetesClient) attach(restConfig *rest.Config) (*transport.Stdio, error) {
+	request := c.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").Namespace(c.namespace).Name(c.pod).SubResource("attach").
+		VersionedParams(&corev1.PodAttachOptions{
+			Container: kubernetesContainer,
+			Stdin:     true,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+	websocketExecutor, err := remotecommand.NewWebSocketExecutor(restConfig, "GET", request.URL().String())
+	if err != nil {
+		return nil, fmt.Errorf("kubernetes: %w", err)
+	}
+	spdyExecutor, err := remotecommand.NewSPDYExecutor(restConfig, "POST", request.URL())
+	if err != nil {
+		return nil, fmt.Errorf("kubernetes: %w", err)
+	}
+	executor, err := remotecommand.NewFallbackExecutor(websocketExecutor, spdyExecutor, func(err error) bool {
+		return httpstream.IsUpgradeFailure(err) || httpstream.IsHTTPSProxyError(err)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("kubernetes: %w", err)
+	}
+
+	stdinReader, stdinWriter := io.Pipe()
+	stdoutReader, stdoutWriter := io.Pipe()
+	stderrReader, stderrWriter := io.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	c.stopAttach = cancel
+	go func() {
+		err := executor.StreamWithContext(ctx, remotecommand.StreamOptions{
+			Stdin:  stdinReader,
+			Stdout: stdoutWriter,
+			Stderr: stderrWriter,
+		})
+		if err != nil && !errors.Is(err, context.Canceled) {
+			slog.Warn("the attachment to the pod stopped", "server", c.server, "pod", c.pod, "error", err)
+		}
+		// the transport sees the end of the stdout of the server
+		stdoutWriter.CloseWithError(err)
+		stderrWriter.CloseWithError(err)
+	}()
+	return transport.NewIO(stdoutReader, stdinWriter, stderrReader), nil
+}
+
+// Close closes the stdin of the server (the pod stops), detaches
+// from the pod and deletes it with its secret
+func (c *kubernetesClient) Close() error {
+	err := c.Client.Close()
+	c.stopAttach()
+	c.deletePod()
+	return err
+}
+
+// deletePod deletes the pod of the server (the secret is owned by the pod),
+// the host does not wait for its termination
+func (c *kubernetesClient) deletePod() {
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	background := metav1.DeletePropagationBackground
+	err := c.clientset.CoreV1().Pods(c.namespace).Delete(ctx, c.pod, metav1.DeleteOptions{PropagationPolicy: &background})
+	if err != nil && !apierrors.IsNotFound(err) {
+		slog.Warn("failed to delete the pod of the server", "server", c.server, "pod", c.pod, "error", err)
+	}
+}
+
+// deleteSecret deletes the secret of a pod which is not owned by the pod
+func (c *kubernetesClient) deleteSecret(secret *corev1.Secret) {
+	if secret == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	if err := c.clientset.CoreV1().Secrets(c.namespace).Delete(ctx, secret.Name, metav1.DeleteOptions{}); err != nil {
+		slog.Warn("failed to delete the secret of the pod", "server", c.server, "secret", secret.Name, "error", err)
+	}
+}
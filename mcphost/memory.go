@@ -0,0 +1,340 @@
+package mcphost
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// DefaultMemoryDriver is the database/sql driver of the memory: the driver
+// of modernc.org/sqlite, linked in the CLI
+const DefaultMemoryDriver = "sqlite"
+
+// Default settings of the memory
+const (
+	DefaultMemoryRecentTurns     = 3
+	DefaultMemoryEmbeddingsModel = "nomic-embed-text"
+)
+
+// MemoryConfig enables the memory of the conversations across the sessions
+type MemoryConfig struct {
+	// Database is the SQLite file of the memory
+	Database string `json:"database"`
+	// Driver is the database/sql driver (DefaultMemoryDriver by default)
+	Driver string `json:"driver"`
+	// User is the owner of the memories ($USER by default):
+	// the sessions only recall the turns of their user
+	User string `json:"user"`
+	// RecentTurns is the number of the last turns recalled
+	// (DefaultMemoryRecentTurns by default, negative to disable them)
+	RecentTurns int `json:"recentTurns"`
+	// RelevantTurns is the number of the turns recalled for their similarity
+	// with the prompt (0 disables the embeddings)
+	RelevantTurns int `json:"relevantTurns"`
+	// EmbeddingsModel computes the embeddings of the turns
+	// (DefaultMemoryEmbeddingsModel by default)
+	EmbeddingsModel string `json:"embeddingsModel"`
+}
+
+// MemoryTurn is a turn of a previous session: the prompt, the tool calls
+// and results, and the answer
+type MemoryTurn struct {
+	ID        int64
+	User      string
+	Session   string
+	CreatedAt time.Time
+	Prompt    string
+	Answer    string
+	Messages  []api.Message
+	// Embedding is the embedding of the prompt and of the answer (nil without embeddings)
+	Embedding []float32
+	// Score is the similarity with the prompt of a relevant turn
+	Score float64
+}
+
+// MemoryStore saves the turns of the sessions in a SQLite database
+type MemoryStore struct {
+	db *sql.DB
+}
+
+// OpenMemoryStore opens (and creates) the memory database,
+// the driver must be linked in the program
+func OpenMemoryStore(driver string, dataSource string) (*MemoryStore, error) {
+	db, err := sql.Open(driver, dataSource)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the memory %s (is the %s driver linked?): %w", dataSource, driver, err)
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS memory_turns (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user TEXT NOT NULL,
+		session TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		prompt TEXT NOT NULL,
+		answer TEXT NOT NULL,
+		messages TEXT NOT NULL,
+		embedding TEXT
+	)`)
+	if err == nil {
+		_, err = db.Exec(`CREATE INDEX IF NOT EXISTS memory_turns_user ON memory_turns (user, id)`)
+	}
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create the memory tables: %w", err)
+	}
+	return &MemoryStore{db: db}, nil
+}
+
+// Save adds a turn to the memory
+func (m *MemoryStore) Save(ctx context.Context, turn MemoryTurn) error {
+	messages, err := json.Marshal(turn.Messages)
+	if err != nil {
+		return err
+	}
+	var embedding interface{}
+	if turn.Embedding != nil {
+		data, err := json.Marshal(turn.Embedding)
+		if err != nil {
+			return err
+		}
+		embedding = string(data)
+	}
+	_, err = m.db.ExecContext(ctx,
+		`INSERT INTO memory_turns (user, session, created_at, prompt, answer, messages, embedding) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		turn.User, turn.Session, turn.CreatedAt.UTC().Format(time.RFC3339Nano), turn.Prompt, turn.Answer, string(messages), embedding)
+	return err
+}
+
+// Recent returns the last turns of a user, the oldest first,
+// without the turns of the session exclude
+func (m *MemoryStore) Recent(ctx context.Context, user string, limit int, exclude string) ([]MemoryTurn, error) {
+	turns, err := m.query(ctx,
+		`SELECT id, user, session, created_at, prompt, answer, messages, embedding FROM memory_turns
+		WHERE user = ? AND session <> ? ORDER BY id DESC LIMIT ?`, user, exclude, limit)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(turns, func(i, j int) bool { return turns[i].ID < turns[j].ID })
+	return turns, nil
+}
+
+// Relevant returns the turns of a user with the embeddings the most similar
+// to embedding (cosine similarity), the most similar first,
+// without the turns of the session exclude
+func (m *MemoryStore) Relevant(ctx context.Context, user string, embedding []float32, limit int, exclude string) ([]MemoryTurn, error) {
+	turns, err := m.query(ctx,
+		`SELECT id, user, session, created_at, prompt, answer, messages, embedding FROM memory_turns
+		WHERE user = ? AND session <> ? AND embedding IS NOT NULL`, user, exclude)
+	if err != nil {
+		return nil, err
+	}
+	for i := range turns {
+		turns[i].Score = cosineSimilarity(embedding, turns[i].Embedding)
+	}
+	sort.SliceStable(turns, func(i, j int) bool { return turns[i].Score > turns[j].Score })
+	if len(turns) > limit {
+		turns = turns[:limit]
+	}
+	return turns, nil
+}
+
+func (m *MemoryStore) query(ctx context.Context, query string, args ...interface{}) ([]MemoryTurn, error) {
+	rows, err := m.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	turns := []MemoryTurn{}
+	for rows.Next() {
+		var turn MemoryTurn
+		var createdAt, messages string
+		var embedding sql.NullString
+		if err := rows.Scan(&turn.ID, &turn.User, &turn.Session, &createdAt, &turn.Prompt, &turn.Answer, &messages, &embedding); err != nil {
+			return nil, err
+		}
+		turn.CreatedAt, _ = time.Parse(time.RFC3339Nano, createdAt)
+		if err := json.Unmarshal([]byte(messages), &turn.Messages); err != nil {
+			return nil, fmt.Errorf("invalid messages in the memory turn %d: %w", turn.ID, err)
+		}
+		if embedding.Valid {
+			if err := json.Unmarshal([]byte(embedding.String), &turn.Embedding); err != nil {
+				return nil, fmt.Errorf("invalid embedding in the memory turn %d: %w", turn.ID, err)
+			}
+		}
+		turns = append(turns, turn)
+	}
+	return turns, rows.Err()
+}
+
+// Close closes the database
+func (m *MemoryStore) Close() error {
+	return m.db.Close()
+}
+
+// cosineSimilarity returns the similarity of two embeddings (0 when their sizes differ)
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// Memory gives the sessions of a user the turns of their previous sessions:
+// the last turns and the turns relevant to the prompt are added to the
+// system instructions, and each answered turn is saved
+type Memory struct {
+	Store           *MemoryStore
+	Ollama          *api.Client
+	User            string
+	RecentTurns     int
+	RelevantTurns   int
+	EmbeddingsModel string
+}
+
+// NewMemory opens the memory of a config
+func NewMemory(ollama *api.Client, config MemoryConfig) (*Memory, error) {
+	driver := config.Driver
+	if driver == "" {
+		driver = DefaultMemoryDriver
+	}
+	store, err := OpenMemoryStore(driver, os.ExpandEnv(config.Database))
+	if err != nil {
+		return nil, err
+	}
+	memory := &Memory{
+		Store:           store,
+		Ollama:          ollama,
+		User:            config.User,
+		RecentTurns:     config.RecentTurns,
+		RelevantTurns:   config.RelevantTurns,
+		EmbeddingsModel: config.EmbeddingsModel,
+	}
+	if memory.User == "" {
+		memory.User = os.Getenv("USER")
+	}
+	if memory.RecentTurns == 0 {
+		memory.RecentTurns = DefaultMemoryRecentTurns
+	}
+	if memory.EmbeddingsModel == "" {
+		memory.EmbeddingsModel = DefaultMemoryEmbeddingsModel
+	}
+	return memory, nil
+}
+
+// Recall returns the memories of the previous sessions to give with a prompt
+// ("" when there are none). A failure of the embeddings only disables the
+// relevant turns.
+func (m *Memory) Recall(ctx context.Context, session string, prompt string) (string, error) {
+	turns := []MemoryTurn{}
+	if m.RecentTurns > 0 {
+		recent, err := m.Store.Recent(ctx, m.User, m.RecentTurns, session)
+		if err != nil {
+			return "", err
+		}
+		turns = append(turns, recent...)
+	}
+	if m.RelevantTurns > 0 {
+		embedding, err := m.embed(ctx, prompt)
+		if err != nil {
+			slog.Warn("failed to compute the embedding of the prompt, no relevant memories", "model", m.EmbeddingsModel, "error", err)
+		} else {
+			relevant, err := m.Store.Relevant(ctx, m.User, embedding, m.RelevantTurns, session)
+			if err != nil {
+				return "", err
+			}
+			turns = append(turns, relevant...)
+		}
+	}
+	if len(turns) == 0 {
+		return "", nil
+	}
+
+	var b strings.Builder
+	b.WriteString("Memories of your previous conversations with the user (use them if they help):\n")
+	recalled := map[int64]bool{}
+	for _, turn := range turns {
+		if recalled[turn.ID] {
+			continue
+		}
+		recalled[turn.ID] = true
+		fmt.Fprintf(&b, "\n[%s] User: %s\n", turn.CreatedAt.Format(time.DateTime), turn.Prompt)
+		for _, message := range turn.Messages {
+			if message.Role == "tool" {
+				fmt.Fprintf(&b, "Tool result: %s\n", truncateMemory(message.Content))
+			}
+		}
+		fmt.Fprintf(&b, "Assistant: %s\n", truncateMemory(turn.Answer))
+	}
+	slog.Info("memories recalled", "user", m.User, "turns", len(recalled))
+	return b.String(), nil
+}
+
+// Remember saves a turn of a session: the messages from the prompt to the answer
+func (m *Memory) Remember(ctx context.Context, session string, messages []api.Message, answer string) error {
+	prompt := ""
+	for _, message := range messages {
+		if message.Role == "user" {
+			prompt = message.Content
+			break
+		}
+	}
+	turn := MemoryTurn{
+		User:      m.User,
+		Session:   session,
+		CreatedAt: time.Now(),
+		Prompt:    prompt,
+		Answer:    answer,
+		Messages:  messages,
+	}
+	if m.RelevantTurns > 0 {
+		embedding, err := m.embed(ctx, prompt+"\n"+answer)
+		if err != nil {
+			slog.Warn("failed to compute the embedding of the turn", "model", m.EmbeddingsModel, "error", err)
+		}
+		turn.Embedding = embedding
+	}
+	return m.Store.Save(ctx, turn)
+}
+
+// Close closes the memory database
+func (m *Memory) Close() error {
+	return m.Store.Close()
+}
+
+func (m *Memory) embed(ctx context.Context, text string) ([]float32, error) {
+	response, err := m.Ollama.Embed(ctx, &api.EmbedRequest{Model: m.EmbeddingsModel, Input: text})
+	if err != nil {
+		return nil, err
+	}
+	if len(response.Embeddings) == 0 {
+		return nil, fmt.Errorf("no embedding returned by %s", m.EmbeddingsModel)
+	}
+	return response.Embeddings[0], nil
+}
+
+// truncateMemory shortens the long contents of the recalled turns
+func truncateMemory(text string) string {
+	const maxLength = 500
+	text = strings.TrimSpace(text)
+	if len(text) <= maxLength {
+		return text
+	}
+	return text[:cutIndex(text, maxLength)] + "..."
+}
@@ -0,0 +1,110 @@
+package mcphost
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ollama/ollama/api"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics are the Prometheus metrics of a host, in the registry of the host
+// (NewHost creates them, the chat server exposes them on /metrics).
+// A nil Metrics records nothing.
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	toolCalls    *prometheus.CounterVec
+	toolErrors   *prometheus.CounterVec
+	tokens       *prometheus.CounterVec
+	toolDuration *prometheus.HistogramVec
+	chatDuration *prometheus.HistogramVec
+}
+
+// NewMetrics creates the metrics of a host and their registry,
+// the connected servers of tools are counted when the metrics are collected
+func NewMetrics(tools *ToolRegistry) *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		toolCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mcphost_tool_calls_total",
+			Help: "Number of MCP tool calls.",
+		}, []string{"server", "tool"}),
+		toolErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mcphost_tool_errors_total",
+			Help: "Number of failed MCP tool calls.",
+		}, []string{"server", "tool"}),
+		tokens: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mcphost_tokens_total",
+			Help: "Number of tokens evaluated (prompt) and generated (completion) by the models.",
+		}, []string{"model", "type"}),
+		toolDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "mcphost_tool_call_duration_seconds",
+			Help:    "Duration of the MCP tool calls.",
+			Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+		}, []string{"server", "tool"}),
+		chatDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "mcphost_chat_duration_seconds",
+			Help:    "Duration of the chat completions per model.",
+			Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+		}, []string{"model"}),
+	}
+	connections := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "mcphost_mcp_connections",
+		Help: "Number of connected MCP servers.",
+	}, func() float64 {
+		connected := 0
+		for _, server := range tools.Servers() {
+			if server.Client() != nil {
+				connected++
+			}
+		}
+		return float64(connected)
+	})
+	m.Registry.MustRegister(m.toolCalls, m.toolErrors, m.tokens, m.toolDuration, m.chatDuration, connections)
+	return m
+}
+
+// Handler exposes the metrics in the Prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{})
+}
+
+// recordToolCall records a tool call and its duration, failed is true
+// for an error of the call or an error result of the tool
+func (m *Metrics) recordToolCall(server string, tool string, duration time.Duration, failed bool) {
+	if m == nil {
+		return
+	}
+	m.toolCalls.WithLabelValues(server, tool).Inc()
+	if failed {
+		m.toolErrors.WithLabelValues(server, tool).Inc()
+	}
+	m.toolDuration.WithLabelValues(server, tool).Observe(duration.Seconds())
+}
+
+// recordChat records a chat completion: its duration
+// and the tokens of the last response (Ollama sends the counts when done)
+func (m *Metrics) recordChat(model string, duration time.Duration, last api.ChatResponse) {
+	if m == nil {
+		return
+	}
+	m.chatDuration.WithLabelValues(model).Observe(duration.Seconds())
+	m.tokens.WithLabelValues(model, "prompt").Add(float64(last.PromptEvalCount))
+	m.tokens.WithLabelValues(model, "completion").Add(float64(last.EvalCount))
+}
+
+// SetMetrics sets the metrics recording the tool calls
+// (NewHost uses the metrics of the host)
+func (r *ToolRegistry) SetMetrics(metrics *Metrics) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = metrics
+}
+
+func (r *ToolRegistry) toolMetrics() *Metrics {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.metrics
+}
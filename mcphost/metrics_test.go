@@ -0,0 +1,39 @@
+package mcphost
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ollama/ollama/api"
+)
+
+func TestMetrics(t *testing.T) {
+	var calls atomic.Int64
+	host := newMockHost(t, &calls, toolCallRules(
+		MockToolCall{Name: "math.add", Arguments: map[string]interface{}{"a": 2, "b": 3}},
+		MockToolCall{Name: "math.fail", Arguments: map[string]interface{}{}},
+	)...)
+	// the metrics of another host are not mixed with these ones
+	newMockHost(t, &calls)
+	if _, _, err := host.NewSession().Agent.Run(context.Background(), []api.Message{{Role: "user", Content: "2+3?"}}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	host.Metrics.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body := recorder.Body.String()
+	for _, want := range []string{
+		`mcphost_tool_calls_total{server="math",tool="add"} 1`,
+		`mcphost_tool_calls_total{server="math",tool="fail"} 1`,
+		`mcphost_tool_errors_total{server="math",tool="fail"} 1`,
+		`mcphost_tool_call_duration_seconds_count{server="math",tool="add"} 1`,
+		`mcphost_chat_duration_seconds_count{model="` + host.AgentModel() + `"} 2`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics without %s:\n%s", want, body)
+		}
+	}
+}
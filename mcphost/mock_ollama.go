@@ -0,0 +1,189 @@
+package mcphost
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// MockOllama is a fake Ollama backend for the development and the tests
+// without GPU nor Ollama: it is the transport of an Ollama API client
+// (see Client) and answers the chat requests with the canned tool calls
+// and completions of a fixture. All the models are available.
+type MockOllama struct {
+	Fixture MockFixture
+}
+
+// MockFixture describes the answers of the mock (JSON fixture file)
+type MockFixture struct {
+	// NoTools makes the models look like models without tool support
+	NoTools bool `json:"noTools"`
+	// Rules are tried in order, the first matching rule answers
+	// (without matching rule, the answer repeats the last message)
+	Rules []MockRule `json:"rules"`
+}
+
+// MockRule is a canned answer and the requests it answers
+type MockRule struct {
+	// Model, if set, is the model of the request
+	Model string `json:"model"`
+	// Match, if set, is a case insensitive part of the last message
+	Match string `json:"match"`
+	// Role, if set, is the role of the last message (e.g. "tool" for the answer
+	// after a tool call, "user" for the first call)
+	Role string `json:"role"`
+	// Tools, if set, tells if the request has tools (true for the tools model)
+	Tools *bool `json:"tools"`
+
+	// Content is the answer, {{last}} is replaced by the last message
+	Content   string         `json:"content"`
+	ToolCalls []MockToolCall `json:"toolCalls"`
+}
+
+// MockToolCall is a tool call of a canned answer (with the namespaced tool name)
+type MockToolCall struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments"`
+}
+
+// defaultMockContent is the answer without matching rule
+const defaultMockContent = "Mock answer to: {{last}}"
+
+// NewMockOllama creates the mock with the fixture file ("" for the default answers)
+func NewMockOllama(fixturePath string) (*MockOllama, error) {
+	mock := &MockOllama{}
+	if fixturePath == "" {
+		return mock, nil
+	}
+	data, err := os.ReadFile(fixturePath)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &mock.Fixture); err != nil {
+		return nil, fmt.Errorf("invalid mock fixture %s: %w", fixturePath, err)
+	}
+	return mock, nil
+}
+
+// Client returns an Ollama API client answered by the mock
+func (m *MockOllama) Client() *api.Client {
+	return api.NewClient(&url.URL{Scheme: "http", Host: "mock-ollama"}, &http.Client{Transport: m})
+}
+
+// RoundTrip answers the requests of the Ollama API client
+func (m *MockOllama) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body interface{}
+	status := http.StatusOK
+	switch req.URL.Path {
+	case "/api/chat":
+		var chat api.ChatRequest
+		if err := json.NewDecoder(req.Body).Decode(&chat); err != nil {
+			return mockResponse(req, http.StatusBadRequest, map[string]string{"error": err.Error()}), nil
+		}
+		return m.chat(req, &chat), nil
+	case "/api/show":
+		var show api.ShowRequest
+		json.NewDecoder(req.Body).Decode(&show)
+		template := "{{ if .Tools }}{{ .Tools }}{{ end }}{{ .Prompt }}"
+		if m.Fixture.NoTools {
+			template = "{{ .Prompt }}"
+		}
+		body = api.ShowResponse{Template: template}
+	case "/api/version":
+		body = map[string]string{"version": "mock"}
+	case "/api/pull":
+		body = api.ProgressResponse{Status: "success"}
+	default:
+		status, body = http.StatusNotFound, map[string]string{"error": "not supported by the mock: " + req.URL.Path}
+	}
+	return mockResponse(req, status, body), nil
+}
+
+// chat answers a chat request with the matching rule, streamed word by word
+// when the request is streamed
+func (m *MockOllama) chat(req *http.Request, chat *api.ChatRequest) *http.Response {
+	rule := m.rule(chat)
+	last := ""
+	if len(chat.Messages) > 0 {
+		last = chat.Messages[len(chat.Messages)-1].Content
+	}
+	message := api.Message{Role: "assistant", Content: strings.ReplaceAll(rule.Content, "{{last}}", last)}
+	for _, call := range rule.ToolCalls {
+		message.ToolCalls = append(message.ToolCalls, api.ToolCall{
+			Function: api.ToolCallFunction{Name: call.Name, Arguments: callArguments(call.Arguments)},
+		})
+	}
+
+	var chunks []api.ChatResponse
+	if chat.Stream == nil || *chat.Stream {
+		for _, word := range strings.SplitAfter(message.Content, " ") {
+			chunks = append(chunks, api.ChatResponse{
+				Model:   chat.Model,
+				Message: api.Message{Role: "assistant", Content: word},
+			})
+		}
+		message.Content = ""
+	}
+	chunks = append(chunks, api.ChatResponse{
+		Model:      chat.Model,
+		CreatedAt:  time.Now(),
+		Message:    message,
+		Done:       true,
+		DoneReason: "stop",
+		Metrics: api.Metrics{
+			PromptEvalCount: EstimateMessagesTokens(chat.Messages),
+			EvalCount:       EstimateTokens(strings.ReplaceAll(rule.Content, "{{last}}", last)),
+		},
+	})
+
+	var ndjson bytes.Buffer
+	encoder := json.NewEncoder(&ndjson)
+	for _, chunk := range chunks {
+		encoder.Encode(chunk)
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Status:     "200 OK",
+		Header:     http.Header{"Content-Type": {"application/x-ndjson"}},
+		Body:       io.NopCloser(&ndjson),
+		Request:    req,
+	}
+}
+
+// rule returns the first rule matching the request
+func (m *MockOllama) rule(chat *api.ChatRequest) MockRule {
+	var last api.Message
+	if len(chat.Messages) > 0 {
+		last = chat.Messages[len(chat.Messages)-1]
+	}
+	for _, rule := range m.Fixture.Rules {
+		switch {
+		case rule.Model != "" && rule.Model != chat.Model:
+		case rule.Match != "" && !strings.Contains(strings.ToLower(last.Content), strings.ToLower(rule.Match)):
+		case rule.Role != "" && rule.Role != last.Role:
+		case rule.Tools != nil && *rule.Tools != (len(chat.Tools) > 0):
+		default:
+			return rule
+		}
+	}
+	return MockRule{Content: defaultMockContent}
+}
+
+func mockResponse(req *http.Request, status int, body interface{}) *http.Response {
+	data, _ := json.Marshal(body)
+	return &http.Response{
+		StatusCode: status,
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(data)),
+		Request:    req,
+	}
+}
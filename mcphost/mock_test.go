@@ -0,0 +1,170 @@
+package mcphost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/ollama/ollama/api"
+)
+
+// newMockHost returns a host without MCP servers whose models are mocked,
+// the native server "math" has the tools add and fail (and the excluded tool hidden)
+func newMockHost(t *testing.T, calls *atomic.Int64, rules ...MockRule) *Host {
+	t.Helper()
+	mock := &MockOllama{Fixture: MockFixture{Rules: rules}}
+	host, err := NewHost(context.Background(), mock.Client(), Config{})
+	if err != nil {
+		t.Fatalf("NewHost: %v", err)
+	}
+	t.Cleanup(host.Close)
+
+	add := NativeTool{
+		Tool: mcp.NewTool("add", mcp.WithDescription("Add two numbers"),
+			mcp.WithNumber("a", mcp.Required()), mcp.WithNumber("b", mcp.Required())),
+		Handler: func(ctx context.Context, arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+			calls.Add(1)
+			a, _ := arguments["a"].(float64)
+			b, _ := arguments["b"].(float64)
+			return mcp.NewToolResultText(fmt.Sprint(a + b)), nil
+		},
+	}
+	fail := NativeTool{
+		Tool: mcp.NewTool("fail", mcp.WithDescription("Always fails")),
+		Handler: func(ctx context.Context, arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+			calls.Add(1)
+			return nil, errors.New("out of order")
+		},
+	}
+	hidden := NativeTool{Tool: mcp.NewTool("hidden"), Handler: fail.Handler}
+	config := MCPServerConfig{Approval: ApprovalAllow, Exclude: []string{"hid*"}}
+	if err := host.Registry.RegisterNativeTools("math", config, add, fail, hidden); err != nil {
+		t.Fatalf("RegisterNativeTools: %v", err)
+	}
+	return host
+}
+
+// toolCallRules call the tools for the user prompts, then answer
+// with the last tool result
+func toolCallRules(calls ...MockToolCall) []MockRule {
+	withTools := true
+	return []MockRule{
+		{Role: "user", Tools: &withTools, ToolCalls: calls},
+		{Tools: &withTools},
+		{Content: "Result: {{last}}"},
+	}
+}
+
+func TestMockRegistryTools(t *testing.T) {
+	var calls atomic.Int64
+	host := newMockHost(t, &calls)
+
+	var names []string
+	for _, tool := range host.Registry.Tools() {
+		names = append(names, tool.Name)
+	}
+	if got := strings.Join(names, ","); got != "math.add,math.fail" {
+		t.Errorf("tools = %s, want math.add,math.fail", got)
+	}
+	if err := host.Registry.RegisterNativeTools("math", MCPServerConfig{}); err == nil {
+		t.Error("RegisterNativeTools: the second math server is registered")
+	}
+
+	result, err := host.Registry.CallTool(context.Background(), "math.add", map[string]interface{}{"a": 2.0, "b": 3.0})
+	if err != nil || result.IsError || NormalizeToolResult(result).Text != "5" {
+		t.Errorf("CallTool(math.add) = %+v, %v, want 5", result, err)
+	}
+	result, err = host.Registry.CallTool(context.Background(), "math.fail", nil)
+	if err != nil || !result.IsError {
+		t.Errorf("CallTool(math.fail) = %+v, %v, want an error result", result, err)
+	}
+	if _, err := host.Registry.CallTool(context.Background(), "math.sub", nil); err == nil {
+		t.Error("CallTool(math.sub): error expected for an unknown tool")
+	}
+	if calls.Load() != 2 {
+		t.Errorf("%d calls of the handlers, want 2", calls.Load())
+	}
+}
+
+func TestMockAgentLoop(t *testing.T) {
+	var calls atomic.Int64
+	host := newMockHost(t, &calls, toolCallRules(
+		MockToolCall{Name: "math.add", Arguments: map[string]interface{}{"a": 2, "b": 3}},
+		// an identical call of the same answer runs once
+		MockToolCall{Name: "math.add", Arguments: map[string]interface{}{"a": 2, "b": 3}},
+		MockToolCall{Name: "math.fail", Arguments: map[string]interface{}{}},
+	)...)
+	session := host.NewSession()
+
+	messages, results, err := session.Agent.Run(context.Background(), []api.Message{{Role: "user", Content: "2+3?"}})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	// the duplicate call has a tool message, not a result
+	if len(results) != 2 {
+		t.Fatalf("%d tool results, want 2", len(results))
+	}
+	if results[0].Content != "5" || results[0].IsError {
+		t.Errorf("result of math.add = %+v, want 5", results[0])
+	}
+	if !results[1].IsError || !strings.Contains(results[1].Content, "out of order") {
+		t.Errorf("result of math.fail = %+v, want an error", results[1])
+	}
+	toolMessages := 0
+	for _, message := range messages {
+		if message.Role == "tool" {
+			toolMessages++
+		}
+	}
+	if toolMessages != 3 {
+		t.Errorf("%d tool messages, want one per call", toolMessages)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("%d calls of the handlers, want 2", calls.Load())
+	}
+	if last := messages[len(messages)-1]; last.Role != "assistant" || len(last.ToolCalls) != 0 {
+		t.Errorf("last message = %+v, want the final answer of the model", last)
+	}
+
+	answer, err := session.Ask(context.Background(), "2+3?", func(string) {})
+	if err != nil || !strings.HasPrefix(answer, "Result: ") {
+		t.Errorf("Ask = %q, %v, want the answer of the chat model", answer, err)
+	}
+}
+
+func TestMockAgentLoopUnknownTool(t *testing.T) {
+	var calls atomic.Int64
+	host := newMockHost(t, &calls, toolCallRules(MockToolCall{Name: "math.hidden"})...)
+	agent := host.NewSession().Agent
+
+	_, results, err := agent.Run(context.Background(), []api.Message{{Role: "user", Content: "hide"}})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(results) != 1 || !results[0].IsError || calls.Load() != 0 {
+		t.Errorf("results = %+v (%d calls), want an error result without call", results, calls.Load())
+	}
+}
+
+func TestMockAgentLoopMaxIterations(t *testing.T) {
+	var calls atomic.Int64
+	withTools := true
+	// the model never stops calling the tool
+	host := newMockHost(t, &calls, MockRule{Tools: &withTools, ToolCalls: []MockToolCall{
+		{Name: "math.add", Arguments: map[string]interface{}{"a": 1, "b": 1}},
+	}})
+	agent := host.NewSession().Agent
+	agent.MaxIterations = 3
+
+	_, results, err := agent.Run(context.Background(), []api.Message{{Role: "user", Content: "loop"}})
+	if !errors.Is(err, ErrMaxIterations) || !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("Run: %v, want ErrMaxIterations", err)
+	}
+	if len(results) != 3 || calls.Load() != 3 {
+		t.Errorf("%d results and %d calls, want 3", len(results), calls.Load())
+	}
+}
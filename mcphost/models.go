@@ -0,0 +1,137 @@
+package mcphost
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+)
+
+// SupportsTools asks Ollama if the model supports the native tool calls:
+// the template of such a model uses the tools (.Tools)
+func SupportsTools(ctx context.Context, ollama *api.Client, model string) (bool, error) {
+	show, err := ollama.Show(ctx, &api.ShowRequest{Model: model})
+	if err != nil {
+		return false, err
+	}
+	return strings.Contains(show.Template, ".Tools"), nil
+}
+
+// MissingModels returns the models that are not available locally (/api/tags)
+func MissingModels(ctx context.Context, ollama *api.Client, models []string) ([]string, error) {
+	list, err := ollama.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	local := map[string]bool{}
+	for _, model := range list.Models {
+		local[fullModelName(model.Name)] = true
+	}
+
+	missing := []string{}
+	for _, model := range models {
+		if !local[fullModelName(model)] {
+			missing = append(missing, model)
+		}
+	}
+	return missing, nil
+}
+
+// fullModelName adds the default tag to a model name ("qwen2.5" is "qwen2.5:latest")
+func fullModelName(model string) string {
+	name := model[strings.LastIndex(model, "/")+1:]
+	if !strings.Contains(name, ":") {
+		return model + ":latest"
+	}
+	return model
+}
+
+// PullModel downloads a model and logs the progress of the download
+// (each step, and every 10% of the downloads)
+func PullModel(ctx context.Context, ollama *api.Client, model string) error {
+	lastStatus, lastPercent := "", int64(-1)
+	return ollama.Pull(ctx, &api.PullRequest{Model: model}, func(progress api.ProgressResponse) error {
+		if progress.Status != lastStatus {
+			slog.Info("pulling model", "model", model, "status", progress.Status)
+			lastStatus, lastPercent = progress.Status, -1
+		}
+		if progress.Total > 0 {
+			if percent := progress.Completed * 100 / progress.Total; percent/10 != lastPercent/10 {
+				slog.Info("pulling model", "model", model, "status", progress.Status, "percent", percent)
+				lastPercent = percent
+			}
+		}
+		return nil
+	})
+}
+
+// AgentModel returns the model that calls the tools:
+// the tools model, or the chat model in single model mode
+func (h *Host) AgentModel() string {
+	if h.SingleModel {
+		return h.ChatModel
+	}
+	return h.ToolsModel
+}
+
+// Models returns the models used by the sessions
+func (h *Host) Models() []string {
+	models := []string{h.ChatModel}
+	if !h.SingleModel && h.ToolsModel != h.ChatModel {
+		models = []string{h.ToolsModel, h.ChatModel}
+	}
+	if h.Summarizer != nil && h.Summarizer.Model != "" && !slices.Contains(models, h.Summarizer.Model) {
+		models = append(models, h.Summarizer.Model)
+	}
+	return models
+}
+
+// EnsureModels checks that the models of the host are available locally.
+// The missing models are pulled when pull is true, otherwise an error tells
+// how to get them.
+func (h *Host) EnsureModels(ctx context.Context, pull bool) error {
+	var missing []string
+	err := h.OllamaRetry.retry(ctx, "list models", func() (err error) {
+		missing, err = MissingModels(ctx, h.Ollama, h.Models())
+		return err
+	}, transientOllamaError)
+	if err != nil {
+		return fmt.Errorf("failed to list the Ollama models: %w", err)
+	}
+	for _, model := range missing {
+		if !pull {
+			return fmt.Errorf("the model %s is not available: run ollama pull %s", model, model)
+		}
+		if err := PullModel(ctx, h.Ollama, model); err != nil {
+			return fmt.Errorf("failed to pull %s: %w", model, err)
+		}
+	}
+	return nil
+}
+
+// CheckToolSupport switches to the prompt tool calls when the agent model
+// does not support the native tool calls (instead of getting no tool calls)
+func (h *Host) CheckToolSupport(ctx context.Context) error {
+	if h.ToolCallMode == ToolCallModePrompt {
+		return nil
+	}
+
+	ctx, cancel := withTimeout(ctx, h.ChatTimeout)
+	defer cancel()
+	var supported bool
+	err := h.OllamaRetry.retry(ctx, "show "+h.AgentModel(), func() (err error) {
+		supported, err = SupportsTools(ctx, h.Ollama, h.AgentModel())
+		return err
+	}, transientOllamaError)
+	if err != nil {
+		return fmt.Errorf("failed to get the capabilities of %s: %w", h.AgentModel(), err)
+	}
+	if !supported {
+		slog.Warn("the model does not support tools: they are described in the prompt", "model", h.AgentModel())
+		h.ToolCallMode = ToolCallModePrompt
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package mcphost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// NativeToolHandler runs a native tool with the arguments of the model.
+// An error is sent to the model as an error result of the tool.
+type NativeToolHandler func(ctx context.Context, arguments map[string]interface{}) (*mcp.CallToolResult, error)
+
+// NativeTool is a tool implemented by a Go function of the host process
+type NativeTool struct {
+	Tool    mcp.Tool
+	Handler NativeToolHandler
+}
+
+// RegisterNativeTools adds Go functions to the registry as the tools of a server
+// named name: they are called like the tools of the MCP servers (same namespacing,
+// approvals, timeouts and metrics) without starting a process.
+// The approval policies, the include/exclude patterns and the timeouts of config are used.
+func (r *ToolRegistry) RegisterNativeTools(name string, config MCPServerConfig, tools ...NativeTool) error {
+	if r.registered(name) {
+		return fmt.Errorf("server %s is already registered", name)
+	}
+
+	native := &nativeClient{name: name, handlers: map[string]NativeToolHandler{}}
+	server := &MCPServer{
+		Name:     name,
+		Config:   config,
+		Info:     mcp.Implementation{Name: name, Version: "native"},
+		timeouts: config.Timeouts.withDefaults(DefaultTimeouts),
+		client:   native,
+	}
+	for _, tool := range tools {
+		if !config.AllowsTool(tool.Tool.Name) {
+			continue
+		}
+		if tool.Tool.InputSchema.Type == "" {
+			tool.Tool.InputSchema.Type = "object"
+		}
+		native.tools = append(native.tools, tool.Tool)
+		native.handlers[tool.Tool.Name] = tool.Handler
+		server.Tools = append(server.Tools, tool.Tool)
+	}
+
+	r.add(server)
+	return nil
+}
+
+// nativeClient is the MCP client of the native tools: the requests are
+// function calls in the host process
+type nativeClient struct {
+	name     string
+	tools    []mcp.Tool
+	handlers map[string]NativeToolHandler
+}
+
+func (c *nativeClient) Initialize(ctx context.Context, request mcp.InitializeRequest) (*mcp.InitializeResult, error) {
+	result := &mcp.InitializeResult{
+		ProtocolVersion: mcp.LATEST_PROTOCOL_VERSION,
+		ServerInfo:      mcp.Implementation{Name: c.name, Version: "native"},
+	}
+	result.Capabilities.Tools = &struct {
+		ListChanged bool `json:"listChanged,omitempty"`
+	}{}
+	return result, nil
+}
+
+func (c *nativeClient) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (c *nativeClient) ListTools(ctx context.Context, request mcp.ListToolsRequest) (*mcp.ListToolsResult, error) {
+	return &mcp.ListToolsResult{Tools: c.tools}, nil
+}
+
+// CallTool runs the handler of the tool: its errors (and panics)
+// are returned as error results, like an MCP server does
+func (c *nativeClient) CallTool(ctx context.Context, request mcp.CallToolRequest) (result *mcp.CallToolResult, err error) {
+	handler, ok := c.handlers[request.Params.Name]
+	if !ok {
+		return nil, fmt.Errorf("unknown tool %s", request.Params.Name)
+	}
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			slog.Error("native tool panicked", "server", c.name, "tool", request.Params.Name, "panic", recovered)
+			result, err = mcp.NewToolResultError(fmt.Sprintf("the tool panicked: %v", recovered)), nil
+		}
+	}()
+
+	result, err = handler(ctx, request.GetArguments())
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	return result, nil
+}
+
+func (c *nativeClient) ListPrompts(ctx context.Context, request mcp.ListPromptsRequest) (*mcp.ListPromptsResult, error) {
+	return nil, errors.New("prompts not supported")
+}
+
+func (c *nativeClient) GetPrompt(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	return nil, errors.New("prompts not supported")
+}
+
+func (c *nativeClient) ListResources(ctx context.Context, request mcp.ListResourcesRequest) (*mcp.ListResourcesResult, error) {
+	return nil, errors.New("resources not supported")
+}
+
+func (c *nativeClient) ReadResource(ctx context.Context, request mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+	return nil, errors.New("resources not supported")
+}
+
+func (c *nativeClient) Subscribe(ctx context.Context, request mcp.SubscribeRequest) error {
+	return errors.New("resources not supported")
+}
+
+func (c *nativeClient) Unsubscribe(ctx context.Context, request mcp.UnsubscribeRequest) error {
+	return errors.New("resources not supported")
+}
+
+func (c *nativeClient) SetLevel(ctx context.Context, request mcp.SetLevelRequest) error {
+	return errors.New("logging not supported")
+}
+
+func (c *nativeClient) Close() error {
+	return nil
+}
@@ -0,0 +1,612 @@
+package mcphost
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultOAuthTimeout is the time given to the user to authorize the host
+const DefaultOAuthTimeout = 5 * time.Minute
+
+// OAuthConfig enables the OAuth authorization of a remote (http) server,
+// following the authorization of the MCP specification: the authorization
+// server is discovered from the server, the host is registered when there
+// is no client id (dynamic client registration), and the user authorizes
+// the host in the browser (authorization code with PKCE).
+// The tokens are cached in a file and refreshed when they expire.
+type OAuthConfig struct {
+	// ClientID and ClientSecret are the client of the host (with the ${VAR}
+	// references), the host is registered without them
+	ClientID     string `json:"clientId"`
+	ClientSecret string `json:"clientSecret"`
+	// Scopes are the scopes requested (the scopes of the server by default)
+	Scopes []string `json:"scopes"`
+	// RedirectPort is the port of the local redirect URI (a free port by default)
+	RedirectPort int `json:"redirectPort"`
+	// TokenFile caches the tokens (a file of the oauth directory of the user
+	// config directory by default)
+	TokenFile string `json:"tokenFile"`
+}
+
+// oauthToken is the response of the token endpoint
+type oauthToken struct {
+	AccessToken  string    `json:"access_token"`
+	TokenType    string    `json:"token_type,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	ExpiresIn    int       `json:"expires_in,omitempty"`
+	Expiry       time.Time `json:"expiry,omitempty"`
+}
+
+// expired tells if the token expires in less than a minute
+func (t *oauthToken) expired() bool {
+	return !t.Expiry.IsZero() && time.Until(t.Expiry) < time.Minute
+}
+
+// oauthState is the content of the token file: the client of the host,
+// the endpoints of the authorization server and the tokens
+type oauthState struct {
+	ClientID      string      `json:"clientId,omitempty"`
+	ClientSecret  string      `json:"clientSecret,omitempty"`
+	RedirectURI   string      `json:"redirectURI,omitempty"`
+	TokenEndpoint string      `json:"tokenEndpoint,omitempty"`
+	Token         *oauthToken `json:"token,omitempty"`
+}
+
+// authServerMetadata are the endpoints of an authorization server (RFC 8414)
+type authServerMetadata struct {
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	RegistrationEndpoint  string   `json:"registration_endpoint"`
+	ScopesSupported       []string `json:"scopes_supported"`
+}
+
+// OAuthClient authorizes the requests sent to a remote server:
+// it is the http.RoundTripper of the HTTP client of the server
+type OAuthClient struct {
+	// resource is the URL of the MCP endpoint
+	resource string
+	config   OAuthConfig
+	path     string
+	base     http.RoundTripper
+
+	mu    sync.Mutex
+	state oauthState
+}
+
+// oauthClients are the OAuth clients by MCP endpoint: the tokens are shared
+// by the clients of a server (restarts, reconnections)
+var (
+	oauthClientsMu sync.Mutex
+	oauthClients   = map[string]*OAuthClient{}
+)
+
+// oauthClientFor returns the OAuth client of the MCP endpoint
+func oauthClientFor(resource string, config OAuthConfig) (*OAuthClient, error) {
+	oauthClientsMu.Lock()
+	defer oauthClientsMu.Unlock()
+	if client, ok := oauthClients[resource]; ok {
+		return client, nil
+	}
+	client, err := newOAuthClient(resource, config)
+	if err != nil {
+		return nil, err
+	}
+	oauthClients[resource] = client
+	return client, nil
+}
+
+func newOAuthClient(resource string, config OAuthConfig) (*OAuthClient, error) {
+	var err error
+	if config.ClientID, err = expandEnv(config.ClientID); err != nil {
+		return nil, fmt.Errorf("oauth clientId: %w", err)
+	}
+	if config.ClientSecret, err = expandEnv(config.ClientSecret); err != nil {
+		return nil, fmt.Errorf("oauth clientSecret: %w", err)
+	}
+	path := config.TokenFile
+	if path == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return nil, fmt.Errorf("no directory for the OAuth tokens: %w", err)
+		}
+		hash := sha256.Sum256([]byte(resource))
+		path = filepath.Join(dir, "mcphost", "oauth", hex.EncodeToString(hash[:8])+".json")
+	}
+	client := &OAuthClient{resource: resource, config: config, path: path, base: http.DefaultTransport}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &client.state); err != nil {
+			slog.Warn("invalid OAuth token file, the host is authorized again", "file", path, "error", err)
+			client.state = oauthState{}
+		}
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+	return client, nil
+}
+
+// Authorized tells if the client has a token (it may need a refresh)
+func (c *OAuthClient) Authorized() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state.Token != nil
+}
+
+// RoundTrip sends the request with the access token. When the server
+// answers 401, the token is refreshed (or the user authorizes the host again),
+// then the request is sent again.
+func (c *OAuthClient) RoundTrip(req *http.Request) (*http.Response, error) {
+	token := c.accessToken(req.Context())
+	resp, err := c.base.RoundTrip(withBearer(req, token))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	challenge := resp.Header.Get("WWW-Authenticate")
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if token, err = c.reauthorize(req.Context(), token, challenge); err != nil {
+		return nil, err
+	}
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	return c.base.RoundTrip(withBearer(retry, token))
+}
+
+// withBearer returns a copy of the request with the access token
+func withBearer(req *http.Request, token string) *http.Request {
+	if token == "" {
+		return req
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+// accessToken returns the access token, refreshed when it expired
+// ("" before the authorization)
+func (c *OAuthClient) accessToken(ctx context.Context) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state.Token == nil {
+		return ""
+	}
+	if c.state.Token.expired() && c.state.Token.RefreshToken != "" {
+		if err := c.refresh(ctx); err != nil {
+			// the server rejects the token: the user authorizes the host again
+			slog.Warn("failed to refresh the OAuth token", "server", c.resource, "error", err)
+		}
+	}
+	return c.state.Token.AccessToken
+}
+
+// reauthorize gets a new token after the rejection of failed:
+// with the refresh token, or by asking the user
+func (c *OAuthClient) reauthorize(ctx context.Context, failed string, challenge string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state.Token != nil && c.state.Token.AccessToken != failed {
+		// another request already got a new token
+		return c.state.Token.AccessToken, nil
+	}
+	if c.state.Token != nil && c.state.Token.RefreshToken != "" {
+		err := c.refresh(ctx)
+		if err == nil {
+			return c.state.Token.AccessToken, nil
+		}
+		slog.Warn("failed to refresh the OAuth token", "server", c.resource, "error", err)
+	}
+	if err := c.authorize(ctx, challenge); err != nil {
+		return "", err
+	}
+	return c.state.Token.AccessToken, nil
+}
+
+// Authorize asks the user to authorize the host, the tokens are cached
+func (c *OAuthClient) Authorize(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.authorize(ctx, c.probe(ctx))
+}
+
+// probe sends a request without token to get the challenge of the server
+func (c *OAuthClient) probe(ctx context.Context) string {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.resource,
+		strings.NewReader(`{"jsonrpc":"2.0","id":0,"method":"ping"}`))
+	if err != nil {
+		return ""
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	resp, err := c.base.RoundTrip(req)
+	if err != nil {
+		return ""
+	}
+	resp.Body.Close()
+	return resp.Header.Get("WWW-Authenticate")
+}
+
+// authorize runs the authorization code flow with PKCE (c.mu is locked):
+// the user opens the authorization URL, the code is received by a local
+// redirect URI and exchanged for the tokens
+func (c *OAuthClient) authorize(ctx context.Context, challenge string) error {
+	// the user has DefaultOAuthTimeout to authorize the host,
+	// even when the request which needs the token has a shorter timeout
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), DefaultOAuthTimeout)
+	defer cancel()
+
+	metadata, scopes, err := c.discover(ctx, challenge)
+	if err != nil {
+		return fmt.Errorf("failed to discover the authorization server: %w", err)
+	}
+	listener, redirectURI, err := c.listen()
+	if err != nil {
+		return fmt.Errorf("failed to listen for the OAuth redirect: %w", err)
+	}
+	defer listener.Close()
+	if err := c.register(ctx, metadata, redirectURI); err != nil {
+		return err
+	}
+
+	verifier := randomString(32)
+	state := randomString(16)
+	hash := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {c.state.ClientID},
+		"redirect_uri":          {redirectURI},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(hash[:])},
+		"code_challenge_method": {"S256"},
+		"state":                 {state},
+		"resource":              {c.resource},
+	}
+	if len(scopes) > 0 {
+		query.Set("scope", strings.Join(scopes, " "))
+	}
+	authorizationURL := metadata.AuthorizationEndpoint + "?" + query.Encode()
+	if strings.Contains(metadata.AuthorizationEndpoint, "?") {
+		authorizationURL = metadata.AuthorizationEndpoint + "&" + query.Encode()
+	}
+	fmt.Fprintf(os.Stderr, "🔐 The MCP server %s needs an authorization, open this URL in a browser:\n%s\n",
+		c.resource, authorizationURL)
+
+	code, err := waitForCode(ctx, listener, state)
+	if err != nil {
+		return err
+	}
+	token, err := c.requestToken(ctx, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {verifier},
+	})
+	if err != nil {
+		return err
+	}
+	c.state.Token = token
+	slog.Info("the host is authorized by the MCP server", "server", c.resource)
+	return c.save()
+}
+
+// refresh gets a new access token with the refresh token (c.mu is locked)
+func (c *OAuthClient) refresh(ctx context.Context) error {
+	refreshToken := c.state.Token.RefreshToken
+	token, err := c.requestToken(ctx, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	})
+	if err != nil {
+		return err
+	}
+	if token.RefreshToken == "" {
+		token.RefreshToken = refreshToken
+	}
+	c.state.Token = token
+	slog.Info("OAuth token refreshed", "server", c.resource)
+	return c.save()
+}
+
+// requestToken posts a grant to the token endpoint
+func (c *OAuthClient) requestToken(ctx context.Context, grant url.Values) (*oauthToken, error) {
+	if c.state.TokenEndpoint == "" {
+		return nil, fmt.Errorf("unknown token endpoint")
+	}
+	grant.Set("client_id", c.state.ClientID)
+	grant.Set("resource", c.resource)
+	if c.state.ClientSecret != "" {
+		grant.Set("client_secret", c.state.ClientSecret)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.state.TokenEndpoint, strings.NewReader(grant.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var token oauthToken
+	if err := c.doJSON(req, &token); err != nil {
+		return nil, fmt.Errorf("token request (%s): %w", grant.Get("grant_type"), err)
+	}
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("token request (%s): no access token", grant.Get("grant_type"))
+	}
+	if token.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	return &token, nil
+}
+
+// resourceMetadataParameter is the resource_metadata parameter of a challenge
+var resourceMetadataParameter = regexp.MustCompile(`resource_metadata="([^"]+)"`)
+
+// discover returns the metadata of the authorization server of the resource
+// and the scopes to request: the protected resource metadata (RFC 9728) gives
+// the authorization server, the server of the resource is used without it
+func (c *OAuthClient) discover(ctx context.Context, challenge string) (authServerMetadata, []string, error) {
+	resource, err := url.Parse(c.resource)
+	if err != nil {
+		return authServerMetadata{}, nil, err
+	}
+	origin := resource.Scheme + "://" + resource.Host
+
+	var candidates []string
+	if match := resourceMetadataParameter.FindStringSubmatch(challenge); match != nil {
+		candidates = append(candidates, match[1])
+	}
+	if path := strings.TrimSuffix(resource.Path, "/"); path != "" {
+		candidates = append(candidates, origin+"/.well-known/oauth-protected-resource"+path)
+	}
+	candidates = append(candidates, origin+"/.well-known/oauth-protected-resource")
+
+	issuer, scopes := origin, c.config.Scopes
+	for _, candidate := range candidates {
+		var protected struct {
+			AuthorizationServers []string `json:"authorization_servers"`
+			ScopesSupported      []string `json:"scopes_supported"`
+		}
+		if c.getJSON(ctx, candidate, &protected) == nil && len(protected.AuthorizationServers) > 0 {
+			issuer = strings.TrimSuffix(protected.AuthorizationServers[0], "/")
+			if len(scopes) == 0 {
+				scopes = protected.ScopesSupported
+			}
+			break
+		}
+	}
+
+	issuerURL, err := url.Parse(issuer)
+	if err != nil {
+		return authServerMetadata{}, nil, err
+	}
+	issuerOrigin, issuerPath := issuerURL.Scheme+"://"+issuerURL.Host, strings.TrimSuffix(issuerURL.Path, "/")
+	for _, candidate := range []string{
+		issuerOrigin + "/.well-known/oauth-authorization-server" + issuerPath,
+		issuerOrigin + "/.well-known/openid-configuration" + issuerPath,
+		issuer + "/.well-known/openid-configuration",
+	} {
+		var metadata authServerMetadata
+		if c.getJSON(ctx, candidate, &metadata) == nil && metadata.AuthorizationEndpoint != "" && metadata.TokenEndpoint != "" {
+			if len(scopes) == 0 {
+				scopes = metadata.ScopesSupported
+			}
+			c.state.TokenEndpoint = metadata.TokenEndpoint
+			return metadata, scopes, nil
+		}
+	}
+
+	// without metadata, the default endpoints of the MCP specification
+	slog.Warn("no authorization server metadata, the default endpoints are used", "issuer", issuer)
+	metadata := authServerMetadata{
+		AuthorizationEndpoint: issuerOrigin + "/authorize",
+		TokenEndpoint:         issuerOrigin + "/token",
+		RegistrationEndpoint:  issuerOrigin + "/register",
+	}
+	c.state.TokenEndpoint = metadata.TokenEndpoint
+	return metadata, scopes, nil
+}
+
+// listen opens the local listener of the redirect URI: the port of the
+// config, or the port of the registered redirect URI when it is free
+func (c *OAuthClient) listen() (net.Listener, string, error) {
+	port := c.config.RedirectPort
+	if port == 0 && c.state.RedirectURI != "" {
+		if registered, err := url.Parse(c.state.RedirectURI); err == nil {
+			if listener, err := net.Listen("tcp", "127.0.0.1:"+registered.Port()); err == nil {
+				return listener, c.state.RedirectURI, nil
+			}
+		}
+	}
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return nil, "", err
+	}
+	return listener, fmt.Sprintf("http://127.0.0.1:%d/callback", listener.Addr().(*net.TCPAddr).Port), nil
+}
+
+// register sets the client of the host: the client of the config, the
+// client registered before with the same redirect URI, or a new client
+// registered with the registration endpoint (RFC 7591)
+func (c *OAuthClient) register(ctx context.Context, metadata authServerMetadata, redirectURI string) error {
+	if c.config.ClientID != "" {
+		c.state.ClientID, c.state.ClientSecret, c.state.RedirectURI = c.config.ClientID, c.config.ClientSecret, redirectURI
+		return nil
+	}
+	if c.state.ClientID != "" && c.state.RedirectURI == redirectURI {
+		return nil
+	}
+	if metadata.RegistrationEndpoint == "" {
+		return fmt.Errorf("the authorization server does not register the clients: set the clientId of the oauth config")
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"client_name":                "mcphost",
+		"redirect_uris":              []string{redirectURI},
+		"grant_types":                []string{"authorization_code", "refresh_token"},
+		"response_types":             []string{"code"},
+		"token_endpoint_auth_method": "none",
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.RegistrationEndpoint, strings.NewReader(string(body)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	var registered struct {
+		ClientID     string `json:"client_id"`
+		ClientSecret string `json:"client_secret"`
+	}
+	if err := c.doJSON(req, &registered); err != nil {
+		return fmt.Errorf("failed to register the host: %w", err)
+	}
+	if registered.ClientID == "" {
+		return fmt.Errorf("failed to register the host: no client id")
+	}
+	slog.Info("the host is registered by the authorization server", "server", c.resource, "client", registered.ClientID)
+	c.state.ClientID, c.state.ClientSecret, c.state.RedirectURI = registered.ClientID, registered.ClientSecret, redirectURI
+	return nil
+}
+
+// waitForCode waits for the redirection of the browser with the code
+func waitForCode(ctx context.Context, listener net.Listener, state string) (string, error) {
+	type callback struct {
+		code string
+		err  error
+	}
+	result := make(chan callback, 1)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		var answer callback
+		switch {
+		case r.URL.Path != "/callback":
+			http.NotFound(w, r)
+			return
+		case query.Get("error") != "":
+			answer.err = fmt.Errorf("authorization denied: %s %s", query.Get("error"), query.Get("error_description"))
+		case query.Get("state") != state:
+			answer.err = fmt.Errorf("invalid state of the authorization response")
+		case query.Get("code") == "":
+			answer.err = fmt.Errorf("no code in the authorization response")
+		default:
+			answer.code = query.Get("code")
+		}
+		if answer.err != nil {
+			http.Error(w, answer.err.Error(), http.StatusBadRequest)
+		} else {
+			fmt.Fprintln(w, "The host is authorized, you can close this page.")
+		}
+		select {
+		case result <- answer:
+		default:
+		}
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	select {
+	case answer := <-result:
+		return answer.code, answer.err
+	case <-ctx.Done():
+		return "", fmt.Errorf("no authorization before the timeout: %w", ctx.Err())
+	}
+}
+
+// getJSON gets a JSON document
+func (c *OAuthClient) getJSON(ctx context.Context, url string, value interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	return c.doJSON(req, value)
+}
+
+// doJSON sends the request and decodes its JSON response
+func (c *OAuthClient) doJSON(req *http.Request, value interface{}) error {
+	resp, err := c.base.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("HTTP %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return json.NewDecoder(resp.Body).Decode(value)
+}
+
+// save writes the token file, readable by the user only (c.mu is locked)
+func (c *OAuthClient) save() error {
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(c.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path)
+}
+
+// randomString returns n random bytes encoded in base64url
+func randomString(n int) string {
+	data := make([]byte, n)
+	rand.Read(data)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// AuthorizeServer asks the user to authorize the host for the remote server
+// of the config (e.g. before starting the host), the tokens are cached
+func AuthorizeServer(ctx context.Context, config MCPServerConfig) error {
+	client, err := config.oauthClient()
+	if err != nil {
+		return err
+	}
+	if client == nil {
+		return fmt.Errorf("the server has no oauth config")
+	}
+	return client.Authorize(ctx)
+}
+
+// oauthClient returns the OAuth client of a remote server (nil without oauth config)
+func (s MCPServerConfig) oauthClient() (*OAuthClient, error) {
+	if s.OAuth == nil || s.Transport != "http" {
+		return nil, nil
+	}
+	resource, err := expandEnv(s.URL)
+	if err != nil {
+		return nil, fmt.Errorf("url: %w", err)
+	}
+	return oauthClientFor(resource, *s.OAuth)
+}
@@ -0,0 +1,212 @@
+package mcphost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// DefaultOllamaCooldown is the time an Ollama endpoint is skipped after a failure
+const DefaultOllamaCooldown = 30 * time.Second
+
+// OllamaPool spreads the requests to Ollama on several endpoints.
+// It is the transport of the HTTP client of the Ollama API client (see Client):
+// each request goes to the first healthy endpoint, and is sent to the next one
+// when the endpoint can not be reached or is unavailable (502, 503, 504).
+// A failed endpoint is skipped during Cooldown (unless all the endpoints failed).
+// With RoundRobin, the chat completions are spread on the healthy endpoints.
+type OllamaPool struct {
+	RoundRobin bool
+	Cooldown   time.Duration
+
+	endpoints []*ollamaEndpoint
+	transport http.RoundTripper
+	next      atomic.Uint64
+}
+
+type ollamaEndpoint struct {
+	url *url.URL
+
+	mu        sync.Mutex
+	downUntil time.Time
+}
+
+// NewOllamaPool creates the pool of the endpoints (OLLAMA_HOST URLs)
+func NewOllamaPool(rawURLs []string, roundRobin bool) (*OllamaPool, error) {
+	pool := &OllamaPool{
+		RoundRobin: roundRobin,
+		Cooldown:   DefaultOllamaCooldown,
+		transport:  http.DefaultTransport,
+	}
+	for _, rawURL := range rawURLs {
+		endpoint, err := url.Parse(strings.TrimSuffix(strings.TrimSpace(rawURL), "/"))
+		if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+			return nil, fmt.Errorf("invalid Ollama URL %q", rawURL)
+		}
+		pool.endpoints = append(pool.endpoints, &ollamaEndpoint{url: endpoint})
+	}
+	if len(pool.endpoints) == 0 {
+		return nil, errors.New("no Ollama URL")
+	}
+	return pool, nil
+}
+
+// ParseOllamaHosts splits a comma separated list of Ollama URLs
+// (OLLAMA_HOST=http://gpu1:11434,http://gpu2:11434)
+func ParseOllamaHosts(value string) []string {
+	hosts := []string{}
+	for _, host := range strings.Split(value, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// Client returns an Ollama API client sending its requests to the pool
+func (p *OllamaPool) Client() *api.Client {
+	return api.NewClient(p.endpoints[0].url, &http.Client{Transport: p})
+}
+
+// RoundTrip sends the request to the endpoints until one of them answers
+func (p *OllamaPool) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoints := p.candidates(req)
+	var lastErr error
+	for i, endpoint := range endpoints {
+		attempt, err := endpoint.request(req, p.endpoints[0].url.Path)
+		if err != nil {
+			return nil, err
+		}
+		response, err := p.transport.RoundTrip(attempt)
+		if req.Context().Err() != nil {
+			return response, err
+		}
+		if err == nil && !unavailableStatus(response.StatusCode) {
+			endpoint.setDown(time.Time{})
+			return response, nil
+		}
+
+		endpoint.setDown(time.Now().Add(p.Cooldown))
+		if err == nil {
+			err = fmt.Errorf("status %s", response.Status)
+		}
+		if i == len(endpoints)-1 {
+			// the last endpoint answer (or error) is the result
+			return response, err
+		}
+		if response != nil {
+			response.Body.Close()
+		}
+		slog.Warn("ollama endpoint failed, trying the next one", "endpoint", endpoint.url.Redacted(), "error", err)
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// candidates returns the endpoints in the order of the attempts:
+// the healthy ones first (starting with the next one of the round-robin
+// for the completions), then the failed ones
+func (p *OllamaPool) candidates(req *http.Request) []*ollamaEndpoint {
+	start := 0
+	if p.RoundRobin && (strings.HasSuffix(req.URL.Path, "/api/chat") || strings.HasSuffix(req.URL.Path, "/api/generate")) {
+		start = int(p.next.Add(1)-1) % len(p.endpoints)
+	}
+	now := time.Now()
+	healthy, failed := []*ollamaEndpoint{}, []*ollamaEndpoint{}
+	for i := range p.endpoints {
+		endpoint := p.endpoints[(start+i)%len(p.endpoints)]
+		if endpoint.isDown(now) {
+			failed = append(failed, endpoint)
+		} else {
+			healthy = append(healthy, endpoint)
+		}
+	}
+	return append(healthy, failed...)
+}
+
+// CheckHealth checks all the endpoints (GET /api/version): the failed ones
+// are skipped during the cooldown. It returns the number of healthy endpoints.
+func (p *OllamaPool) CheckHealth(ctx context.Context) int {
+	var healthy atomic.Int64
+	var wg sync.WaitGroup
+	for _, endpoint := range p.endpoints {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := endpoint.check(ctx, p.transport)
+			if err != nil {
+				slog.Warn("ollama endpoint unavailable", "endpoint", endpoint.url.Redacted(), "error", err)
+				endpoint.setDown(time.Now().Add(p.Cooldown))
+				return
+			}
+			endpoint.setDown(time.Time{})
+			healthy.Add(1)
+		}()
+	}
+	wg.Wait()
+	return int(healthy.Load())
+}
+
+// request returns the request sent to the endpoint: the URL of the request
+// of the API client (built on the first endpoint, with basePath)
+// is moved to the endpoint
+func (e *ollamaEndpoint) request(req *http.Request, basePath string) (*http.Request, error) {
+	attempt := req.Clone(req.Context())
+	if req.Body != nil && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		attempt.Body = body
+	}
+	attempt.URL.Scheme = e.url.Scheme
+	attempt.URL.Host = e.url.Host
+	attempt.URL.User = e.url.User
+	attempt.URL.Path = e.url.Path + strings.TrimPrefix(req.URL.Path, basePath)
+	attempt.URL.RawPath = ""
+	attempt.Host = ""
+	return attempt, nil
+}
+
+func (e *ollamaEndpoint) check(ctx context.Context, transport http.RoundTripper) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.url.JoinPath("api", "version").String(), nil)
+	if err != nil {
+		return err
+	}
+	response, err := transport.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %s", response.Status)
+	}
+	return nil
+}
+
+func (e *ollamaEndpoint) isDown(now time.Time) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return now.Before(e.downUntil)
+}
+
+func (e *ollamaEndpoint) setDown(until time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.downUntil = until
+}
+
+// unavailableStatus tells if the status means that the endpoint can not
+// answer (another endpoint can)
+func unavailableStatus(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
@@ -0,0 +1,385 @@
+package mcphost
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// OpenAIBackend sends the chat requests to an OpenAI-compatible endpoint
+// (/v1/chat/completions of vLLM, the llama.cpp server, LM Studio...).
+// It is the transport of an Ollama API client (see Client): the Ollama requests
+// are converted to the OpenAI format and the responses back to the Ollama
+// format, so the sessions, the agent and the tool conversion are unchanged.
+type OpenAIBackend struct {
+	// BaseURL is the URL of the API, with the /v1 prefix (e.g. http://localhost:8000/v1)
+	BaseURL string
+	APIKey  string
+
+	transport http.RoundTripper
+}
+
+// NewOpenAIBackend creates the backend of an OpenAI-compatible API
+func NewOpenAIBackend(baseURL string, apiKey string) (*OpenAIBackend, error) {
+	parsed, err := url.Parse(baseURL)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid OpenAI base URL %q", baseURL)
+	}
+	return &OpenAIBackend{
+		BaseURL:   strings.TrimSuffix(baseURL, "/"),
+		APIKey:    apiKey,
+		transport: http.DefaultTransport,
+	}, nil
+}
+
+// Client returns an Ollama API client sending its requests to the backend
+func (b *OpenAIBackend) Client() *api.Client {
+	return api.NewClient(&url.URL{Scheme: "http", Host: "openai-backend"}, &http.Client{Transport: b})
+}
+
+// The OpenAI tool names only accept [a-zA-Z0-9_-]: the separator
+// of the namespaced names is replaced like in the gateway
+func openAIToolName(name string) string {
+	return strings.Replace(name, ToolNameSeparator, gatewayToolSeparator, 1)
+}
+
+// RoundTrip converts a request of the Ollama API client
+func (b *OpenAIBackend) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch req.URL.Path {
+	case "/api/chat":
+		var chat api.ChatRequest
+		if err := json.NewDecoder(req.Body).Decode(&chat); err != nil {
+			return mockResponse(req, http.StatusBadRequest, map[string]string{"error": err.Error()}), nil
+		}
+		return b.chat(req, &chat)
+	case "/api/tags":
+		return b.models(req)
+	case "/api/show":
+		// the tool support is not known: the models are supposed to support tools
+		return mockResponse(req, http.StatusOK, api.ShowResponse{Template: "{{ .Tools }}"}), nil
+	case "/api/version":
+		return mockResponse(req, http.StatusOK, map[string]string{"version": "openai"}), nil
+	default:
+		return mockResponse(req, http.StatusNotFound, map[string]string{
+			"error": "not supported by the OpenAI backend: " + req.URL.Path,
+		}), nil
+	}
+}
+
+// openAIMessage is a message of the OpenAI chat API
+type openAIMessage struct {
+	Role       string           `json:"role"`
+	Content    interface{}      `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+type openAIToolCall struct {
+	Index    int    `json:"index"`
+	ID       string `json:"id,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Function struct {
+		Name      string `json:"name,omitempty"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type openAIChoice struct {
+	Message      openAIMessage `json:"message"`
+	Delta        openAIMessage `json:"delta"`
+	FinishReason string        `json:"finish_reason"`
+}
+
+type openAIResponse struct {
+	Choices []openAIChoice `json:"choices"`
+	Usage   *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// chatRequest converts an Ollama chat request to the OpenAI format.
+// The ids of the tool calls are generated, and given to the tool
+// messages in the order of the calls.
+func (b *OpenAIBackend) chatRequest(chat *api.ChatRequest, stream bool) map[string]interface{} {
+	messages := []openAIMessage{}
+	pendingIDs := []string{}
+	for i, message := range chat.Messages {
+		converted := openAIMessage{Role: message.Role, Content: message.Content}
+		if len(message.Images) > 0 {
+			parts := []map[string]interface{}{{"type": "text", "text": message.Content}}
+			for _, image := range message.Images {
+				parts = append(parts, map[string]interface{}{
+					"type":      "image_url",
+					"image_url": map[string]string{"url": "data:image/png;base64," + base64.StdEncoding.EncodeToString(image)},
+				})
+			}
+			converted.Content = parts
+		}
+		if len(message.ToolCalls) > 0 {
+			pendingIDs = pendingIDs[:0]
+			for j, toolCall := range message.ToolCalls {
+				call := openAIToolCall{Index: j, ID: fmt.Sprintf("call_%d_%d", i, j), Type: "function"}
+				call.Function.Name = openAIToolName(toolCall.Function.Name)
+				arguments, _ := json.Marshal(toolCall.Function.Arguments)
+				call.Function.Arguments = string(arguments)
+				converted.ToolCalls = append(converted.ToolCalls, call)
+				pendingIDs = append(pendingIDs, call.ID)
+			}
+		}
+		if message.Role == "tool" && len(pendingIDs) > 0 {
+			converted.ToolCallID, pendingIDs = pendingIDs[0], pendingIDs[1:]
+		}
+		messages = append(messages, converted)
+	}
+
+	request := map[string]interface{}{
+		"model":    chat.Model,
+		"messages": messages,
+		"stream":   stream,
+	}
+	if stream {
+		request["stream_options"] = map[string]bool{"include_usage": true}
+	}
+	if len(chat.Tools) > 0 {
+		tools := make([]api.Tool, len(chat.Tools))
+		for i, tool := range chat.Tools {
+			tool.Function.Name = openAIToolName(tool.Function.Name)
+			tools[i] = tool
+		}
+		request["tools"] = tools
+	}
+
+	// the Ollama options with an OpenAI equivalent
+	for option, parameter := range map[string]string{
+		"temperature": "temperature",
+		"top_p":       "top_p",
+		"seed":        "seed",
+		"stop":        "stop",
+		"num_predict": "max_tokens",
+	} {
+		if value, ok := chat.Options[option]; ok {
+			request[parameter] = value
+		}
+	}
+
+	switch format := strings.TrimSpace(string(chat.Format)); {
+	case format == "":
+	case format == `"json"`:
+		request["response_format"] = map[string]string{"type": "json_object"}
+	default:
+		request["response_format"] = map[string]interface{}{
+			"type":        "json_schema",
+			"json_schema": map[string]interface{}{"name": "answer", "schema": chat.Format},
+		}
+	}
+	return request
+}
+
+// chat sends the chat request and converts the response
+// (the OpenAI stream of server-sent events becomes an Ollama NDJSON stream)
+func (b *OpenAIBackend) chat(req *http.Request, chat *api.ChatRequest) (*http.Response, error) {
+	stream := chat.Stream == nil || *chat.Stream
+	body, err := json.Marshal(b.chatRequest(chat, stream))
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequestWithContext(req.Context(), http.MethodPost, b.BaseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if b.APIKey != "" {
+		request.Header.Set("Authorization", "Bearer "+b.APIKey)
+	}
+
+	response, err := b.transport.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode >= http.StatusBadRequest {
+		defer response.Body.Close()
+		return mockResponse(req, response.StatusCode, map[string]string{"error": openAIError(response)}), nil
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		defer response.Body.Close()
+		if stream {
+			writer.CloseWithError(convertOpenAIStream(response.Body, writer, chat.Model))
+		} else {
+			writer.CloseWithError(convertOpenAIResponse(response.Body, writer, chat.Model))
+		}
+	}()
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Status:     "200 OK",
+		Header:     http.Header{"Content-Type": {"application/x-ndjson"}},
+		Body:       reader,
+		Request:    req,
+	}, nil
+}
+
+// openAIError returns the message of an error response
+func openAIError(response *http.Response) string {
+	data, _ := io.ReadAll(io.LimitReader(response.Body, 64*1024))
+	var decoded openAIResponse
+	if json.Unmarshal(data, &decoded) == nil && decoded.Error != nil {
+		return decoded.Error.Message
+	}
+	if message := strings.TrimSpace(string(data)); message != "" {
+		return message
+	}
+	return response.Status
+}
+
+func convertOpenAIResponse(body io.Reader, out io.Writer, model string) error {
+	var decoded openAIResponse
+	if err := json.NewDecoder(body).Decode(&decoded); err != nil {
+		return fmt.Errorf("invalid OpenAI response: %w", err)
+	}
+	if len(decoded.Choices) == 0 {
+		return fmt.Errorf("OpenAI response without choices")
+	}
+	choice := decoded.Choices[0]
+	content, _ := choice.Message.Content.(string)
+	done := api.ChatResponse{
+		Model:      model,
+		CreatedAt:  time.Now(),
+		Message:    api.Message{Role: "assistant", Content: content, ToolCalls: ollamaToolCalls(choice.Message.ToolCalls)},
+		Done:       true,
+		DoneReason: choice.FinishReason,
+	}
+	if decoded.Usage != nil {
+		done.PromptEvalCount, done.EvalCount = decoded.Usage.PromptTokens, decoded.Usage.CompletionTokens
+	}
+	return json.NewEncoder(out).Encode(done)
+}
+
+// convertOpenAIStream converts the deltas of the stream to Ollama chunks.
+// The tool calls are streamed in fragments: they are sent with the last chunk.
+func convertOpenAIStream(body io.Reader, out io.Writer, model string) error {
+	encoder := json.NewEncoder(out)
+	toolCalls := []openAIToolCall{}
+	done := api.ChatResponse{Model: model, Message: api.Message{Role: "assistant"}, Done: true}
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if data = strings.TrimSpace(data); !ok || data == "" {
+			continue
+		}
+		if data == "[DONE]" {
+			break
+		}
+		var chunk openAIResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("invalid OpenAI stream: %w", err)
+		}
+		if chunk.Error != nil {
+			return fmt.Errorf("%s", chunk.Error.Message)
+		}
+		if chunk.Usage != nil {
+			done.PromptEvalCount, done.EvalCount = chunk.Usage.PromptTokens, chunk.Usage.CompletionTokens
+		}
+		for _, choice := range chunk.Choices {
+			if content, _ := choice.Delta.Content.(string); content != "" {
+				err := encoder.Encode(api.ChatResponse{Model: model, Message: api.Message{Role: "assistant", Content: content}})
+				if err != nil {
+					return err
+				}
+			}
+			for _, fragment := range choice.Delta.ToolCalls {
+				for len(toolCalls) <= fragment.Index {
+					toolCalls = append(toolCalls, openAIToolCall{Index: len(toolCalls)})
+				}
+				call := &toolCalls[fragment.Index]
+				call.Function.Name += fragment.Function.Name
+				call.Function.Arguments += fragment.Function.Arguments
+			}
+			if choice.FinishReason != "" {
+				done.DoneReason = choice.FinishReason
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	done.CreatedAt = time.Now()
+	done.Message.ToolCalls = ollamaToolCalls(toolCalls)
+	return encoder.Encode(done)
+}
+
+// ollamaToolCalls converts the OpenAI tool calls (arguments as a JSON string)
+func ollamaToolCalls(calls []openAIToolCall) []api.ToolCall {
+	toolCalls := []api.ToolCall{}
+	for _, call := range calls {
+		arguments := map[string]interface{}{}
+		if strings.TrimSpace(call.Function.Arguments) != "" {
+			if err := json.Unmarshal([]byte(call.Function.Arguments), &arguments); err != nil {
+				// the arguments are checked with the schema of the tool
+				arguments = map[string]interface{}{"arguments": call.Function.Arguments}
+			}
+		}
+		toolCalls = append(toolCalls, api.ToolCall{Function: api.ToolCallFunction{
+			Index:     call.Index,
+			Name:      strings.Replace(call.Function.Name, gatewayToolSeparator, ToolNameSeparator, 1),
+			Arguments: callArguments(arguments),
+		}})
+	}
+	return toolCalls
+}
+
+// models lists the models of the endpoint (/v1/models) in the Ollama format
+func (b *OpenAIBackend) models(req *http.Request) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(req.Context(), http.MethodGet, b.BaseURL+"/models", nil)
+	if err != nil {
+		return nil, err
+	}
+	if b.APIKey != "" {
+		request.Header.Set("Authorization", "Bearer "+b.APIKey)
+	}
+	response, err := b.transport.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= http.StatusBadRequest {
+		return mockResponse(req, response.StatusCode, map[string]string{"error": openAIError(response)}), nil
+	}
+
+	var decoded struct {
+		Data []struct {
+			ID      string `json:"id"`
+			Created int64  `json:"created"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&decoded); err != nil {
+		return nil, fmt.Errorf("invalid OpenAI models: %w", err)
+	}
+	list := api.ListResponse{Models: []api.ListModelResponse{}}
+	for _, model := range decoded.Data {
+		// the models are listed with their tag, like the Ollama models
+		name := model.ID
+		if !strings.Contains(name[strings.LastIndex(name, "/")+1:], ":") {
+			name += ":latest"
+		}
+		list.Models = append(list.Models, api.ListModelResponse{
+			Name: name, Model: name, ModifiedAt: time.Unix(model.Created, 0),
+		})
+	}
+	return mockResponse(req, http.StatusOK, list), nil
+}
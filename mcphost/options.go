@@ -0,0 +1,92 @@
+package mcphost
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+)
+
+// DefaultOptions are the options of the models, the config overrides them
+var DefaultOptions = map[string]interface{}{
+	"temperature":   0.0,
+	"repeat_last_n": 2,
+}
+
+// keepAliveOption is not an option of the model but a field of the requests:
+// it sets how long the model stays loaded after a request ("10m", -1 forever)
+const keepAliveOption = "keep_alive"
+
+// MergeOptions returns the union of the options, the last ones win
+func MergeOptions(options ...map[string]interface{}) map[string]interface{} {
+	merged := map[string]interface{}{}
+	for _, values := range options {
+		maps.Copy(merged, values)
+	}
+	return merged
+}
+
+// ValidateOptions checks the names and the types of the options of a model
+// (the Ollama options, e.g. num_ctx, top_p, seed, stop, num_predict, and keep_alive)
+func ValidateOptions(options map[string]interface{}) error {
+	known := map[string]bool{}
+	for _, field := range reflect.VisibleFields(reflect.TypeOf(api.Options{})) {
+		if name := strings.Split(field.Tag.Get("json"), ",")[0]; name != "" {
+			known[name] = true
+		}
+	}
+
+	modelOptions, keepAlive := splitKeepAlive(options)
+	for name := range modelOptions {
+		if !known[name] {
+			return fmt.Errorf("unknown option %s", name)
+		}
+	}
+	defaults := api.DefaultOptions()
+	if err := defaults.FromMap(modelOptions); err != nil {
+		return err
+	}
+	if keepAlive != nil {
+		if _, err := parseKeepAlive(keepAlive); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// requestOptions returns the options of a request: the options of the model
+// and the keep_alive of the request (nil when it is not set or invalid)
+func requestOptions(options map[string]interface{}) (map[string]interface{}, *api.Duration) {
+	modelOptions, keepAlive := splitKeepAlive(options)
+	if keepAlive == nil {
+		return modelOptions, nil
+	}
+	duration, _ := parseKeepAlive(keepAlive)
+	return modelOptions, duration
+}
+
+func splitKeepAlive(options map[string]interface{}) (map[string]interface{}, interface{}) {
+	keepAlive, ok := options[keepAliveOption]
+	if !ok {
+		return options, nil
+	}
+	modelOptions := maps.Clone(options)
+	delete(modelOptions, keepAliveOption)
+	return modelOptions, keepAlive
+}
+
+// parseKeepAlive parses a duration string ("10m") or a number of seconds
+func parseKeepAlive(value interface{}) (*api.Duration, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var duration api.Duration
+	if err := duration.UnmarshalJSON(data); err != nil {
+		return nil, fmt.Errorf("invalid option %s: %w", keepAliveOption, err)
+	}
+	return &duration, nil
+}
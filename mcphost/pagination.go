@@ -0,0 +1,71 @@
+package mcphost
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// listAll calls list with the cursor of the next page until the last page
+// (without next cursor), and returns the items of all the pages
+func listAll[T any](ctx context.Context, list func(ctx context.Context, cursor mcp.Cursor) ([]T, mcp.Cursor, error)) ([]T, error) {
+	all := []T{}
+	var cursor mcp.Cursor
+	// a server returning a cursor again would be listed for ever
+	seen := map[mcp.Cursor]bool{}
+	for {
+		items, next, err := list(ctx, cursor)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, items...)
+		if next == "" {
+			return all, nil
+		}
+		if seen[next] {
+			return nil, fmt.Errorf("the server returned the cursor %s twice", next)
+		}
+		seen[next] = true
+		cursor = next
+	}
+}
+
+// listTools returns the tools of all the pages of tools/list
+func listTools(ctx context.Context, mcpClient MCPClient) ([]mcp.Tool, error) {
+	return listAll(ctx, func(ctx context.Context, cursor mcp.Cursor) ([]mcp.Tool, mcp.Cursor, error) {
+		request := mcp.ListToolsRequest{}
+		request.Params.Cursor = cursor
+		result, err := mcpClient.ListTools(ctx, request)
+		if err != nil {
+			return nil, "", err
+		}
+		return result.Tools, result.NextCursor, nil
+	})
+}
+
+// listPrompts returns the prompts of all the pages of prompts/list
+func listPrompts(ctx context.Context, mcpClient MCPClient) ([]mcp.Prompt, error) {
+	return listAll(ctx, func(ctx context.Context, cursor mcp.Cursor) ([]mcp.Prompt, mcp.Cursor, error) {
+		request := mcp.ListPromptsRequest{}
+		request.Params.Cursor = cursor
+		result, err := mcpClient.ListPrompts(ctx, request)
+		if err != nil {
+			return nil, "", err
+		}
+		return result.Prompts, result.NextCursor, nil
+	})
+}
+
+// listResources returns the resources of all the pages of resources/list
+func listResources(ctx context.Context, mcpClient MCPClient) ([]mcp.Resource, error) {
+	return listAll(ctx, func(ctx context.Context, cursor mcp.Cursor) ([]mcp.Resource, mcp.Cursor, error) {
+		request := mcp.ListResourcesRequest{}
+		request.Params.Cursor = cursor
+		result, err := mcpClient.ListResources(ctx, request)
+		if err != nil {
+			return nil, "", err
+		}
+		return result.Resources, result.NextCursor, nil
+	})
+}
@@ -0,0 +1,180 @@
+package mcphost
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Types of the personal data masked by the PII filter
+const (
+	PIIEmail = "email"
+	PIIPhone = "phone"
+	PIIToken = "token"
+)
+
+// maxPlaceholderLength is the length above which a [ in the stream
+// of an answer is not the start of a placeholder
+const maxPlaceholderLength = 32
+
+// defaultPIIPatterns are the patterns of the types of personal data
+var defaultPIIPatterns = map[string]string{
+	PIIEmail: `\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`,
+	// international numbers, US numbers and the numbers in groups of 2 digits
+	PIIPhone: `\+\d{1,3}[\s.-]?\(?\d{1,4}\)?(?:[\s.-]?\d{2,4}){2,5}\b|\(\d{3}\)\s?\d{3}[\s.-]\d{4}\b|\b\d{3}[.-]\d{3}[.-]\d{4}\b|\b0\d(?:[\s.]\d{2}){4}\b`,
+	// the API keys with a known prefix and the JWT
+	PIIToken: `\b(?:sk-[A-Za-z0-9_-]{20,}|gh[pousr]_[A-Za-z0-9]{20,}|github_pat_[A-Za-z0-9_]{20,}|xox[abprs]-[A-Za-z0-9-]{10,}|AKIA[0-9A-Z]{16}|AIza[0-9A-Za-z_-]{35}|eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,})`,
+}
+
+// piiTypeName matches the names of the types of the patterns
+var piiTypeName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*$`)
+
+// placeholderPattern matches the placeholders of the masked values
+var placeholderPattern = regexp.MustCompile(`\[[A-Z][A-Z0-9]*_[0-9]+\]`)
+
+// PIIConfig is the setting of the masking of the personal data
+// in the tool results
+type PIIConfig struct {
+	// Types are the masked types: email, phone, token (all by default)
+	Types []string `json:"types"`
+	// Patterns are more types: the regular expressions of their values
+	Patterns map[string]string `json:"patterns"`
+	// Restore replaces the placeholders in the answers with the masked
+	// values (the models and the history only get the placeholders)
+	Restore bool `json:"restore"`
+}
+
+// PIIFilter masks the personal data of the tool results with placeholders
+// (e.g. [EMAIL_1]) before they are sent to the models. The placeholders of
+// a session are stable: a value gets the same placeholder in all the results.
+// The table of the placeholders is not saved with the session.
+type PIIFilter struct {
+	Restore  bool
+	patterns []piiPattern
+
+	mu sync.Mutex
+	// placeholders are the placeholders of the values, values the values
+	// of the placeholders, counts the number of values of each type
+	placeholders map[string]string
+	values       map[string]string
+	counts       map[string]int
+}
+
+type piiPattern struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+// NewPIIFilter returns the filter of the config
+func NewPIIFilter(config PIIConfig) (*PIIFilter, error) {
+	types := config.Types
+	if len(types) == 0 {
+		types = []string{PIIToken, PIIEmail, PIIPhone}
+	}
+	filter := &PIIFilter{Restore: config.Restore}
+	add := func(name string, pattern string) error {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern of %s: %w", name, err)
+		}
+		filter.patterns = append(filter.patterns, piiPattern{name: strings.ToUpper(name), pattern: compiled})
+		return nil
+	}
+	for _, name := range types {
+		pattern, ok := defaultPIIPatterns[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown type %s (email, phone or token)", name)
+		}
+		if err := add(name, pattern); err != nil {
+			return nil, err
+		}
+	}
+	// the types are sorted: the placeholders do not depend on the map order
+	for _, name := range slices.Sorted(maps.Keys(config.Patterns)) {
+		if !piiTypeName.MatchString(name) {
+			return nil, fmt.Errorf("invalid type name %s (letters and digits)", name)
+		}
+		if err := add(name, config.Patterns[name]); err != nil {
+			return nil, err
+		}
+	}
+	return filter.session(), nil
+}
+
+// session returns a filter with the patterns of f and an empty table
+func (f *PIIFilter) session() *PIIFilter {
+	if f == nil {
+		return nil
+	}
+	return &PIIFilter{
+		Restore:      f.Restore,
+		patterns:     f.patterns,
+		placeholders: map[string]string{},
+		values:       map[string]string{},
+		counts:       map[string]int{},
+	}
+}
+
+// Mask replaces the personal data of the text with placeholders
+func (f *PIIFilter) Mask(text string) string {
+	if f == nil {
+		return text
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, pii := range f.patterns {
+		text = pii.pattern.ReplaceAllStringFunc(text, func(value string) string {
+			if placeholder, ok := f.placeholders[value]; ok {
+				return placeholder
+			}
+			f.counts[pii.name]++
+			placeholder := fmt.Sprintf("[%s_%d]", pii.name, f.counts[pii.name])
+			f.placeholders[value], f.values[placeholder] = placeholder, value
+			return placeholder
+		})
+	}
+	return text
+}
+
+// RestoreText replaces the placeholders of the text with their values
+func (f *PIIFilter) RestoreText(text string) string {
+	if f == nil {
+		return text
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		if value, ok := f.values[placeholder]; ok {
+			return value
+		}
+		return placeholder
+	})
+}
+
+// restoreStream wraps the token handler of an answer: the placeholders split
+// across the tokens are restored. flush sends the end of the answer.
+func (f *PIIFilter) restoreStream(onToken func(string)) (restored func(string), flush func()) {
+	pending := ""
+	restored = func(token string) {
+		pending += token
+		cut := len(pending)
+		// the text from a [ without ] may be the start of a placeholder
+		if i := strings.LastIndex(pending, "["); i >= 0 && !strings.Contains(pending[i:], "]") && len(pending)-i < maxPlaceholderLength {
+			cut = i
+		}
+		if cut > 0 {
+			onToken(f.RestoreText(pending[:cut]))
+			pending = pending[cut:]
+		}
+	}
+	flush = func() {
+		if pending != "" {
+			onToken(f.RestoreText(pending))
+			pending = ""
+		}
+	}
+	return restored, flush
+}
@@ -0,0 +1,343 @@
+package mcphost
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// Pipeline is a declarative workflow: its steps are executed in order,
+// without a model choosing the tools. The texts of the steps are Go
+// templates with the variables ({{.vars.url}}) and the outputs of the
+// previous steps ({{.steps.page}}), e.g. in YAML:
+//
+//	name: digest
+//	vars:
+//	  url: https://example.com
+//	steps:
+//	  - name: page
+//	    tool: mcp-curl-with-docker.use_curl
+//	    arguments:
+//	      url: "{{.vars.url}}"
+//	  - name: summary
+//	    prompt: "Summarize this page: {{.steps.page}}"
+//	  - name: save
+//	    write: digest.md
+//	    content: "{{.steps.summary}}"
+type Pipeline struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Vars are the variables and their default values
+	// (a variable without value must be given to RunPipeline)
+	Vars  map[string]interface{} `json:"vars"`
+	Steps []PipelineStep         `json:"steps"`
+	// Output is the template of the result of the pipeline
+	// (the output of the last step by default)
+	Output string `json:"output"`
+}
+
+// PipelineStep is a step of a pipeline: a tool call, a completion,
+// a question to a chat session or the writing of a file
+type PipelineStep struct {
+	// Name identifies the output of the step in the templates (step<n> by default)
+	Name string `json:"name"`
+	// Tool is the namespaced tool called with the Arguments
+	// (the templates of their strings are executed)
+	Tool      string                 `json:"tool"`
+	Arguments map[string]interface{} `json:"arguments"`
+	// Prompt is sent to the Model (the chat model by default)
+	// with the System instructions, without tools
+	Prompt string `json:"prompt"`
+	System string `json:"system"`
+	Model  string `json:"model"`
+	// Ask is asked to a new chat session: the models can call the tools
+	Ask string `json:"ask"`
+	// Write is the path of the file where the Content is written
+	Write   string `json:"write"`
+	Content string `json:"content"`
+	// JSON parses the output: the next steps can use its fields
+	// (e.g. {{.steps.issue.title}})
+	JSON bool `json:"json"`
+}
+
+// pipelineStepName matches the names usable in the templates
+var pipelineStepName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// LoadPipeline reads a pipeline file (YAML or JSON)
+func LoadPipeline(path string) (Pipeline, error) {
+	var pipeline Pipeline
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return pipeline, fmt.Errorf("failed to read the pipeline: %w", err)
+	}
+	document, err := parseYAML(data)
+	if err != nil {
+		return pipeline, fmt.Errorf("invalid pipeline %s: %w", path, err)
+	}
+	data, err = json.Marshal(document)
+	if err != nil {
+		return pipeline, err
+	}
+	// the unknown fields are errors: a misspelled field would silently change a step
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&pipeline); err != nil {
+		return pipeline, fmt.Errorf("invalid pipeline %s: %w", path, err)
+	}
+	if pipeline.Name == "" {
+		pipeline.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return pipeline, pipeline.validate()
+}
+
+// validate checks the steps and sets their default names
+func (p *Pipeline) validate() error {
+	if len(p.Steps) == 0 {
+		return fmt.Errorf("pipeline %s: no steps", p.Name)
+	}
+	names := map[string]bool{}
+	for i := range p.Steps {
+		step := &p.Steps[i]
+		if step.Name == "" {
+			step.Name = fmt.Sprintf("step%d", i+1)
+		}
+		if !pipelineStepName.MatchString(step.Name) {
+			return fmt.Errorf("pipeline %s: invalid step name %q (letters, digits and _)", p.Name, step.Name)
+		}
+		if names[step.Name] {
+			return fmt.Errorf("pipeline %s: duplicate step %s", p.Name, step.Name)
+		}
+		names[step.Name] = true
+
+		kinds := 0
+		for _, set := range []bool{step.Tool != "", step.Prompt != "", step.Ask != "", step.Write != ""} {
+			if set {
+				kinds++
+			}
+		}
+		if kinds != 1 {
+			return fmt.Errorf("pipeline %s: step %s: one of tool, prompt, ask or write is expected", p.Name, step.Name)
+		}
+		if step.Arguments != nil && step.Tool == "" {
+			return fmt.Errorf("pipeline %s: step %s: arguments without tool", p.Name, step.Name)
+		}
+	}
+	return nil
+}
+
+// RunPipeline executes the steps of the pipeline with the variables (they
+// override the default values) and returns its output. A failed step
+// (e.g. a tool returning an error) stops the pipeline.
+func (h *Host) RunPipeline(ctx context.Context, pipeline Pipeline, vars map[string]string) (string, error) {
+	values := map[string]interface{}{}
+	for name, value := range pipeline.Vars {
+		values[name] = value
+	}
+	for name, value := range vars {
+		values[name] = value
+	}
+	for name, value := range values {
+		if value == nil {
+			return "", fmt.Errorf("pipeline %s: missing variable %s", pipeline.Name, name)
+		}
+	}
+	outputs := map[string]interface{}{}
+	data := map[string]interface{}{"vars": values, "steps": outputs}
+
+	ctx, span := startSpan(ctx, "pipeline", spanKindInternal, "pipeline", pipeline.Name)
+	output := ""
+	for _, step := range pipeline.Steps {
+		start := time.Now()
+		slog.Info("pipeline step", "pipeline", pipeline.Name, "step", step.Name)
+		result, err := h.runPipelineStep(ctx, step, data)
+		if err != nil {
+			err = fmt.Errorf("pipeline %s: step %s: %w", pipeline.Name, step.Name, err)
+			span.End(err)
+			return "", err
+		}
+		slog.Info("pipeline step done", "pipeline", pipeline.Name, "step", step.Name,
+			"duration", time.Since(start).Round(time.Millisecond), "bytes", len(result))
+		outputs[step.Name] = result
+		if step.JSON {
+			var parsed interface{}
+			if err := json.Unmarshal([]byte(result), &parsed); err != nil {
+				err = fmt.Errorf("pipeline %s: step %s: the output is not JSON: %w", pipeline.Name, step.Name, err)
+				span.End(err)
+				return "", err
+			}
+			outputs[step.Name] = parsed
+		}
+		output = result
+	}
+	if pipeline.Output != "" {
+		var err error
+		if output, err = renderTemplate("output", pipeline.Output, data); err != nil {
+			err = fmt.Errorf("pipeline %s: %w", pipeline.Name, err)
+			span.End(err)
+			return "", err
+		}
+	}
+	span.End(nil)
+	return output, nil
+}
+
+// runPipelineStep executes a step and returns its output
+func (h *Host) runPipelineStep(ctx context.Context, step PipelineStep, data map[string]interface{}) (string, error) {
+	switch {
+	case step.Tool != "":
+		arguments, err := renderArguments(step.Arguments, data)
+		if err != nil {
+			return "", err
+		}
+		return h.pipelineToolCall(ctx, step.Tool, arguments)
+
+	case step.Prompt != "":
+		prompt, err := renderTemplate("prompt", step.Prompt, data)
+		if err != nil {
+			return "", err
+		}
+		system, err := renderTemplate("system", step.System, data)
+		if err != nil {
+			return "", err
+		}
+		model := step.Model
+		if model == "" {
+			model = h.ChatModel
+		}
+		messages := []api.Message{{Role: "user", Content: prompt}}
+		if system != "" {
+			messages = append([]api.Message{{Role: "system", Content: system}}, messages...)
+		}
+		answer, err := complete(ctx, h.Ollama, h.Metrics, model, messages, h.ModelOptionsOf(model), h.ChatTimeout, h.OllamaRetry, "pipeline")
+		return strings.TrimSpace(answer), err
+
+	case step.Ask != "":
+		prompt, err := renderTemplate("ask", step.Ask, data)
+		if err != nil {
+			return "", err
+		}
+		session := h.NewSession()
+		if step.Model != "" {
+			session.ChatModel = step.Model
+		}
+		answer, err := session.Ask(ctx, prompt, func(string) {})
+		return strings.TrimSpace(answer), err
+
+	default:
+		path, err := renderTemplate("write", step.Write, data)
+		if err != nil {
+			return "", err
+		}
+		content, err := renderTemplate("content", step.Content, data)
+		if err != nil {
+			return "", err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			return "", err
+		}
+		return path, nil
+	}
+}
+
+// pipelineToolCall calls a tool of a step: the arguments are converted to the
+// types of its schema and checked, the tools denied by the config can not be called
+func (h *Host) pipelineToolCall(ctx context.Context, name string, arguments map[string]interface{}) (string, error) {
+	server, toolName, ok := h.Registry.server(name)
+	if !ok {
+		return "", fmt.Errorf("unknown tool %s", name)
+	}
+	if server.Config.ApprovalPolicy(toolName) == ApprovalDeny {
+		return "", fmt.Errorf("the tool %s is denied by the config", name)
+	}
+	arguments = h.Registry.CoerceArguments(name, arguments)
+	if err := h.Registry.ValidateArguments(name, arguments); err != nil {
+		return "", err
+	}
+	result, err := h.Registry.CallTool(ctx, name, arguments)
+	if err != nil {
+		return "", err
+	}
+	content := NormalizeToolResult(result)
+	if result.IsError {
+		return "", fmt.Errorf("the tool %s returned an error: %s", name, content.Text)
+	}
+	return content.Text, nil
+}
+
+// renderArguments executes the templates of the strings of the arguments
+func renderArguments(arguments map[string]interface{}, data map[string]interface{}) (map[string]interface{}, error) {
+	rendered, err := renderValue("arguments", arguments, data)
+	if err != nil {
+		return nil, err
+	}
+	if rendered == nil {
+		return map[string]interface{}{}, nil
+	}
+	return rendered.(map[string]interface{}), nil
+}
+
+func renderValue(name string, value interface{}, data map[string]interface{}) (interface{}, error) {
+	switch value := value.(type) {
+	case string:
+		return renderTemplate(name, value, data)
+	case map[string]interface{}:
+		rendered := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			var err error
+			if rendered[key], err = renderValue(name+"."+key, item, data); err != nil {
+				return nil, err
+			}
+		}
+		return rendered, nil
+	case []interface{}:
+		rendered := make([]interface{}, len(value))
+		for i, item := range value {
+			var err error
+			if rendered[i], err = renderValue(fmt.Sprintf("%s.%d", name, i), item, data); err != nil {
+				return nil, err
+			}
+		}
+		return rendered, nil
+	}
+	return value, nil
+}
+
+// pipelineFuncs are the functions of the templates:
+// env returns an environment variable, json the JSON of a value
+var pipelineFuncs = template.FuncMap{
+	"env": os.Getenv,
+	"json": func(value interface{}) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+}
+
+// renderTemplate executes a template of a step (a missing variable
+// or step output is an error)
+func renderTemplate(name string, text string, data map[string]interface{}) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	tmpl, err := template.New(name).Funcs(pipelineFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid template of %s: %w", name, err)
+	}
+	var rendered strings.Builder
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return "", fmt.Errorf("failed to render %s: %w", name, err)
+	}
+	return rendered.String(), nil
+}
@@ -0,0 +1,306 @@
+package mcphost
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+)
+
+// PlanMode tells if the model plans its tool calls before executing them
+type PlanMode string
+
+const (
+	// PlanOff runs the usual tool loop: the model decides the next tool
+	// calls after each result (default)
+	PlanOff PlanMode = "off"
+	// PlanExecute asks the model for a numbered plan of tool calls first,
+	// then executes the steps one by one, each step getting the results
+	// of the previous ones (more reliable with the small models)
+	PlanExecute PlanMode = "execute"
+	// PlanApprove is PlanExecute with an approval of the whole plan by the
+	// user, instead of the approvals of its tool calls
+	PlanApprove PlanMode = "approve"
+)
+
+// planApprovalName is the name of the plans for the "always" answers of the approver
+const planApprovalName = "plan"
+
+// ParsePlanMode checks a plan mode, "" is the off mode
+func ParsePlanMode(value string) (PlanMode, error) {
+	switch mode := PlanMode(value); mode {
+	case "":
+		return PlanOff, nil
+	case PlanOff, PlanExecute, PlanApprove:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown plan mode %s (off, execute or approve)", value)
+	}
+}
+
+// PlanStep is a tool invocation of a plan
+type PlanStep struct {
+	Tool      string                 `json:"tool"`
+	Arguments map[string]interface{} `json:"arguments"`
+	// Purpose tells what the step is for
+	Purpose string `json:"purpose"`
+}
+
+// FormatPlan returns the numbered list of the steps
+func FormatPlan(steps []PlanStep) string {
+	var plan strings.Builder
+	for i, step := range steps {
+		arguments, _ := json.Marshal(step.Arguments)
+		fmt.Fprintf(&plan, "%d. %s %s", i+1, step.Tool, arguments)
+		if step.Purpose != "" {
+			fmt.Fprintf(&plan, ": %s", step.Purpose)
+		}
+		plan.WriteString("\n")
+	}
+	return plan.String()
+}
+
+// runPlan runs the turn in the plan mode: the model writes the plan, then
+// the steps are executed in order. An invalid plan falls back to the tool loop.
+func (a *Agent) runPlan(ctx context.Context, messages []api.Message) ([]api.Message, []ToolResult, error) {
+	results := []ToolResult{}
+	tools := a.availableTools()
+
+	steps, err := a.plan(ctx, messages, tools)
+	if err != nil {
+		return messages, results, err
+	}
+	if steps == nil {
+		slog.Warn("invalid plan, the tools are called without plan", "model", a.Model)
+		return a.runLoop(ctx, messages)
+	}
+	if len(steps) == 0 {
+		// no tool is needed: the model answers
+		answer, err := a.chat(ctx, messages, nil)
+		if err != nil {
+			return messages, results, err
+		}
+		return append(messages, answer), results, nil
+	}
+
+	var budgetErr error
+	maxSteps := a.MaxIterations
+	if a.MaxToolCalls > 0 && a.MaxToolCalls < maxSteps {
+		maxSteps = a.MaxToolCalls
+	}
+	if len(steps) > maxSteps {
+		slog.Warn("the plan is too long, its last steps are dropped", "steps", len(steps), "max", maxSteps)
+		steps = steps[:maxSteps]
+		budgetErr = ErrMaxIterations
+		if maxSteps == a.MaxToolCalls {
+			budgetErr = ErrMaxToolCalls
+		}
+	}
+
+	plan := FormatPlan(steps)
+	slog.Info("plan", "model", a.Model, "steps", len(steps))
+	a.emit(Event{Type: EventPlan, Content: plan})
+	planApproved := false
+	if a.Plan == PlanApprove && a.Approver != nil {
+		if !a.Approver.ApprovePlan(plan) {
+			slog.Warn("plan rejected by the user", "steps", len(steps))
+			messages = append(messages, api.Message{Role: "system", Content: "The user rejected this plan of tool calls:\n" + plan +
+				"No tool was called. Answer the user without the tools, and tell them that the plan was rejected."})
+			answer, err := a.chat(ctx, messages, nil)
+			if err != nil {
+				return messages, results, err
+			}
+			return append(messages, answer), results, nil
+		}
+		planApproved = true
+	}
+
+	toolOutputBytes := 0
+	for i, step := range steps {
+		toolCall := api.ToolCall{}
+		toolCall.Function.Name = step.Tool
+		toolCall.Function.Arguments = callArguments(step.Arguments)
+		if i > 0 {
+			// the arguments are completed with the results of the previous steps
+			if toolCall, err = a.stepToolCall(ctx, messages, i, steps, tools); err != nil {
+				return messages, results, err
+			}
+		}
+		toolCall.Function.Arguments = callArguments(a.Registry.CoerceArguments(toolCall.Function.Name, toolArguments(toolCall)))
+
+		slog.Info("tool call", "tool", toolCall.Function.Name, "arguments", toolArguments(toolCall), "step", i+1)
+		a.emit(Event{Type: EventToolCall, Tool: toolCall.Function.Name, Arguments: toolArguments(toolCall)})
+		var result ToolResult
+		approved := true
+		if err := a.Registry.ValidateArguments(toolCall.Function.Name, toolArguments(toolCall)); err != nil {
+			result = a.invalidArguments(toolCall, err)
+		} else if approved = a.approveStep(toolCall, planApproved); approved {
+			result = a.callTool(ctx, toolCall)
+		}
+		if ctx.Err() != nil {
+			return messages, results, fmt.Errorf("failed to call the tools: %w", ctx.Err())
+		}
+
+		message := api.Message{Role: "tool", ToolName: toolCall.Function.Name, Content: result.Content, Images: result.Images}
+		if !approved {
+			message.Content = fmt.Sprintf("The user denied the execution of the tool %s.", toolCall.Function.Name)
+		} else {
+			results = append(results, result)
+			toolOutputBytes += len(result.Content)
+		}
+		messages = append(messages, a.stepMessages(toolCall, message)...)
+
+		if !approved || result.IsError {
+			// the next steps may depend on this one: the plan stops
+			slog.Warn("plan step failed, the next steps are not executed", "step", i+1, "tool", toolCall.Function.Name)
+			if i < len(steps)-1 {
+				messages = append(messages, api.Message{Role: "system", Content: fmt.Sprintf(
+					"The step %d of the plan failed: the next steps were not executed.", i+1)})
+			}
+			break
+		}
+		if a.MaxToolOutputBytes > 0 && toolOutputBytes > a.MaxToolOutputBytes {
+			budgetErr = ErrMaxToolOutput
+			break
+		}
+	}
+	if budgetErr != nil {
+		return a.budgetExceeded(messages, budgetErr), results, budgetErr
+	}
+
+	// the model answers with the results of the plan
+	answer, err := a.chat(ctx, messages, nil)
+	if err != nil {
+		return messages, results, err
+	}
+	return append(messages, answer), results, nil
+}
+
+// plan asks the model for the plan of the turn. It returns nil when the
+// answer is not a valid plan (unknown tool, no JSON), and an empty plan when
+// no tool is needed.
+func (a *Agent) plan(ctx context.Context, messages []api.Message, tools []api.Tool) ([]PlanStep, error) {
+	answer, err := a.chat(ctx, withPlanPrompt(messages, tools), nil)
+	if err != nil {
+		return nil, err
+	}
+	start := strings.Index(answer.Content, "[")
+	end := strings.LastIndex(answer.Content, "]")
+	if start < 0 || end < start {
+		return nil, nil
+	}
+	var steps []PlanStep
+	if err := json.Unmarshal([]byte(answer.Content[start:end+1]), &steps); err != nil {
+		return nil, nil
+	}
+	known := map[string]bool{}
+	for _, tool := range tools {
+		known[tool.Function.Name] = true
+	}
+	for _, step := range steps {
+		if !known[step.Tool] {
+			slog.Warn("unknown tool in the plan", "tool", step.Tool, "model", a.Model)
+			return nil, nil
+		}
+	}
+	return steps, nil
+}
+
+// stepToolCall asks the model for the tool call of a step with the results
+// of the previous steps: the planned arguments are used when the model
+// does not call the tool of the step
+func (a *Agent) stepToolCall(ctx context.Context, messages []api.Message, step int, steps []PlanStep,
+	tools []api.Tool) (api.ToolCall, error) {
+	planned := api.ToolCall{}
+	planned.Function.Name = steps[step].Tool
+	planned.Function.Arguments = callArguments(steps[step].Arguments)
+
+	var stepTools []api.Tool
+	for _, tool := range tools {
+		if tool.Function.Name == planned.Function.Name {
+			stepTools = append(stepTools, tool)
+		}
+	}
+	arguments, _ := json.Marshal(planned.Function.Arguments)
+	messages = append(messages, api.Message{Role: "system", Content: fmt.Sprintf(
+		"Plan:\n%sExecute the step %d: call the tool %s. The planned arguments are %s: "+
+			"replace the values that depend on the results of the previous steps.",
+		FormatPlan(steps), step+1, planned.Function.Name, arguments)})
+	if a.ToolCallMode == ToolCallModePrompt {
+		messages = withToolsPrompt(messages, stepTools)
+		stepTools = nil
+	}
+	answer, err := a.chat(ctx, messages, stepTools)
+	if toolsNotSupported(err) {
+		return planned, nil
+	}
+	if err != nil {
+		return planned, err
+	}
+	if len(answer.ToolCalls) == 0 && a.ToolCallMode != ToolCallModeNative && a.ToolCallMode != "" {
+		answer.ToolCalls = parseToolCalls(answer.Content, tools)
+	}
+	for _, toolCall := range answer.ToolCalls {
+		if toolCall.Function.Name == planned.Function.Name {
+			return toolCall, nil
+		}
+	}
+	slog.Debug("the planned arguments are used", "step", step+1, "tool", planned.Function.Name)
+	return planned, nil
+}
+
+// approveStep tells if the tool call of a step can be executed: the calls of
+// an approved plan are only denied by the config
+func (a *Agent) approveStep(toolCall api.ToolCall, planApproved bool) bool {
+	if !planApproved {
+		return a.approve(toolCall.Function.Name, toolArguments(toolCall))
+	}
+	server, toolName, ok := a.Registry.server(toolCall.Function.Name)
+	if ok && server.Config.ApprovalPolicy(toolName) == ApprovalDeny {
+		slog.Warn("tool denied by the config", "tool", toolCall.Function.Name)
+		a.Registry.audit.recordCall(withAuditDecision(context.Background(), AuditDenied), server.Name, toolName,
+			toolArguments(toolCall), nil, nil, 0, false)
+		return false
+	}
+	return true
+}
+
+// stepMessages returns the messages of an executed step: the tool call
+// and its result (a user message in the prompt mode)
+func (a *Agent) stepMessages(toolCall api.ToolCall, result api.Message) []api.Message {
+	call := api.Message{Role: "assistant", ToolCalls: []api.ToolCall{toolCall}}
+	if a.ToolCallMode == ToolCallModePrompt {
+		arguments, _ := json.Marshal(toolArguments(toolCall))
+		call = api.Message{Role: "assistant", Content: fmt.Sprintf(`{"name": %q, "arguments": %s}`, toolCall.Function.Name, arguments)}
+		result.Role, result.ToolName = "user", ""
+		result.Content = fmt.Sprintf("Result of the tool %s:\n%s", toolCall.Function.Name, result.Content)
+	}
+	return []api.Message{call, result}
+}
+
+// withPlanPrompt returns the messages with the tools catalog and the
+// instructions of the plan at the end of the system message
+func withPlanPrompt(messages []api.Message, tools []api.Tool) []api.Message {
+	var catalog strings.Builder
+	catalog.WriteString("\nYou can use the following tools:\n")
+	for _, tool := range tools {
+		parameters, _ := json.Marshal(tool.Function.Parameters)
+		fmt.Fprintf(&catalog, "- %s: %s\n  parameters: %s\n", tool.Function.Name, tool.Function.Description, parameters)
+	}
+	catalog.WriteString(`Before calling any tool, write the plan of the tool calls needed to answer the last request of the user.
+Answer only with a JSON array of the steps, in the order of their execution, without any other text:
+[{"tool": "<tool name>", "arguments": {"<argument name>": <value>}, "purpose": "<what the step is for>"}]
+When a value depends on the result of a previous step, write your best guess: it will be updated with the result.
+If no tool is needed, answer with [].
+`)
+
+	if len(messages) > 0 && messages[0].Role == "system" {
+		system := messages[0]
+		system.Content += catalog.String()
+		return append([]api.Message{system}, messages[1:]...)
+	}
+	return append([]api.Message{{Role: "system", Content: catalog.String()}}, messages...)
+}
@@ -0,0 +1,209 @@
+package mcphost
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Actions of the policy rules
+const (
+	PolicyDeny  = "deny"
+	PolicyAllow = "allow"
+)
+
+// ErrDeniedByPolicy is the error of the tool calls denied by the policy
+var ErrDeniedByPolicy = errors.New("denied by the tool policy")
+
+// PolicyRule is a rule of the tool policy, evaluated before each tool call:
+// the first rule matching the tool and the arguments decides (the calls
+// matching no rule are allowed). A rule without condition (match, allowedHosts
+// or denyShellMetacharacters) matches all the calls of its tools, e.g.
+//
+//	{"tools": ["fetch.*"], "allowedHosts": ["*.wikipedia.org"], "reason": "only Wikipedia"}
+//	{"tools": ["shell.*"], "denyShellMetacharacters": true}
+type PolicyRule struct {
+	// Tools are the patterns of the namespaced tools (all the tools by default)
+	Tools []string `json:"tools"`
+	// Action is PolicyDeny (default) or PolicyAllow
+	Action string `json:"action"`
+	// Arguments are the patterns of the checked arguments, with their path
+	// for the nested values (e.g. "url", "options.*"), all the arguments by default
+	Arguments []string `json:"arguments"`
+	// Match is a regular expression: the rule matches an argument matching it
+	Match string `json:"match"`
+	// AllowedHosts are the patterns of the hosts of the URLs: the rule
+	// matches an argument with a URL outside of the hosts (deny rules only:
+	// an allow rule would allow the URLs outside of the hosts)
+	AllowedHosts []string `json:"allowedHosts"`
+	// DenyShellMetacharacters: the rule matches an argument
+	// with a shell metacharacter (; & | ` $ < > or a new line)
+	DenyShellMetacharacters bool `json:"denyShellMetacharacters"`
+	// Reason is told to the model (and logged) when the call is denied
+	Reason string `json:"reason"`
+}
+
+// ToolPolicy decides if the tool calls are allowed (a nil policy allows all the calls)
+type ToolPolicy struct {
+	rules []policyRule
+}
+
+type policyRule struct {
+	PolicyRule
+	match *regexp.Regexp
+}
+
+var (
+	// urlPattern matches the URLs in the arguments
+	urlPattern = regexp.MustCompile(`(?i)\b[a-z][a-z0-9+.-]*://[^\s"'<>]+`)
+	// shellMetacharacters are the characters of the shell commands chaining,
+	// substitutions and redirections
+	shellMetacharacters = regexp.MustCompile("[;&|`$<>\n]")
+)
+
+// NewToolPolicy checks the rules and returns their policy (nil without rules)
+func NewToolPolicy(rules []PolicyRule) (*ToolPolicy, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	policy := &ToolPolicy{}
+	for i, rule := range rules {
+		compiled := policyRule{PolicyRule: rule}
+		switch rule.Action {
+		case "":
+			compiled.Action = PolicyDeny
+		case PolicyDeny, PolicyAllow:
+		default:
+			return nil, fmt.Errorf("rule %d: unknown action %s (deny or allow)", i, rule.Action)
+		}
+		if compiled.Action == PolicyAllow && len(rule.AllowedHosts) > 0 {
+			return nil, fmt.Errorf("rule %d: allowedHosts is only valid in the deny rules", i)
+		}
+		for _, pattern := range append(append(append([]string{}, rule.Tools...), rule.Arguments...), rule.AllowedHosts...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("rule %d: invalid pattern %s", i, pattern)
+			}
+		}
+		if rule.Match != "" {
+			match, err := regexp.Compile(rule.Match)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: invalid match: %w", i, err)
+			}
+			compiled.match = match
+		}
+		policy.rules = append(policy.rules, compiled)
+	}
+	return policy, nil
+}
+
+// Check returns an error wrapping ErrDeniedByPolicy when the call of the
+// namespaced tool is denied. The decisions of the rules are logged.
+func (p *ToolPolicy) Check(name string, arguments map[string]interface{}) error {
+	if p == nil {
+		return nil
+	}
+	values := map[string]string{}
+	policyValues("", arguments, values)
+	for i, rule := range p.rules {
+		argument, detail, ok := rule.matches(name, values)
+		if !ok {
+			continue
+		}
+		if rule.Action == PolicyAllow {
+			slog.Info("tool call allowed by the policy", "tool", name, "rule", i)
+			return nil
+		}
+		reason := rule.Reason
+		if reason == "" {
+			reason = detail
+		}
+		slog.Warn("tool call denied by the policy", "tool", name, "rule", i, "argument", argument, "reason", reason)
+		if argument != "" {
+			return fmt.Errorf("%w (argument %s): %s", ErrDeniedByPolicy, argument, reason)
+		}
+		return fmt.Errorf("%w: %s", ErrDeniedByPolicy, reason)
+	}
+	slog.Debug("tool call allowed (no policy rule)", "tool", name)
+	return nil
+}
+
+// matches tells if the rule matches the call, with the matching argument
+// and the condition it breaks
+func (r policyRule) matches(name string, values map[string]string) (string, string, bool) {
+	if len(r.Tools) > 0 && !matchAny(r.Tools, name) {
+		return "", "", false
+	}
+	if r.match == nil && len(r.AllowedHosts) == 0 && !r.DenyShellMetacharacters {
+		return "", "rule of the tool", true
+	}
+	// the arguments are checked in order: the decision does not depend on the map order
+	arguments := make([]string, 0, len(values))
+	for argument := range values {
+		arguments = append(arguments, argument)
+	}
+	sort.Strings(arguments)
+	for _, argument := range arguments {
+		if len(r.Arguments) > 0 && !matchAny(r.Arguments, argument) {
+			continue
+		}
+		value := values[argument]
+		if r.match != nil && r.match.MatchString(value) {
+			return argument, "matches " + r.Match, true
+		}
+		if r.DenyShellMetacharacters && shellMetacharacters.MatchString(value) {
+			return argument, "shell metacharacters are not allowed", true
+		}
+		if len(r.AllowedHosts) > 0 {
+			for _, match := range urlPattern.FindAllString(value, -1) {
+				parsed, err := url.Parse(match)
+				if err != nil || !matchAny(r.AllowedHosts, strings.ToLower(parsed.Hostname())) {
+					return argument, "the URL " + match + " is outside of the allowed hosts", true
+				}
+			}
+		}
+	}
+	return "", "", false
+}
+
+// policyValues collects the scalar values of the arguments by path
+// (e.g. "options.headers.0")
+func policyValues(prefix string, value interface{}, values map[string]string) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, item := range value {
+			policyValues(policyPath(prefix, key), item, values)
+		}
+	case []interface{}:
+		for i, item := range value {
+			policyValues(policyPath(prefix, strconv.Itoa(i)), item, values)
+		}
+	case nil:
+	case string:
+		values[prefix] = value
+	default:
+		values[prefix] = fmt.Sprint(value)
+	}
+}
+
+func policyPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// matchAny tells if the name matches one of the patterns
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
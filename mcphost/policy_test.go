@@ -0,0 +1,151 @@
+package mcphost
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestToolPolicyCheck(t *testing.T) {
+	tests := []struct {
+		name      string
+		rules     []PolicyRule
+		tool      string
+		arguments map[string]interface{}
+		// denied is the argument of the denial ("-" when the call is allowed)
+		denied string
+	}{
+		{
+			name:      "deny rule of the tool",
+			rules:     []PolicyRule{{Tools: []string{"shell.*"}}},
+			tool:      "shell.run",
+			arguments: map[string]interface{}{"command": "ls"},
+		},
+		{
+			name:      "no matching rule",
+			rules:     []PolicyRule{{Tools: []string{"shell.*"}}},
+			tool:      "fetch.get",
+			arguments: map[string]interface{}{"url": "https://example.com"},
+			denied:    "-",
+		},
+		{
+			name:      "deny match",
+			rules:     []PolicyRule{{Match: `rm\s+-rf`}},
+			tool:      "shell.run",
+			arguments: map[string]interface{}{"command": "rm -rf /"},
+			denied:    "command",
+		},
+		{
+			name:      "deny match not matching",
+			rules:     []PolicyRule{{Match: `rm\s+-rf`}},
+			tool:      "shell.run",
+			arguments: map[string]interface{}{"command": "ls -l"},
+			denied:    "-",
+		},
+		{
+			name: "allow match before the deny rule",
+			rules: []PolicyRule{
+				{Tools: []string{"shell.*"}, Action: PolicyAllow, Match: `^git status$`},
+				{Tools: []string{"shell.*"}},
+			},
+			tool:      "shell.run",
+			arguments: map[string]interface{}{"command": "git status"},
+			denied:    "-",
+		},
+		{
+			name: "allow match not matching",
+			rules: []PolicyRule{
+				{Tools: []string{"shell.*"}, Action: PolicyAllow, Match: `^git status$`},
+				{Tools: []string{"shell.*"}},
+			},
+			tool:      "shell.run",
+			arguments: map[string]interface{}{"command": "git push"},
+		},
+		{
+			name:      "allowed host",
+			rules:     []PolicyRule{{AllowedHosts: []string{"*.wikipedia.org"}}},
+			tool:      "fetch.get",
+			arguments: map[string]interface{}{"url": "https://en.wikipedia.org/wiki/Go"},
+			denied:    "-",
+		},
+		{
+			name:      "host outside of the allowed hosts",
+			rules:     []PolicyRule{{AllowedHosts: []string{"*.wikipedia.org"}}},
+			tool:      "fetch.get",
+			arguments: map[string]interface{}{"url": "https://evil.example.com/?q=en.wikipedia.org"},
+			denied:    "url",
+		},
+		{
+			name:      "shell metacharacters",
+			rules:     []PolicyRule{{DenyShellMetacharacters: true}},
+			tool:      "shell.run",
+			arguments: map[string]interface{}{"command": "ls; cat /etc/passwd"},
+			denied:    "command",
+		},
+		{
+			name:      "no shell metacharacters",
+			rules:     []PolicyRule{{DenyShellMetacharacters: true}},
+			tool:      "shell.run",
+			arguments: map[string]interface{}{"command": "ls -l"},
+			denied:    "-",
+		},
+		{
+			name:  "nested argument",
+			rules: []PolicyRule{{Arguments: []string{"options.*"}, DenyShellMetacharacters: true}},
+			tool:  "shell.run",
+			arguments: map[string]interface{}{
+				"command": "echo $HOME",
+				"options": map[string]interface{}{"args": []interface{}{"-l", "$(id)"}},
+			},
+			denied: "options.args.1",
+		},
+		{
+			name:  "nested argument outside of the patterns",
+			rules: []PolicyRule{{Arguments: []string{"options.*"}, DenyShellMetacharacters: true}},
+			tool:  "shell.run",
+			arguments: map[string]interface{}{
+				"command": "echo $HOME",
+				"options": map[string]interface{}{"cwd": "/tmp"},
+			},
+			denied: "-",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy, err := NewToolPolicy(test.rules)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = policy.Check(test.tool, test.arguments)
+			switch {
+			case test.denied == "-":
+				if err != nil {
+					t.Errorf("Check() = %v, want allowed", err)
+				}
+			case !errors.Is(err, ErrDeniedByPolicy):
+				t.Errorf("Check() = %v, want denied", err)
+			case test.denied != "" && !strings.Contains(err.Error(), "(argument "+test.denied+")"):
+				t.Errorf("Check() = %v, want denied argument %s", err, test.denied)
+			}
+		})
+	}
+}
+
+func TestNewToolPolicyErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		rule PolicyRule
+	}{
+		{name: "unknown action", rule: PolicyRule{Action: "ask"}},
+		{name: "invalid pattern", rule: PolicyRule{Tools: []string{"["}}},
+		{name: "invalid match", rule: PolicyRule{Match: "("}},
+		{name: "allow rule with allowed hosts", rule: PolicyRule{Action: PolicyAllow, AllowedHosts: []string{"example.com"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := NewToolPolicy([]PolicyRule{test.rule}); err == nil {
+				t.Error("NewToolPolicy() = nil error, want an error")
+			}
+		})
+	}
+}
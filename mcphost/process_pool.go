@@ -0,0 +1,138 @@
+package mcphost
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// processPool is the client of a stdio server started as several processes
+// (see MCPServerConfig.Processes): each process runs one request at a time,
+// the requests wait in a queue for a free process.
+// The subscriptions go to the first process, the notifications and the
+// requests of all the processes are handled by the server.
+type processPool struct {
+	processes []MCPClient
+	// idle are the processes waiting for a request
+	idle chan MCPClient
+}
+
+// newProcessPool starts the processes of the pool, the clients are
+// created with newClient and wrapped by the server
+func (s *MCPServer) newProcessPool(newClient func() (MCPClient, error), size int) (*processPool, error) {
+	pool := &processPool{idle: make(chan MCPClient, size)}
+	for range size {
+		mcpClient, err := newClient()
+		if err != nil {
+			pool.Close()
+			return nil, err
+		}
+		mcpClient = s.wrap(mcpClient)
+		pool.processes = append(pool.processes, mcpClient)
+		pool.idle <- mcpClient
+	}
+	slog.Info("process pool started", "server", s.Name, "processes", size)
+	return pool, nil
+}
+
+// do runs the request on a free process
+func do[T any](ctx context.Context, p *processPool, call func(mcpClient MCPClient) (T, error)) (T, error) {
+	var zero T
+	select {
+	case mcpClient := <-p.idle:
+		defer func() { p.idle <- mcpClient }()
+		return call(mcpClient)
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+// Initialize initializes all the processes, it returns the result of the first one
+func (p *processPool) Initialize(ctx context.Context, request mcp.InitializeRequest) (*mcp.InitializeResult, error) {
+	var first *mcp.InitializeResult
+	for _, process := range p.processes {
+		result, err := process.Initialize(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+		if first == nil {
+			first = result
+		}
+	}
+	return first, nil
+}
+
+// Ping pings all the processes: the pool is restarted when one of them is down
+func (p *processPool) Ping(ctx context.Context) error {
+	for _, process := range p.processes {
+		if err := process.Ping(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *processPool) ListTools(ctx context.Context, request mcp.ListToolsRequest) (*mcp.ListToolsResult, error) {
+	return do(ctx, p, func(mcpClient MCPClient) (*mcp.ListToolsResult, error) {
+		return mcpClient.ListTools(ctx, request)
+	})
+}
+
+func (p *processPool) CallTool(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return do(ctx, p, func(mcpClient MCPClient) (*mcp.CallToolResult, error) {
+		return mcpClient.CallTool(ctx, request)
+	})
+}
+
+func (p *processPool) ListPrompts(ctx context.Context, request mcp.ListPromptsRequest) (*mcp.ListPromptsResult, error) {
+	return do(ctx, p, func(mcpClient MCPClient) (*mcp.ListPromptsResult, error) {
+		return mcpClient.ListPrompts(ctx, request)
+	})
+}
+
+func (p *processPool) GetPrompt(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	return do(ctx, p, func(mcpClient MCPClient) (*mcp.GetPromptResult, error) {
+		return mcpClient.GetPrompt(ctx, request)
+	})
+}
+
+func (p *processPool) ListResources(ctx context.Context, request mcp.ListResourcesRequest) (*mcp.ListResourcesResult, error) {
+	return do(ctx, p, func(mcpClient MCPClient) (*mcp.ListResourcesResult, error) {
+		return mcpClient.ListResources(ctx, request)
+	})
+}
+
+func (p *processPool) ReadResource(ctx context.Context, request mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+	return do(ctx, p, func(mcpClient MCPClient) (*mcp.ReadResourceResult, error) {
+		return mcpClient.ReadResource(ctx, request)
+	})
+}
+
+// Subscribe subscribes with the first process only (the updates are notified once)
+func (p *processPool) Subscribe(ctx context.Context, request mcp.SubscribeRequest) error {
+	return p.processes[0].Subscribe(ctx, request)
+}
+
+func (p *processPool) Unsubscribe(ctx context.Context, request mcp.UnsubscribeRequest) error {
+	return p.processes[0].Unsubscribe(ctx, request)
+}
+
+// SetLevel sets the log level of all the processes
+func (p *processPool) SetLevel(ctx context.Context, request mcp.SetLevelRequest) error {
+	var errs []error
+	for _, process := range p.processes {
+		errs = append(errs, process.SetLevel(ctx, request))
+	}
+	return errors.Join(errs...)
+}
+
+// Close stops all the processes
+func (p *processPool) Close() error {
+	var errs []error
+	for _, process := range p.processes {
+		errs = append(errs, process.Close())
+	}
+	return errors.Join(errs...)
+}
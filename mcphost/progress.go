@@ -0,0 +1,66 @@
+package mcphost
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Progress is a progress notification of a tool call (notifications/progress)
+type Progress struct {
+	Progress float64
+	// Total is 0 when it is not known
+	Total   float64
+	Message string
+}
+
+type progressKey struct{}
+
+// WithProgress returns a context whose tool calls ask the servers
+// for progress notifications, they are given to onProgress
+func WithProgress(ctx context.Context, onProgress func(Progress)) context.Context {
+	return context.WithValue(ctx, progressKey{}, onProgress)
+}
+
+func progressHandler(ctx context.Context) func(Progress) {
+	onProgress, _ := ctx.Value(progressKey{}).(func(Progress))
+	return onProgress
+}
+
+// progressTokens generates the progress tokens of the requests
+var progressTokens atomic.Int64
+
+// watchProgress registers the handler of the progress notifications
+// of a request, stop unregisters it
+func (s *MCPServer) watchProgress(onProgress func(Progress)) (token string, stop func()) {
+	token = "progress-" + strconv.FormatInt(progressTokens.Add(1), 10)
+	s.mu.Lock()
+	if s.progress == nil {
+		s.progress = map[string]func(Progress){}
+	}
+	s.progress[token] = onProgress
+	s.mu.Unlock()
+	return token, func() {
+		s.mu.Lock()
+		delete(s.progress, token)
+		s.mu.Unlock()
+	}
+}
+
+// notifyProgress gives a progress notification to the handler of its request
+func (s *MCPServer) notifyProgress(notification mcp.JSONRPCNotification) {
+	fields := notification.Params.AdditionalFields
+	s.mu.RLock()
+	onProgress, ok := s.progress[fmt.Sprint(fields["progressToken"])]
+	s.mu.RUnlock()
+	if !ok {
+		return
+	}
+	progress, _ := fields["progress"].(float64)
+	total, _ := fields["total"].(float64)
+	message, _ := fields["message"].(string)
+	onProgress(Progress{Progress: progress, Total: total, Message: message})
+}
@@ -0,0 +1,111 @@
+package mcphost
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// ProtocolVersion is the version of the MCP protocol asked by the host,
+// the servers can negotiate an older supported version
+const ProtocolVersion = "2025-06-18"
+
+// hostInfo is the name and the version of the host, sent to the servers
+// as its client info and to the MCP clients of the gateway as its server info
+var hostInfo = mcp.Implementation{Name: "mcphost", Version: "1.0.0"}
+
+// The first protocol versions of the features depending on the version
+const (
+	// protocolStreamableHTTP replaced the HTTP+SSE transport by the streamable HTTP transport
+	protocolStreamableHTTP = "2025-03-26"
+	// legacyProtocolVersion is the version of the servers without version
+	// and of the HTTP+SSE transport
+	legacyProtocolVersion = "2024-11-05"
+)
+
+// SupportedProtocolVersions are the versions the servers can negotiate (newest first)
+var SupportedProtocolVersions = []string{ProtocolVersion, protocolStreamableHTTP, legacyProtocolVersion}
+
+// negotiatedVersion checks the protocol version answered by the server
+// to initialize: the host disconnects the servers of an unknown version
+func negotiatedVersion(result *mcp.InitializeResult) (string, error) {
+	version := result.ProtocolVersion
+	if version == "" {
+		return legacyProtocolVersion, nil
+	}
+	for _, supported := range SupportedProtocolVersions {
+		if version == supported {
+			return version, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported protocol version %s (the host supports %s)",
+		version, strings.Join(SupportedProtocolVersions, ", "))
+}
+
+// SupportsProtocol tells if the negotiated protocol version of the server
+// is at least version (the versions are dates: they are sorted as strings)
+func (s *MCPServer) SupportsProtocol(version string) bool {
+	return s.ProtocolVersion >= version
+}
+
+// legacyTransport tells if the error of the initialization of an http server
+// means that it only has the HTTP+SSE transport of the protocol 2024-11-05
+// (it does not accept the POST of initialize). The streamable HTTP client
+// of mcp-go only reports the status of the response in the error message.
+func legacyTransport(err error) bool {
+	for _, status := range []int{http.StatusBadRequest, http.StatusNotFound, http.StatusMethodNotAllowed} {
+		if strings.Contains(err.Error(), fmt.Sprintf("request failed with status %d", status)) {
+			return true
+		}
+	}
+	return false
+}
+
+// connectLegacySSE connects to a server with the HTTP+SSE transport of the
+// protocol 2024-11-05 (the SSE transport of mcp-go): it is used when the
+// server does not accept the streamable HTTP transport
+func (s *MCPServer) connectLegacySSE(ctx context.Context, initRequest mcp.InitializeRequest) (MCPClient, *mcp.InitializeResult, error) {
+	url, err := expandEnv(s.Config.URL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("url: %w", err)
+	}
+	headers, err := s.Config.HTTPHeaders()
+	if err != nil {
+		return nil, nil, err
+	}
+	options := []transport.ClientOption{transport.WithHeaders(headers)}
+	httpClient, err := s.Config.httpClient()
+	if err != nil {
+		return nil, nil, err
+	}
+	if httpClient != nil {
+		options = append(options, transport.WithHTTPClient(httpClient))
+	}
+	sseTransport, err := transport.NewSSE(url, options...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create client: %w", err)
+	}
+	// the SSE stream lives as long as the client (Close stops it),
+	// the timeout of the initialization only covers its opening
+	streamCtx := context.WithoutCancel(ctx)
+	stopTimeout := context.AfterFunc(ctx, func() { sseTransport.Close() })
+	sseClient, err := s.startClient(streamCtx, sseTransport)
+	stopTimeout()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open the SSE stream: %w", err)
+	}
+	mcpClient := s.wrap(sseClient)
+	initRequest.Params.ProtocolVersion = legacyProtocolVersion
+	initResult, err := mcpClient.Initialize(ctx, initRequest)
+	if err != nil {
+		mcpClient.Close()
+		return nil, nil, fmt.Errorf("failed to initialize: %w", err)
+	}
+	slog.Warn("the server only has the HTTP+SSE transport of the protocol "+legacyProtocolVersion, "server", s.Name)
+	return mcpClient, initResult, nil
+}
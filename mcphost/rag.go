@@ -0,0 +1,459 @@
+package mcphost
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ollama/ollama/api"
+)
+
+// Default settings of the retrieval of the local documents
+const (
+	DefaultRAGChunkTokens   = 300
+	DefaultRAGOverlapTokens = 50
+	DefaultRAGTopK          = 4
+	// ragEmbedBatch is the number of chunks embedded by request
+	ragEmbedBatch = 32
+)
+
+// DefaultRAGExtensions are the extensions of the ingested documents
+var DefaultRAGExtensions = []string{".md", ".txt", ".rst", ".adoc", ".html", ".json", ".yaml", ".yml", ".go", ".py", ".js", ".ts"}
+
+// RAGConfig enables the retrieval of the chunks of local documents
+// relevant to the prompts (retrieval-augmented generation)
+type RAGConfig struct {
+	// Documents are the files and directories ingested at the start
+	// (${VAR} references are expanded)
+	Documents []string `json:"documents"`
+	// Extensions are the extensions of the files of the directories
+	// (DefaultRAGExtensions by default)
+	Extensions []string `json:"extensions"`
+	// Index is the SQLite file keeping the embeddings between the runs (only
+	// the modified documents are embedded again), the index is in memory without it
+	Index string `json:"index"`
+	// Driver is the database/sql driver of the index (DefaultMemoryDriver by default)
+	Driver string `json:"driver"`
+	// EmbeddingsModel computes the embeddings (DefaultMemoryEmbeddingsModel by default)
+	EmbeddingsModel string `json:"embeddingsModel"`
+	// ChunkTokens and OverlapTokens are the size of the chunks and the size
+	// of the end of a chunk repeated at the start of the next one
+	ChunkTokens   int `json:"chunkTokens"`
+	OverlapTokens int `json:"overlapTokens"`
+	// TopK is the number of chunks added to a prompt (DefaultRAGTopK by default)
+	TopK int `json:"topK"`
+	// MinScore is the minimum cosine similarity of the added chunks
+	MinScore float64 `json:"minScore"`
+}
+
+// DocumentChunk is a part of a local document with its embedding
+type DocumentChunk struct {
+	Source    string
+	Index     int
+	Content   string
+	Embedding []float32
+	// Score is the similarity with the prompt of a retrieved chunk
+	Score float64
+}
+
+// DocumentIndex stores the embedded chunks of the documents
+type DocumentIndex interface {
+	// Modified returns the modification time of the indexed version
+	// of a document (zero when it is not indexed)
+	Modified(ctx context.Context, source string) (time.Time, error)
+	// Replace replaces the chunks of a document
+	Replace(ctx context.Context, source string, modified time.Time, chunks []DocumentChunk) error
+	// Search returns the k chunks the most similar to embedding, the most similar first
+	Search(ctx context.Context, embedding []float32, k int) ([]DocumentChunk, error)
+	Close() error
+}
+
+// memoryDocumentIndex is the in-memory index (the documents are embedded at each start)
+type memoryDocumentIndex struct {
+	mu       sync.RWMutex
+	modified map[string]time.Time
+	chunks   map[string][]DocumentChunk
+}
+
+func newMemoryDocumentIndex() *memoryDocumentIndex {
+	return &memoryDocumentIndex{modified: map[string]time.Time{}, chunks: map[string][]DocumentChunk{}}
+}
+
+func (i *memoryDocumentIndex) Modified(ctx context.Context, source string) (time.Time, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.modified[source], nil
+}
+
+func (i *memoryDocumentIndex) Replace(ctx context.Context, source string, modified time.Time, chunks []DocumentChunk) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.modified[source] = modified
+	i.chunks[source] = chunks
+	return nil
+}
+
+func (i *memoryDocumentIndex) Search(ctx context.Context, embedding []float32, k int) ([]DocumentChunk, error) {
+	i.mu.RLock()
+	all := []DocumentChunk{}
+	for _, chunks := range i.chunks {
+		all = append(all, chunks...)
+	}
+	i.mu.RUnlock()
+	return topChunks(all, embedding, k), nil
+}
+
+func (i *memoryDocumentIndex) Close() error {
+	return nil
+}
+
+// sqlDocumentIndex keeps the chunks in a SQLite database (the embeddings are
+// JSON arrays, the similarities are computed by the host)
+type sqlDocumentIndex struct {
+	db *sql.DB
+}
+
+// OpenDocumentIndex opens (and creates) a SQLite index of the documents,
+// the driver must be linked in the program
+func OpenDocumentIndex(driver string, dataSource string) (DocumentIndex, error) {
+	db, err := sql.Open(driver, dataSource)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the document index %s (is the %s driver linked?): %w", dataSource, driver, err)
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS rag_documents (
+		source TEXT PRIMARY KEY,
+		modified TEXT NOT NULL
+	)`)
+	if err == nil {
+		_, err = db.Exec(`CREATE TABLE IF NOT EXISTS rag_chunks (
+			source TEXT NOT NULL,
+			chunk INTEGER NOT NULL,
+			content TEXT NOT NULL,
+			embedding TEXT NOT NULL,
+			PRIMARY KEY (source, chunk)
+		)`)
+	}
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create the document index tables: %w", err)
+	}
+	return &sqlDocumentIndex{db: db}, nil
+}
+
+func (i *sqlDocumentIndex) Modified(ctx context.Context, source string) (time.Time, error) {
+	var modified string
+	err := i.db.QueryRowContext(ctx, `SELECT modified FROM rag_documents WHERE source = ?`, source).Scan(&modified)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339Nano, modified)
+}
+
+func (i *sqlDocumentIndex) Replace(ctx context.Context, source string, modified time.Time, chunks []DocumentChunk) error {
+	tx, err := i.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM rag_chunks WHERE source = ?`, source); err != nil {
+		return err
+	}
+	for _, chunk := range chunks {
+		embedding, err := json.Marshal(chunk.Embedding)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO rag_chunks (source, chunk, content, embedding) VALUES (?, ?, ?, ?)`,
+			source, chunk.Index, chunk.Content, string(embedding))
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.ExecContext(ctx, `INSERT OR REPLACE INTO rag_documents (source, modified) VALUES (?, ?)`,
+		source, modified.UTC().Format(time.RFC3339Nano))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (i *sqlDocumentIndex) Search(ctx context.Context, embedding []float32, k int) ([]DocumentChunk, error) {
+	rows, err := i.db.QueryContext(ctx, `SELECT source, chunk, content, embedding FROM rag_chunks`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	all := []DocumentChunk{}
+	for rows.Next() {
+		var chunk DocumentChunk
+		var data string
+		if err := rows.Scan(&chunk.Source, &chunk.Index, &chunk.Content, &data); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(data), &chunk.Embedding); err != nil {
+			return nil, fmt.Errorf("invalid embedding of %s#%d: %w", chunk.Source, chunk.Index, err)
+		}
+		all = append(all, chunk)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return topChunks(all, embedding, k), nil
+}
+
+func (i *sqlDocumentIndex) Close() error {
+	return i.db.Close()
+}
+
+// topChunks returns the k chunks the most similar to embedding
+func topChunks(chunks []DocumentChunk, embedding []float32, k int) []DocumentChunk {
+	for i := range chunks {
+		chunks[i].Score = cosineSimilarity(embedding, chunks[i].Embedding)
+	}
+	sort.SliceStable(chunks, func(i, j int) bool { return chunks[i].Score > chunks[j].Score })
+	if len(chunks) > k {
+		chunks = chunks[:k]
+	}
+	return chunks
+}
+
+// Retriever embeds the local documents with Ollama and retrieves
+// the chunks relevant to the prompts
+type Retriever struct {
+	Index           DocumentIndex
+	Ollama          *api.Client
+	EmbeddingsModel string
+	ChunkTokens     int
+	OverlapTokens   int
+	TopK            int
+	MinScore        float64
+	Extensions      []string
+}
+
+// NewRetriever opens the index of a config and ingests its documents
+func NewRetriever(ctx context.Context, ollama *api.Client, config RAGConfig) (*Retriever, error) {
+	var index DocumentIndex = newMemoryDocumentIndex()
+	if config.Index != "" {
+		driver := config.Driver
+		if driver == "" {
+			driver = DefaultMemoryDriver
+		}
+		var err error
+		if index, err = OpenDocumentIndex(driver, os.ExpandEnv(config.Index)); err != nil {
+			return nil, err
+		}
+	}
+	retriever := &Retriever{
+		Index:           index,
+		Ollama:          ollama,
+		EmbeddingsModel: config.EmbeddingsModel,
+		ChunkTokens:     config.ChunkTokens,
+		OverlapTokens:   config.OverlapTokens,
+		TopK:            config.TopK,
+		MinScore:        config.MinScore,
+		Extensions:      config.Extensions,
+	}
+	if retriever.EmbeddingsModel == "" {
+		retriever.EmbeddingsModel = DefaultMemoryEmbeddingsModel
+	}
+	if retriever.ChunkTokens <= 0 {
+		retriever.ChunkTokens = DefaultRAGChunkTokens
+	}
+	if retriever.OverlapTokens == 0 {
+		retriever.OverlapTokens = DefaultRAGOverlapTokens
+	}
+	if retriever.TopK <= 0 {
+		retriever.TopK = DefaultRAGTopK
+	}
+	if len(retriever.Extensions) == 0 {
+		retriever.Extensions = DefaultRAGExtensions
+	}
+
+	paths := []string{}
+	for _, path := range config.Documents {
+		paths = append(paths, os.ExpandEnv(path))
+	}
+	if err := retriever.Ingest(ctx, paths...); err != nil {
+		index.Close()
+		return nil, err
+	}
+	return retriever, nil
+}
+
+// Ingest embeds the files and the files of the directories (with the
+// extensions of the retriever), the documents not modified since their
+// last ingestion are skipped
+func (r *Retriever) Ingest(ctx context.Context, paths ...string) error {
+	files := []string{}
+	for _, path := range paths {
+		err := filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() {
+				if file != path && strings.HasPrefix(entry.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if file == path || r.extension(file) {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list the documents of %s: %w", path, err)
+		}
+	}
+
+	ingested, chunks := 0, 0
+	for _, file := range files {
+		count, err := r.ingestFile(ctx, file)
+		if err != nil {
+			return fmt.Errorf("failed to ingest %s: %w", file, err)
+		}
+		if count > 0 {
+			ingested++
+			chunks += count
+		}
+	}
+	slog.Info("documents ingested", "documents", len(files), "embedded", ingested, "chunks", chunks, "model", r.EmbeddingsModel)
+	return nil
+}
+
+func (r *Retriever) extension(file string) bool {
+	extension := strings.ToLower(filepath.Ext(file))
+	for _, accepted := range r.Extensions {
+		if extension == accepted {
+			return true
+		}
+	}
+	return false
+}
+
+// ingestFile embeds the chunks of a file, it returns the number of chunks
+// (0 when the file is not modified or is not a text)
+func (r *Retriever) ingestFile(ctx context.Context, file string) (int, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return 0, err
+	}
+	modified, err := r.Index.Modified(ctx, file)
+	if err != nil {
+		return 0, err
+	}
+	if modified.Equal(info.ModTime()) {
+		return 0, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	if !utf8.Valid(data) || strings.ContainsRune(string(data), 0) {
+		slog.Debug("document skipped: it is not a text", "document", file)
+		return 0, nil
+	}
+
+	texts := chunkText(string(data), r.ChunkTokens*charactersPerToken, r.OverlapTokens*charactersPerToken)
+	chunks := []DocumentChunk{}
+	for start := 0; start < len(texts); start += ragEmbedBatch {
+		batch := texts[start:min(start+ragEmbedBatch, len(texts))]
+		embeddings, err := r.embed(ctx, batch)
+		if err != nil {
+			return 0, err
+		}
+		for i, text := range batch {
+			chunks = append(chunks, DocumentChunk{Source: file, Index: start + i, Content: text, Embedding: embeddings[i]})
+		}
+	}
+	return len(chunks), r.Index.Replace(ctx, file, info.ModTime(), chunks)
+}
+
+// Retrieve returns the chunks the most similar to the prompt
+// with a score of at least MinScore
+func (r *Retriever) Retrieve(ctx context.Context, prompt string) ([]DocumentChunk, error) {
+	embeddings, err := r.embed(ctx, []string{prompt})
+	if err != nil {
+		return nil, err
+	}
+	chunks, err := r.Index.Search(ctx, embeddings[0], r.TopK)
+	if err != nil {
+		return nil, err
+	}
+	relevant := []DocumentChunk{}
+	for _, chunk := range chunks {
+		if chunk.Score >= r.MinScore {
+			relevant = append(relevant, chunk)
+		}
+	}
+	return relevant, nil
+}
+
+// Augment returns the extracts of the documents relevant to the prompt
+// to give with it ("" when there are none)
+func (r *Retriever) Augment(ctx context.Context, prompt string) (string, error) {
+	chunks, err := r.Retrieve(ctx, prompt)
+	if err != nil || len(chunks) == 0 {
+		return "", err
+	}
+	var b strings.Builder
+	b.WriteString("Extracts of the local documents relevant to the request (cite their source when you use them):\n")
+	for _, chunk := range chunks {
+		fmt.Fprintf(&b, "\n[%s#%d]\n%s\n", chunk.Source, chunk.Index, strings.TrimSpace(chunk.Content))
+	}
+	slog.Info("documents retrieved", "chunks", len(chunks), "best", chunks[0].Source, "score", chunks[0].Score)
+	return b.String(), nil
+}
+
+// Close closes the index
+func (r *Retriever) Close() error {
+	return r.Index.Close()
+}
+
+func (r *Retriever) embed(ctx context.Context, texts []string) ([][]float32, error) {
+	response, err := r.Ollama.Embed(ctx, &api.EmbedRequest{Model: r.EmbeddingsModel, Input: texts})
+	if err != nil {
+		return nil, err
+	}
+	if len(response.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("%s returned %d embeddings for %d texts", r.EmbeddingsModel, len(response.Embeddings), len(texts))
+	}
+	return response.Embeddings, nil
+}
+
+// chunkText splits a text in chunks of at most size bytes (see splitText),
+// each chunk starts with the end of the previous one (at most overlap bytes)
+func chunkText(text string, size int, overlap int) []string {
+	if overlap <= 0 || overlap >= size {
+		return splitText(text, size)
+	}
+	chunks := []string{}
+	for _, part := range splitText(text, size-overlap) {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		if len(chunks) > 0 {
+			previous := chunks[len(chunks)-1]
+			start := max(len(previous)-overlap, 0)
+			for start < len(previous) && !utf8.RuneStart(previous[start]) {
+				start++
+			}
+			part = previous[start:] + part
+		}
+		chunks = append(chunks, part)
+	}
+	return chunks
+}
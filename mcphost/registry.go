@@ -0,0 +1,1028 @@
+package mcphost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/ollama/ollama/api"
+)
+
+// ToolNameSeparator separates the server name from the tool name
+// in the tool names sent to the model (e.g. "mcp-curl.use_curl")
+const ToolNameSeparator = "."
+
+// pingTimeout is the time given to a server to answer a ping
+// before it is considered as down
+const pingTimeout = 5 * time.Second
+
+// MCPClient is the part of the mcp-go client API used by the host
+type MCPClient interface {
+	Initialize(ctx context.Context, request mcp.InitializeRequest) (*mcp.InitializeResult, error)
+	Ping(ctx context.Context) error
+	ListTools(ctx context.Context, request mcp.ListToolsRequest) (*mcp.ListToolsResult, error)
+	CallTool(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error)
+	ListPrompts(ctx context.Context, request mcp.ListPromptsRequest) (*mcp.ListPromptsResult, error)
+	GetPrompt(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error)
+	ListResources(ctx context.Context, request mcp.ListResourcesRequest) (*mcp.ListResourcesResult, error)
+	ReadResource(ctx context.Context, request mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error)
+	Subscribe(ctx context.Context, request mcp.SubscribeRequest) error
+	Unsubscribe(ctx context.Context, request mcp.UnsubscribeRequest) error
+	SetLevel(ctx context.Context, request mcp.SetLevelRequest) error
+	Close() error
+}
+
+// MCPServer is a started and initialized MCP server
+type MCPServer struct {
+	Name   string
+	Config MCPServerConfig
+	Info   mcp.Implementation
+	Tools  []mcp.Tool
+	// Prompts and Resources are empty when the server does not have
+	// the prompts or resources capability
+	Prompts   []mcp.Prompt
+	Resources []mcp.Resource
+	// ProtocolVersion is the MCP version negotiated with the server
+	ProtocolVersion string
+	// readsResources is true when the server has the resources capability,
+	// subscribes when it accepts the subscriptions to the updates
+	readsResources bool
+	subscribes     bool
+	// subscriptions are the URIs of the subscribed resources
+	subscriptions map[string]bool
+	// progress are the handlers of the progress notifications by token
+	progress map[string]func(Progress)
+
+	timeouts Timeouts
+	// debug logs the JSON-RPC messages exchanged with the server
+	debug bool
+	// newClient creates the client of the server (newMCPClient by default)
+	newClient func() (MCPClient, error)
+	// recorder, if set, records the interactions with the server
+	recorder *Cassette
+	mu       sync.RWMutex
+	client   MCPClient
+
+	// the idle shutdown (see MCPServerConfig.IdleTimeout): active counts
+	// the running requests, stopped is true when the process is stopped
+	lastUsed time.Time
+	active   int
+	stopped  bool
+	closed   bool
+	done     chan struct{}
+	// slots limits the concurrent requests (see MCPServerConfig.MaxConcurrency)
+	slots chan struct{}
+
+	// unhealthy is true when the server did not answer the last ping
+	unhealthy bool
+	lastCheck time.Time
+
+	// onToolsChanged replaces the tools of the server when they changed,
+	// onResourceUpdated reads an updated resource (set by the registry)
+	onToolsChanged    func(server *MCPServer, tools []mcp.Tool)
+	onResourceUpdated func(server *MCPServer, uri string)
+	// onSample answers the sampling requests of the server,
+	// onElicit its questions to the user (set by the registry)
+	onSample func(ctx context.Context, server *MCPServer, request mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error)
+	onElicit func(ctx context.Context, server *MCPServer, request ElicitationRequest) (ElicitationResult, error)
+}
+
+// notifier is implemented by the clients receiving the notifications of the server
+type notifier interface {
+	OnNotification(handler func(notification mcp.JSONRPCNotification))
+}
+
+// Client returns the current client of the server
+// (it changes when the server is restarted, nil when it is stopped)
+func (s *MCPServer) Client() MCPClient {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.stopped {
+		return nil
+	}
+	return s.client
+}
+
+// acquire returns the client of a request: the server stopped after its
+// idle timeout is started again. release must be called after the request.
+func (s *MCPServer) acquire(ctx context.Context) (MCPClient, error) {
+	if s.slots != nil {
+		// the requests of all the sessions wait for a free slot
+		select {
+		case s.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		s.freeSlot()
+		return nil, fmt.Errorf("server %s is closed", s.Name)
+	}
+	if s.stopped {
+		slog.Info("restarting the idle server", "server", s.Name)
+		mcpClient, initResult, err := s.connect(ctx)
+		if err != nil {
+			s.freeSlot()
+			return nil, fmt.Errorf("failed to restart the idle server %s: %w", s.Name, err)
+		}
+		s.client, s.Info, s.stopped = mcpClient, initResult.ServerInfo, false
+		s.resubscribe(ctx, mcpClient)
+	}
+	s.active++
+	return s.client, nil
+}
+
+// release ends a request started with acquire
+func (s *MCPServer) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active--
+	s.lastUsed = time.Now()
+	s.freeSlot()
+}
+
+// freeSlot frees the slot of a request taken by acquire
+func (s *MCPServer) freeSlot() {
+	if s.slots != nil {
+		<-s.slots
+	}
+}
+
+// watchIdle stops the server process after timeout without request,
+// until the server is closed
+func (s *MCPServer) watchIdle(timeout time.Duration) {
+	ticker := time.NewTicker(max(timeout/4, time.Second))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.stopIfIdle(timeout)
+		}
+	}
+}
+
+func (s *MCPServer) stopIfIdle(timeout time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped || s.closed || s.active > 0 || time.Since(s.lastUsed) < timeout {
+		return
+	}
+	slog.Info("stopping the idle server", "server", s.Name, "idle", timeout)
+	s.client.Close()
+	s.stopped = true
+}
+
+// close stops the server and its idle watcher
+func (s *MCPServer) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	if s.done != nil {
+		close(s.done)
+	}
+	if !s.stopped {
+		s.client.Close()
+	}
+}
+
+// DefaultStartConcurrency is the number of servers started at the same time
+const DefaultStartConcurrency = 4
+
+// ToolRegistry starts the MCP servers declared in the config,
+// aggregates their tools and routes the tool calls to the right server
+type ToolRegistry struct {
+	servers []*MCPServer
+	// failed are the errors of the servers that failed to start
+	failed map[string]error
+	// done stops the health checks
+	done chan struct{}
+
+	// watched are the resources subscribed with Watch
+	watchMu sync.Mutex
+	watched map[string]*WatchedResource
+
+	// mu protects the routes and the tools of the servers,
+	// they change when a server sends a tools/list_changed notification
+	mu sync.RWMutex
+	// version is incremented when the tools change
+	version int
+	// namespaced tool name -> server
+	routes map[string]*MCPServer
+	// namespaced prompt name -> server
+	promptRoutes map[string]*MCPServer
+	// sampler answers the sampling requests of the servers,
+	// elicitor asks their questions to the user
+	sampler  Sampler
+	elicitor Elicitor
+	// cache keeps the results of the tools with a cache TTL
+	cache *toolCache
+	// policy denies the tool calls breaking its rules
+	policy *ToolPolicy
+	// audit records the tool invocations (nil records nothing)
+	audit *AuditLog
+	// metrics count the tool calls (nil records nothing)
+	metrics *Metrics
+}
+
+// NewToolRegistry starts and initializes the servers of the config
+// concurrently (startConcurrency at a time, each one with its initialize
+// and listTools timeouts). The host starts without the servers that failed
+// (see Failed), it fails only when all the servers failed
+// (without the built-in tools).
+func NewToolRegistry(ctx context.Context, config Config) (*ToolRegistry, error) {
+	registry := &ToolRegistry{
+		failed:       map[string]error{},
+		done:         make(chan struct{}),
+		watched:      map[string]*WatchedResource{},
+		routes:       map[string]*MCPServer{},
+		promptRoutes: map[string]*MCPServer{},
+		cache:        newToolCache(config.ToolCacheSize),
+	}
+
+	cassette, replay, err := config.cassette()
+	if err != nil {
+		return nil, err
+	}
+	if registry.policy, err = NewToolPolicy(config.ToolPolicy); err != nil {
+		return nil, fmt.Errorf("toolPolicy: %w", err)
+	}
+	if config.AuditLog != "" {
+		if registry.audit, err = OpenAuditLog(os.ExpandEnv(config.AuditLog)); err != nil {
+			return nil, err
+		}
+	}
+	names := config.ServerNames()
+	servers := make([]*MCPServer, len(names))
+	errs := make([]error, len(names))
+	concurrency := config.StartConcurrency
+	if concurrency <= 0 {
+		concurrency = DefaultStartConcurrency
+	}
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			servers[i], errs[i] = startServer(ctx, name, config, cassette, replay)
+		}()
+	}
+	wg.Wait()
+
+	// the servers are added in the order of their names
+	var failures []error
+	for i, name := range names {
+		if errs[i] != nil {
+			registry.failed[name] = errs[i]
+			failures = append(failures, fmt.Errorf("server %s: %w", name, errs[i]))
+			continue
+		}
+		registry.add(servers[i])
+	}
+	if len(names) > 0 && len(failures) == len(names) && config.Builtin == nil {
+		registry.Close()
+		return nil, fmt.Errorf("all the servers failed: %w", errors.Join(failures...))
+	}
+
+	if config.Builtin != nil {
+		builtinConfig := config.ServerConfig(BuiltinServerName)
+		builtinConfig.Timeouts = config.Timeouts
+		if err := registry.RegisterNativeTools(BuiltinServerName, builtinConfig, BuiltinTools(config.Builtin.Root)...); err != nil {
+			registry.Close()
+			return nil, err
+		}
+	}
+
+	// the servers are pinged periodically (a negative interval disables it)
+	interval := time.Duration(config.HealthCheckInterval)
+	if interval == 0 {
+		interval = DefaultHealthCheckInterval
+	}
+	if interval > 0 {
+		go registry.checkHealth(interval)
+	}
+	return registry, nil
+}
+
+// add adds a started server to the registry and routes its tools and prompts
+func (r *ToolRegistry) add(server *MCPServer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	server.mu.Lock()
+	server.onToolsChanged = r.setTools
+	server.onResourceUpdated = r.resourceUpdated
+	server.onSample = r.sample
+	server.onElicit = r.elicit
+	server.mu.Unlock()
+	r.servers = append(r.servers, server)
+	for _, tool := range server.Tools {
+		r.routes[server.Name+ToolNameSeparator+tool.Name] = server
+	}
+	for _, prompt := range server.Prompts {
+		r.promptRoutes[server.Name+ToolNameSeparator+prompt.Name] = server
+	}
+}
+
+// setTools replaces the tools of a server and their routes
+func (r *ToolRegistry) setTools(server *MCPServer, tools []mcp.Tool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name, routed := range r.routes {
+		if routed == server {
+			delete(r.routes, name)
+		}
+	}
+	server.Tools = tools
+	for _, tool := range tools {
+		r.routes[server.Name+ToolNameSeparator+tool.Name] = server
+	}
+	r.version++
+}
+
+// Version changes each time the tools of a server change
+// (the sessions then update the tools sent to the model)
+func (r *ToolRegistry) Version() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.version
+}
+
+// registered tells if a server name is already used
+func (r *ToolRegistry) registered(name string) bool {
+	for _, server := range r.servers {
+		if server.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// newMCPClient creates the client of the transport declared in the config
+func (s *MCPServer) newMCPClient() (MCPClient, error) {
+	switch {
+	case s.Config.Transport == "http":
+		return s.newHTTPClient()
+	case s.Config.Kubernetes != nil:
+		return s.newKubernetesClient()
+	}
+	return s.newStdioClient()
+}
+
+// startServer starts a server of the config. With a cassette, the interactions
+// with the server are recorded, or replayed without starting the server.
+func startServer(ctx context.Context, name string, hostConfig Config, cassette *Cassette, replay bool) (*MCPServer, error) {
+	server := &MCPServer{
+		Name:     name,
+		Config:   hostConfig.MCPServers[name],
+		timeouts: hostConfig.ServerTimeouts(name),
+		debug:    hostConfig.DebugMCP,
+	}
+	server.Config.Roots = hostConfig.ServerRoots(name)
+	if server.Config.MaxConcurrency > 0 {
+		server.slots = make(chan struct{}, server.Config.MaxConcurrency)
+	}
+	switch {
+	case cassette != nil && replay:
+		server.newClient = func() (MCPClient, error) {
+			return &replayMCPClient{server: name, cassette: cassette}, nil
+		}
+	case cassette != nil:
+		server.recorder = cassette
+	}
+	if !replay {
+		// the user authorizes the host before the initialization
+		// (which has a shorter timeout)
+		oauthClient, err := server.Config.oauthClient()
+		if err != nil {
+			return nil, err
+		}
+		if oauthClient != nil && !oauthClient.Authorized() {
+			if err := oauthClient.Authorize(ctx); err != nil {
+				return nil, fmt.Errorf("failed to authorize the host: %w", err)
+			}
+		}
+	}
+	if err := server.start(ctx); err != nil {
+		return nil, err
+	}
+
+	// the idle shutdown stops the process, a replayed server has no process
+	idleTimeout := time.Duration(server.Config.IdleTimeout)
+	if idleTimeout > 0 && server.Config.Transport != "http" && !replay {
+		server.lastUsed = time.Now()
+		server.done = make(chan struct{})
+		go server.watchIdle(idleTimeout)
+	}
+	return server, nil
+}
+
+// start connects to the server and lists its tools, prompts and resources
+func (s *MCPServer) start(ctx context.Context) error {
+	mcpClient, initResult, err := s.connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	listCtx, cancel := withTimeout(ctx, time.Duration(s.timeouts.ListTools))
+	tools, err := listTools(listCtx, mcpClient)
+	cancel()
+	if err != nil {
+		mcpClient.Close()
+		return fmt.Errorf("failed to list tools: %w", err)
+	}
+
+	// The prompts are optional: a server that fails to list them is still usable
+	if initResult.Capabilities.Prompts != nil {
+		listCtx, cancel := withTimeout(ctx, time.Duration(s.timeouts.ListTools))
+		prompts, err := listPrompts(listCtx, mcpClient)
+		cancel()
+		if err != nil {
+			slog.Warn("failed to list the prompts", "server", s.Name, "error", err)
+		} else {
+			s.Prompts = prompts
+		}
+	}
+	if initResult.Capabilities.Resources != nil {
+		s.readsResources = true
+		s.subscribes = initResult.Capabilities.Resources.Subscribe
+		listCtx, cancel := withTimeout(ctx, time.Duration(s.timeouts.ListTools))
+		resources, err := listResources(listCtx, mcpClient)
+		cancel()
+		if err != nil {
+			slog.Warn("failed to list the resources", "server", s.Name, "error", err)
+		} else {
+			s.Resources = resources
+		}
+	}
+
+	s.client = mcpClient
+	s.Info = initResult.ServerInfo
+	s.ProtocolVersion = initResult.ProtocolVersion
+	for _, tool := range tools {
+		if s.Config.AllowsTool(tool.Name) {
+			s.Tools = append(s.Tools, tool)
+		}
+	}
+	return nil
+}
+
+// connect creates a client for the server and initializes it before the timeout
+func (s *MCPServer) connect(ctx context.Context) (MCPClient, *mcp.InitializeResult, error) {
+	ctx, cancel := withTimeout(ctx, time.Duration(s.timeouts.Initialize))
+	defer cancel()
+
+	newClient := s.newClient
+	if newClient == nil {
+		newClient = s.newMCPClient
+	}
+	var mcpClient MCPClient
+	var err error
+	if s.Config.Processes > 1 && s.newClient == nil {
+		mcpClient, err = s.newProcessPool(newClient, s.Config.Processes)
+	} else if mcpClient, err = newClient(); err == nil {
+		mcpClient = s.wrap(mcpClient)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create client: %w", err)
+	}
+
+	initRequest := mcp.InitializeRequest{}
+	initRequest.Params.ProtocolVersion = ProtocolVersion
+	// the capabilities are declared by the clients of mcp-go (see clientOptions)
+	initRequest.Params.ClientInfo = hostInfo
+
+	initResult, err := mcpClient.Initialize(ctx, initRequest)
+	switch {
+	case err != nil && s.Config.Transport == "http" && s.newClient == nil && legacyTransport(err):
+		mcpClient.Close()
+		if mcpClient, initResult, err = s.connectLegacySSE(ctx, initRequest); err != nil {
+			return nil, nil, err
+		}
+	case err != nil:
+		mcpClient.Close()
+		return nil, nil, fmt.Errorf("failed to initialize: %w", err)
+	}
+
+	version, err := negotiatedVersion(initResult)
+	if err != nil {
+		mcpClient.Close()
+		return nil, nil, err
+	}
+	initResult.ProtocolVersion = version
+	slog.Info("server initialized", "server", s.Name, "protocolVersion", version)
+	if initResult.Capabilities.Logging != nil {
+		s.setLogLevel(ctx, mcpClient)
+	}
+	return mcpClient, initResult, nil
+}
+
+// wrap registers the handler of the notifications of the server, and adds the recording and the debug logs to the client
+func (s *MCPServer) wrap(mcpClient MCPClient) MCPClient {
+	if notifier, ok := mcpClient.(notifier); ok {
+		notifier.OnNotification(s.handleNotification)
+	}
+	if s.recorder != nil {
+		mcpClient = &recordingMCPClient{MCPClient: mcpClient, server: s.Name, cassette: s.recorder}
+	}
+	if s.debug {
+		mcpClient = &debugMCPClient{server: s.Name, client: mcpClient}
+	}
+	return mcpClient
+}
+
+// restart replaces the client of the server by a new one.
+// failed is the client that failed: if another call already restarted
+// the server, nothing is done.
+func (s *MCPServer) restart(ctx context.Context, failed MCPClient) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client != failed {
+		return nil
+	}
+
+	s.client.Close()
+	mcpClient, initResult, err := s.connect(ctx)
+	if err != nil {
+		return err
+	}
+	s.client = mcpClient
+	s.Info = initResult.ServerInfo
+	s.ProtocolVersion = initResult.ProtocolVersion
+	s.resubscribe(ctx, mcpClient)
+	return nil
+}
+
+// handleNotification handles the notifications of the server: the tools
+// are listed again after a tools/list_changed notification, a watched resource
+// is read again after a resources/updated notification
+// (in another goroutine, the handler is called by the reader of the responses)
+func (s *MCPServer) handleNotification(notification mcp.JSONRPCNotification) {
+	switch notification.Method {
+	case "notifications/message":
+		s.log(notification)
+	case "notifications/progress":
+		s.notifyProgress(notification)
+	case "notifications/tools/list_changed":
+		go s.refreshTools()
+	case "notifications/resources/updated":
+		uri, _ := notification.Params.AdditionalFields["uri"].(string)
+		s.mu.RLock()
+		onResourceUpdated := s.onResourceUpdated
+		s.mu.RUnlock()
+		if uri != "" && onResourceUpdated != nil {
+			go onResourceUpdated(s, uri)
+		}
+	}
+}
+
+// serverRequests answers the requests sent by the server to the host,
+// it is the sampling, roots and elicitation handler of the clients of mcp-go
+type serverRequests struct {
+	server *MCPServer
+}
+
+// clientOptions registers the handlers of the requests of the server on a
+// client of mcp-go, which declares the matching capabilities to initialize
+// (sampling and roots only when the config of the server enables them)
+func (s *MCPServer) clientOptions() []client.ClientOption {
+	requests := serverRequests{server: s}
+	options := []client.ClientOption{client.WithElicitationHandler(requests)}
+	if s.Config.Sampling {
+		options = append(options, client.WithSamplingHandler(requests))
+	}
+	if len(s.Config.Roots) > 0 {
+		options = append(options, client.WithRootsHandler(requests))
+	}
+	return options
+}
+
+// CreateMessage answers sampling/createMessage with the sampler of the registry
+func (r serverRequests) CreateMessage(ctx context.Context, request mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error) {
+	s := r.server
+	s.mu.RLock()
+	onSample := s.onSample
+	s.mu.RUnlock()
+	if onSample == nil {
+		return nil, fmt.Errorf("the host does not answer the sampling requests")
+	}
+	return onSample(ctx, s, request)
+}
+
+// ListRoots answers roots/list with the roots of the config
+func (r serverRequests) ListRoots(ctx context.Context, request mcp.ListRootsRequest) (*mcp.ListRootsResult, error) {
+	roots, err := r.server.Config.ListRoots()
+	if err != nil {
+		return nil, err
+	}
+	return &mcp.ListRootsResult{Roots: roots}, nil
+}
+
+// Elicit answers elicitation/create with the elicitor of the registry
+// (the questions are declined without it, and the URL mode is not supported)
+func (r serverRequests) Elicit(ctx context.Context, request mcp.ElicitationRequest) (*mcp.ElicitationResult, error) {
+	s := r.server
+	s.mu.RLock()
+	onElicit := s.onElicit
+	s.mu.RUnlock()
+	answer := ElicitationResult{Action: ElicitationDecline}
+	if onElicit != nil && (request.Params.Mode == "" || request.Params.Mode == "form") {
+		question, err := elicitationQuestion(request.Params)
+		if err != nil {
+			return nil, err
+		}
+		if answer, err = onElicit(ctx, s, question); err != nil {
+			return nil, err
+		}
+	}
+	result := &mcp.ElicitationResult{}
+	result.Action = mcp.ElicitationResponseAction(answer.Action)
+	if answer.Content != nil {
+		result.Content = answer.Content
+	}
+	return result, nil
+}
+
+// refreshTools lists the tools of the server again
+func (s *MCPServer) refreshTools() {
+	mcpClient := s.Client()
+	if mcpClient == nil {
+		return
+	}
+	ctx, cancel := withTimeout(context.Background(), time.Duration(s.timeouts.ListTools))
+	defer cancel()
+	allTools, err := listTools(ctx, mcpClient)
+	if err != nil {
+		slog.Warn("failed to refresh the tools", "server", s.Name, "error", err)
+		return
+	}
+	tools := []mcp.Tool{}
+	for _, tool := range allTools {
+		if s.Config.AllowsTool(tool.Name) {
+			tools = append(tools, tool)
+		}
+	}
+
+	s.mu.RLock()
+	onToolsChanged := s.onToolsChanged
+	s.mu.RUnlock()
+	if onToolsChanged != nil {
+		onToolsChanged(s, tools)
+	}
+	slog.Info("the tools of the server changed", "server", s.Name, "tools", len(tools))
+}
+
+// callTimeout returns the timeout of a call of the tool
+func (s *MCPServer) callTimeout(tool string) time.Duration {
+	if timeout, ok := s.Config.ToolTimeouts[tool]; ok && timeout > 0 {
+		return time.Duration(timeout)
+	}
+	return time.Duration(s.timeouts.CallTool)
+}
+
+// alive pings the server to know if its transport still works
+func (s *MCPServer) alive(mcpClient MCPClient) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	return mcpClient.Ping(ctx) == nil
+}
+
+// Servers returns the started servers
+func (r *ToolRegistry) Servers() []*MCPServer {
+	return r.servers
+}
+
+// Failed returns the errors of the servers that failed to start
+func (r *ToolRegistry) Failed() map[string]error {
+	return r.failed
+}
+
+// Tools returns the tools of all the servers,
+// with their names prefixed by the server name
+func (r *ToolRegistry) Tools() []mcp.Tool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tools := []mcp.Tool{}
+	for _, server := range r.servers {
+		for _, tool := range server.Tools {
+			tool.Name = server.Name + ToolNameSeparator + tool.Name
+			tools = append(tools, tool)
+		}
+	}
+	return tools
+}
+
+// ValidateArguments checks the arguments of a tool call with the input schema
+// of the tool (unknown tools are reported by CallTool)
+func (r *ToolRegistry) ValidateArguments(name string, arguments map[string]interface{}) error {
+	tool, ok := r.tool(name)
+	if !ok {
+		return nil
+	}
+	return ValidateToolArguments(tool.InputSchema, arguments)
+}
+
+// CoerceArguments converts the arguments of a tool call to the types
+// of the input schema of the tool
+func (r *ToolRegistry) CoerceArguments(name string, arguments map[string]interface{}) map[string]interface{} {
+	tool, ok := r.tool(name)
+	if !ok {
+		return arguments
+	}
+	return CoerceToolArguments(tool.InputSchema, arguments)
+}
+
+// tool returns the definition of a namespaced tool (with the name of its server)
+func (r *ToolRegistry) tool(name string) (mcp.Tool, bool) {
+	server, toolName, ok := r.server(name)
+	if !ok {
+		return mcp.Tool{}, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, tool := range server.Tools {
+		if tool.Name == toolName {
+			return tool, true
+		}
+	}
+	return mcp.Tool{}, false
+}
+
+// Lookup returns the server name and the tool name of a namespaced tool
+func (r *ToolRegistry) Lookup(name string) (string, string, bool) {
+	server, toolName, ok := r.server(name)
+	if !ok {
+		return "", "", false
+	}
+	return server.Name, toolName, true
+}
+
+// server returns the server and the tool name of a namespaced tool
+func (r *ToolRegistry) server(name string) (*MCPServer, string, bool) {
+	r.mu.RLock()
+	server, ok := r.routes[name]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, "", false
+	}
+	return server, strings.TrimPrefix(name, server.Name+ToolNameSeparator), true
+}
+
+// CallTool calls a namespaced tool on the server that exposes it.
+// The call is cancelled after the timeout of the tool.
+func (r *ToolRegistry) CallTool(ctx context.Context, name string, arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	server, _, ok := r.server(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown tool %s", name)
+	}
+
+	request := mcp.CallToolRequest{
+		Request: mcp.Request{
+			Method: "tools/call",
+		},
+	}
+	request.Params.Name = strings.TrimPrefix(name, server.Name+ToolNameSeparator)
+	request.Params.Arguments = arguments
+	if err := r.policy.Check(name, arguments); err != nil {
+		r.audit.recordCall(withAuditDecision(ctx, AuditPolicyDenied), server.Name, request.Params.Name, arguments, nil, err, 0, false)
+		return nil, err
+	}
+
+	// identical calls within the cache TTL of the tool are not executed again
+	ttl := server.cacheTTL(request.Params.Name)
+	key := ""
+	if ttl > 0 && r.cache != nil {
+		key = toolCallKey(name, arguments)
+		if result, ok := r.cache.get(key); ok {
+			slog.Info("tool result from the cache", "tool", name)
+			r.audit.recordCall(ctx, server.Name, request.Params.Name, arguments, result, nil, 0, true)
+			return result, nil
+		}
+	}
+	if onProgress := progressHandler(ctx); onProgress != nil {
+		token, stop := server.watchProgress(onProgress)
+		defer stop()
+		request.Params.Meta = &mcp.Meta{ProgressToken: token}
+	}
+
+	ctx, span := startSpan(ctx, "mcp tools/call", spanKindClient, "mcp.server", server.Name, "mcp.tool", request.Params.Name)
+	timeout := server.callTimeout(request.Params.Name)
+	callCtx, cancel := withTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	result, err := server.callTool(callCtx, request)
+	if err != nil && errors.Is(callCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+		err = fmt.Errorf("the tool %s timed out after %s", name, timeout)
+	}
+	r.toolMetrics().recordToolCall(server.Name, request.Params.Name, time.Since(start), err != nil || result.IsError)
+	r.audit.recordCall(ctx, server.Name, request.Params.Name, arguments, result, err, time.Since(start), false)
+	if err == nil && result.IsError {
+		span.SetAttribute("mcp.tool.is_error", "true")
+	}
+	span.End(err)
+	if key != "" && err == nil && !result.IsError {
+		r.cache.put(key, result, ttl)
+	}
+	return result, err
+}
+
+// callTool calls the tool, the server is restarted if it crashed
+func (s *MCPServer) callTool(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	retry := s.Config.RetryPolicy()
+	for attempt := 0; ; attempt++ {
+		mcpClient, err := s.acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		result, err := mcpClient.CallTool(ctx, request)
+		s.release()
+		if err == nil {
+			return result, nil
+		}
+
+		// A cancelled call is not a crash of the server (it was told by notifications/cancelled)
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return nil, err
+		}
+		// An error returned by a working server is not retried,
+		// a crashed server is restarted, then the call is retried
+		if s.alive(mcpClient) {
+			return nil, err
+		}
+		if attempt >= retry.MaxRestarts {
+			return nil, fmt.Errorf("server %s is down: %w", s.Name, err)
+		}
+
+		slog.Warn("server is down, restarting it", "server", s.Name, "error", err)
+		if ctx.Err() != nil {
+			// Too late to retry this call, but the next calls will use a new process
+			// (the restart has its own initialize timeout)
+			s.restart(context.Background(), mcpClient)
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(time.Duration(retry.Delay)):
+		}
+		if restartErr := s.restart(ctx, mcpClient); restartErr != nil {
+			slog.Error("failed to restart the server", "server", s.Name, "error", restartErr)
+		}
+	}
+}
+
+// Prompts returns the prompts of all the servers,
+// with their names prefixed by the server name
+func (r *ToolRegistry) Prompts() []mcp.Prompt {
+	prompts := []mcp.Prompt{}
+	for _, server := range r.servers {
+		for _, prompt := range server.Prompts {
+			prompt.Name = server.Name + ToolNameSeparator + prompt.Name
+			prompts = append(prompts, prompt)
+		}
+	}
+	return prompts
+}
+
+// GetPrompt gets a namespaced prompt from the server that exposes it
+// and converts its messages for Ollama
+func (r *ToolRegistry) GetPrompt(ctx context.Context, name string, arguments map[string]string) ([]api.Message, error) {
+	server, ok := r.promptRoutes[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown prompt %s", name)
+	}
+	promptName := strings.TrimPrefix(name, server.Name+ToolNameSeparator)
+
+	missing := []string{}
+	for _, prompt := range server.Prompts {
+		if prompt.Name != promptName {
+			continue
+		}
+		for _, argument := range prompt.Arguments {
+			if _, ok := arguments[argument.Name]; argument.Required && !ok {
+				missing = append(missing, argument.Name)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("prompt %s: missing arguments: %s", name, strings.Join(missing, ", "))
+	}
+
+	request := mcp.GetPromptRequest{
+		Request: mcp.Request{
+			Method: "prompts/get",
+		},
+	}
+	request.Params.Name = promptName
+	request.Params.Arguments = arguments
+
+	ctx, cancel := withTimeout(ctx, time.Duration(server.timeouts.CallTool))
+	defer cancel()
+	mcpClient, err := server.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer server.release()
+	result, err := mcpClient.GetPrompt(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	return ConvertPromptMessages(result), nil
+}
+
+// Resources returns the resources of all the servers
+// (their URIs are not namespaced)
+func (r *ToolRegistry) Resources() []mcp.Resource {
+	resources := []mcp.Resource{}
+	for _, server := range r.servers {
+		resources = append(resources, server.Resources...)
+	}
+	return resources
+}
+
+// ReadResource reads a resource on the server that lists it. A URI that is not
+// listed (e.g. from a resource template) is asked to every server with
+// the resources capability.
+func (r *ToolRegistry) ReadResource(ctx context.Context, uri string) (ToolContent, error) {
+	candidates := []*MCPServer{}
+	for _, server := range r.servers {
+		for _, resource := range server.Resources {
+			if resource.URI == uri {
+				candidates = append(candidates, server)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		for _, server := range r.servers {
+			if server.readsResources {
+				candidates = append(candidates, server)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return ToolContent{}, fmt.Errorf("no server can read the resource %s", uri)
+	}
+
+	var err error
+	for _, server := range candidates {
+		var content ToolContent
+		if content, err = server.readResource(ctx, uri); err == nil {
+			return content, nil
+		}
+	}
+	return ToolContent{}, fmt.Errorf("failed to read the resource %s: %w", uri, err)
+}
+
+// readResource reads a resource of the server
+func (s *MCPServer) readResource(ctx context.Context, uri string) (ToolContent, error) {
+	request := mcp.ReadResourceRequest{
+		Request: mcp.Request{
+			Method: "resources/read",
+		},
+	}
+	request.Params.URI = uri
+
+	ctx, cancel := withTimeout(ctx, time.Duration(s.timeouts.CallTool))
+	defer cancel()
+	mcpClient, err := s.acquire(ctx)
+	if err != nil {
+		return ToolContent{}, err
+	}
+	defer s.release()
+	result, err := mcpClient.ReadResource(ctx, request)
+	if err != nil {
+		return ToolContent{}, err
+	}
+	return ConvertResourceContents(result), nil
+}
+
+// Close stops all the servers
+func (r *ToolRegistry) Close() {
+	select {
+	case <-r.done:
+	default:
+		close(r.done)
+	}
+	for _, server := range r.servers {
+		server.close()
+	}
+	if err := r.audit.Close(); err != nil {
+		slog.Warn("failed to close the audit log", "error", err)
+	}
+}
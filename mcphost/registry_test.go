@@ -0,0 +1,208 @@
+package mcphost
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// errCrash is returned by the tools of a test server that crash it:
+// the call gets no answer and the server refuses its next requests
+var errCrash = errors.New("crash")
+
+// testTool is a tool of a test server, its errors are JSON-RPC errors
+type testTool func(arguments map[string]interface{}) (string, error)
+
+// testServer is an MCP server of the streamable HTTP transport for the tests
+type testServer struct {
+	*httptest.Server
+	tools map[string]testTool
+	// schemas are the JSON input schemas of the tools, {"type": "object"} by default
+	schemas map[string]string
+	// initializations and calls count the initialize and tools/call requests
+	initializations atomic.Int64
+	calls           atomic.Int64
+
+	mu sync.Mutex
+	// downtime is the number of requests refused after a crash,
+	// down is the number of requests still refused
+	downtime int
+	down     int
+}
+
+// newTestServer starts a test server with the tools,
+// it is closed at the end of the test
+func newTestServer(t *testing.T, tools map[string]testTool) *testServer {
+	t.Helper()
+	server := &testServer{tools: tools}
+	server.Server = httptest.NewServer(server)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// config is the config of an http server of the host with a short retry delay
+func (s *testServer) config() MCPServerConfig {
+	return MCPServerConfig{
+		Transport: "http",
+		URL:       s.URL,
+		Retry:     &RetryPolicy{MaxRestarts: 1, Delay: Duration(time.Millisecond)},
+	}
+}
+
+func (s *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	down := s.down > 0
+	if down {
+		s.down--
+	}
+	s.mu.Unlock()
+	if down {
+		http.Error(w, "server down", http.StatusServiceUnavailable)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Params struct {
+			ProtocolVersion string                 `json:"protocolVersion"`
+			Name            string                 `json:"name"`
+			Arguments       map[string]interface{} `json:"arguments"`
+		} `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.ID == nil {
+		// a notification
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	response := map[string]interface{}{"jsonrpc": "2.0", "id": request.ID}
+	switch request.Method {
+	case "initialize":
+		s.initializations.Add(1)
+		// the server speaks the version of the client
+		response["result"] = map[string]interface{}{
+			"protocolVersion": request.Params.ProtocolVersion,
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+			"serverInfo":      map[string]interface{}{"name": "test", "version": "1.0.0"},
+		}
+	case "ping":
+		response["result"] = map[string]interface{}{}
+	case "tools/list":
+		tools := []interface{}{}
+		for name := range s.tools {
+			schema := json.RawMessage(`{"type": "object"}`)
+			if s.schemas[name] != "" {
+				schema = json.RawMessage(s.schemas[name])
+			}
+			tools = append(tools, map[string]interface{}{"name": name, "inputSchema": schema})
+		}
+		sort.Slice(tools, func(i, j int) bool {
+			return tools[i].(map[string]interface{})["name"].(string) < tools[j].(map[string]interface{})["name"].(string)
+		})
+		response["result"] = map[string]interface{}{"tools": tools}
+	case "tools/call":
+		s.calls.Add(1)
+		tool, ok := s.tools[request.Params.Name]
+		if !ok {
+			response["error"] = map[string]interface{}{"code": -32602, "message": "unknown tool " + request.Params.Name}
+			break
+		}
+		text, err := tool(request.Params.Arguments)
+		if errors.Is(err, errCrash) {
+			s.mu.Lock()
+			s.down = s.downtime
+			s.mu.Unlock()
+			http.Error(w, "server crashed", http.StatusBadGateway)
+			return
+		}
+		if err != nil {
+			response["error"] = map[string]interface{}{"code": -32603, "message": err.Error()}
+			break
+		}
+		response["result"] = map[string]interface{}{
+			"content": []interface{}{map[string]interface{}{"type": "text", "text": text}},
+		}
+	default:
+		response["error"] = map[string]interface{}{"code": -32601, "message": "unknown method " + request.Method}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func TestCallToolRestart(t *testing.T) {
+	tests := []struct {
+		name string
+		tool string
+		// downtime is the number of requests refused after a crash
+		downtime        int
+		want            string
+		err             string
+		calls           int64
+		initializations int64
+	}{
+		{name: "working server", tool: "echo", want: "hello", calls: 1, initializations: 1},
+		{name: "error of a working server", tool: "broken", err: "out of order", calls: 1, initializations: 1},
+		{name: "restarted server", tool: "flaky", downtime: 1, want: "back", calls: 2, initializations: 2},
+		{name: "server down", tool: "flaky", downtime: 100, err: "server test is down", calls: 1, initializations: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			crashed := false
+			server := newTestServer(t, map[string]testTool{
+				"echo": func(arguments map[string]interface{}) (string, error) {
+					text, _ := arguments["text"].(string)
+					return text, nil
+				},
+				"broken": func(arguments map[string]interface{}) (string, error) {
+					return "", errors.New("out of order")
+				},
+				// flaky crashes the server on the first call
+				"flaky": func(arguments map[string]interface{}) (string, error) {
+					if !crashed {
+						crashed = true
+						return "", errCrash
+					}
+					return "back", nil
+				},
+			})
+			server.downtime = test.downtime
+			registry, err := NewToolRegistry(context.Background(), Config{
+				MCPServers: map[string]MCPServerConfig{"test": server.config()},
+			})
+			if err != nil {
+				t.Fatalf("NewToolRegistry: %v", err)
+			}
+			defer registry.Close()
+
+			result, err := registry.CallTool(context.Background(), "test."+test.tool, map[string]interface{}{"text": "hello"})
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("CallTool(%s) = %+v, %v, want an error with %q", test.tool, result, err, test.err)
+				}
+			} else if err != nil || NormalizeToolResult(result).Text != test.want {
+				t.Errorf("CallTool(%s) = %+v, %v, want %q", test.tool, result, err, test.want)
+			}
+			if server.calls.Load() != test.calls || server.initializations.Load() != test.initializations {
+				t.Errorf("%d calls and %d initializations, want %d and %d",
+					server.calls.Load(), server.initializations.Load(), test.calls, test.initializations)
+			}
+		})
+	}
+}
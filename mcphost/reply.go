@@ -0,0 +1,85 @@
+package mcphost
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultUpdateInterval is the default time between two edits of the
+// message of an answer streamed to a chat app (Slack, Discord)
+const DefaultUpdateInterval = time.Second
+
+// streamedReply is the text of an answer streamed to a chat app by editing
+// its message: the answer, or the running tool until the answer starts
+type streamedReply struct {
+	mu      sync.Mutex
+	answer  strings.Builder
+	status  string
+	changed bool
+}
+
+// token adds a token of the answer
+func (r *streamedReply) token(token string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.answer.WriteString(token)
+	r.changed = true
+}
+
+// event shows the tool calls of the turn (the OnEvent of the agent)
+func (r *streamedReply) event(event Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch event.Type {
+	case EventToolCall:
+		r.status = fmt.Sprintf("🔧 `%s`…", event.Tool)
+	case EventPlan:
+		r.status = "📋 " + event.Content
+	default:
+		return
+	}
+	r.changed = true
+}
+
+// pending returns the text of the reply and whether it changed since the last call
+func (r *streamedReply) pending() (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	changed := r.changed
+	r.changed = false
+	if r.answer.Len() > 0 {
+		return r.answer.String(), changed
+	}
+	return r.status, changed
+}
+
+// stream calls edit with the text of the reply when it changed, at most once
+// per interval (DefaultUpdateInterval when it is 0), until stop is called
+func (r *streamedReply) stream(interval time.Duration, edit func(text string)) (stop func()) {
+	if interval <= 0 {
+		interval = DefaultUpdateInterval
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if text, changed := r.pending(); changed {
+					edit(text)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
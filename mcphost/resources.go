@@ -0,0 +1,43 @@
+package mcphost
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+)
+
+// resourceMention matches the "@<uri>" mentions of a prompt (e.g. "@file:///README.md"),
+// the @ must start a word so that the email addresses are not matched
+var resourceMention = regexp.MustCompile(`(?:^|\s)@([a-zA-Z][a-zA-Z0-9+.-]*://\S+)`)
+
+// ResourceMentions returns the URIs mentioned in the prompt, without duplicates
+func ResourceMentions(prompt string) []string {
+	uris := []string{}
+	seen := map[string]bool{}
+	for _, match := range resourceMention.FindAllStringSubmatch(prompt, -1) {
+		// a mention can end a sentence
+		uri := strings.TrimRight(match[1], ".,;:!?)")
+		if !seen[uri] {
+			seen[uri] = true
+			uris = append(uris, uri)
+		}
+	}
+	return uris
+}
+
+// ExpandResourceMentions reads the resources mentioned in the prompt
+// and returns a user message with their contents after the prompt
+func (r *ToolRegistry) ExpandResourceMentions(ctx context.Context, prompt string) (api.Message, error) {
+	message := api.Message{Role: "user", Content: prompt}
+	for _, uri := range ResourceMentions(prompt) {
+		content, err := r.ReadResource(ctx, uri)
+		if err != nil {
+			return message, err
+		}
+		message.Content += "\n\n" + content.Text
+		message.Images = append(message.Images, content.Images...)
+	}
+	return message, nil
+}
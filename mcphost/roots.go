@@ -0,0 +1,37 @@
+package mcphost
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// ListRoots returns the roots of the server (the answer to roots/list):
+// the directories given in the config, with their ${VAR} references
+// expanded, as absolute file:// URIs
+func (c MCPServerConfig) ListRoots() ([]mcp.Root, error) {
+	roots := []mcp.Root{}
+	for _, root := range c.Roots {
+		expanded, err := expandEnv(root)
+		if err != nil {
+			return nil, fmt.Errorf("roots: %w", err)
+		}
+		path, err := filepath.Abs(expanded)
+		if err != nil {
+			return nil, fmt.Errorf("roots: %w", err)
+		}
+		uri := url.URL{Scheme: "file", Path: filepath.ToSlash(path)}
+		roots = append(roots, mcp.Root{URI: uri.String(), Name: filepath.Base(path)})
+	}
+	return roots, nil
+}
+
+// ServerRoots returns the roots of a server: its own roots, then the global ones
+func (c Config) ServerRoots(name string) []string {
+	if roots := c.MCPServers[name].Roots; len(roots) > 0 {
+		return roots
+	}
+	return c.Roots
+}
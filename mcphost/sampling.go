@@ -0,0 +1,101 @@
+package mcphost
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/ollama/ollama/api"
+)
+
+// Sampler answers the sampling requests of the servers (sampling/createMessage)
+// with a completion of a model of the host
+type Sampler func(ctx context.Context, server *MCPServer, request mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error)
+
+// SetSampler sets the sampler of the servers with the sampling option
+// (NewHost uses Host.Sample)
+func (r *ToolRegistry) SetSampler(sampler Sampler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sampler = sampler
+}
+
+func (r *ToolRegistry) sample(ctx context.Context, server *MCPServer, request mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error) {
+	r.mu.RLock()
+	sampler := r.sampler
+	r.mu.RUnlock()
+	if sampler == nil {
+		return nil, fmt.Errorf("the host does not answer the sampling requests")
+	}
+	return sampler(ctx, server, request)
+}
+
+// Sample answers a sampling request of a server with a completion of the
+// model matching its preferences, once approved like the tools of the server
+func (h *Host) Sample(ctx context.Context, server *MCPServer, request mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error) {
+	model := h.SamplingModel(ctx, request.ModelPreferences)
+	messages := ConvertSamplingMessages(request.Messages)
+	if request.SystemPrompt != "" {
+		messages = append([]api.Message{{Role: "system", Content: request.SystemPrompt}}, messages...)
+	}
+	if h.Approver != nil && !h.Approver.ApproveSampling(server, model, messages) {
+		return nil, fmt.Errorf("the user denied the sampling request")
+	}
+
+	options := h.ModelOptionsOf(model)
+	if request.Temperature > 0 {
+		options["temperature"] = request.Temperature
+	}
+	if request.MaxTokens > 0 {
+		options["num_predict"] = request.MaxTokens
+	}
+	if len(request.StopSequences) > 0 {
+		options["stop"] = request.StopSequences
+	}
+
+	slog.Info("sampling request", "server", server.Name, "model", model, "messages", len(messages))
+	answer, err := complete(ctx, h.Ollama, h.Metrics, model, messages, options, h.ChatTimeout, h.OllamaRetry, "sampling")
+	if err != nil {
+		return nil, err
+	}
+	return &mcp.CreateMessageResult{
+		SamplingMessage: mcp.SamplingMessage{
+			Role:    mcp.RoleAssistant,
+			Content: mcp.TextContent{Type: "text", Text: answer},
+		},
+		Model:      model,
+		StopReason: "endTurn",
+	}, nil
+}
+
+// SamplingModel chooses the model of a sampling request: the first
+// installed model matching a hint of the server (a part of its name),
+// otherwise the tools model when the server prefers the speed
+// to the intelligence, and the chat model by default
+func (h *Host) SamplingModel(ctx context.Context, preferences *mcp.ModelPreferences) string {
+	if preferences == nil {
+		return h.ChatModel
+	}
+	models := []string{h.ChatModel, h.ToolsModel}
+	if list, err := h.Ollama.List(ctx); err == nil {
+		for _, model := range list.Models {
+			models = append(models, model.Name)
+		}
+	}
+	for _, hint := range preferences.Hints {
+		if hint.Name == "" {
+			continue
+		}
+		for _, model := range models {
+			if strings.Contains(strings.ToLower(model), strings.ToLower(hint.Name)) {
+				return model
+			}
+		}
+	}
+	if preferences.SpeedPriority > preferences.IntelligencePriority && !h.SingleModel {
+		return h.ToolsModel
+	}
+	return h.ChatModel
+}
@@ -0,0 +1,278 @@
+package mcphost
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// scheduleWebhookTimeout is the timeout of the requests to the webhooks
+const scheduleWebhookTimeout = 30 * time.Second
+
+// ScheduleConfig is a task run by the daemon mode on a cron schedule:
+// a prompt asked to a new chat session (the models call the tools) or a
+// pipeline. The result is written to a file and/or posted to a webhook, e.g.
+//
+//	{"name": "digest", "cron": "0 8 * * mon-fri", "prompt": "Fetch ... and summarize it",
+//	 "output": "digests/{{.time.Format \"2006-01-02\"}}.md"}
+type ScheduleConfig struct {
+	Name string `json:"name"`
+	// Cron is the schedule: 5 fields (minute hour day-of-month month
+	// day-of-week), a shortcut (@daily, @hourly...) or "@every 30m"
+	Cron string `json:"cron"`
+	// Timezone of the schedule (the local time by default)
+	Timezone string `json:"timezone"`
+	// Prompt is asked to a chat session, or Pipeline (a file) is run with the Vars
+	Prompt   string            `json:"prompt"`
+	Pipeline string            `json:"pipeline"`
+	Vars     map[string]string `json:"vars"`
+	// Output is the file where the result is written, a template with
+	// the name and the time of the run (e.g. "{{.name}}-{{.time.Unix}}.md")
+	Output string `json:"output"`
+	// Append adds the results at the end of the Output file
+	Append bool `json:"append"`
+	// Webhook receives the results (a POST of a JSON object with the
+	// schedule, the time, the output and the error), with the Headers
+	// (their ${VAR} references are replaced)
+	Webhook string            `json:"webhook"`
+	Headers map[string]string `json:"headers"`
+	// Timeout of a run (no timeout by default)
+	Timeout Duration `json:"timeout"`
+}
+
+// ScheduleResult is the result of a run, posted to the webhook
+type ScheduleResult struct {
+	Schedule string    `json:"schedule"`
+	Time     time.Time `json:"time"`
+	Output   string    `json:"output"`
+	Error    string    `json:"error,omitempty"`
+	// DurationMs is the duration of the run in milliseconds
+	DurationMs int64 `json:"durationMs"`
+}
+
+// validateSchedules checks the schedules of the config
+func (c Config) validateSchedules() error {
+	names := map[string]bool{}
+	for i, schedule := range c.Schedules {
+		if schedule.Name == "" {
+			return fmt.Errorf("schedules: schedule %d: missing name", i)
+		}
+		if names[schedule.Name] {
+			return fmt.Errorf("schedules: duplicate schedule %s", schedule.Name)
+		}
+		names[schedule.Name] = true
+		if _, err := parseCron(schedule.Cron); err != nil {
+			return fmt.Errorf("schedules: %s: %w", schedule.Name, err)
+		}
+		if _, err := time.LoadLocation(schedule.Timezone); err != nil {
+			return fmt.Errorf("schedules: %s: invalid timezone: %w", schedule.Name, err)
+		}
+		switch {
+		case (schedule.Prompt == "") == (schedule.Pipeline == ""):
+			return fmt.Errorf("schedules: %s: a prompt or a pipeline is expected", schedule.Name)
+		case schedule.Output == "" && schedule.Webhook == "":
+			return fmt.Errorf("schedules: %s: an output or a webhook is expected", schedule.Name)
+		case len(schedule.Vars) > 0 && schedule.Pipeline == "":
+			return fmt.Errorf("schedules: %s: vars are only used by the pipelines", schedule.Name)
+		case schedule.Timeout < 0:
+			return fmt.Errorf("schedules: %s: negative timeout", schedule.Name)
+		}
+	}
+	return nil
+}
+
+// Scheduler runs the scheduled tasks of a host (the daemon mode)
+type Scheduler struct {
+	host      *Host
+	schedules []ScheduleConfig
+	client    *http.Client
+
+	// running are the names of the schedules being run: a run is skipped
+	// while the previous one is not over
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+// NewScheduler returns the scheduler of the tasks
+func NewScheduler(host *Host, schedules []ScheduleConfig) *Scheduler {
+	return &Scheduler{
+		host:      host,
+		schedules: schedules,
+		client:    &http.Client{Timeout: scheduleWebhookTimeout},
+		running:   map[string]bool{},
+	}
+}
+
+// Run runs the tasks on their schedules until the context is cancelled
+// (the runs in progress are cancelled too, Run waits for their end)
+func (s *Scheduler) Run(ctx context.Context) error {
+	if len(s.schedules) == 0 {
+		return fmt.Errorf("no schedules in the config")
+	}
+	var wg sync.WaitGroup
+	for _, schedule := range s.schedules {
+		cron, err := parseCron(schedule.Cron)
+		if err != nil {
+			return fmt.Errorf("schedule %s: %w", schedule.Name, err)
+		}
+		location, err := time.LoadLocation(schedule.Timezone)
+		if err != nil {
+			return fmt.Errorf("schedule %s: %w", schedule.Name, err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.loop(ctx, &wg, schedule, cron, location)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// loop waits for the next times of the schedule and starts the runs
+func (s *Scheduler) loop(ctx context.Context, wg *sync.WaitGroup, schedule ScheduleConfig, cron *cronSchedule, location *time.Location) {
+	for {
+		next := cron.next(time.Now().In(location))
+		if next.IsZero() {
+			slog.Warn("the schedule never runs", "schedule", schedule.Name, "cron", schedule.Cron)
+			return
+		}
+		slog.Info("next scheduled run", "schedule", schedule.Name, "time", next)
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		s.mu.Lock()
+		busy := s.running[schedule.Name]
+		s.running[schedule.Name] = true
+		s.mu.Unlock()
+		if busy {
+			slog.Warn("the previous run is not over, the run is skipped", "schedule", schedule.Name)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.RunNow(ctx, schedule)
+			s.mu.Lock()
+			delete(s.running, schedule.Name)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// RunNow runs the task of the schedule and delivers its result
+func (s *Scheduler) RunNow(ctx context.Context, schedule ScheduleConfig) ScheduleResult {
+	start := time.Now()
+	result := ScheduleResult{Schedule: schedule.Name, Time: start}
+	slog.Info("scheduled run", "schedule", schedule.Name)
+
+	runCtx, cancel := withTimeout(ctx, time.Duration(schedule.Timeout))
+	output, err := s.run(runCtx, schedule)
+	cancel()
+	result.Output, result.DurationMs = output, time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		slog.Error("scheduled run failed", "schedule", schedule.Name, "error", err)
+	} else {
+		slog.Info("scheduled run done", "schedule", schedule.Name, "duration", time.Since(start).Round(time.Millisecond))
+	}
+
+	if schedule.Output != "" && err == nil {
+		if err := writeScheduleOutput(schedule, result); err != nil {
+			slog.Error("failed to write the result of the scheduled run", "schedule", schedule.Name, "error", err)
+		}
+	}
+	if schedule.Webhook != "" {
+		// the result of a run cancelled by the end of the daemon is still posted
+		if err := postJSON(context.WithoutCancel(ctx), s.client, schedule.Webhook, schedule.Headers, result); err != nil {
+			slog.Error("failed to post the result of the scheduled run", "schedule", schedule.Name, "error", err)
+		}
+	}
+	return result
+}
+
+// run asks the prompt to a new session or runs the pipeline
+func (s *Scheduler) run(ctx context.Context, schedule ScheduleConfig) (string, error) {
+	if schedule.Pipeline != "" {
+		// the file is read at each run: it can be changed while the daemon runs
+		pipeline, err := LoadPipeline(schedule.Pipeline)
+		if err != nil {
+			return "", err
+		}
+		return s.host.RunPipeline(ctx, pipeline, schedule.Vars)
+	}
+	session := s.host.NewSession()
+	return session.Ask(ctx, schedule.Prompt, func(string) {})
+}
+
+// writeScheduleOutput writes (or appends) the output of a run to its file
+func writeScheduleOutput(schedule ScheduleConfig, result ScheduleResult) error {
+	path, err := renderTemplate("output", schedule.Output, map[string]interface{}{"name": schedule.Name, "time": result.Time})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	content := result.Output + "\n"
+	if schedule.Append {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		content = fmt.Sprintf("## %s %s\n\n%s\n\n", schedule.Name, result.Time.Format(time.RFC3339), result.Output)
+	}
+	file, err := os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteString(content); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// postJSON posts the JSON of the value to the URL with the headers
+// (the ${VAR} references of the URL and of the headers are replaced)
+func postJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, value interface{}) error {
+	url, err := expandEnv(url)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		expanded, err := expandEnv(value)
+		if err != nil {
+			return fmt.Errorf("header %s: %w", name, err)
+		}
+		request.Header.Set(name, expanded)
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("%s answered %s", url, response.Status)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package mcphost
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// ValidateJSONAnswer checks that the answer of a model is JSON and,
+// when format is a JSON schema (and not just "json"), that it follows the schema.
+// Only the common keywords are checked: type, properties, required, items and enum.
+func ValidateJSONAnswer(format json.RawMessage, answer string) error {
+	var value interface{}
+	if err := json.Unmarshal([]byte(answer), &value); err != nil {
+		return fmt.Errorf("the answer is not JSON: %w", err)
+	}
+
+	var schema map[string]interface{}
+	if err := json.Unmarshal(format, &schema); err != nil {
+		// "json" format: any JSON value is valid
+		return nil
+	}
+	return validateSchema(schema, value, "$")
+}
+
+// ValidateToolArguments checks the arguments of a tool call with the input schema
+// of the tool: the required arguments, and the type and enum of each argument.
+// All the errors are returned, so that the model can fix them in one call.
+func ValidateToolArguments(schema mcp.ToolInputSchema, arguments map[string]interface{}) error {
+	// The arguments are compared with the schema as JSON values
+	var values map[string]interface{}
+	data, err := json.Marshal(arguments)
+	if err != nil {
+		return fmt.Errorf("the arguments are not JSON: %w", err)
+	}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("the arguments are not JSON: %w", err)
+	}
+
+	errs := []error{}
+	for _, name := range schema.Required {
+		if _, ok := values[name]; !ok {
+			errs = append(errs, fmt.Errorf("missing required argument %s", name))
+		}
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if property, ok := schema.Properties[name].(map[string]interface{}); ok {
+			if err := validateSchema(property, values[name], name); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func validateSchema(schema map[string]interface{}, value interface{}, path string) error {
+	if types := schemaTypes(schema["type"]); len(types) > 0 {
+		matched := false
+		for _, schemaType := range types {
+			if jsonTypeMatches(schemaType, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s: expected %s", path, strings.Join(types, " or "))
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			if fmt.Sprint(allowed) == fmt.Sprint(value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: %v is not one of %v", path, value, enum)
+		}
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if _, ok := value[fmt.Sprint(name)]; !ok {
+					return fmt.Errorf("%s: missing property %v", path, name)
+				}
+			}
+		}
+		if properties, ok := schema["properties"].(map[string]interface{}); ok {
+			names := make([]string, 0, len(value))
+			for name := range value {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				if property, ok := properties[name].(map[string]interface{}); ok {
+					if err := validateSchema(property, value[name], path+"."+name); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range value {
+				if err := validateSchema(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func jsonTypeMatches(schemaType string, value interface{}) bool {
+	switch value := value.(type) {
+	case nil:
+		return schemaType == "null"
+	case bool:
+		return schemaType == "boolean"
+	case string:
+		return schemaType == "string"
+	case float64:
+		return schemaType == "number" || (schemaType == "integer" && value == math.Trunc(value))
+	case []interface{}:
+		return schemaType == "array"
+	case map[string]interface{}:
+		return schemaType == "object"
+	}
+	return false
+}
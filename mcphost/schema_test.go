@@ -0,0 +1,99 @@
+package mcphost
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestValidateToolArguments(t *testing.T) {
+	schema := mcp.ToolInputSchema{Type: "object", Required: []string{"city"}}
+	properties := `{
+		"city": {"type": "string"},
+		"days": {"type": "integer"},
+		"unit": {"type": "string", "enum": ["c", "f"]},
+		"limit": {"type": ["integer", "null"]},
+		"tags": {"type": "array", "items": {"type": "string"}},
+		"page": {"type": "object", "properties": {"url": {"type": "string"}}, "required": ["url"]}
+	}`
+	if err := json.Unmarshal([]byte(properties), &schema.Properties); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		arguments map[string]interface{}
+		want      string
+	}{
+		{name: "valid", arguments: map[string]interface{}{"city": "Lyon", "days": 3, "unit": "c", "tags": []string{"a"}}},
+		{name: "unknown argument", arguments: map[string]interface{}{"city": "Lyon", "other": true}},
+		{name: "list of types", arguments: map[string]interface{}{"city": "Lyon", "limit": nil}},
+		{name: "missing required", arguments: map[string]interface{}{"days": 3}, want: "missing required argument city"},
+		{name: "wrong type", arguments: map[string]interface{}{"city": 42}, want: "city: expected string"},
+		{name: "not an integer", arguments: map[string]interface{}{"city": "Lyon", "days": 2.5}, want: "days: expected integer"},
+		{name: "enum", arguments: map[string]interface{}{"city": "Lyon", "unit": "k"}, want: "unit: k is not one of [c f]"},
+		{name: "array item", arguments: map[string]interface{}{"city": "Lyon", "tags": []interface{}{"a", 1}}, want: "tags[1]: expected string"},
+		{name: "nested property", arguments: map[string]interface{}{"city": "Lyon", "page": map[string]interface{}{"url": 1}}, want: "page.url: expected string"},
+		{name: "nested required", arguments: map[string]interface{}{"city": "Lyon", "page": map[string]interface{}{}}, want: "page: missing property url"},
+		{
+			name:      "all the errors",
+			arguments: map[string]interface{}{"days": "3", "unit": "k"},
+			want:      "missing required argument city\ndays: expected integer\nunit: k is not one of [c f]",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateToolArguments(schema, test.arguments)
+			switch {
+			case test.want == "" && err != nil:
+				t.Errorf("ValidateToolArguments() = %v, want no error", err)
+			case test.want != "" && (err == nil || err.Error() != test.want):
+				t.Errorf("ValidateToolArguments() = %v, want %q", err, test.want)
+			}
+		})
+	}
+}
+
+// newMathRegistry returns a registry with the add tool of a math test server,
+// the tool fails when it is called
+func newMathRegistry(t *testing.T) (*ToolRegistry, *testServer) {
+	t.Helper()
+	server := newTestServer(t, map[string]testTool{
+		"add": func(arguments map[string]interface{}) (string, error) {
+			return "", errors.New("add called")
+		},
+	})
+	server.schemas = map[string]string{
+		"add": `{"type": "object", "properties": {"a": {"type": "number"}, "b": {"type": "number"}}, "required": ["a", "b"]}`,
+	}
+	registry, err := NewToolRegistry(context.Background(), Config{
+		MCPServers: map[string]MCPServerConfig{"math": server.config()},
+	})
+	if err != nil {
+		t.Fatalf("NewToolRegistry: %v", err)
+	}
+	t.Cleanup(registry.Close)
+	return registry, server
+}
+
+func TestRegistryValidateArguments(t *testing.T) {
+	registry, server := newMathRegistry(t)
+
+	if err := registry.ValidateArguments("math.add", map[string]interface{}{"a": 2, "b": 3}); err != nil {
+		t.Errorf("ValidateArguments(math.add) = %v, want no error", err)
+	}
+	err := registry.ValidateArguments("math.add", map[string]interface{}{"a": "two"})
+	if want := "missing required argument b\na: expected number"; err == nil || err.Error() != want {
+		t.Errorf("ValidateArguments(math.add) = %v, want %q", err, want)
+	}
+	// the unknown tools are reported by CallTool
+	if err := registry.ValidateArguments("math.sub", map[string]interface{}{"a": "two"}); err != nil {
+		t.Errorf("ValidateArguments(math.sub) = %v, want no error", err)
+	}
+	if server.calls.Load() != 0 {
+		t.Errorf("%d calls of the tools, want 0", server.calls.Load())
+	}
+}
@@ -0,0 +1,170 @@
+package mcphost
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ChatServer exposes the host over HTTP.
+// POST /chat with {"prompt": "..."} runs a turn of a chat session: the tools are
+// executed server side and the answer is streamed with server-sent events
+// (tool_call, tool_result and token events, then done or error).
+// With a format, the answer of the done event is validated JSON.
+// The id of the session is in the X-Session-ID header and the done event:
+// the next prompts with this session_id continue the conversation
+// (one prompt at a time per session), DELETE /chat/{id} ends it.
+// GET /ws?session_id=... streams the events of a session over a WebSocket
+// and receives the prompts, the interruptions and the approvals of the tool
+// calls (see WebSocketMessage).
+// GET / is a chat page using the WebSocket (see webui/index.html).
+// GET /metrics exposes the metrics of the host for Prometheus.
+// POST /mcp serves the host as an MCP server (see Gateway).
+// POST /hooks/{name} runs the hook of the name (see HookConfig).
+type ChatServer struct {
+	Host *Host
+	// Timeout of a chat request (0 means no timeout)
+	Timeout time.Duration
+	// Sessions keeps the sessions between the requests
+	Sessions *SessionPool
+	// Auth, if set, requires an API key for all the requests but the chat page
+	// (and the hooks checking the signatures of their payloads)
+	Auth *APIKeyAuth
+	// Hooks are the webhook triggers by name
+	Hooks map[string]HookConfig
+	// AllowedOrigins are the origins of the other web pages allowed
+	// to call the server (see OriginCheck)
+	AllowedOrigins []string
+}
+
+// ChatRequest is the body of a POST /chat request
+type ChatRequest struct {
+	Prompt string `json:"prompt"`
+	// SessionID continues a session (a new session is created without it)
+	SessionID string `json:"session_id,omitempty"`
+	// Format overrides the answer format of the host ("json" or a JSON schema)
+	Format json.RawMessage `json:"format,omitempty"`
+}
+
+// NewChatServer creates an HTTP server for the host
+func NewChatServer(host *Host, timeout time.Duration) *ChatServer {
+	return &ChatServer{
+		Host:     host,
+		Timeout:  timeout,
+		Sessions: NewSessionPool(host, DefaultMaxSessions, DefaultSessionIdleTimeout),
+	}
+}
+
+// Handler returns the HTTP handler of the server
+func (s *ChatServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /chat", s.handleChat)
+	mux.HandleFunc("DELETE /chat/{id}", s.handleEndSession)
+	mux.HandleFunc("GET /ws", s.handleWebSocket)
+	mux.Handle("GET /metrics", s.Host.Metrics.Handler())
+	mux.Handle("POST /mcp", NewGateway(s.Host))
+	mux.HandleFunc("POST /hooks/{name}", s.handleHook)
+	if s.Auth == nil {
+		mux.HandleFunc("GET /{$}", s.handleWebUI)
+		return OriginCheck(s.AllowedOrigins, mux)
+	}
+	// the chat page is public, it sends the access_token of its URL
+	root := http.NewServeMux()
+	root.HandleFunc("GET /{$}", s.handleWebUI)
+	// the hooks with a secret check the signatures instead of the API keys
+	// (e.g. for the webhooks of GitHub)
+	for name, hook := range s.Hooks {
+		if hook.SecretEnv != "" {
+			root.HandleFunc("POST /hooks/"+name, s.handleHook)
+		}
+	}
+	root.Handle("/", s.Auth.Handler(mux))
+	return OriginCheck(s.AllowedOrigins, root)
+}
+
+func (s *ChatServer) handleChat(w http.ResponseWriter, r *http.Request) {
+	var request ChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Prompt == "" {
+		http.Error(w, "the body must be a JSON object with a prompt", http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	session, release, ok := s.acquireSession(w, r, request.SessionID)
+	if !ok {
+		return
+	}
+	defer release()
+
+	w.Header().Set("X-Session-ID", session.ID)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	send := func(event Event) {
+		data, _ := json.Marshal(event)
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+		flusher.Flush()
+	}
+
+	ctx := r.Context()
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+
+	// the events and the format are the ones of this request
+	session.Agent.OnEvent = send
+	defer func() { session.Agent.OnEvent = nil }()
+	session.Format = s.Host.Format
+	if request.Format != nil {
+		session.Format = request.Format
+	}
+
+	answer, err := session.Ask(ctx, request.Prompt, func(token string) {
+		send(Event{Type: EventToken, Content: token})
+	})
+	if err != nil {
+		send(Event{Type: EventError, Error: err.Error()})
+		return
+	}
+	useTokens(ctx, request.Prompt, answer)
+	send(Event{Type: EventDone, Content: answer, Session: session.ID})
+}
+
+// acquireSession returns the session of a request, the errors are answered
+func (s *ChatServer) acquireSession(w http.ResponseWriter, r *http.Request, id string) (*ChatSession, func(), bool) {
+	session, release, err := s.Sessions.Acquire(id, apiKeyName(r.Context()))
+	switch {
+	case errors.Is(err, ErrSessionOwner):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return nil, nil, false
+	case errors.Is(err, ErrSessionBusy):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return nil, nil, false
+	case errors.Is(err, ErrTooManySessions):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return nil, nil, false
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return nil, nil, false
+	}
+	return session, release, true
+}
+
+func (s *ChatServer) handleEndSession(w http.ResponseWriter, r *http.Request) {
+	if !s.Sessions.Remove(r.PathValue("id"), apiKeyName(r.Context())) {
+		http.Error(w, "unknown or busy session", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,73 @@
+package mcphost
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// DefaultServerLogLevel is the minimum level of the log messages of the servers
+const DefaultServerLogLevel = mcp.LoggingLevelInfo
+
+// loggingLevels are the severities of the MCP log levels (syslog order)
+// and the levels of the host logger
+var loggingLevels = map[mcp.LoggingLevel]struct {
+	severity int
+	level    slog.Level
+}{
+	mcp.LoggingLevelDebug:     {0, slog.LevelDebug},
+	mcp.LoggingLevelInfo:      {1, slog.LevelInfo},
+	mcp.LoggingLevelNotice:    {2, slog.LevelInfo},
+	mcp.LoggingLevelWarning:   {3, slog.LevelWarn},
+	mcp.LoggingLevelError:     {4, slog.LevelError},
+	mcp.LoggingLevelCritical:  {5, slog.LevelError},
+	mcp.LoggingLevelAlert:     {6, slog.LevelError},
+	mcp.LoggingLevelEmergency: {7, slog.LevelError},
+}
+
+// logLevel returns the minimum level of the log messages of the server
+func (s *MCPServer) logLevel() mcp.LoggingLevel {
+	if s.Config.LogLevel == "" {
+		return DefaultServerLogLevel
+	}
+	return s.Config.LogLevel
+}
+
+// setLogLevel asks the server to send the messages of its minimum level
+// (logging/setLevel), the messages below it are dropped anyway
+func (s *MCPServer) setLogLevel(ctx context.Context, mcpClient MCPClient) {
+	request := mcp.SetLevelRequest{Request: mcp.Request{Method: "logging/setLevel"}}
+	request.Params.Level = s.logLevel()
+	if err := mcpClient.SetLevel(ctx, request); err != nil {
+		slog.Warn("failed to set the log level of the server", "server", s.Name, "error", err)
+	}
+}
+
+// log writes a log message of the server (notifications/message)
+// with the host logger, the message is prefixed with the server name
+func (s *MCPServer) log(notification mcp.JSONRPCNotification) {
+	fields := notification.Params.AdditionalFields
+	level, _ := fields["level"].(string)
+	known, ok := loggingLevels[mcp.LoggingLevel(level)]
+	if !ok {
+		known = loggingLevels[mcp.LoggingLevelInfo]
+	}
+	if known.severity < loggingLevels[s.logLevel()].severity {
+		return
+	}
+
+	// the data is a string or any JSON value
+	message, isString := fields["data"].(string)
+	if !isString {
+		data, _ := json.Marshal(fields["data"])
+		message = string(data)
+	}
+	attributes := []any{"server", s.Name, "level", level}
+	if logger, _ := fields["logger"].(string); logger != "" {
+		attributes = append(attributes, "logger", logger)
+	}
+	slog.Log(context.Background(), known.level, fmt.Sprintf("[%s] %s", s.Name, message), attributes...)
+}
@@ -0,0 +1,239 @@
+package mcphost
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+// Types of the messages of the clients of the /ws endpoint
+const (
+	// WebSocketPrompt starts a turn with the prompt
+	WebSocketPrompt = "prompt"
+	// WebSocketInterrupt cancels the running turn
+	WebSocketInterrupt = "interrupt"
+	// WebSocketCancelTools cancels the running tool calls (not the turn)
+	WebSocketCancelTools = "cancel_tools"
+	// WebSocketApproval answers an approval event
+	WebSocketApproval = "approval"
+)
+
+// WebSocketMessage is a message sent by a client of the /ws endpoint
+type WebSocketMessage struct {
+	Type   string `json:"type"`
+	Prompt string `json:"prompt,omitempty"`
+	// ID and Answer (yes, no or always) answer the approval event of the id
+	ID     string `json:"id,omitempty"`
+	Answer string `json:"answer,omitempty"`
+}
+
+// Limits of the WebSocket connections
+const (
+	// maxWebSocketMessage is the maximum size of a message sent by the peer
+	maxWebSocketMessage = 1 << 20
+	// webSocketWriteTimeout is the time given to the peer to read a message
+	webSocketWriteTimeout = 10 * time.Second
+)
+
+// webSocketChat is a WebSocket connection of a chat session: the events of
+// the turns are sent down, the prompts, the interruptions and the answers
+// of the approvals come up. It runs one turn at a time.
+type webSocketChat struct {
+	ws      *websocket.Conn
+	session *ChatSession
+	timeout time.Duration
+
+	mu sync.Mutex
+	// turn is the context of the running turn and cancel cancels it
+	// (nil between the turns)
+	turn   context.Context
+	cancel context.CancelFunc
+	// approvals are the pending approvals by id
+	approvals map[string]chan string
+	lastID    int
+}
+
+// handleWebSocket serves the session of the session_id parameter
+// (or a new session) over a WebSocket
+func (s *ChatServer) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	session, release, ok := s.acquireSession(w, r, r.URL.Query().Get("session_id"))
+	if !ok {
+		return
+	}
+	defer release()
+	// the handshakes of the browsers of the other origins are refused
+	ws, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		slog.Warn("failed to open the WebSocket", "error", err)
+		return
+	}
+	defer ws.CloseNow()
+	ws.SetReadLimit(maxWebSocketMessage)
+
+	chat := &webSocketChat{ws: ws, session: session, timeout: s.Timeout, approvals: map[string]chan string{}}
+	// the events and the approvals of the session go to this connection
+	approver, format := session.Agent.Approver, session.Format
+	session.Agent.OnEvent = chat.send
+	session.Agent.Approver = NewRemoteApprover(chat.ask)
+	session.Format = s.Host.Format
+	defer func() {
+		session.Agent.OnEvent, session.Agent.Approver, session.Format = nil, approver, format
+	}()
+
+	chat.send(Event{Type: EventSession, Session: session.ID})
+	chat.serve(r.Context())
+}
+
+// serve reads the messages of the client until the connection is closed
+// (or ctx is cancelled: the connection is then closed), the running turn
+// is then cancelled
+func (c *webSocketChat) serve(ctx context.Context) {
+	var wg sync.WaitGroup
+	defer func() {
+		c.interrupt()
+		wg.Wait()
+	}()
+	for {
+		_, data, err := c.ws.Read(ctx)
+		if err != nil {
+			if websocket.CloseStatus(err) == -1 && ctx.Err() == nil {
+				slog.Warn("failed to read the WebSocket", "session", c.session.ID, "error", err)
+			}
+			return
+		}
+		var message WebSocketMessage
+		if err := json.Unmarshal(data, &message); err != nil {
+			c.send(Event{Type: EventError, Error: "invalid message: " + err.Error()})
+			continue
+		}
+
+		switch message.Type {
+		case WebSocketPrompt:
+			if err := rateLimited(ctx); err != nil {
+				c.send(Event{Type: EventError, Error: err.Error()})
+				continue
+			}
+			turnCtx, ok := c.startTurn(ctx)
+			if !ok {
+				c.send(Event{Type: EventError, Error: ErrSessionBusy.Error()})
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c.runTurn(turnCtx, message.Prompt)
+			}()
+		case WebSocketInterrupt:
+			c.interrupt()
+		case WebSocketCancelTools:
+			c.session.Agent.CancelToolCalls()
+		case WebSocketApproval:
+			c.answer(message.ID, message.Answer)
+		default:
+			c.send(Event{Type: EventError, Error: "unknown message type " + message.Type})
+		}
+	}
+}
+
+// startTurn returns the context of a new turn, false when a turn is running
+func (c *webSocketChat) startTurn(ctx context.Context) (context.Context, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cancel != nil {
+		return nil, false
+	}
+	if c.timeout > 0 {
+		ctx, c.cancel = context.WithTimeout(ctx, c.timeout)
+	} else {
+		ctx, c.cancel = context.WithCancel(ctx)
+	}
+	c.turn = ctx
+	return ctx, true
+}
+
+// runTurn answers the prompt, then ends the turn
+func (c *webSocketChat) runTurn(ctx context.Context, prompt string) {
+	answer, err := c.session.Ask(ctx, prompt, func(token string) {
+		c.send(Event{Type: EventToken, Content: token})
+	})
+
+	c.mu.Lock()
+	c.cancel()
+	c.turn, c.cancel = nil, nil
+	c.mu.Unlock()
+
+	if err != nil {
+		c.send(Event{Type: EventError, Error: err.Error()})
+		return
+	}
+	useTokens(ctx, prompt, answer)
+	c.send(Event{Type: EventDone, Content: answer, Session: c.session.ID})
+}
+
+// interrupt cancels the running turn (its pending approvals are denied)
+func (c *webSocketChat) interrupt() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cancel != nil {
+		c.cancel()
+	}
+}
+
+// ask sends an approval event and waits for its answer
+// (the approval is denied when the turn is interrupted)
+func (c *webSocketChat) ask(question string) string {
+	answer := make(chan string, 1)
+	c.mu.Lock()
+	turn := c.turn
+	c.lastID++
+	id := strconv.Itoa(c.lastID)
+	c.approvals[id] = answer
+	c.mu.Unlock()
+	if turn == nil {
+		return "no"
+	}
+	defer func() {
+		c.mu.Lock()
+		delete(c.approvals, id)
+		c.mu.Unlock()
+	}()
+
+	c.send(Event{Type: EventApproval, ID: id, Content: question})
+	select {
+	case result := <-answer:
+		return result
+	case <-turn.Done():
+		return "no"
+	}
+}
+
+// answer sends the answer of the client to the pending approval of the id
+func (c *webSocketChat) answer(id string, answer string) {
+	c.mu.Lock()
+	pending, ok := c.approvals[id]
+	c.mu.Unlock()
+	if !ok {
+		c.send(Event{Type: EventError, Error: "unknown approval " + id})
+		return
+	}
+	select {
+	case pending <- answer:
+	default:
+	}
+}
+
+// send sends an event to the client
+func (c *webSocketChat) send(event Event) {
+	data, _ := json.Marshal(event)
+	ctx, cancel := context.WithTimeout(context.Background(), webSocketWriteTimeout)
+	defer cancel()
+	if err := c.ws.Write(ctx, websocket.MessageText, data); err != nil {
+		slog.Debug("failed to write the WebSocket", "session", c.session.ID, "error", err)
+	}
+}
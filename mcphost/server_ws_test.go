@@ -0,0 +1,127 @@
+package mcphost
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+// testWebSocket is the client side of a WebSocket connection for the tests
+type testWebSocket struct {
+	conn *websocket.Conn
+}
+
+// dialTestWebSocket opens a WebSocket on the path of the server,
+// it is closed at the end of the test
+func dialTestWebSocket(t *testing.T, server *httptest.Server, path string) *testWebSocket {
+	t.Helper()
+	conn, _, err := websocket.Dial(context.Background(), "ws"+strings.TrimPrefix(server.URL, "http")+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.CloseNow() })
+	return &testWebSocket{conn: conn}
+}
+
+// send sends a message to the server
+func (c *testWebSocket) send(t *testing.T, message WebSocketMessage) {
+	t.Helper()
+	if err := wsjson.Write(context.Background(), c.conn, message); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// next returns the next event of one of the types (the other events are skipped)
+func (c *testWebSocket) next(t *testing.T, types ...string) Event {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for {
+		var event Event
+		if err := wsjson.Read(ctx, c.conn, &event); err != nil {
+			t.Fatalf("waiting for %v: %v", types, err)
+		}
+		for _, eventType := range types {
+			if event.Type == eventType {
+				return event
+			}
+		}
+	}
+}
+
+func TestWebSocketApproval(t *testing.T) {
+	tests := []struct {
+		name string
+		// answer is the answer of the approval, "" interrupts the turn instead
+		answer string
+		calls  int64
+		// want is the end of the turn: a done event with this content or an error
+		want string
+		err  string
+	}{
+		{name: "approved", answer: "yes", calls: 1, want: "Result: hello"},
+		{name: "denied", answer: "no", calls: 0, want: "Result: The user denied the execution of the tool test.echo."},
+		{name: "interrupted", calls: 0, err: "context canceled"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t, map[string]testTool{
+				"echo": func(arguments map[string]interface{}) (string, error) {
+					text, _ := arguments["text"].(string)
+					return text, nil
+				},
+			})
+			// the tools of the server need an approval
+			mock := &MockOllama{Fixture: MockFixture{Rules: toolCallRules(
+				MockToolCall{Name: "test.echo", Arguments: map[string]interface{}{"text": "hello"}},
+			)}}
+			host, err := NewHost(context.Background(), mock.Client(), Config{
+				MCPServers: map[string]MCPServerConfig{"test": server.config()},
+			})
+			if err != nil {
+				t.Fatalf("NewHost: %v", err)
+			}
+			t.Cleanup(host.Close)
+			chat := httptest.NewServer(NewChatServer(host, 0).Handler())
+			t.Cleanup(chat.Close)
+			ws := dialTestWebSocket(t, chat, "/ws")
+
+			if event := ws.next(t, EventSession); event.Session == "" {
+				t.Errorf("session event = %+v, want the id of the session", event)
+			}
+			ws.send(t, WebSocketMessage{Type: WebSocketPrompt, Prompt: "echo hello"})
+			approval := ws.next(t, EventApproval)
+			if approval.ID == "" || !strings.Contains(approval.Content, "test.echo") {
+				t.Errorf("approval event = %+v, want a question about test.echo", approval)
+			}
+			if test.answer == "" {
+				ws.send(t, WebSocketMessage{Type: WebSocketInterrupt})
+			} else {
+				ws.send(t, WebSocketMessage{Type: WebSocketApproval, ID: approval.ID, Answer: test.answer})
+			}
+
+			event := ws.next(t, EventDone, EventError)
+			if test.err != "" {
+				if event.Type != EventError || !strings.Contains(event.Error, test.err) {
+					t.Errorf("end of the turn = %+v, want an error with %q", event, test.err)
+				}
+			} else if event.Type != EventDone || event.Content != test.want {
+				t.Errorf("end of the turn = %+v, want the answer %q", event, test.want)
+			}
+			if server.calls.Load() != test.calls {
+				t.Errorf("%d calls of the tool, want %d", server.calls.Load(), test.calls)
+			}
+
+			// the approval is not pending anymore
+			ws.send(t, WebSocketMessage{Type: WebSocketApproval, ID: approval.ID, Answer: "yes"})
+			if event := ws.next(t, EventError); event.Error != "unknown approval "+approval.ID {
+				t.Errorf("error event = %+v, want an unknown approval", event)
+			}
+		})
+	}
+}
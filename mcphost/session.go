@@ -0,0 +1,347 @@
+package mcphost
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// ChatSession is a conversation with the models.
+// Each user prompt goes through the tool loop of the agent (tools model),
+// then the chat model answers using the results of the tools.
+// In single model mode, the agent uses the chat model and its last answer
+// is the answer of the session.
+type ChatSession struct {
+	// ID identifies the session in the store
+	ID        string
+	CreatedAt time.Time
+	// Store saves the session after each answer (nil disables the saving)
+	Store *SessionStore
+	// Owner is the name of the API key which created the session on the
+	// HTTP server (empty without keys), the other keys can not use it
+	Owner string
+
+	Agent       *Agent
+	Ollama      *api.Client
+	ChatModel   string
+	SingleModel bool
+	Options     map[string]interface{}
+	// ChatTimeout is the timeout of the completion of the chat model (0 means no timeout)
+	ChatTimeout time.Duration
+	// Retry tells how the failed completions are retried
+	Retry                   BackoffPolicy
+	SystemToolsInstructions string
+	SystemChatInstructions  string
+	// Thinking tells what to do with the reasoning of the thinking models
+	// ("" hides it), the reasoning is not part of the answer
+	Thinking ThinkingMode
+	// Format, if set, asks the chat model for a JSON answer:
+	// "json" or a JSON schema (the answer is validated)
+	Format json.RawMessage
+	// History contains the previous user prompts, tool calls, tool results and answers
+	History []api.Message
+	// CompactThreshold, if set, compacts the history after an answer
+	// when it is larger than this number of tokens (see Compact)
+	CompactThreshold int
+	// CompactKeepTurns is the number of recent turns kept by the compaction
+	CompactKeepTurns int
+	// Seed is the seed option of the models (nil for a random seed),
+	// it is saved with the session
+	Seed *int
+	// Memory, if set, recalls the turns of the previous sessions of the user
+	// and remembers the turns of the session
+	Memory *Memory
+	// Retriever, if set, gives the extracts of the local documents
+	// relevant to the prompts
+	Retriever *Retriever
+
+	// pending are the messages added before the next prompt
+	// (the updated contents of the watched resources)
+	pending []api.Message
+	// memories and documents are the memories and the extracts of the
+	// documents recalled for the current turn
+	memories  string
+	documents string
+}
+
+// AddResourceUpdates adds the contents of the watched resources updated
+// since the last call to the next turn (see ToolRegistry.Watch).
+// It returns the number of updated resources.
+func (s *ChatSession) AddResourceUpdates() int {
+	updates := s.Agent.Registry.ResourceUpdateMessages()
+	s.pending = append(s.pending, updates...)
+	return len(updates)
+}
+
+// SetSeed sets the seed option of the models of the session
+func (s *ChatSession) SetSeed(seed int) {
+	s.Seed = &seed
+	s.Options = MergeOptions(s.Options, map[string]interface{}{"seed": seed})
+	s.Agent.Options = MergeOptions(s.Agent.Options, map[string]interface{}{"seed": seed})
+}
+
+// Ask sends a user prompt to the session and returns the answer of the chat model.
+// The answer is streamed to onToken as it is generated.
+// The resources mentioned in the prompt ("@<uri>") are read and added to the message.
+func (s *ChatSession) Ask(ctx context.Context, prompt string, onToken func(string)) (string, error) {
+	message, err := s.Agent.Registry.ExpandResourceMentions(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+	return s.AskMessages(ctx, []api.Message{message}, onToken)
+}
+
+// AskMessages is Ask with several messages for the turn of the user
+// (e.g. the messages of an MCP prompt)
+func (s *ChatSession) AskMessages(ctx context.Context, turn []api.Message, onToken func(string)) (string, error) {
+	// The turn is the root span of the trace of its chat completions and tool calls
+	ctx, span := startSpan(ctx, "chat turn", spanKindInternal, "session.id", s.ID)
+	if len(s.pending) > 0 {
+		turn = append(s.pending, turn...)
+	}
+	s.recall(ctx, turn)
+	before := len(s.History)
+	// the history and the memory keep the placeholders of the masked values
+	flush := func() {}
+	if filter := s.Agent.PIIFilter; filter != nil && filter.Restore {
+		onToken, flush = filter.restoreStream(onToken)
+	}
+	answer, err := s.askMessages(ctx, turn, onToken)
+	flush()
+	if err == nil {
+		s.pending = nil
+		s.remember(ctx, s.History[before:], answer)
+		s.autoCompact(ctx)
+	}
+	span.End(err)
+	if filter := s.Agent.PIIFilter; filter != nil && filter.Restore {
+		answer = filter.RestoreText(answer)
+	}
+	return answer, err
+}
+
+func (s *ChatSession) askMessages(ctx context.Context, turn []api.Message, onToken func(string)) (string, error) {
+	if s.SingleModel {
+		return s.askSingleModel(ctx, turn, onToken)
+	}
+
+	// Have a "tool chat" with Ollama 🦙
+	messages := []api.Message{
+		{Role: "system", Content: s.system(s.SystemToolsInstructions)},
+	}
+	messages = append(messages, s.History...)
+	messages = append(messages, turn...)
+
+	conversation, toolResults, err := s.Agent.Run(ctx, messages)
+	// over the budget, the chat model answers with the results of the tools
+	if err != nil && !errors.Is(err, ErrBudgetExceeded) {
+		return "", err
+	}
+
+	for _, toolResult := range toolResults {
+		slog.Debug("tool result", "tool", toolResult.Name, "error", toolResult.IsError, "content", toolResult.Content)
+	}
+
+	// The chat model gets the turn of the tools model: the assistant messages
+	// with the tool calls, followed by the "tool" messages with the results.
+	// The last message of the tools model is replaced by the answer.
+	turn = conversation[len(s.History)+1:]
+	if last := turn[len(turn)-1]; last.Role == "assistant" && len(last.ToolCalls) == 0 {
+		turn = turn[:len(turn)-1]
+	}
+
+	slog.Info("generating the completion", "model", s.ChatModel)
+
+	// Have a "chat" with Ollama 🦙
+	messages = []api.Message{
+		{Role: "system", Content: s.system(s.SystemChatInstructions)},
+	}
+	messages = append(messages, s.History...)
+	messages = append(messages, turn...)
+
+	answer, err := s.streamChat(ctx, messages, onToken)
+	if err != nil {
+		return answer, err
+	}
+	if err := s.validate(answer); err != nil {
+		return answer, err
+	}
+
+	s.History = append(s.History, turn...)
+	s.History = append(s.History, api.Message{Role: "assistant", Content: answer})
+	s.save()
+	return answer, nil
+}
+
+// askSingleModel runs the tool loop with the chat model:
+// when the model stops requesting tools, its last message is the answer
+func (s *ChatSession) askSingleModel(ctx context.Context, turn []api.Message, onToken func(string)) (string, error) {
+	messages := []api.Message{
+		{Role: "system", Content: s.system(s.SystemChatInstructions)},
+	}
+	messages = append(messages, s.History...)
+	messages = append(messages, turn...)
+
+	conversation, _, err := s.Agent.Run(ctx, messages)
+
+	answer := ""
+	switch {
+	case errors.Is(err, ErrBudgetExceeded):
+		// The model is still calling tools: ask for an answer without tools
+		slog.Info("generating the completion", "model", s.ChatModel)
+		answer, err = s.streamChat(ctx, conversation, onToken)
+		if err != nil {
+			return answer, err
+		}
+		conversation = append(conversation, api.Message{Role: "assistant", Content: answer})
+	case err != nil:
+		return "", err
+	case s.Format != nil:
+		// The last answer is written again with the JSON format
+		// (the format is not used while the model calls tools)
+		conversation = conversation[:len(conversation)-1]
+		answer, err = s.streamChat(ctx, conversation, onToken)
+		if err != nil {
+			return answer, err
+		}
+		conversation = append(conversation, api.Message{Role: "assistant", Content: answer})
+	default:
+		answer = conversation[len(conversation)-1].Content
+		onToken(answer)
+	}
+	if err := s.validate(answer); err != nil {
+		return answer, err
+	}
+
+	// The conversation ends with the messages of the user, the tool calls,
+	// the tool results and the answer
+	s.History = append(s.History, conversation[len(s.History)+1:]...)
+	s.save()
+	return answer, nil
+}
+
+// recall sets the memories and the extracts of the documents of the turn,
+// a failure of the memory or of the retriever does not stop the conversation
+func (s *ChatSession) recall(ctx context.Context, turn []api.Message) {
+	s.memories, s.documents = "", ""
+	if s.Memory == nil && s.Retriever == nil {
+		return
+	}
+	prompt := ""
+	for _, message := range turn {
+		if message.Role == "user" {
+			prompt = message.Content
+		}
+	}
+	if s.Memory != nil {
+		memories, err := s.Memory.Recall(ctx, s.ID, prompt)
+		if err != nil {
+			slog.Error("failed to recall the memories", "session", s.ID, "error", err)
+		}
+		s.memories = memories
+	}
+	if s.Retriever != nil {
+		documents, err := s.Retriever.Augment(ctx, prompt)
+		if err != nil {
+			slog.Error("failed to retrieve the documents", "session", s.ID, "error", err)
+		}
+		s.documents = documents
+	}
+}
+
+// remember saves the messages of an answered turn in the memory
+func (s *ChatSession) remember(ctx context.Context, turn []api.Message, answer string) {
+	if s.Memory == nil {
+		return
+	}
+	if err := s.Memory.Remember(ctx, s.ID, turn, answer); err != nil {
+		slog.Error("failed to remember the turn", "session", s.ID, "error", err)
+	}
+}
+
+// system returns the system instructions with the memories
+// and the extracts of the documents of the turn
+func (s *ChatSession) system(instructions string) string {
+	for _, recalled := range []string{s.memories, s.documents} {
+		if recalled != "" {
+			instructions += "\n\n" + recalled
+		}
+	}
+	return instructions
+}
+
+// Saved returns the session in the format of the store
+func (s *ChatSession) Saved() SavedSession {
+	return SavedSession{
+		ID:        s.ID,
+		CreatedAt: s.CreatedAt,
+		UpdatedAt: time.Now(),
+		ChatModel: s.ChatModel,
+		Owner:     s.Owner,
+		Seed:      s.Seed,
+		Messages:  s.History,
+	}
+}
+
+// save writes the session in the store. A failure is reported but does not
+// stop the conversation.
+func (s *ChatSession) save() {
+	if s.Store == nil {
+		return
+	}
+	if err := s.Store.Save(s.Saved()); err != nil {
+		slog.Error("failed to save the session", "session", s.ID, "error", err)
+	}
+}
+
+// validate checks the answer when a JSON format is requested
+func (s *ChatSession) validate(answer string) error {
+	if s.Format == nil {
+		return nil
+	}
+	if err := ValidateJSONAnswer(s.Format, answer); err != nil {
+		return fmt.Errorf("invalid JSON answer: %w", err)
+	}
+	return nil
+}
+
+// streamChat sends the messages to the chat model and streams the answer to onToken,
+// without the reasoning of the thinking models
+func (s *ChatSession) streamChat(ctx context.Context, messages []api.Message, onToken func(string)) (string, error) {
+	var TRUE = true
+	options, keepAlive := requestOptions(s.Options)
+	reqChat := &api.ChatRequest{
+		Model:     s.ChatModel,
+		Messages:  FitContextWindow(messages, promptBudget(s.Options)),
+		Options:   options,
+		KeepAlive: keepAlive,
+		Stream:    &TRUE,
+		Format:    s.Format,
+	}
+
+	ctx, span := startSpan(ctx, "ollama chat", spanKindClient, "model", s.ChatModel, "stream", "true")
+	ctx, cancel := withTimeout(ctx, s.ChatTimeout)
+	defer cancel()
+
+	answer := ""
+	filter := newThinkingFilter(s.Thinking, s.ChatModel, func(token string) {
+		answer += token
+		onToken(token)
+	}, s.Agent.emit)
+	var last api.ChatResponse
+	start := time.Now()
+	err := chatWithRetry(ctx, s.Ollama, s.Retry, reqChat, func(resp api.ChatResponse) error {
+		filter.write(resp.Message.Content)
+		last = resp
+		return nil
+	})
+	filter.flush()
+	s.Agent.Metrics.recordChat(s.ChatModel, time.Since(start), last)
+	span.End(err)
+	return answer, err
+}
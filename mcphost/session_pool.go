@@ -0,0 +1,205 @@
+package mcphost
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Default settings of the sessions of the HTTP server
+const (
+	DefaultMaxSessions        = 100
+	DefaultSessionIdleTimeout = 30 * time.Minute
+)
+
+// Errors of the session pool
+var (
+	// ErrSessionBusy is returned when a turn of the session is already running
+	ErrSessionBusy = errors.New("the session is answering another prompt")
+	// ErrTooManySessions is returned when all the sessions of the pool are busy
+	ErrTooManySessions = errors.New("too many sessions")
+	// ErrSessionOwner is returned when the session belongs to another API key
+	ErrSessionOwner = errors.New("the session belongs to another API key")
+)
+
+// SessionPool keeps the chat sessions of the HTTP server between the requests.
+// Each session has its own history and runs one turn at a time, the sessions
+// share the MCP clients of the host (the registry multiplexes their calls).
+// The sessions idle for IdleTimeout are dropped, and the least recently used
+// session is dropped when the pool is full.
+type SessionPool struct {
+	Host *Host
+	// MaxSessions is the maximum number of sessions kept in memory
+	// (DefaultMaxSessions by default)
+	MaxSessions int
+	// IdleTimeout drops the sessions without prompt during this time
+	// (DefaultSessionIdleTimeout by default)
+	IdleTimeout time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]*pooledSession
+	// keys are the ids of the sessions bound to keys (see AcquireKey)
+	keys map[string]string
+}
+
+// pooledSession is a session of the pool, busy while a turn is running
+type pooledSession struct {
+	session  *ChatSession
+	busy     bool
+	lastUsed time.Time
+}
+
+// NewSessionPool creates an empty pool of sessions of the host
+func NewSessionPool(host *Host, maxSessions int, idleTimeout time.Duration) *SessionPool {
+	if maxSessions <= 0 {
+		maxSessions = DefaultMaxSessions
+	}
+	if idleTimeout <= 0 {
+		idleTimeout = DefaultSessionIdleTimeout
+	}
+	return &SessionPool{
+		Host:        host,
+		MaxSessions: maxSessions,
+		IdleTimeout: idleTimeout,
+		sessions:    map[string]*pooledSession{},
+		keys:        map[string]string{},
+	}
+}
+
+// Acquire returns the session of the id for a turn: a new session of the owner
+// (the name of an API key, or empty) when id is empty, the saved session of
+// the store when it is not in the pool. The sessions of other owners are
+// rejected. release must be called at the end of the turn.
+func (p *SessionPool) Acquire(id string, owner string) (*ChatSession, func(), error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.dropIdle()
+	pooled, ok := p.sessions[id]
+	if !ok {
+		if len(p.sessions) >= p.MaxSessions && !p.dropOldest() {
+			return nil, nil, ErrTooManySessions
+		}
+		session := p.Host.NewSession()
+		session.Owner = owner
+		if id != "" {
+			var err error
+			if session, err = p.Host.ResumeSession(id); err != nil {
+				return nil, nil, err
+			}
+		}
+		pooled = &pooledSession{session: session}
+		p.sessions[session.ID] = pooled
+	}
+	if pooled.session.Owner != owner {
+		return nil, nil, ErrSessionOwner
+	}
+	if pooled.busy {
+		return nil, nil, ErrSessionBusy
+	}
+	pooled.busy = true
+
+	return pooled.session, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		pooled.busy = false
+		pooled.lastUsed = time.Now()
+	}, nil
+}
+
+// AcquireKey returns the session bound to the key (e.g. a chat thread or
+// channel) for a turn: a new session is bound to a new key, or to a key whose
+// session was dropped from the pool (and can not be resumed).
+// release must be called at the end of the turn.
+func (p *SessionPool) AcquireKey(key string) (*ChatSession, func(), error) {
+	p.mu.Lock()
+	id := p.keys[key]
+	p.mu.Unlock()
+
+	session, release, err := p.Acquire(id, "")
+	if err != nil && id != "" && !errors.Is(err, ErrSessionBusy) && !errors.Is(err, ErrTooManySessions) {
+		slog.Info("the session of the key was dropped, starting a new one", "key", key, "session", id, "error", err)
+		session, release, err = p.Acquire("", "")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	p.mu.Lock()
+	p.keys[key] = session.ID
+	p.mu.Unlock()
+	return session, release, nil
+}
+
+// RemoveKey drops the session bound to the key: the next turn of the key
+// starts a new session. It returns false when the session is busy.
+func (p *SessionPool) RemoveKey(key string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	id, ok := p.keys[key]
+	if !ok {
+		return true
+	}
+	if pooled, ok := p.sessions[id]; ok && pooled.busy {
+		return false
+	}
+	p.drop(id)
+	return true
+}
+
+// Remove drops the session of the id, it returns false when the session
+// is not in the pool, when it belongs to another owner or when it is busy
+func (p *SessionPool) Remove(id string, owner string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pooled, ok := p.sessions[id]
+	if !ok || pooled.session.Owner != owner || pooled.busy {
+		return false
+	}
+	p.drop(id)
+	return true
+}
+
+// Len returns the number of sessions of the pool
+func (p *SessionPool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.sessions)
+}
+
+// dropIdle drops the sessions idle for more than IdleTimeout
+func (p *SessionPool) dropIdle() {
+	for id, pooled := range p.sessions {
+		if !pooled.busy && time.Since(pooled.lastUsed) > p.IdleTimeout {
+			slog.Info("dropping the idle session", "session", id)
+			p.drop(id)
+		}
+	}
+}
+
+// dropOldest drops the least recently used session which is not busy,
+// it returns false when all the sessions are busy
+func (p *SessionPool) dropOldest() bool {
+	oldest := ""
+	for id, pooled := range p.sessions {
+		if !pooled.busy && (oldest == "" || pooled.lastUsed.Before(p.sessions[oldest].lastUsed)) {
+			oldest = id
+		}
+	}
+	if oldest == "" {
+		return false
+	}
+	slog.Info("dropping the least recently used session", "session", oldest)
+	p.drop(oldest)
+	return true
+}
+
+// drop removes the session of the id and its keys
+func (p *SessionPool) drop(id string) {
+	delete(p.sessions, id)
+	for key, session := range p.keys {
+		if session == id {
+			delete(p.keys, key)
+		}
+	}
+}
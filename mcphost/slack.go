@@ -0,0 +1,385 @@
+package mcphost
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+// DefaultSlackAPIURL is the base URL of the Web API of Slack
+const DefaultSlackAPIURL = "https://slack.com/api"
+
+// maxSlackText is the maximum length of the text of a message
+// (Slack truncates the longer texts)
+const maxSlackText = 39000
+
+// slackMention matches the mentions of the users in the texts (<@U123>)
+var slackMention = regexp.MustCompile(`<@[A-Z0-9]+(\|[^>]*)?>`)
+
+// SlackConfig connects the host to a Slack app in socket mode (the app needs
+// no public URL): a mention of the bot asks the prompt to the session of the
+// thread, the answer is streamed by editing the reply, e.g.
+//
+//	"slack": {"appTokenEnv": "SLACK_APP_TOKEN", "botTokenEnv": "SLACK_BOT_TOKEN"}
+//
+// The app needs the socket mode, the app_mention event and the
+// app_mentions:read and chat:write scopes.
+type SlackConfig struct {
+	// AppTokenEnv is the environment variable of the app-level token
+	// (xapp-..., connections:write scope), SLACK_APP_TOKEN by default
+	AppTokenEnv string `json:"appTokenEnv"`
+	// BotTokenEnv is the environment variable of the bot token (xoxb-...),
+	// SLACK_BOT_TOKEN by default
+	BotTokenEnv string `json:"botTokenEnv"`
+	// APIURL is the base URL of the Web API (DefaultSlackAPIURL by default)
+	APIURL string `json:"apiURL"`
+	// UpdateInterval is the time between two edits of the reply while the
+	// answer is streamed (DefaultUpdateInterval by default: Slack
+	// limits the edits to about one per second)
+	UpdateInterval Duration `json:"updateInterval"`
+}
+
+// validate checks the setting of the bot (the tokens are checked when it starts)
+func (c SlackConfig) validate() error {
+	if c.APIURL != "" {
+		if _, err := url.ParseRequestURI(c.APIURL); err != nil {
+			return fmt.Errorf("slack: invalid apiURL: %w", err)
+		}
+	}
+	if c.UpdateInterval < 0 {
+		return fmt.Errorf("slack: negative updateInterval")
+	}
+	return nil
+}
+
+// tokens returns the app-level token and the bot token
+func (c SlackConfig) tokens() (string, string, error) {
+	appEnv, botEnv := c.AppTokenEnv, c.BotTokenEnv
+	if appEnv == "" {
+		appEnv = "SLACK_APP_TOKEN"
+	}
+	if botEnv == "" {
+		botEnv = "SLACK_BOT_TOKEN"
+	}
+	appToken, botToken := os.Getenv(appEnv), os.Getenv(botEnv)
+	switch {
+	case appToken == "":
+		return "", "", fmt.Errorf("the environment variable %s of the Slack app token is not set", appEnv)
+	case botToken == "":
+		return "", "", fmt.Errorf("the environment variable %s of the Slack bot token is not set", botEnv)
+	}
+	return appToken, botToken, nil
+}
+
+// SlackError is an error answered by the Web API of Slack (e.g. invalid_auth)
+type SlackError struct {
+	Method string
+	Code   string
+}
+
+func (e *SlackError) Error() string {
+	return fmt.Sprintf("slack %s: %s", e.Method, e.Code)
+}
+
+// slackEnvelope is a message of the socket mode connection
+type slackEnvelope struct {
+	EnvelopeID string `json:"envelope_id"`
+	Type       string `json:"type"`
+	// Reason tells why Slack closes the connection (disconnect messages)
+	Reason  string `json:"reason"`
+	Payload struct {
+		Event slackEvent `json:"event"`
+	} `json:"payload"`
+}
+
+// slackEvent is an event of the Events API
+type slackEvent struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	User     string `json:"user"`
+	BotID    string `json:"bot_id"`
+	Channel  string `json:"channel"`
+	TS       string `json:"ts"`
+	ThreadTS string `json:"thread_ts"`
+}
+
+// SlackBot answers the mentions of a Slack app with the chat sessions of
+// the host: each thread is a session, the sessions answer one prompt at a time
+type SlackBot struct {
+	Host   *Host
+	Config SlackConfig
+	// Sessions are the sessions of the threads
+	Sessions *SessionPool
+	// Timeout of a turn (0 means no timeout)
+	Timeout time.Duration
+
+	appToken, botToken string
+	client             *http.Client
+	turns              sync.WaitGroup
+}
+
+// NewSlackBot returns the bot of the host, with a default session pool
+func NewSlackBot(host *Host, config SlackConfig, timeout time.Duration) *SlackBot {
+	return &SlackBot{
+		Host:     host,
+		Config:   config,
+		Sessions: NewSessionPool(host, 0, 0),
+		Timeout:  timeout,
+		client:   &http.Client{Timeout: scheduleWebhookTimeout},
+	}
+}
+
+// Run connects the bot to Slack until the context is cancelled: the
+// connection is opened again when it is lost (or when Slack refreshes it),
+// Run waits for the end of the running turns
+func (b *SlackBot) Run(ctx context.Context) error {
+	var err error
+	if b.appToken, b.botToken, err = b.Config.tokens(); err != nil {
+		return err
+	}
+	defer b.turns.Wait()
+
+	policy := BackoffPolicy{InitialDelay: Duration(time.Second), MaxDelay: Duration(time.Minute)}
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		err := b.connect(ctx)
+		var slackErr *SlackError
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case errors.As(err, &slackErr) && slackErr.Method == "apps.connections.open":
+			// a wrong token or a disabled socket mode
+			return err
+		case err == nil:
+			// Slack refreshes the connection
+			attempt = 0
+			continue
+		case time.Since(start) > time.Minute:
+			// the loss of a connection which worked
+			attempt = 0
+		}
+		delay := policy.delay(max(attempt, 1))
+		slog.Warn("Slack connection closed, reconnecting", "error", err, "delay", delay)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+	}
+}
+
+// connect opens a socket mode connection and handles its events until it is
+// closed (nil when Slack asks to reconnect)
+func (b *SlackBot) connect(ctx context.Context) error {
+	var opened struct {
+		URL string `json:"url"`
+	}
+	if err := b.call(ctx, "apps.connections.open", b.appToken, nil, &opened); err != nil {
+		return err
+	}
+	ws, _, err := websocket.Dial(ctx, opened.URL, nil)
+	if err != nil {
+		return err
+	}
+	defer ws.CloseNow()
+	ws.SetReadLimit(maxWebSocketMessage)
+
+	for {
+		// the connection is closed when ctx is cancelled
+		_, data, err := ws.Read(ctx)
+		if err != nil {
+			return err
+		}
+		var envelope slackEnvelope
+		if err := json.Unmarshal(data, &envelope); err != nil {
+			slog.Warn("invalid Slack message", "error", err)
+			continue
+		}
+		// the events are acknowledged at once, else Slack sends them again
+		if envelope.EnvelopeID != "" {
+			ack, _ := json.Marshal(map[string]string{"envelope_id": envelope.EnvelopeID})
+			if err := ws.Write(ctx, websocket.MessageText, ack); err != nil {
+				return err
+			}
+		}
+		switch envelope.Type {
+		case "hello":
+			slog.Info("connected to Slack")
+		case "disconnect":
+			slog.Info("Slack asks to reconnect", "reason", envelope.Reason)
+			return nil
+		case "events_api":
+			b.handleEvent(ctx, envelope.Payload.Event)
+		}
+	}
+}
+
+// handleEvent starts the turn of a mention of the bot
+func (b *SlackBot) handleEvent(ctx context.Context, event slackEvent) {
+	if event.Type != "app_mention" || event.BotID != "" {
+		return
+	}
+	prompt := strings.TrimSpace(slackMention.ReplaceAllString(event.Text, ""))
+	if prompt == "" {
+		return
+	}
+	// a mention out of a thread starts a thread
+	thread := event.ThreadTS
+	if thread == "" {
+		thread = event.TS
+	}
+	b.turns.Add(1)
+	go func() {
+		defer b.turns.Done()
+		b.answer(ctx, event.Channel, thread, event.User, prompt)
+	}()
+}
+
+// answer asks the prompt to the session of the thread, the reply is
+// edited while the answer is streamed
+func (b *SlackBot) answer(ctx context.Context, channel, thread, user, prompt string) {
+	session, release, err := b.Sessions.AcquireKey(channel + "/" + thread)
+	if err != nil {
+		b.postMessage(ctx, channel, thread, "⚠️ "+err.Error())
+		return
+	}
+	defer release()
+	slog.Info("Slack mention", "channel", channel, "thread", thread, "user", user, "session", session.ID)
+
+	ts, err := b.postMessage(ctx, channel, thread, "…")
+	if err != nil {
+		slog.Error("failed to reply on Slack", "channel", channel, "error", err)
+		return
+	}
+	reply := &streamedReply{}
+	session.Agent.OnEvent = reply.event
+	defer func() { session.Agent.OnEvent = nil }()
+	stop := reply.stream(time.Duration(b.Config.UpdateInterval), func(text string) {
+		if err := b.update(ctx, channel, ts, text); err != nil {
+			slog.Warn("failed to edit the Slack reply", "channel", channel, "error", err)
+		}
+	})
+
+	turnCtx, cancel := withTimeout(ctx, b.Timeout)
+	answer, err := session.Ask(turnCtx, prompt, reply.token)
+	cancel()
+	stop()
+
+	text := strings.TrimSpace(answer)
+	if err != nil {
+		slog.Error("Slack turn failed", "channel", channel, "session", session.ID, "error", err)
+		text = strings.TrimSpace(text + "\n\n⚠️ " + err.Error())
+	}
+	// the final answer is written even when the bot stops
+	if err := b.update(context.WithoutCancel(ctx), channel, ts, text); err != nil {
+		slog.Error("failed to edit the Slack reply", "channel", channel, "error", err)
+	}
+}
+
+// postMessage posts a message in the thread and returns its ts
+func (b *SlackBot) postMessage(ctx context.Context, channel, thread, text string) (string, error) {
+	var posted struct {
+		TS string `json:"ts"`
+	}
+	err := b.call(ctx, "chat.postMessage", b.botToken, map[string]string{
+		"channel": channel, "thread_ts": thread, "text": slackText(text),
+	}, &posted)
+	return posted.TS, err
+}
+
+// update replaces the text of a message
+func (b *SlackBot) update(ctx context.Context, channel, ts, text string) error {
+	return b.call(ctx, "chat.update", b.botToken, map[string]string{
+		"channel": channel, "ts": ts, "text": slackText(text),
+	}, nil)
+}
+
+// call calls a method of the Web API with the token and decodes its response in
+// result: the rate limited requests are sent again after the Retry-After delay
+func (b *SlackBot) call(ctx context.Context, method, token string, body interface{}, result interface{}) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	for attempt := 1; ; attempt++ {
+		request, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(b.apiURL(), "/")+"/"+method, bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		request.Header.Set("Authorization", "Bearer "+token)
+		if body != nil {
+			request.Header.Set("Content-Type", "application/json; charset=utf-8")
+		}
+		response, err := b.client.Do(request)
+		if err != nil {
+			return err
+		}
+		content, err := io.ReadAll(response.Body)
+		response.Body.Close()
+		if err != nil {
+			return err
+		}
+		if response.StatusCode == http.StatusTooManyRequests && attempt < 3 {
+			delay, _ := strconv.Atoi(response.Header.Get("Retry-After"))
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(max(delay, 1)) * time.Second):
+			}
+			continue
+		}
+		if response.StatusCode != http.StatusOK {
+			return fmt.Errorf("slack %s: %s", method, response.Status)
+		}
+		var status struct {
+			OK    bool   `json:"ok"`
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(content, &status); err != nil {
+			return fmt.Errorf("slack %s: invalid response: %w", method, err)
+		}
+		if !status.OK {
+			return &SlackError{Method: method, Code: status.Error}
+		}
+		if result == nil {
+			return nil
+		}
+		return json.Unmarshal(content, result)
+	}
+}
+
+func (b *SlackBot) apiURL() string {
+	if b.Config.APIURL != "" {
+		return b.Config.APIURL
+	}
+	return DefaultSlackAPIURL
+}
+
+// slackText returns the text of a message: an empty text is not allowed,
+// the long texts are truncated
+func slackText(text string) string {
+	if text == "" {
+		return "…"
+	}
+	if len(text) > maxSlackText {
+		text = strings.ToValidUTF8(text[:maxSlackText], "") + "…"
+	}
+	return text
+}
@@ -0,0 +1,110 @@
+package mcphost
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// SavedSession is the content of a session file
+type SavedSession struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	ChatModel string    `json:"chatModel"`
+	// Owner is the API key which created the session on the HTTP server
+	Owner string `json:"owner,omitempty"`
+	// Seed is the seed of the models of the session (nil for a random seed)
+	Seed *int `json:"seed,omitempty"`
+	// Messages is the whole history: the user prompts, the tool calls,
+	// the tool results and the answers
+	Messages []api.Message `json:"messages"`
+}
+
+// SessionStore saves the chat sessions as JSON files (<id>.json) in a directory
+type SessionStore struct {
+	Dir string
+}
+
+// NewSessionStore creates the directory of the store if needed
+func NewSessionStore(dir string) (*SessionStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &SessionStore{Dir: dir}, nil
+}
+
+// NewSessionID returns a new session id, sortable by creation date.
+// Its 128 random bits make it unguessable: the id gives access to the
+// session on the HTTP server.
+func NewSessionID() string {
+	return time.Now().Format("20060102-150405") + "-" + randomHex(16)
+}
+
+// randomHex returns size random bytes in hexadecimal
+func randomHex(size int) string {
+	id := make([]byte, size)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Save writes the session file. The file is replaced atomically,
+// a crash while saving keeps the previous version.
+func (s *SessionStore) Save(session SavedSession) error {
+	path, err := s.path(session.ID)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.Dir, session.ID+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Load reads the session file of the id
+func (s *SessionStore) Load(id string) (SavedSession, error) {
+	var session SavedSession
+
+	path, err := s.path(id)
+	if err != nil {
+		return session, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return session, fmt.Errorf("unknown session %s", id)
+	}
+	if err != nil {
+		return session, err
+	}
+	if err := json.Unmarshal(data, &session); err != nil {
+		return session, fmt.Errorf("invalid session file %s: %w", path, err)
+	}
+	return session, nil
+}
+
+func (s *SessionStore) path(id string) (string, error) {
+	if id == "" || filepath.Base(id) != id || id == "." || id == ".." {
+		return "", fmt.Errorf("invalid session id %q", id)
+	}
+	return filepath.Join(s.Dir, id+".json"), nil
+}
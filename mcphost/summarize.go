@@ -0,0 +1,112 @@
+package mcphost
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// Default settings of the summaries of the tool results
+const (
+	DefaultSummaryChunkTokens = 1024
+)
+
+// Summarizer shortens the large tool results before they are sent to the models:
+// the result is split into chunks, each chunk is summarized by a (small) model.
+type Summarizer struct {
+	Ollama *api.Client
+	Model  string
+	// Threshold is the size (in tokens) above which a result is summarized
+	Threshold int
+	// ChunkTokens is the size (in tokens) of the chunks sent to the model
+	ChunkTokens int
+	Options     map[string]interface{}
+	Timeout     time.Duration
+	Retry       BackoffPolicy
+	// Metrics record the completions (nil records nothing)
+	Metrics *Metrics
+}
+
+// NeedsSummary tells if the text is larger than the threshold
+func (s *Summarizer) NeedsSummary(text string) bool {
+	return s != nil && s.Threshold > 0 && EstimateTokens(text) > s.Threshold
+}
+
+// Summarize returns the summary of the result of a tool
+func (s *Summarizer) Summarize(ctx context.Context, tool string, text string) (string, error) {
+	chunkTokens := s.ChunkTokens
+	if chunkTokens <= 0 {
+		chunkTokens = DefaultSummaryChunkTokens
+	}
+	chunks := splitText(text, chunkTokens*charactersPerToken)
+
+	summaries := []string{}
+	for i, chunk := range chunks {
+		summary, err := s.summarizeChunk(ctx, tool, chunk, i+1, len(chunks))
+		if err != nil {
+			return "", err
+		}
+		summaries = append(summaries, strings.TrimSpace(summary))
+	}
+	return fmt.Sprintf("[Summary of the result of %s (%d characters)]\n%s",
+		tool, len(text), strings.Join(summaries, "\n")), nil
+}
+
+func (s *Summarizer) summarizeChunk(ctx context.Context, tool string, chunk string, part int, parts int) (string, error) {
+	messages := []api.Message{
+		{Role: "system", Content: fmt.Sprintf(
+			"Summarize the part %d/%d of the result of the tool %s. "+
+				"Keep the facts, names, numbers, code and URLs. Answer with the summary only.",
+			part, parts, tool)},
+		{Role: "user", Content: chunk},
+	}
+	return complete(ctx, s.Ollama, s.Metrics, s.Model, messages, s.Options, s.Timeout, s.Retry, "summary")
+}
+
+// complete sends the messages to the model without streaming and returns
+// its answer (purpose is an attribute of the span: what the completion is for)
+func complete(ctx context.Context, ollama *api.Client, metrics *Metrics, model string, messages []api.Message,
+	options map[string]interface{}, timeout time.Duration, retry BackoffPolicy, purpose string) (string, error) {
+	var FALSE = false
+	options, keepAlive := requestOptions(options)
+	req := &api.ChatRequest{
+		Model:     model,
+		Messages:  messages,
+		Options:   options,
+		KeepAlive: keepAlive,
+		Stream:    &FALSE,
+	}
+
+	ctx, span := startSpan(ctx, "ollama chat", spanKindClient, "model", model, "purpose", purpose)
+	ctx, cancel := withTimeout(ctx, timeout)
+	defer cancel()
+
+	answer := ""
+	var last api.ChatResponse
+	start := time.Now()
+	err := chatWithRetry(ctx, ollama, retry, req, func(resp api.ChatResponse) error {
+		answer += resp.Message.Content
+		last = resp
+		return nil
+	})
+	metrics.recordChat(model, time.Since(start), last)
+	span.End(err)
+	// the reasoning of a thinking model is not part of the summary
+	_, answer = SplitThinking(answer)
+	return answer, err
+}
+
+// splitText splits the text in chunks of at most size bytes, at line boundaries
+// when possible
+func splitText(text string, size int) []string {
+	chunks := []string{}
+	for len(text) > size {
+		cut := cutIndex(text, size)
+		chunks = append(chunks, text[:cut])
+		text = text[cut:]
+	}
+	return append(chunks, text)
+}
@@ -0,0 +1,178 @@
+package mcphost
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// ThinkingMode tells what to do with the reasoning of the thinking models
+// (the <think>...</think> blocks of deepseek-r1, qwq...).
+// The reasoning is always removed from the answers, from the tool call parsing
+// and from the history.
+type ThinkingMode string
+
+const (
+	// ThinkingHide drops the reasoning (default)
+	ThinkingHide ThinkingMode = "hide"
+	// ThinkingShow sends the reasoning as "thinking" events while it is generated
+	// (the CLI displays it dimmed)
+	ThinkingShow ThinkingMode = "show"
+	// ThinkingLog logs the reasoning (info level) at the end of each block
+	ThinkingLog ThinkingMode = "log"
+)
+
+const (
+	thinkStart = "<think>"
+	thinkEnd   = "</think>"
+)
+
+// ParseThinkingMode checks a thinking mode, "" is the hide mode
+func ParseThinkingMode(value string) (ThinkingMode, error) {
+	switch mode := ThinkingMode(value); mode {
+	case "":
+		return ThinkingHide, nil
+	case ThinkingHide, ThinkingShow, ThinkingLog:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown thinking mode %s (hide, show or log)", value)
+	}
+}
+
+// SplitThinking separates the reasoning blocks of a complete message from the answer.
+// A closing tag without opening tag (the template of the model opened the block)
+// ends a reasoning starting at the beginning of the message.
+func SplitThinking(content string) (thinking string, answer string) {
+	var reasoning, text strings.Builder
+	filter := &thinkingFilter{
+		onAnswer:   func(chunk string) { text.WriteString(chunk) },
+		onThinking: func(chunk string) { reasoning.WriteString(chunk) },
+	}
+	filter.write(openThinking(content))
+	filter.flush()
+	return strings.TrimSpace(reasoning.String()), strings.TrimSpace(text.String())
+}
+
+// stripThinking removes the reasoning of a complete message of model,
+// the reasoning is handled with mode
+func stripThinking(content string, mode ThinkingMode, model string, emit func(Event)) string {
+	if !strings.Contains(content, thinkEnd) && !strings.Contains(content, thinkStart) {
+		return content
+	}
+	var text strings.Builder
+	filter := newThinkingFilter(mode, model, func(chunk string) { text.WriteString(chunk) }, emit)
+	filter.write(openThinking(content))
+	filter.flush()
+	return strings.TrimSpace(text.String())
+}
+
+// openThinking adds the missing opening tag of a message starting with
+// a reasoning block
+func openThinking(content string) string {
+	if end := strings.Index(content, thinkEnd); end >= 0 && !strings.Contains(content[:end], thinkStart) {
+		return thinkStart + content
+	}
+	return content
+}
+
+// thinkingFilter splits a stream of tokens between the reasoning
+// and the answer. The tags can be split across tokens: the end of a token
+// which can start a tag is kept until the next one.
+type thinkingFilter struct {
+	onAnswer   func(string)
+	onThinking func(string)
+	// onBlockEnd, if set, is called at the end of each reasoning block
+	onBlockEnd func()
+
+	inThinking bool
+	pending    string
+	// trimAnswer drops the blank lines following a reasoning block
+	trimAnswer bool
+}
+
+func (f *thinkingFilter) write(token string) {
+	text := f.pending + token
+	f.pending = ""
+	for text != "" {
+		tag := thinkStart
+		if f.inThinking {
+			tag = thinkEnd
+		}
+		index := strings.Index(text, tag)
+		if index < 0 {
+			keep := partialTag(text, tag)
+			f.emit(text[:len(text)-keep])
+			f.pending = text[len(text)-keep:]
+			return
+		}
+		f.emit(text[:index])
+		if f.inThinking && f.onBlockEnd != nil {
+			f.onBlockEnd()
+		}
+		f.inThinking = !f.inThinking
+		f.trimAnswer = !f.inThinking
+		text = text[index+len(tag):]
+	}
+}
+
+// flush emits the kept end of the stream (a reasoning block
+// without closing tag ends with the stream)
+func (f *thinkingFilter) flush() {
+	f.emit(f.pending)
+	f.pending = ""
+	if f.inThinking && f.onBlockEnd != nil {
+		f.onBlockEnd()
+	}
+	f.inThinking = false
+}
+
+func (f *thinkingFilter) emit(chunk string) {
+	switch {
+	case chunk == "":
+	case f.inThinking:
+		f.onThinking(chunk)
+	default:
+		if f.trimAnswer {
+			chunk = strings.TrimLeft(chunk, " \t\r\n")
+			if chunk == "" {
+				return
+			}
+			f.trimAnswer = false
+		}
+		f.onAnswer(chunk)
+	}
+}
+
+// partialTag returns the length of the end of text which is the beginning of tag
+func partialTag(text string, tag string) int {
+	for size := min(len(text), len(tag)-1); size > 0; size-- {
+		if strings.HasSuffix(text, tag[:size]) {
+			return size
+		}
+	}
+	return 0
+}
+
+// newThinkingFilter creates the filter of a completion of model:
+// the answer goes to onAnswer, the reasoning is dropped, sent to emit
+// or logged depending on mode
+func newThinkingFilter(mode ThinkingMode, model string, onAnswer func(string), emit func(Event)) *thinkingFilter {
+	var reasoning strings.Builder
+	filter := &thinkingFilter{onAnswer: onAnswer, onThinking: func(string) {}}
+	switch mode {
+	case ThinkingShow:
+		filter.onThinking = func(chunk string) {
+			emit(Event{Type: EventThinking, Content: chunk})
+		}
+		filter.onBlockEnd = func() {
+			emit(Event{Type: EventThinking, Content: "\n"})
+		}
+	case ThinkingLog:
+		filter.onThinking = func(chunk string) { reasoning.WriteString(chunk) }
+		filter.onBlockEnd = func() {
+			slog.Info("thinking", "model", model, "content", strings.TrimSpace(reasoning.String()))
+			reasoning.Reset()
+		}
+	}
+	return filter
+}
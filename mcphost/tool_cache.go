@@ -0,0 +1,93 @@
+package mcphost
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// DefaultToolCacheSize is the number of tool results kept by the cache
+const DefaultToolCacheSize = 256
+
+// toolCache keeps the results of the tool calls (same tool and same
+// arguments) for the cache TTL of their tool, the least recently used
+// results are removed when it is full
+type toolCache struct {
+	size int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// lru lists the entries, the most recently used first
+	lru *list.List
+}
+
+type toolCacheEntry struct {
+	key     string
+	result  *mcp.CallToolResult
+	expires time.Time
+}
+
+func newToolCache(size int) *toolCache {
+	if size <= 0 {
+		size = DefaultToolCacheSize
+	}
+	return &toolCache{size: size, entries: map[string]*list.Element{}, lru: list.New()}
+}
+
+// toolCallKey hashes a call: the namespaced name of the tool and its
+// arguments (the keys of the JSON objects are sorted)
+func toolCallKey(name string, arguments map[string]interface{}) string {
+	data, _ := json.Marshal(arguments)
+	hash := sha256.Sum256(append([]byte(name+"\x00"), data...))
+	return hex.EncodeToString(hash[:])
+}
+
+// get returns the result of a call that has not expired
+func (c *toolCache) get(key string) (*mcp.CallToolResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*toolCacheEntry)
+	if time.Now().After(entry.expires) {
+		c.lru.Remove(element)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	return entry.result, true
+}
+
+// put adds the result of a call for ttl
+func (c *toolCache) put(key string, result *mcp.CallToolResult, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := &toolCacheEntry{key: key, result: result, expires: time.Now().Add(ttl)}
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.lru.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*toolCacheEntry).key)
+	}
+}
+
+// cacheTTL returns how long the results of a tool are cached
+// (0 when they are not cached)
+func (s *MCPServer) cacheTTL(tool string) time.Duration {
+	if ttl, ok := s.Config.ToolCacheTTLs[tool]; ok {
+		return time.Duration(ttl)
+	}
+	return time.Duration(s.Config.CacheTTL)
+}
@@ -0,0 +1,72 @@
+package mcphost
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// ToolResultLimit limits the size of each tool result sent to the model:
+// the larger results keep their head and tail around an elision marker
+type ToolResultLimit struct {
+	// MaxBytes is the maximum size of a tool result (0 means no limit)
+	MaxBytes int
+	// Dir, if set, is the directory where the full content of the truncated
+	// results is written, the marker gives the path of the file
+	Dir string
+}
+
+// Limit returns the text cut to MaxBytes (or the text when it is small enough)
+func (l ToolResultLimit) Limit(tool string, text string) string {
+	if l.MaxBytes <= 0 || len(text) <= l.MaxBytes {
+		return text
+	}
+	head := cutIndex(text, l.MaxBytes/2)
+	tail := tailIndex(text, l.MaxBytes-head)
+	marker := fmt.Sprintf("\n[... %d bytes of the result of %s elided ...]\n", tail-head, tool)
+	if l.Dir != "" {
+		path, err := l.save(tool, text)
+		if err != nil {
+			slog.Warn("failed to save the full tool result", "tool", tool, "error", err)
+		} else {
+			marker = fmt.Sprintf("\n[... %d bytes of the result of %s elided, the full result (%d bytes) is in %s ...]\n",
+				tail-head, tool, len(text), path)
+		}
+	}
+	slog.Info("tool result truncated", "tool", tool, "bytes", len(text), "max", l.MaxBytes)
+	return text[:head] + marker + text[tail:]
+}
+
+// save writes the full result in a new file of Dir and returns its path
+func (l ToolResultLimit) save(tool string, text string) (string, error) {
+	if err := os.MkdirAll(l.Dir, 0o755); err != nil {
+		return "", err
+	}
+	file, err := os.CreateTemp(l.Dir, strings.ReplaceAll(tool, string(os.PathSeparator), "_")+"-*.txt")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if _, err := file.WriteString(text); err != nil {
+		return "", err
+	}
+	return file.Name(), file.Close()
+}
+
+// tailIndex returns where the tail of the text starts to keep at most size bytes:
+// at the first line boundary, or at a rune boundary when the line is too long
+func tailIndex(text string, size int) int {
+	start := len(text) - size
+	if start <= 0 {
+		return 0
+	}
+	if newline := strings.Index(text[start:], "\n"); newline >= 0 && newline < size/2 {
+		return start + newline + 1
+	}
+	for start < len(text) && !utf8.RuneStart(text[start]) {
+		start++
+	}
+	return start
+}
@@ -0,0 +1,159 @@
+package mcphost
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ollama/ollama/api"
+)
+
+// Default settings of the selection of the tools
+const (
+	DefaultToolSelectionTopK      = 8
+	DefaultToolSelectionThreshold = 20
+)
+
+// ToolSelectionConfig enables the selection of the tools sent to the model
+// when the catalog is large: the tools are ranked by the similarity of
+// their embeddings with the prompt
+type ToolSelectionConfig struct {
+	// TopK is the number of tools sent to the model (DefaultToolSelectionTopK by default)
+	TopK int `json:"topK"`
+	// Threshold is the size of the catalog above which the tools are selected
+	// (DefaultToolSelectionThreshold by default)
+	Threshold int `json:"threshold"`
+	// EmbeddingsModel computes the embeddings (DefaultMemoryEmbeddingsModel by default)
+	EmbeddingsModel string `json:"embeddingsModel"`
+	// Always are the tools always sent (with the name of their server)
+	Always []string `json:"always"`
+}
+
+// ToolSelector selects the tools relevant to a prompt,
+// the embeddings of the tools are computed once
+type ToolSelector struct {
+	Ollama          *api.Client
+	EmbeddingsModel string
+	TopK            int
+	Threshold       int
+	Always          []string
+
+	mu sync.Mutex
+	// embeddings are the embeddings of the tools by description (see toolText)
+	embeddings map[string][]float32
+}
+
+// NewToolSelector creates the selector of a config
+func NewToolSelector(ollama *api.Client, config ToolSelectionConfig) *ToolSelector {
+	selector := &ToolSelector{
+		Ollama:          ollama,
+		EmbeddingsModel: config.EmbeddingsModel,
+		TopK:            config.TopK,
+		Threshold:       config.Threshold,
+		Always:          config.Always,
+		embeddings:      map[string][]float32{},
+	}
+	if selector.EmbeddingsModel == "" {
+		selector.EmbeddingsModel = DefaultMemoryEmbeddingsModel
+	}
+	if selector.TopK <= 0 {
+		selector.TopK = DefaultToolSelectionTopK
+	}
+	if selector.Threshold <= 0 {
+		selector.Threshold = DefaultToolSelectionThreshold
+	}
+	return selector
+}
+
+// Select returns the names of the tools to send to the model: the TopK tools
+// the most similar to the prompt and the Always tools. It returns nil (all
+// the tools) when the catalog is small or when the embeddings fail.
+func (s *ToolSelector) Select(ctx context.Context, prompt string, tools []api.Tool) map[string]bool {
+	if len(tools) <= s.Threshold || strings.TrimSpace(prompt) == "" {
+		return nil
+	}
+	embeddings, err := s.toolEmbeddings(ctx, tools)
+	if err == nil {
+		var prompts [][]float32
+		if prompts, err = s.embed(ctx, []string{prompt}); err == nil {
+			return s.rank(prompts[0], tools, embeddings)
+		}
+	}
+	slog.Warn("failed to select the tools, all the tools are sent", "model", s.EmbeddingsModel, "error", err)
+	return nil
+}
+
+// rank keeps the TopK tools the most similar to the prompt
+func (s *ToolSelector) rank(prompt []float32, tools []api.Tool, embeddings [][]float32) map[string]bool {
+	scores := make([]float64, len(tools))
+	order := make([]int, len(tools))
+	for i := range tools {
+		scores[i] = cosineSimilarity(prompt, embeddings[i])
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return scores[order[i]] > scores[order[j]] })
+
+	selected := map[string]bool{}
+	for _, name := range s.Always {
+		selected[name] = true
+	}
+	names := []string{}
+	for _, i := range order[:min(s.TopK, len(order))] {
+		selected[tools[i].Function.Name] = true
+		names = append(names, fmt.Sprintf("%s (%.2f)", tools[i].Function.Name, scores[i]))
+	}
+	slog.Info("tools selected", "tools", len(selected), "catalog", len(tools), "best", strings.Join(names, ", "))
+	return selected
+}
+
+// toolEmbeddings returns the embeddings of the tools, in their order
+// (the new tools are embedded in one request)
+func (s *ToolSelector) toolEmbeddings(ctx context.Context, tools []api.Tool) ([][]float32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	missing := []string{}
+	for _, tool := range tools {
+		if _, ok := s.embeddings[toolText(tool)]; !ok {
+			missing = append(missing, toolText(tool))
+		}
+	}
+	if len(missing) > 0 {
+		embeddings, err := s.embed(ctx, missing)
+		if err != nil {
+			return nil, err
+		}
+		for i, text := range missing {
+			s.embeddings[text] = embeddings[i]
+		}
+	}
+	embeddings := make([][]float32, len(tools))
+	for i, tool := range tools {
+		embeddings[i] = s.embeddings[toolText(tool)]
+	}
+	return embeddings, nil
+}
+
+func (s *ToolSelector) embed(ctx context.Context, texts []string) ([][]float32, error) {
+	response, err := s.Ollama.Embed(ctx, &api.EmbedRequest{Model: s.EmbeddingsModel, Input: texts})
+	if err != nil {
+		return nil, err
+	}
+	if len(response.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("%s returned %d embeddings for %d texts", s.EmbeddingsModel, len(response.Embeddings), len(texts))
+	}
+	return response.Embeddings, nil
+}
+
+// toolText is the text embedded for a tool: its name, its description
+// and the names and descriptions of its parameters
+func toolText(tool api.Tool) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s", tool.Function.Name, tool.Function.Description)
+	for name, property := range tool.Function.Parameters.Properties.All() {
+		fmt.Fprintf(&b, "\n%s: %s", name, property.Description)
+	}
+	return b.String()
+}
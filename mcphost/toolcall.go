@@ -0,0 +1,137 @@
+package mcphost
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+)
+
+// ToolCallMode tells how the model is asked to call the tools
+type ToolCallMode string
+
+const (
+	// ToolCallModeNative sends the tools with the Ollama API (default)
+	ToolCallModeNative ToolCallMode = "native"
+	// ToolCallModePrompt describes the tools in the system prompt
+	// and parses the JSON tool invocations of the answers
+	ToolCallModePrompt ToolCallMode = "prompt"
+	// ToolCallModeAuto uses the native tool calls, then the prompt mode
+	// when the model does not support tools. A JSON tool invocation written
+	// in the content of an answer is also used.
+	ToolCallModeAuto ToolCallMode = "auto"
+)
+
+// ParseToolCallMode checks a tool call mode, "" is the native mode
+func ParseToolCallMode(value string) (ToolCallMode, error) {
+	switch mode := ToolCallMode(value); mode {
+	case "":
+		return ToolCallModeNative, nil
+	case ToolCallModeNative, ToolCallModePrompt, ToolCallModeAuto:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown tool call mode %s (native, prompt or auto)", value)
+	}
+}
+
+// withToolsPrompt returns the messages with the tools catalog
+// at the end of the system message
+func withToolsPrompt(messages []api.Message, tools []api.Tool) []api.Message {
+	var catalog strings.Builder
+	catalog.WriteString("\nYou can use the following tools:\n")
+	for _, tool := range tools {
+		parameters, _ := json.Marshal(tool.Function.Parameters)
+		fmt.Fprintf(&catalog, "- %s: %s\n  parameters: %s\n", tool.Function.Name, tool.Function.Description, parameters)
+	}
+	catalog.WriteString(`To use a tool, answer only with a JSON object, without any other text:
+{"name": "<tool name>", "arguments": {"<argument name>": <value>}}
+To use several tools, answer with a JSON array of these objects.
+If no tool is needed, answer normally.
+`)
+
+	if len(messages) > 0 && messages[0].Role == "system" {
+		system := messages[0]
+		system.Content += catalog.String()
+		return append([]api.Message{system}, messages[1:]...)
+	}
+	return append([]api.Message{{Role: "system", Content: catalog.String()}}, messages...)
+}
+
+// promptToolCall is a tool invocation written by the model in its answer
+type promptToolCall struct {
+	Name       string                 `json:"name"`
+	Arguments  map[string]interface{} `json:"arguments"`
+	Parameters map[string]interface{} `json:"parameters"`
+}
+
+// parseToolCalls extracts the JSON tool invocations of an answer:
+// an object, an array of objects or {"tool_calls": [...]}, possibly in a
+// markdown code block. Only the known tools are returned, so that a JSON answer
+// is not mistaken for a tool call.
+func parseToolCalls(content string, tools []api.Tool) []api.ToolCall {
+	start := strings.IndexAny(content, "{[")
+	end := strings.LastIndexAny(content, "}]")
+	if start < 0 || end < start {
+		return nil
+	}
+	data := []byte(content[start : end+1])
+
+	var invocations []promptToolCall
+	var single promptToolCall
+	var wrapped struct {
+		ToolCalls []promptToolCall `json:"tool_calls"`
+	}
+	switch {
+	case json.Unmarshal(data, &invocations) == nil:
+	case json.Unmarshal(data, &wrapped) == nil && len(wrapped.ToolCalls) > 0:
+		invocations = wrapped.ToolCalls
+	case json.Unmarshal(data, &single) == nil:
+		invocations = []promptToolCall{single}
+	default:
+		return nil
+	}
+
+	known := map[string]bool{}
+	for _, tool := range tools {
+		known[tool.Function.Name] = true
+	}
+
+	toolCalls := []api.ToolCall{}
+	for _, invocation := range invocations {
+		if !known[invocation.Name] {
+			return nil
+		}
+		arguments := invocation.Arguments
+		if arguments == nil {
+			arguments = invocation.Parameters
+		}
+		toolCall := api.ToolCall{}
+		toolCall.Function.Name = invocation.Name
+		toolCall.Function.Arguments = callArguments(arguments)
+		toolCalls = append(toolCalls, toolCall)
+	}
+	return toolCalls
+}
+
+// toolsNotSupported tells if the error is the answer of Ollama
+// to a request with tools for a model without tool support
+func toolsNotSupported(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "does not support tools")
+}
+
+// callArguments converts arguments to the arguments of an Ollama tool call
+// (sorted by name, like encoding/json marshals a map)
+func callArguments(arguments map[string]interface{}) api.ToolCallFunctionArguments {
+	result := api.NewToolCallFunctionArguments()
+	names := make([]string, 0, len(arguments))
+	for name := range arguments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		result.Set(name, arguments[name])
+	}
+	return result
+}
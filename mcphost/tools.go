@@ -0,0 +1,156 @@
+package mcphost
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/ollama/ollama/api"
+)
+
+// From: https://github.com/mark3labs/mcphost/blob/main/pkg/llm/ollama/provider.go
+func ConvertToOllamaTools(tools []mcp.Tool) []api.Tool {
+	// Convert tools to Ollama format
+	ollamaTools := make([]api.Tool, len(tools))
+	for i, tool := range tools {
+		// The input schema of a tool is always an object
+		if tool.InputSchema.Type == "" {
+			tool.InputSchema.Type = "object"
+		}
+		ollamaTools[i] = api.Tool{
+			Type: "function",
+			Function: api.ToolFunction{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters: api.ToolFunctionParameters{
+					Type:       tool.InputSchema.Type,
+					Required:   tool.InputSchema.Required,
+					Properties: convertProperties(tool.InputSchema.Properties),
+				},
+			},
+		}
+	}
+	return ollamaTools
+}
+
+// Helper function to convert properties to Ollama's format.
+// The items of the arrays, the properties of the objects and the anyOf
+// alternatives are converted recursively: the rest of the JSON Schema of a
+// property (format, bounds...) is appended to its description so the model
+// still knows the constraints.
+func convertProperties(props map[string]interface{}) *api.ToolPropertiesMap {
+	result := api.NewToolPropertiesMap()
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if propMap, ok := props[name].(map[string]interface{}); ok {
+			result.Set(name, convertProperty(propMap))
+		}
+	}
+	return result
+}
+
+// convertProperty converts the JSON Schema of a property
+func convertProperty(schema map[string]interface{}) api.ToolProperty {
+	prop := api.ToolProperty{
+		Type:        api.PropertyType(schemaTypes(schema["type"])),
+		Description: getString(schema, "description"),
+	}
+	// A schema without type but with properties or items is an object or an array
+	if len(prop.Type) == 0 {
+		switch {
+		case schema["properties"] != nil:
+			prop.Type = api.PropertyType{"object"}
+		case schema["items"] != nil:
+			prop.Type = api.PropertyType{"array"}
+		case schema["anyOf"] == nil && schema["oneOf"] == nil:
+			prop.Type = api.PropertyType{"string"}
+		}
+	}
+
+	// Handle enum if present
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		prop.Enum = enum
+	}
+	switch items := schema["items"].(type) {
+	case map[string]interface{}:
+		prop.Items = convertProperty(items)
+	case nil:
+	default:
+		// a tuple (list of schemas) is kept as is
+		prop.Items = items
+	}
+	if properties, ok := schema["properties"].(map[string]interface{}); ok {
+		prop.Properties = convertProperties(properties)
+	}
+	for _, key := range []string{"anyOf", "oneOf"} {
+		alternatives, _ := schema[key].([]interface{})
+		for _, alternative := range alternatives {
+			if alternative, ok := alternative.(map[string]interface{}); ok {
+				prop.AnyOf = append(prop.AnyOf, convertProperty(alternative))
+			}
+		}
+	}
+
+	if details := schemaDetails(schema); details != "" {
+		prop.Description = strings.TrimSpace(prop.Description + " " + details)
+	}
+	return prop
+}
+
+// schemaTypes returns the types of a "type" keyword (a string or a list)
+func schemaTypes(raw interface{}) []string {
+	switch raw := raw.(type) {
+	case string:
+		return []string{raw}
+	case []interface{}:
+		types := []string{}
+		for _, item := range raw {
+			types = append(types, fmt.Sprint(item))
+		}
+		return types
+	}
+	return nil
+}
+
+// schemaDetails describes the parts of the JSON Schema of a property
+// that do not fit in the Ollama tool definition
+func schemaDetails(schema map[string]interface{}) string {
+	details := map[string]interface{}{}
+	for key, value := range schema {
+		switch key {
+		case "type", "description", "enum", "title", "items", "properties", "anyOf", "oneOf":
+			// already in the Ollama definition
+		default:
+			details[key] = value
+		}
+	}
+	if len(details) == 0 {
+		return ""
+	}
+
+	data, err := json.Marshal(details)
+	if err != nil {
+		return ""
+	}
+	return "JSON Schema: " + string(data)
+}
+
+// toolArguments returns the arguments of a tool call as a map
+// (the Ollama API keeps them in an ordered map)
+func toolArguments(toolCall api.ToolCall) map[string]interface{} {
+	return toolCall.Function.Arguments.ToMap()
+}
+
+// Helper function to safely get string values from map
+func getString(m map[string]interface{}, key string) string {
+	if v, ok := m[key].(string); ok {
+		return v
+	}
+	return ""
+}
@@ -0,0 +1,64 @@
+package mcphost
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestConvertToOllamaTools(t *testing.T) {
+	tests := []struct {
+		name       string
+		properties string
+		want       string
+	}{
+		{
+			name:       "scalar with enum",
+			properties: `{"unit": {"type": "string", "description": "the unit", "enum": ["c", "f"]}}`,
+			want:       `{"unit":{"type":"string","description":"the unit","enum":["c","f"]}}`,
+		},
+		{
+			name:       "scalar types",
+			properties: `{"count": {"type": "integer", "minimum": 1}, "ratio": {"type": "number"}, "strict": {"type": "boolean", "enum": [true]}}`,
+			want: `{"count":{"type":"integer","description":"JSON Schema: {\"minimum\":1}"},"ratio":{"type":"number"},` +
+				`"strict":{"type":"boolean","enum":[true]}}`,
+		},
+		{
+			name:       "array of objects",
+			properties: `{"points": {"type": "array", "items": {"type": "object", "properties": {"x": {"type": "number"}, "y": {"type": "number"}}, "required": ["x", "y"]}}}`,
+			want: `{"points":{"type":"array","items":{"type":"object","description":"JSON Schema: {\"required\":[\"x\",\"y\"]}",` +
+				`"properties":{"x":{"type":"number"},"y":{"type":"number"}}}}}`,
+		},
+		{
+			name:       "nested object",
+			properties: `{"page": {"description": "the page", "properties": {"url": {"type": "string", "format": "uri"}, "tags": {"type": "array", "items": {"type": "string"}}}}}`,
+			want: `{"page":{"type":"object","description":"the page","properties":{` +
+				`"tags":{"type":"array","items":{"type":"string"}},"url":{"type":"string","description":"JSON Schema: {\"format\":\"uri\"}"}}}}`,
+		},
+		{
+			name:       "list of types and anyOf",
+			properties: `{"limit": {"type": ["integer", "null"]}, "id": {"anyOf": [{"type": "string"}, {"type": "integer"}]}}`,
+			want:       `{"id":{"anyOf":[{"type":"string"},{"type":"integer"}]},"limit":{"type":["integer","null"]}}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tool := mcp.Tool{Name: "tool"}
+			if err := json.Unmarshal([]byte(test.properties), &tool.InputSchema.Properties); err != nil {
+				t.Fatal(err)
+			}
+			tools := ConvertToOllamaTools([]mcp.Tool{tool})
+			if tools[0].Function.Parameters.Type != "object" {
+				t.Errorf("type = %q, want object", tools[0].Function.Parameters.Type)
+			}
+			got, err := json.Marshal(tools[0].Function.Parameters.Properties)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.want {
+				t.Errorf("properties =\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
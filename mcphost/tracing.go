@@ -0,0 +1,97 @@
+package mcphost
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracer records the spans of the host (user turns, Ollama chat completions
+// and MCP tool calls) with the OpenTelemetry SDK, and exports them in batches
+// to an OpenTelemetry collector with OTLP/HTTP.
+// The other settings of the exporter (headers, timeout...) are read from
+// the OTEL_EXPORTER_OTLP_* environment variables.
+type Tracer struct {
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+}
+
+// NewTracer creates a tracer exporting to the OTLP traces endpoint
+// (e.g. http://localhost:4318/v1/traces)
+func NewTracer(endpoint string, serviceName string) (*Tracer, error) {
+	exporter, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the OTLP exporter: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+	)
+	return &Tracer{provider: provider, tracer: provider.Tracer("mcphost")}, nil
+}
+
+// Shutdown exports the remaining spans and stops the exporter
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	return t.provider.Shutdown(ctx)
+}
+
+// Span is a timed operation of a trace. A nil span (no tracer) does nothing.
+type Span struct {
+	span trace.Span
+}
+
+// Kinds of the spans
+const (
+	spanKindInternal = trace.SpanKindInternal
+	spanKindClient   = trace.SpanKindClient
+)
+
+type tracerKey struct{}
+
+// WithTracer returns a context whose operations are traced by the tracer
+func WithTracer(ctx context.Context, tracer *Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey{}, tracer)
+}
+
+// startSpan starts a span, child of the span of ctx.
+// attributes are key, value pairs.
+func startSpan(ctx context.Context, name string, kind trace.SpanKind, attributes ...string) (context.Context, *Span) {
+	tracer, _ := ctx.Value(tracerKey{}).(*Tracer)
+	if tracer == nil {
+		return ctx, nil
+	}
+	options := []trace.SpanStartOption{trace.WithSpanKind(kind)}
+	for i := 0; i+1 < len(attributes); i += 2 {
+		options = append(options, trace.WithAttributes(attribute.String(attributes[i], attributes[i+1])))
+	}
+	ctx, span := tracer.tracer.Start(ctx, name, options...)
+	return ctx, &Span{span: span}
+}
+
+// SetAttribute adds an attribute to the span
+func (s *Span) SetAttribute(key string, value string) {
+	if s == nil {
+		return
+	}
+	s.span.SetAttributes(attribute.String(key, value))
+}
+
+// End ends the span, err is the error of the operation (if any)
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	} else {
+		s.span.SetStatus(codes.Ok, "")
+	}
+	s.span.End()
+}
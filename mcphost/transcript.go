@@ -0,0 +1,158 @@
+package mcphost
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// The kinds of the entries of a transcript
+const (
+	transcriptUser       = "user"
+	transcriptToolCall   = "tool_call"
+	transcriptToolResult = "tool_result"
+	transcriptAnswer     = "answer"
+)
+
+// transcriptEntry is a step of a turn: a prompt of the user, a tool call,
+// a tool result or an answer
+type transcriptEntry struct {
+	Kind    string
+	Tool    string
+	Content string
+}
+
+// transcriptEntries converts the history of a session to the steps of its turns
+func transcriptEntries(messages []api.Message) []transcriptEntry {
+	entries := []transcriptEntry{}
+	calls := []string{}
+	for _, message := range messages {
+		switch message.Role {
+		case "user":
+			entries = append(entries, transcriptEntry{Kind: transcriptUser, Content: message.Content})
+		case "assistant":
+			for _, toolCall := range message.ToolCalls {
+				arguments, _ := json.MarshalIndent(toolArguments(toolCall), "", "  ")
+				entries = append(entries, transcriptEntry{Kind: transcriptToolCall, Tool: toolCall.Function.Name, Content: string(arguments)})
+				calls = append(calls, toolCall.Function.Name)
+			}
+			if strings.TrimSpace(message.Content) != "" {
+				entries = append(entries, transcriptEntry{Kind: transcriptAnswer, Content: message.Content})
+			}
+		case "tool":
+			// the results without tool name (older sessions) follow the order of the calls
+			tool := message.ToolName
+			if len(calls) > 0 {
+				if tool == "" {
+					tool = calls[0]
+				}
+				calls = calls[1:]
+			}
+			entries = append(entries, transcriptEntry{Kind: transcriptToolResult, Tool: tool, Content: message.Content})
+		}
+	}
+	return entries
+}
+
+// WriteMarkdownTranscript writes a readable transcript of a session:
+// the prompts of the user, the tool calls, the tool results and the answers
+func WriteMarkdownTranscript(w io.Writer, session SavedSession) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Session %s\n\n", session.ID)
+	fmt.Fprintf(&b, "_%s, chat model %s_\n", session.CreatedAt.Format(time.DateTime), session.ChatModel)
+	for _, entry := range transcriptEntries(session.Messages) {
+		switch entry.Kind {
+		case transcriptUser:
+			fmt.Fprintf(&b, "\n## User\n\n%s\n", strings.TrimSpace(entry.Content))
+		case transcriptToolCall:
+			fmt.Fprintf(&b, "\n**Tool call** `%s`\n\n%s\n", entry.Tool, markdownFence(entry.Content, "json"))
+		case transcriptToolResult:
+			fmt.Fprintf(&b, "\n**Tool result** `%s`\n\n%s\n", entry.Tool, markdownFence(entry.Content, ""))
+		case transcriptAnswer:
+			fmt.Fprintf(&b, "\n## Answer\n\n%s\n", strings.TrimSpace(entry.Content))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// markdownFence puts a text in a code block, its fence is longer
+// than the backquotes of the text
+func markdownFence(text string, language string) string {
+	fence := "```"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	return fence + language + "\n" + strings.TrimRight(text, "\n") + "\n" + fence
+}
+
+// transcriptHTML is the page of the HTML transcripts,
+// the tool results are collapsed
+var transcriptHTML = template.Must(template.New("transcript").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Session {{.Session.ID}}</title>
+<style>
+body { font-family: sans-serif; max-width: 50em; margin: auto; padding: 1em; }
+.content { white-space: pre-wrap; }
+.user { background: #eef; padding: 0.5em 1em; border-radius: 0.5em; }
+pre { background: #f4f4f4; padding: 0.5em; overflow-x: auto; }
+details { margin: 0.5em 0; }
+</style>
+</head>
+<body>
+<h1>Session {{.Session.ID}}</h1>
+<p><em>{{.Created}}, chat model {{.Session.ChatModel}}</em></p>
+{{range .Entries}}
+{{- if eq .Kind "user"}}<h2>User</h2>
+<div class="user content">{{.Content}}</div>
+{{else if eq .Kind "tool_call"}}<p><strong>Tool call</strong> <code>{{.Tool}}</code></p>
+<pre>{{.Content}}</pre>
+{{else if eq .Kind "tool_result"}}<details>
+<summary><strong>Tool result</strong> <code>{{.Tool}}</code></summary>
+<pre>{{.Content}}</pre>
+</details>
+{{else if eq .Kind "answer"}}<h2>Answer</h2>
+<div class="content">{{.Content}}</div>
+{{end}}
+{{- end}}
+</body>
+</html>
+`))
+
+// WriteHTMLTranscript writes the transcript of a session as an HTML page,
+// the tool results can be expanded
+func WriteHTMLTranscript(w io.Writer, session SavedSession) error {
+	return transcriptHTML.Execute(w, map[string]interface{}{
+		"Session": session,
+		"Created": session.CreatedAt.Format(time.DateTime),
+		"Entries": transcriptEntries(session.Messages),
+	})
+}
+
+// ExportTranscript writes the transcript of a session in a file:
+// an HTML page for the .html and .htm files, markdown otherwise
+func ExportTranscript(path string, session SavedSession) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm":
+		err = WriteHTMLTranscript(file, session)
+	default:
+		err = WriteMarkdownTranscript(file, session)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
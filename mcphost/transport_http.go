@@ -0,0 +1,60 @@
+package mcphost
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+)
+
+// newHTTPClient creates the client of a server with the streamable HTTP
+// transport of mcp-go: every JSON-RPC message is POSTed to the MCP endpoint
+// with the headers of the config, the OAuth client of the server
+// authorizes the requests
+func (s *MCPServer) newHTTPClient() (MCPClient, error) {
+	url, err := expandEnv(s.Config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("url: %w", err)
+	}
+	headers, err := s.Config.HTTPHeaders()
+	if err != nil {
+		return nil, err
+	}
+	options := []transport.StreamableHTTPCOption{transport.WithHTTPHeaders(headers)}
+	httpClient, err := s.Config.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	if httpClient != nil {
+		options = append(options, transport.WithHTTPBasicClient(httpClient))
+	}
+	httpTransport, err := transport.NewStreamableHTTP(url, options...)
+	if err != nil {
+		return nil, err
+	}
+	return s.startClient(context.Background(), httpTransport)
+}
+
+// httpClient returns the HTTP client sending the requests of a remote server
+// with its OAuth tokens (nil without oauth config: the default client is used)
+func (s MCPServerConfig) httpClient() (*http.Client, error) {
+	oauthClient, err := s.oauthClient()
+	if err != nil || oauthClient == nil {
+		return nil, err
+	}
+	return &http.Client{Transport: oauthClient}, nil
+}
+
+// startClient creates the mcp-go client of a transport with the handlers
+// of the requests of the server (sampling, roots and elicitation),
+// and starts the transport: ctx is the lifetime of its streams
+func (s *MCPServer) startClient(ctx context.Context, clientTransport transport.Interface) (*client.Client, error) {
+	mcpClient := client.NewClient(clientTransport, s.clientOptions()...)
+	if err := mcpClient.Start(ctx); err != nil {
+		mcpClient.Close()
+		return nil, err
+	}
+	return mcpClient, nil
+}
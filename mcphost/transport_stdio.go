@@ -0,0 +1,88 @@
+package mcphost
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+)
+
+// stdioCloseTimeout is the time given to a server to exit
+// after its stdin is closed, before its process is killed
+const stdioCloseTimeout = 5 * time.Second
+
+// stdioClient is the mcp-go client of a server started as a process,
+// the JSON-RPC messages are exchanged as lines on its stdin and stdout
+type stdioClient struct {
+	*client.Client
+	server string
+	cmd    *exec.Cmd
+}
+
+// newStdioClient starts the command of the server with the stdio transport
+// of mcp-go: the env vars of the config are added to the environment of the
+// host (on Windows, the batch files such as npx.cmd are started by cmd.exe),
+// and the lines written by the server on stderr are logged
+func (s *MCPServer) newStdioClient() (MCPClient, error) {
+	command, args, err := s.Config.CommandLine()
+	if err != nil {
+		return nil, err
+	}
+	env, err := s.Config.Environment()
+	if err != nil {
+		return nil, err
+	}
+	stdioClient := &stdioClient{server: s.Name}
+	stdio := transport.NewStdioWithOptions(command, env, args, transport.WithCommandFunc(
+		func(ctx context.Context, command string, env []string, args []string) (*exec.Cmd, error) {
+			cmd, err := stdioCommand(command, args)
+			if err != nil {
+				return nil, err
+			}
+			cmd.Env = append(os.Environ(), env...)
+			stdioClient.cmd = cmd
+			return cmd, nil
+		},
+	))
+	// the process and the requests of the server live as long as the client
+	if stdioClient.Client, err = s.startClient(context.Background(), stdio); err != nil {
+		return nil, fmt.Errorf("failed to start command: %w", err)
+	}
+	go logStderr(s.Name, stdio.Stderr())
+	return stdioClient, nil
+}
+
+// logStderr logs the lines written by a server on stderr until it exits
+// (a server blocks when nobody reads them)
+func logStderr(server string, stderr io.Reader) {
+	scanner := bufio.NewScanner(stderr)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		slog.Info("server stderr", "server", server, "line", scanner.Text())
+	}
+}
+
+// Close closes the stdin of the server and waits for its exit,
+// the process is killed when it does not exit before stdioCloseTimeout
+func (c *stdioClient) Close() error {
+	closed := make(chan error, 1)
+	go func() { closed <- c.Client.Close() }()
+	select {
+	case err := <-closed:
+		return err
+	case <-time.After(stdioCloseTimeout):
+		slog.Warn("the server did not exit, killing it", "server", c.server, "timeout", stdioCloseTimeout)
+		if err := c.cmd.Process.Kill(); err != nil {
+			return fmt.Errorf("failed to kill the server: %w", err)
+		}
+		<-closed
+		return nil
+	}
+}
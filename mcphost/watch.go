@@ -0,0 +1,193 @@
+package mcphost
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/ollama/ollama/api"
+)
+
+// WatchedResource is a resource subscribed with Watch: its content is read
+// again each time the server notifies an update (resources/updated)
+type WatchedResource struct {
+	URI     string
+	Server  string
+	Content ToolContent
+	Updated time.Time
+	// Changed is true when the content changed since the last TakeResourceUpdates
+	Changed bool
+}
+
+// Watch subscribes to the updates of a resource (on a server with the
+// resources subscribe capability) and reads its content
+func (r *ToolRegistry) Watch(ctx context.Context, uri string) (*WatchedResource, error) {
+	// a URI that is not listed (e.g. from a resource template) is watched
+	// on the first server with the capability
+	var listed, fallback *MCPServer
+	for _, candidate := range r.servers {
+		if !candidate.subscribes {
+			continue
+		}
+		if fallback == nil {
+			fallback = candidate
+		}
+		for _, resource := range candidate.Resources {
+			if resource.URI == uri && listed == nil {
+				listed = candidate
+			}
+		}
+	}
+	server := listed
+	if server == nil {
+		server = fallback
+	}
+	if server == nil {
+		return nil, fmt.Errorf("no server can watch the resource %s", uri)
+	}
+
+	content, err := server.readResource(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	if err := server.subscribe(ctx, uri); err != nil {
+		return nil, fmt.Errorf("failed to subscribe to %s: %w", uri, err)
+	}
+
+	watched := &WatchedResource{URI: uri, Server: server.Name, Content: content, Updated: time.Now()}
+	r.watchMu.Lock()
+	r.watched[uri] = watched
+	r.watchMu.Unlock()
+	return watched, nil
+}
+
+// Unwatch cancels the subscription to the updates of a resource
+func (r *ToolRegistry) Unwatch(ctx context.Context, uri string) error {
+	r.watchMu.Lock()
+	watched, ok := r.watched[uri]
+	delete(r.watched, uri)
+	r.watchMu.Unlock()
+	if !ok {
+		return fmt.Errorf("the resource %s is not watched", uri)
+	}
+	for _, server := range r.servers {
+		if server.Name == watched.Server {
+			return server.unsubscribe(ctx, uri)
+		}
+	}
+	return nil
+}
+
+// WatchedResources returns the watched resources
+func (r *ToolRegistry) WatchedResources() []WatchedResource {
+	r.watchMu.Lock()
+	defer r.watchMu.Unlock()
+	resources := []WatchedResource{}
+	for _, watched := range r.watched {
+		resources = append(resources, *watched)
+	}
+	return resources
+}
+
+// TakeResourceUpdates returns the watched resources updated since the last call
+func (r *ToolRegistry) TakeResourceUpdates() []WatchedResource {
+	r.watchMu.Lock()
+	defer r.watchMu.Unlock()
+	updates := []WatchedResource{}
+	for _, watched := range r.watched {
+		if watched.Changed {
+			updates = append(updates, *watched)
+			watched.Changed = false
+		}
+	}
+	return updates
+}
+
+// resourceUpdated reads again a watched resource updated by its server
+func (r *ToolRegistry) resourceUpdated(server *MCPServer, uri string) {
+	r.watchMu.Lock()
+	_, ok := r.watched[uri]
+	r.watchMu.Unlock()
+	if !ok {
+		return
+	}
+
+	ctx, cancel := withTimeout(context.Background(), time.Duration(server.timeouts.CallTool))
+	defer cancel()
+	content, err := server.readResource(ctx, uri)
+	if err != nil {
+		slog.Warn("failed to read the updated resource", "server", server.Name, "uri", uri, "error", err)
+		return
+	}
+
+	r.watchMu.Lock()
+	defer r.watchMu.Unlock()
+	if watched, ok := r.watched[uri]; ok {
+		watched.Content, watched.Updated, watched.Changed = content, time.Now(), true
+		slog.Info("watched resource updated", "server", server.Name, "uri", uri)
+	}
+}
+
+// subscribe subscribes to the updates of a resource, the subscriptions
+// are sent again when the server is restarted
+func (s *MCPServer) subscribe(ctx context.Context, uri string) error {
+	mcpClient, err := s.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.release()
+	request := mcp.SubscribeRequest{Request: mcp.Request{Method: "resources/subscribe"}}
+	request.Params.URI = uri
+	if err := mcpClient.Subscribe(ctx, request); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	if s.subscriptions == nil {
+		s.subscriptions = map[string]bool{}
+	}
+	s.subscriptions[uri] = true
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MCPServer) unsubscribe(ctx context.Context, uri string) error {
+	s.mu.Lock()
+	delete(s.subscriptions, uri)
+	s.mu.Unlock()
+	mcpClient, err := s.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.release()
+	request := mcp.UnsubscribeRequest{Request: mcp.Request{Method: "resources/unsubscribe"}}
+	request.Params.URI = uri
+	return mcpClient.Unsubscribe(ctx, request)
+}
+
+// resubscribe sends the subscriptions to a new client of the server
+// (s.mu is locked)
+func (s *MCPServer) resubscribe(ctx context.Context, mcpClient MCPClient) {
+	for uri := range s.subscriptions {
+		request := mcp.SubscribeRequest{Request: mcp.Request{Method: "resources/subscribe"}}
+		request.Params.URI = uri
+		if err := mcpClient.Subscribe(ctx, request); err != nil {
+			slog.Warn("failed to subscribe again to the resource", "server", s.Name, "uri", uri, "error", err)
+		}
+	}
+}
+
+// ResourceUpdateMessages returns the user messages with the contents of the
+// watched resources updated since the last call (see TakeResourceUpdates)
+func (r *ToolRegistry) ResourceUpdateMessages() []api.Message {
+	messages := []api.Message{}
+	for _, update := range r.TakeResourceUpdates() {
+		messages = append(messages, api.Message{
+			Role:    "user",
+			Content: fmt.Sprintf("The resource %s was updated:\n\n%s", update.URI, update.Content.Text),
+			Images:  update.Content.Images,
+		})
+	}
+	return messages
+}
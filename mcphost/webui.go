@@ -0,0 +1,18 @@
+package mcphost
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// webUI is the chat page served at / by the HTTP server: it streams the
+// answers and shows the tool calls of a session with the /ws endpoint
+//
+//go:embed webui/index.html
+var webUI []byte
+
+// handleWebUI serves the chat page
+func (s *ChatServer) handleWebUI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(webUI)
+}
@@ -0,0 +1,147 @@
+package mcphost
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// parseYAML parses a YAML document of the config files (e.g. the pipelines),
+// a JSON document is also accepted. The mappings are map[string]interface{},
+// the sequences []interface{} and the numbers float64, as with encoding/json.
+func parseYAML(data []byte) (interface{}, error) {
+	var document interface{}
+	err := yaml.Unmarshal(data, &document)
+	if err != nil && strings.Contains(err.Error(), "unknown escape character") {
+		// yaml.v3 does not know the \/ escape of YAML 1.2 (and JSON)
+		document = nil
+		err = yaml.Unmarshal(unescapeSlashes(data), &document)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fromYAML(document), nil
+}
+
+// unescapeSlashes replaces the \/ escapes of the double-quoted scalars by /,
+// the other scalars (plain, single-quoted, block) and the comments are kept
+func unescapeSlashes(data []byte) []byte {
+	var out bytes.Buffer
+	// quote is the quote of the scalar spanning the lines, blockIndent the
+	// indentation of the line starting a block scalar (-1 outside of them)
+	quote, blockIndent := byte(0), -1
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		content := bytes.TrimLeft(line, " ")
+		indent := len(line) - len(content)
+		if blockIndent >= 0 {
+			if len(bytes.TrimSpace(line)) == 0 || indent > blockIndent {
+				out.Write(line)
+				continue
+			}
+			blockIndent = -1
+		}
+		// start tells if a scalar can start at the position
+		start := true
+		for i := 0; i < len(line); i++ {
+			c := line[i]
+			switch {
+			case quote == '"' && c == '\\' && i+1 < len(line):
+				if line[i+1] != '/' {
+					out.WriteByte(c)
+				}
+				i++
+				c = line[i]
+			case quote == '"' && c == '"':
+				quote, start = 0, false
+			case quote == '\'' && c == '\'':
+				if i+1 < len(line) && line[i+1] == '\'' {
+					out.WriteByte(c)
+					i++
+				} else {
+					quote, start = 0, false
+				}
+			case quote != 0:
+			case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+				out.Write(line[i:])
+				i = len(line)
+				continue
+			case start && (c == '"' || c == '\''):
+				quote = c
+			case start && (c == '|' || c == '>'):
+				blockIndent = indent
+				out.Write(line[i:])
+				i = len(line)
+				continue
+			case c == '[' || c == '{' || c == ',':
+				start = true
+			case (c == ':' || c == '-' || c == '?') && (i+1 == len(line) || line[i+1] == ' ' || line[i+1] == '\n' || line[i+1] == '\r'):
+				start = true
+			case c != ' ' && c != '\t' && c != '\r' && c != '\n':
+				start = false
+			}
+			out.WriteByte(c)
+		}
+	}
+	return out.Bytes()
+}
+
+// fromYAML converts a value decoded by yaml.v3 to the types of encoding/json
+func fromYAML(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, item := range value {
+			value[key] = fromYAML(item)
+		}
+		return value
+	case map[interface{}]interface{}:
+		// the keys which are not strings (e.g. 1: a)
+		mapping := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			mapping[fmt.Sprint(key)] = fromYAML(item)
+		}
+		return mapping
+	case []interface{}:
+		for i, item := range value {
+			value[i] = fromYAML(item)
+		}
+		return value
+	case int:
+		return float64(value)
+	case uint64:
+		return float64(value)
+	default:
+		return value
+	}
+}
+
+// JSONToYAML writes a JSON document as a YAML document in block style,
+// with the order of its keys
+func JSONToYAML(data []byte) ([]byte, error) {
+	// a JSON document is a YAML document in flow style
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	blockStyle(&document)
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&document); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// blockStyle clears the flow style of the collections and the quotes of the
+// strings (the encoder quotes them when they are needed)
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
@@ -0,0 +1,140 @@
+package mcphost
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want interface{}
+	}{
+		{
+			name: "block mapping and sequence",
+			yaml: "name: digest\nsteps:\n  - name: fetch\n    retries: 2\n  - name: summarize\n",
+			want: map[string]interface{}{
+				"name": "digest",
+				"steps": []interface{}{
+					map[string]interface{}{"name": "fetch", "retries": float64(2)},
+					map[string]interface{}{"name": "summarize"},
+				},
+			},
+		},
+		{
+			name: "document start after a comment",
+			yaml: "# the pipeline\n---\nname: digest\n",
+			want: map[string]interface{}{"name": "digest"},
+		},
+		{
+			name: "flow collections",
+			yaml: "tags: [a, b]\nvars: {a: 1, b: two}\n",
+			want: map[string]interface{}{
+				"tags": []interface{}{"a", "b"},
+				"vars": map[string]interface{}{"a": float64(1), "b": "two"},
+			},
+		},
+		{
+			name: "double-quoted escapes",
+			yaml: `url: "https:\/\/example.com\ttab é"` + "\n",
+			want: map[string]interface{}{"url": "https://example.com\ttab é"},
+		},
+		{
+			name: "slash escapes in the double-quoted scalars only",
+			yaml: "a: \"x\\/y\"\nb: 'x\\/y'\nc: x\\/y # \"\\/\"\nd: [\"x\\/y\", 'x\\/y']\ne: |\n  \"x\\/y\"\n",
+			want: map[string]interface{}{
+				"a": "x/y",
+				"b": `x\/y`,
+				"c": `x\/y`,
+				"d": []interface{}{"x/y", `x\/y`},
+				"e": `"x\/y"` + "\n",
+			},
+		},
+		{
+			name: "block scalars",
+			yaml: "literal: |\n  line 1\n  line 2\nfolded: >\n  a\n  b\n",
+			want: map[string]interface{}{"literal": "line 1\nline 2\n", "folded": "a b\n"},
+		},
+		{
+			name: "JSON document",
+			yaml: `{"name": "digest", "steps": [{"prompt": "a: b"}]}`,
+			want: map[string]interface{}{
+				"name":  "digest",
+				"steps": []interface{}{map[string]interface{}{"prompt": "a: b"}},
+			},
+		},
+		{
+			name: "keys which are not strings",
+			yaml: "1: one\ntrue: yes\n",
+			want: map[string]interface{}{"1": "one", "true": "yes"},
+		},
+		{
+			name: "empty document",
+			yaml: "# nothing\n",
+			want: nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseYAML([]byte(test.yaml))
+			if err != nil {
+				t.Fatalf("parseYAML: %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseYAML = %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	for _, document := range []string{"a: [b\n", "a: b\n c: d\n  - e\n", "\ta: b\n"} {
+		if _, err := parseYAML([]byte(document)); err == nil {
+			t.Errorf("parseYAML(%q): error expected", document)
+		}
+	}
+}
+
+func TestJSONToYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want string
+	}{
+		{
+			name: "order of the keys",
+			json: `{"name": "fetch", "approval": "ask", "count": 2, "ok": true, "none": null}`,
+			want: "name: fetch\napproval: ask\ncount: 2\nok: true\nnone: null\n",
+		},
+		{
+			name: "nested collections",
+			json: `{"tools": [{"name": "a", "tags": ["x", "y"]}, [1, [2, 3]], []], "schema": {"properties": {}}}`,
+			want: "tools:\n  - name: a\n    tags:\n      - x\n      - y\n  - - 1\n    - - 2\n      - 3\n  - []\nschema:\n  properties: {}\n",
+		},
+		{
+			name: "strings which need quotes",
+			json: `{"a": "true", "b": "1.5", "c": "a: b", "d": "line 1\nline 2", "e": "", "key with spaces": "x"}`,
+			want: "a: \"true\"\nb: \"1.5\"\nc: 'a: b'\nd: |-\n  line 1\n  line 2\ne: \"\"\nkey with spaces: x\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := JSONToYAML([]byte(test.json))
+			if err != nil {
+				t.Fatalf("JSONToYAML: %v", err)
+			}
+			if string(got) != test.want {
+				t.Errorf("JSONToYAML =\n%s\nwant\n%s", got, test.want)
+			}
+			// the YAML document is the JSON document
+			var want interface{}
+			json.Unmarshal([]byte(test.json), &want)
+			parsed, err := parseYAML(got)
+			if err != nil || !reflect.DeepEqual(parsed, want) {
+				t.Errorf("parseYAML(JSONToYAML) = %#v, %v, want %#v", parsed, err, want)
+			}
+		})
+	}
+}